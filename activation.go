@@ -0,0 +1,25 @@
+package pipes
+
+// ListenFD is a pipe or fifo passed to the process with socket activation,
+// see ListenFDs.
+type ListenFD struct {
+	// Name is the name of the fd from LISTEN_FDNAMES, or "unknown" if it
+	// does not have one.
+	Name string
+	// Reader is set if the fd is open for reading.
+	Reader *PipeReader
+	// Writer is set if the fd is open for writing.
+	Writer *PipeWriter
+}
+
+// Close closes the reader and writer, if set.
+func (l ListenFD) Close() error {
+	var errs []error
+	if l.Reader != nil {
+		errs = append(errs, l.Reader.Close())
+	}
+	if l.Writer != nil {
+		errs = append(errs, l.Writer.Close())
+	}
+	return joinErrors(errs...)
+}
@@ -0,0 +1,87 @@
+package pipes
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestListenFDs(t *testing.T) {
+	// Socket activation passes fds starting at 3, which are already in use
+	// in the test binary, so place them at a higher fd instead.
+	const start = 200
+
+	var p [2]int
+	if err := unix.Pipe2(p[:], unix.O_CLOEXEC); err != nil {
+		t.Fatal(err)
+	}
+	fifo := mkTestFifo(t)
+	fifoFd, err := unix.Open(fifo, unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sock, err := unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, fd := range []int{p[0], p[1], sock, fifoFd} {
+		if err := unix.Dup3(fd, start+i, unix.O_CLOEXEC); err != nil {
+			t.Fatal(err)
+		}
+		unix.Close(fd)
+	}
+	defer unix.Close(start + 2)
+
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "4")
+	os.Setenv("LISTEN_FDNAMES", "in:out:sock:fifo")
+
+	fds, err := listenFDs(start, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range fds {
+		defer l.Close()
+	}
+
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Fatal("expected env to be unset")
+	}
+	if len(fds) != 3 {
+		t.Fatalf("expected 3 fds, got %d", len(fds))
+	}
+
+	in, out, f := fds[0], fds[1], fds[2]
+	if in.Name != "in" || in.Reader == nil || in.Writer != nil {
+		t.Fatalf("unexpected read end: %+v", in)
+	}
+	if out.Name != "out" || out.Writer == nil || out.Reader != nil {
+		t.Fatalf("unexpected write end: %+v", out)
+	}
+	if f.Name != "fifo" || f.Reader == nil || f.Writer == nil {
+		t.Fatalf("unexpected fifo: %+v", f)
+	}
+
+	if _, err := out.Writer.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	out.Writer.Close()
+	buf, err := io.ReadAll(in.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Fatalf("expected hello, got %q", buf)
+	}
+
+	os.Setenv("LISTEN_PID", "1")
+	os.Setenv("LISTEN_FDS", "4")
+	fds, err = listenFDs(start, true)
+	if err != nil || fds != nil {
+		t.Fatalf("expected no fds for another pid, got %v: %v", fds, err)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package pipes
+
+// ListenFDs is not supported on this platform and always returns
+// ErrNotSupported.
+func ListenFDs(unsetEnv bool) ([]ListenFD, error) {
+	return nil, ErrNotSupported
+}
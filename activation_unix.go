@@ -0,0 +1,98 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package pipes
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// listenFDsStart is the first fd passed by socket activation.
+const listenFDsStart = 3
+
+// ListenFDs returns the pipes and fifos passed to this process with systemd
+// style socket activation (the LISTEN_FDS protocol), for example with
+// ListenFIFO= in a systemd socket unit.
+// Other fds, such as sockets, are left alone so they can be used with the
+// net package or other libraries.
+//
+// Each fd is wrapped according to its access mode: fds opened for reading
+// get a Reader, fds opened for writing get a Writer, and fds opened for both
+// (such as fifos opened by systemd) get both, which can be closed
+// independently. The fds are made close-on-exec and non-blocking.
+//
+// If the activation environment is not meant for this process (LISTEN_PID
+// does not match) no fds are returned. If unsetEnv is true, the
+// LISTEN_PID, LISTEN_FDS and LISTEN_FDNAMES environment variables are
+// unset, so they are not passed on to child processes.
+func ListenFDs(unsetEnv bool) ([]ListenFD, error) {
+	return listenFDs(listenFDsStart, unsetEnv)
+}
+
+func listenFDs(start int, unsetEnv bool) ([]ListenFD, error) {
+	if unsetEnv {
+		defer func() {
+			os.Unsetenv("LISTEN_PID")
+			os.Unsetenv("LISTEN_FDS")
+			os.Unsetenv("LISTEN_FDNAMES")
+		}()
+	}
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+
+	var names []string
+	if s := os.Getenv("LISTEN_FDNAMES"); s != "" {
+		names = strings.Split(s, ":")
+	}
+
+	var out []ListenFD
+	for i := 0; i < n; i++ {
+		fd := start + i
+		if checkFDIsFifo(uintptr(fd), "") != nil {
+			continue
+		}
+
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		lfd, err := wrapListenFD(fd, name)
+		if err != nil {
+			for _, l := range out {
+				l.Close()
+			}
+			return nil, err
+		}
+		out = append(out, lfd)
+	}
+	return out, nil
+}
+
+func wrapListenFD(fd int, name string) (ListenFD, error) {
+	flags, err := unix.FcntlInt(uintptr(fd), unix.F_GETFL, 0)
+	if err != nil {
+		return ListenFD{}, os.NewSyscallError("fcntl", err)
+	}
+	unix.CloseOnExec(fd)
+	if err := setNonblock(uintptr(fd)); err != nil {
+		return ListenFD{}, err
+	}
+
+	pr, pw, err := pipeEndsFromFD(fd, flags, name)
+	if err != nil {
+		return ListenFD{}, err
+	}
+	return ListenFD{Name: name, Reader: pr, Writer: pw}, nil
+}
@@ -0,0 +1,31 @@
+package pipes
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Buffered returns the number of bytes currently buffered in the pipe, that
+// is written to the pipe but not yet read. This shows how full the pipe is.
+func (r *PipeReader) Buffered() (int, error) {
+	rc, err := r.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		n        int
+		ioctlErr error
+	)
+	err = rc.Control(func(fd uintptr) {
+		n, ioctlErr = unix.IoctlGetInt(int(fd), unix.TIOCINQ) // FIONREAD
+	})
+	if err != nil {
+		return 0, err
+	}
+	if ioctlErr != nil {
+		return 0, os.NewSyscallError("ioctl", ioctlErr)
+	}
+	return n, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package pipes
+
+// Buffered is not supported on this platform and always returns
+// ErrNotSupported.
+func (r *PipeReader) Buffered() (int, error) {
+	return 0, ErrNotSupported
+}
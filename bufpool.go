@@ -0,0 +1,65 @@
+package pipes
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// defaultBufSize is the size of buffers used for userspace copies.
+// This matches the default capacity of a pipe on Linux, so a single read
+// can drain a full pipe.
+const defaultBufSize = 64 * 1024
+
+// bufPool holds the buffers for userspace copies, so fallback-heavy
+// workloads do not allocate a new buffer for every copy.
+var bufPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, defaultBufSize)
+		return &buf
+	},
+}
+
+func getBuf() *[]byte {
+	return bufPool.Get().(*[]byte)
+}
+
+func putBuf(buf *[]byte) {
+	bufPool.Put(buf)
+}
+
+// copyBuffer is io.Copy using a pooled buffer.
+//
+// An *os.File is only read from or written to: its ReadFrom and WriteTo
+// methods fall back to io.Copy, which allocates a buffer of its own. The file
+// is left alone if the other side would take over the copy instead, which can
+// move the data in the kernel, such as a *PipeReader source splicing to it or
+// a socket destination using sendfile(2).
+func copyBuffer(dst io.Writer, src io.Reader) (int64, error) {
+	if f, ok := dst.(*os.File); ok {
+		if _, ok := src.(io.WriterTo); !ok {
+			dst = fileWriter{f}
+		}
+	}
+	if f, ok := src.(*os.File); ok {
+		if _, ok := dst.(io.ReaderFrom); !ok {
+			src = fileReader{f}
+		}
+	}
+	buf := getBuf()
+	defer putBuf(buf)
+	return io.CopyBuffer(dst, src, *buf)
+}
+
+// copyNBuffer is io.CopyN using a pooled buffer.
+func copyNBuffer(dst io.Writer, src io.Reader, n int64) (int64, error) {
+	written, err := copyBuffer(dst, io.LimitReader(src, n))
+	if written == n {
+		return n, nil
+	}
+	if written < n && err == nil {
+		// src stopped early, so must have been at EOF.
+		err = io.EOF
+	}
+	return written, err
+}
@@ -0,0 +1,29 @@
+package pipes
+
+import (
+	"context"
+	"time"
+)
+
+type busyPollKey struct{}
+
+// WithBusyPoll returns a new context based on ctx which makes the copies
+// using it, such as CopyContext and NewCopier, busy-poll for up to d when
+// the source runs dry or the destination is full, instead of parking in the
+// poller right away.
+//
+// Busy-polling spins on nonblocking splice(2) calls, which burns a CPU for up
+// to d each time the copy would block, in exchange for picking up new data
+// without the wakeup latency of the poller. It is meant for latency sensitive
+// pipelines, such as telemetry, where a CPU can be dedicated to the copy.
+// It only applies to copies which use splice(2).
+func WithBusyPoll(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, busyPollKey{}, d)
+}
+
+// ContextBusyPoll returns the busy-poll duration attached to ctx with
+// WithBusyPoll, or 0 if there is none.
+func ContextBusyPoll(ctx context.Context) time.Duration {
+	d, _ := ctx.Value(busyPollKey{}).(time.Duration)
+	return d
+}
@@ -0,0 +1,36 @@
+package pipes
+
+import "time"
+
+// spinner keeps track of how long a copy has been busy-polling, see
+// WithBusyPoll.
+type spinner struct {
+	d     time.Duration
+	until time.Time
+}
+
+// spin is called when a splice returns EAGAIN and reports whether it should
+// be retried right away, rather than waiting in the poller.
+// Once the copy has spun for d it parks, and the next EAGAIN after that
+// starts spinning again.
+func (s *spinner) spin() bool {
+	if s.d <= 0 {
+		return false
+	}
+	now := time.Now()
+	if s.until.IsZero() {
+		s.until = now.Add(s.d)
+		return true
+	}
+	if now.Before(s.until) {
+		return true
+	}
+	s.until = time.Time{}
+	return false
+}
+
+// reset is called when the copy made progress so the next EAGAIN gets the
+// full duration.
+func (s *spinner) reset() {
+	s.until = time.Time{}
+}
@@ -0,0 +1,102 @@
+package pipes
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestBusyPoll(t *testing.T) {
+	if !SpliceSupported() {
+		t.Skip("splice not supported")
+	}
+
+	if ContextBusyPoll(context.Background()) != 0 {
+		t.Fatal("expected no busy-poll by default")
+	}
+
+	// writeSlowly writes to w with gaps long enough for a copy to block.
+	writeSlowly := func(t *testing.T, w *PipeWriter) {
+		for _, s := range []string{"hello", " ", "world"} {
+			time.Sleep(20 * time.Millisecond)
+			if _, err := w.Write([]byte(s)); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}
+
+	t.Run("copy", func(t *testing.T) {
+		tr := &traceRecorder{}
+		ctx := WithBusyPoll(WithSpliceTrace(context.Background(), tr.trace()), 5*time.Second)
+
+		r1, w1 := newPipe(t)
+		r2, w2 := newPipe(t)
+
+		go func() {
+			writeSlowly(t, w1)
+			w1.Close()
+		}()
+
+		if _, err := CopyContext(ctx, w2, r1); err != nil {
+			t.Fatal(err)
+		}
+		w2.Close()
+
+		data, err := io.ReadAll(r2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "hello world" {
+			t.Fatalf("unexpected data: %q", data)
+		}
+
+		tr.mu.Lock()
+		defer tr.mu.Unlock()
+		if tr.blocked != 0 {
+			t.Fatalf("expected the copy to spin instead of blocking, blocked %d times", tr.blocked)
+		}
+	})
+
+	t.Run("copier", func(t *testing.T) {
+		tr := &traceRecorder{}
+		ctx, cancel := context.WithCancel(WithSpliceTrace(context.Background(), tr.trace()))
+		defer cancel()
+
+		r, w := newPipe(t)
+		r1, w1 := newPipe(t)
+
+		c, err := NewCopier(ctx, r, w1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetBusyPoll(5 * time.Second)
+
+		go writeSlowly(t, w)
+
+		r1.fd.SetReadDeadline(time.Now().Add(10 * time.Second))
+		buf := make([]byte, len("hello world"))
+		if _, err := io.ReadFull(r1, buf); err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != "hello world" {
+			t.Fatalf("unexpected data: %q", buf)
+		}
+
+		tr.mu.Lock()
+		blocked := tr.blocked
+		tr.mu.Unlock()
+		// The copier may have parked once before SetBusyPoll took effect.
+		if blocked > 1 {
+			t.Fatalf("expected the copier to spin instead of blocking, blocked %d times", blocked)
+		}
+
+		// Closing must not wait for the spin to time out.
+		start := time.Now()
+		c.Close()
+		if d := time.Since(start); d > 2*time.Second {
+			t.Fatalf("copier took %v to stop", d)
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package pipes
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+)
+
+// CombinerHeaderSize is the size of the header prepended to each chunk
+// written by a Combiner.
+//
+// The header is made up of a 4 byte source ID followed by a 4 byte payload
+// length, both big endian.
+const CombinerHeaderSize = 8
+
+// Combiner merges data from multiple sources into a single writer.
+// Since chunks from different sources are interleaved, each chunk is framed
+// with the ID of the source it came from and the length of the chunk so the
+// receiver can demultiplex the stream (see Splitter).
+type Combiner struct {
+	w io.Writer
+
+	mu  sync.Mutex
+	wg  sync.WaitGroup
+	err error
+}
+
+// NewCombiner creates a Combiner which writes framed chunks to w.
+func NewCombiner(w io.Writer) *Combiner {
+	return &Combiner{w: w}
+}
+
+// Add starts copying from r to the combined output, framing each chunk with
+// the passed in id.
+// Copying stops when r returns an error (including io.EOF).
+func (c *Combiner) Add(id uint32, r io.Reader) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		if err := c.copyFrom(id, r); err != nil {
+			c.setErr(err)
+		}
+	}()
+}
+
+func (c *Combiner) copyFrom(id uint32, r io.Reader) error {
+	buf := make([]byte, CombinerHeaderSize+32*1024)
+	for {
+		n, err := r.Read(buf[CombinerHeaderSize:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[0:4], id)
+			binary.BigEndian.PutUint32(buf[4:8], uint32(n))
+			if werr := c.writeFrame(buf[:CombinerHeaderSize+n]); werr != nil {
+				return werr
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func (c *Combiner) writeFrame(p []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+	_, err := c.w.Write(p)
+	return err
+}
+
+func (c *Combiner) setErr(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+}
+
+// Wait waits for all added sources to finish and returns the first error
+// encountered, if any.
+func (c *Combiner) Wait() error {
+	c.wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// ErrFrameTooLarge is returned by Splitter and Framer when a frame is larger
+// than the configured maximum.
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// Splitter reads a stream produced by a Combiner and splits it back into
+// per-source chunks.
+type Splitter struct {
+	r   io.Reader
+	buf []byte
+
+	// MaxFrameSize is the largest payload the splitter will accept. Next
+	// skips over a larger frame, without buffering it, and returns
+	// ErrFrameTooLarge along with the frame's id. The following call to
+	// Next returns the next frame.
+	// If zero, there is no limit.
+	MaxFrameSize uint32
+}
+
+// NewSplitter creates a Splitter which reads framed chunks from r.
+func NewSplitter(r io.Reader) *Splitter {
+	return &Splitter{r: r}
+}
+
+// Next reads the next chunk from the stream.
+// The returned data is only valid until the next call to Next.
+func (s *Splitter) Next() (id uint32, data []byte, _ error) {
+	var hdr [CombinerHeaderSize]byte
+	if _, err := io.ReadFull(s.r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+
+	id = binary.BigEndian.Uint32(hdr[0:4])
+	size := binary.BigEndian.Uint32(hdr[4:8])
+	if s.MaxFrameSize > 0 && size > s.MaxFrameSize {
+		// Discard the payload so the stream stays in sync.
+		if _, err := io.CopyN(io.Discard, s.r, int64(size)); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return id, nil, err
+		}
+		return id, nil, ErrFrameTooLarge
+	}
+
+	if uint32(cap(s.buf)) < size {
+		s.buf = make([]byte, size)
+	}
+	data = s.buf[:size]
+	if _, err := io.ReadFull(s.r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return id, nil, err
+	}
+	return id, data, nil
+}
@@ -0,0 +1,88 @@
+package pipes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCombiner(t *testing.T) {
+	r, w := newPipe(t)
+
+	c := NewCombiner(w)
+	c.Add(1, strings.NewReader("hello"))
+	c.Add(2, strings.NewReader("world"))
+
+	go func() {
+		c.Wait()
+		w.Close()
+	}()
+
+	got := map[uint32]*bytes.Buffer{
+		1: bytes.NewBuffer(nil),
+		2: bytes.NewBuffer(nil),
+	}
+
+	s := NewSplitter(r)
+	for {
+		id, data, err := s.Next()
+		if err != nil {
+			break
+		}
+		buf, ok := got[id]
+		if !ok {
+			t.Fatalf("got unexpected source id: %d", id)
+		}
+		buf.Write(data)
+	}
+
+	if err := c.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if got[1].String() != "hello" {
+		t.Errorf("expected %q, got %q", "hello", got[1])
+	}
+	if got[2].String() != "world" {
+		t.Errorf("expected %q, got %q", "world", got[2])
+	}
+}
+
+func TestSplitterFrameTooLarge(t *testing.T) {
+	var stream bytes.Buffer
+	for _, frame := range []struct {
+		id   uint32
+		data string
+	}{
+		{1, strings.Repeat("x", 100)},
+		{2, "hello"},
+	} {
+		var hdr [CombinerHeaderSize]byte
+		binary.BigEndian.PutUint32(hdr[0:4], frame.id)
+		binary.BigEndian.PutUint32(hdr[4:8], uint32(len(frame.data)))
+		stream.Write(hdr[:])
+		stream.WriteString(frame.data)
+	}
+
+	s := NewSplitter(&stream)
+	s.MaxFrameSize = 10
+
+	id, _, err := s.Next()
+	if err != ErrFrameTooLarge || id != 1 {
+		t.Fatalf("expected ErrFrameTooLarge for frame 1, got: %d %v", id, err)
+	}
+
+	// The oversized payload was skipped, so the next frame is intact.
+	id, data, err := s.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 2 || string(data) != "hello" {
+		t.Fatalf("expected frame 2 with %q, got %d with %q", "hello", id, data)
+	}
+
+	if _, _, err := s.Next(); err != io.EOF {
+		t.Fatalf("expected EOF, got: %v", err)
+	}
+}
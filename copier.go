@@ -0,0 +1,428 @@
+package pipes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// CopierStats is a snapshot of the state of a Copier, see Copier.Stats.
+type CopierStats struct {
+	// BytesRead is the number of bytes read from the reader (or readers, when
+	// it was replaced with SetReader).
+	BytesRead int64
+	// BytesWritten is the number of bytes written to each of the current
+	// writers. Its length is the number of writers.
+	BytesWritten map[*PipeWriter]int64
+	// Evictions is the number of writers which were dropped because writing
+	// to them failed.
+	Evictions int
+	// LastErr is the error which caused the last eviction, if any. The
+	// details of every eviction are returned by Err.
+	LastErr error
+	// Err is the error the copier stopped with, or nil if it is still
+	// running. It is io.EOF if the reader reached EOF, os.ErrClosed if the
+	// copier was closed, or a *CanceledError if its context was done.
+	Err error
+	// Syscalls counts the syscalls the copier issued to move the data.
+	Syscalls SyscallStats
+}
+
+// ErrWriterEvicted matches the errors for writers evicted from a Copier, see
+// WriterEvictedError.
+var ErrWriterEvicted = errors.New("writer evicted")
+
+// WriterEvictedError describes a writer a Copier dropped because writing to
+// it failed. It matches ErrWriterEvicted with errors.Is, and unwraps to the
+// error which caused the eviction.
+type WriterEvictedError struct {
+	// Writer is the writer which was evicted.
+	Writer *PipeWriter
+	// Name is the name of the writer's file, such as the path of a fifo.
+	Name string
+	// Written is the number of bytes delivered to the writer before it was
+	// evicted.
+	Written int64
+	// Err is the error which caused the eviction.
+	Err error
+}
+
+func (e *WriterEvictedError) Error() string {
+	return fmt.Sprintf("writer %s evicted after %d bytes: %v", e.Name, e.Written, e.Err)
+}
+
+func (e *WriterEvictedError) Unwrap() error {
+	return e.Err
+}
+
+func (e *WriterEvictedError) Is(target error) bool {
+	return target == ErrWriterEvicted
+}
+
+// CanceledError is the error a copy stops with when its context is done.
+// It records how much data made it to each destination before the copy
+// stopped, so the caller can resume or reconcile. It unwraps to the error of
+// the context, so errors.Is(err, context.Canceled) still works.
+type CanceledError struct {
+	// Err is the error of the context, context.Canceled or
+	// context.DeadlineExceeded.
+	Err error
+	// Read is the number of bytes read from the source.
+	Read int64
+	// Written is the number of bytes delivered to each destination. For a
+	// Copier this includes the writers which were evicted.
+	Written map[*PipeWriter]int64
+}
+
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("copy canceled after reading %d bytes: %v", e.Read, e.Err)
+}
+
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// copierStats holds the counters for CopierStats. It is protected by the
+// copier's mutex.
+type copierStats struct {
+	read      int64
+	written   map[*PipeWriter]int64
+	evictions int
+	// recent holds the last few evictions for DebugString.
+	recent []copierEviction
+	// evicted holds the errors for all the evicted writers, see Close.
+	evicted []error
+}
+
+// maxRecentEvictions is the number of evictions kept for DebugString.
+const maxRecentEvictions = 8
+
+type copierEviction struct {
+	fd   int
+	n    int64
+	err  error
+	when time.Time
+}
+
+// Stats returns a snapshot of the copier's state, such as for reporting on a
+// health endpoint. All values are taken at the same point in time.
+func (c *Copier) Stats() CopierStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	written := make(map[*PipeWriter]int64, len(c.stats.written))
+	for w, n := range c.stats.written {
+		written[w] = n
+	}
+	return CopierStats{
+		BytesRead:    c.stats.read,
+		BytesWritten: written,
+		Evictions:    c.stats.evictions,
+		LastErr:      c._lastErr,
+		Err:          c.closedErr,
+		Syscalls:     c.syscalls.snapshot(),
+	}
+}
+
+// setCanceled stops the copier with a *CanceledError for the context error
+// err, unless it already stopped.
+func (c *Copier) setCanceled(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closedErr == nil {
+		c.closedErr = c.canceledLocked(err)
+	}
+}
+
+// canceledLocked returns the *CanceledError for the context error err with
+// the current progress. c.mu must be held.
+func (c *Copier) canceledLocked(err error) error {
+	written := make(map[*PipeWriter]int64, len(c.stats.written)+len(c.stats.evicted))
+	for _, e := range c.stats.evicted {
+		if e, ok := e.(*WriterEvictedError); ok {
+			written[e.Writer] = e.Written
+		}
+	}
+	for w, n := range c.stats.written {
+		written[w] = n
+	}
+	return &CanceledError{Err: err, Read: c.stats.read, Written: written}
+}
+
+// addWriterStats starts tracking w. c.mu must be held.
+func (c *Copier) addWriterStats(w *PipeWriter) {
+	if c.stats.written == nil {
+		c.stats.written = make(map[*PipeWriter]int64)
+	}
+	c.stats.written[w] = 0
+	logEvent(c.log, EventWriterAdded, "writer", w)
+}
+
+func (c *Copier) recordRead(n int64) {
+	c.mu.Lock()
+	c.stats.read += n
+	c.mu.Unlock()
+}
+
+func (c *Copier) recordWritten(w *PipeWriter, n int64) {
+	if n <= 0 {
+		return
+	}
+	c.mu.Lock()
+	if _, ok := c.stats.written[w]; ok {
+		c.stats.written[w] += n
+	}
+	c.mu.Unlock()
+}
+
+// recordEvicted records that w was dropped because writing to it failed
+// with err.
+func (c *Copier) recordEvicted(w *PipeWriter, err error) {
+	err = w.writeResult(err)
+	fd := rawConnFD(w)
+	var name string
+	if w.fd != nil {
+		name = w.fd.Name()
+	}
+
+	c.mu.Lock()
+	evictErr := &WriterEvictedError{Writer: w, Name: name, Written: c.stats.written[w], Err: err}
+	c._lastErr = err
+	c.stats.evictions++
+	c.stats.evicted = append(c.stats.evicted, evictErr)
+	if len(c.stats.recent) == maxRecentEvictions {
+		c.stats.recent = append(c.stats.recent[:0], c.stats.recent[1:]...)
+	}
+	c.stats.recent = append(c.stats.recent, copierEviction{fd: fd, n: evictErr.Written, err: err, when: time.Now()})
+	delete(c.stats.written, w)
+	onEvict := c.onEvict
+	c.mu.Unlock()
+
+	logEvent(c.log, EventWriterEvicted, "writer", w, "err", err)
+	if onEvict != nil {
+		onEvict(evictErr)
+	}
+}
+
+// SetRetryPolicy sets how the copier retries transient errors when moving
+// data to a writer, such as EAGAIN while the writer's pipe is full or ENOMEM
+// under memory pressure, instead of evicting the writer. Pass nil, the
+// default, to evict a writer on the first error.
+//
+// Retries block the copier, and so every other writer, for as long as the
+// policy's backoff, so the policy should have a limit.
+// This only applies when the copier uses splice(2) and tee(2), the fallback
+// copy blocks on full writers anyway.
+func (c *Copier) SetRetryPolicy(p *RetryPolicy) {
+	c.mu.Lock()
+	c.retry = p
+	c.mu.Unlock()
+}
+
+func (c *Copier) retryPolicy() *RetryPolicy {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.retry
+}
+
+// SetBusyPoll sets how long the copier spins with nonblocking splice(2)
+// calls when the reader runs dry, before waiting for it in the poller.
+// This trades a CPU for the latency of being woken up by the poller, see
+// WithBusyPoll. The default is taken from the context passed to NewCopier,
+// 0 meaning the copier never spins.
+// This only applies when the copier uses splice(2).
+func (c *Copier) SetBusyPoll(d time.Duration) {
+	c.mu.Lock()
+	c.busyPoll = d
+	c.mu.Unlock()
+}
+
+// SetBatch sets whether the copier keeps draining the reader until it would
+// block before going back to the poller, instead of handling a single chunk
+// per wakeup. Under sustained load this saves a trip through the run loop
+// and the poller for every chunk, at the cost of picking up changes such as
+// a new ThreadPolicy less often.
+// A pass still ends as soon as a writer is evicted.
+// This only applies when the copier uses splice(2).
+func (c *Copier) SetBatch(enabled bool) {
+	c.mu.Lock()
+	c.batch = enabled
+	c.mu.Unlock()
+}
+
+func (c *Copier) batching() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.batch
+}
+
+// Reserve makes room in the copier's internal state for up to n writers in
+// total, so adding writers up to that number does not grow it while data is
+// being copied. The room is made the next time the copier picks up added
+// writers.
+//
+// Once the state is in place, copying a chunk to the writers does not
+// allocate.
+func (c *Copier) Reserve(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if n <= c.reserve {
+		return
+	}
+	c.reserve = n
+
+	written := make(map[*PipeWriter]int64, n)
+	for w, v := range c.stats.written {
+		written[w] = v
+	}
+	c.stats.written = written
+}
+
+// SetEvictHandler sets a function which is called whenever a writer is
+// evicted because writing to it failed. It is called from the copier's
+// goroutine, which is blocked until it returns.
+// Pass nil to remove the handler.
+func (c *Copier) SetEvictHandler(fn func(*WriterEvictedError)) {
+	c.mu.Lock()
+	c.onEvict = fn
+	c.mu.Unlock()
+}
+
+// Close stops the copier and waits for it to finish. Neither the reader nor
+// the writers are closed. Once closed, the copier can not be restarted with
+// SetReader.
+//
+// Close returns the same error as Err once the copier has stopped.
+//
+// On platforms where the reader does not support deadlines, Close only
+// returns once a pending read on the reader returns.
+func (c *Copier) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	if c.closedErr == nil {
+		c.closedErr = os.ErrClosed
+	}
+	src, done := c.src, c.done
+	c.cond.Broadcast()
+	c.mu.Unlock()
+
+	c.cancel()
+
+	// Kick the run loop out of waiting on the reader.
+	src.fd.SetReadDeadline(time.Unix(1, 0))
+	<-done
+	src.fd.SetReadDeadline(time.Time{})
+
+	return c.Err()
+}
+
+// Err returns the errors the copier ran into, joined into a single error:
+// the error the reader failed with, if any, followed by a
+// *WriterEvictedError for each writer which was evicted. It returns nil
+// while the copier is running, or if it stopped cleanly without evicting any
+// writers.
+//
+// The copier stopping because the reader reached EOF or because it was
+// closed is not an error. If its context was done, the reader error is a
+// *CanceledError.
+func (c *Copier) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closedErr == nil {
+		return nil
+	}
+	errs := make([]error, 0, len(c.stats.evicted)+1)
+	if c.closedErr != io.EOF && c.closedErr != os.ErrClosed {
+		errs = append(errs, c.closedErr)
+	}
+	return joinErrors(append(errs, c.stats.evicted...)...)
+}
+
+// DebugString returns a human readable dump of the copier's state: whether the
+// run loop is copying, waiting or stopped, the reader and how much data is
+// buffered in it, the current and pending writers, and the most recent
+// evictions.
+//
+// This is meant to help debug why a writer stopped receiving data. The format
+// is not stable and should not be parsed.
+func (c *Copier) DebugString() string {
+	c.mu.Lock()
+	state := "waiting"
+	switch {
+	case c.closedErr != nil:
+		state = fmt.Sprintf("stopped (%v)", c.closedErr)
+	case c.reading != nil:
+		state = "copying"
+	}
+	src := c.src
+	read := c.stats.read
+	pending := make(map[*PipeWriter]bool)
+	for _, w := range c.pendingWriters() {
+		pending[w] = true
+	}
+	writers := make([]*PipeWriter, 0, len(c.stats.written))
+	written := make(map[*PipeWriter]int64, len(c.stats.written))
+	for w, n := range c.stats.written {
+		writers = append(writers, w)
+		written[w] = n
+	}
+	evictions := c.stats.evictions
+	recent := append([]copierEviction(nil), c.stats.recent...)
+	c.mu.Unlock()
+
+	// Look up fds and fill levels without holding the lock, as these go to
+	// the kernel.
+	fds := make(map[*PipeWriter]int, len(writers))
+	for _, w := range writers {
+		fds[w] = rawConnFD(w)
+	}
+	sort.Slice(writers, func(i, j int) bool { return fds[writers[i]] < fds[writers[j]] })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "copier: %s\n", state)
+
+	fmt.Fprintf(&b, "reader: fd %d, read %d bytes", rawConnFD(src), read)
+	if n, err := src.Buffered(); err == nil {
+		fmt.Fprintf(&b, ", %d bytes buffered", n)
+	}
+	b.WriteString("\n")
+
+	fmt.Fprintf(&b, "writers: %d (%d pending)\n", len(writers)-len(pending), len(pending))
+	for _, w := range writers {
+		fmt.Fprintf(&b, "  fd %d: written %d bytes", fds[w], written[w])
+		if pending[w] {
+			b.WriteString(" (pending)")
+		}
+		b.WriteString("\n")
+	}
+
+	fmt.Fprintf(&b, "evictions: %d\n", evictions)
+	for _, e := range recent {
+		fmt.Fprintf(&b, "  fd %d: written %d bytes, evicted at %s: %v\n", e.fd, e.n, e.when.Format(time.RFC3339Nano), e.err)
+	}
+	return b.String()
+}
+
+// rawConnFD returns the fd backing c, or -1 if it is not available, such as
+// when c is closed.
+func rawConnFD(c syscall.Conn) int {
+	rc, err := c.SyscallConn()
+	if err != nil {
+		return -1
+	}
+	fd := -1
+	if err := rc.Control(func(sysfd uintptr) {
+		fd = int(sysfd)
+	}); err != nil {
+		return -1
+	}
+	return fd
+}
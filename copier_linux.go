@@ -2,22 +2,25 @@ package pipes
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"sync"
 	"syscall"
+	"time"
 
 	"golang.org/x/sys/unix"
 )
 
 func NewCopier(ctx context.Context, r *PipeReader, writers ...*PipeWriter) (*Copier, error) {
-	ls := make([]syscall.RawConn, 0, len(writers))
+	ls := make([]*copierWriter, 0, len(writers))
 	for _, w := range writers {
-		wrc, err := w.SyscallConn()
+		cw, err := newCopierWriter(w)
 		if err != nil {
 			return nil, err
 		}
-		ls = append(ls, wrc)
+		ls = append(ls, cw)
 	}
 
 	rwc, err := r.SyscallConn()
@@ -25,50 +28,180 @@ func NewCopier(ctx context.Context, r *PipeReader, writers ...*PipeWriter) (*Cop
 		return nil, err
 	}
 
-	var buf [2]int
-	if err := unix.Pipe2(buf[:], unix.O_NONBLOCK|unix.O_CLOEXEC); err != nil {
+	buf, err := pipeBufs.get()
+	if err != nil {
 		return nil, fmt.Errorf("error creating pipe buffer: %w", err)
 	}
 
+	trace := ContextSpliceTrace(ctx)
+	log := ContextLogger(ctx)
+	if !SpliceSupported() {
+		fallbackTaken(trace, log, "Copier")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
 	c := &Copier{
+		ctx:     ctx,
+		cancel:  cancel,
+		trace:   trace,
+		log:     log,
+		src:     r,
 		r:       rwc,
 		writers: ls,
+		evict:   make([]int, 0, len(ls)),
 		buf:     buf,
+		done:    make(chan struct{}),
+
+		busyPoll: ContextBusyPoll(ctx),
 	}
 
 	c.cond = sync.NewCond(&c.mu)
+	c.readFn = c.readReady
+	for _, w := range writers {
+		c.addWriterStats(w)
+	}
 
 	go c.run(ctx)
 
 	return c, nil
 }
 
+// copierWriter is a writer the Copier is copying to.
+type copierWriter struct {
+	w  *PipeWriter
+	rc syscall.RawConn
+
+	// The state of the splice or tee in progress is kept here, along with
+	// the callbacks passed to rc which use it, so they are allocated once
+	// per writer instead of once per chunk.
+	rfd      int
+	total    int64
+	written  int64
+	err      error
+	retry    *RetryPolicy
+	sc       *syscallCounter
+	log      Logger
+	spliceFn func(uintptr) bool
+	teeFn    func(uintptr) bool
+}
+
+func newCopierWriter(w *PipeWriter) (*copierWriter, error) {
+	rc, err := w.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	cw := &copierWriter{w: w, rc: rc}
+	cw.spliceFn = cw.splice
+	cw.teeFn = cw.tee
+	return cw, nil
+}
+
+// start resets the state for copying total bytes from rfd.
+func (cw *copierWriter) start(rfd uintptr, total int64, retry *RetryPolicy, sc *syscallCounter, log Logger) {
+	cw.rfd = int(rfd)
+	cw.total = total
+	cw.written = 0
+	cw.err = nil
+	cw.retry = retry
+	cw.sc = sc
+	cw.log = log
+}
+
+func (cw *copierWriter) splice(wfd uintptr) bool {
+	n, err := doSplice(cw.rfd, nil, int(wfd), nil, cw.total-cw.written, DefaultSpliceFlags, cw.retry, cw.sc, cw.log)
+	if n > 0 {
+		cw.written += n
+	}
+	cw.err = err
+
+	if n == 0 && cw.err == nil {
+		cw.err = io.EOF
+	}
+
+	return true
+}
+
+func (cw *copierWriter) tee(wfd uintptr) bool {
+	// See tee for why this is not using SPLICE_F_NONBLOCK.
+	n, err := doTee(cw.rfd, int(wfd), cw.total-cw.written, unix.SPLICE_F_MOVE, cw.retry, cw.sc, cw.log)
+	if n > 0 {
+		cw.written += n
+	}
+	cw.err = err
+
+	if n == 0 {
+		if err == nil {
+			cw.err = io.EOF
+		}
+	}
+
+	return true
+}
+
 type Copier struct {
-	r       syscall.RawConn
-	writers []syscall.RawConn
+	// syscalls is kept first so it is 64-bit aligned on 32-bit platforms.
+	syscalls syscallCounter
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	trace   *SpliceTrace
+	log     Logger
+	writers []*copierWriter
 
 	mu        sync.Mutex
 	cond      *sync.Cond
-	pending   []syscall.RawConn
+	pending   []*copierWriter
 	closedErr error
+	done      chan struct{}
+	maxChunk  int64
+
+	// src and r are the reader currently being copied from.
+	// swapped is set when SetReader has replaced the reader and the run loop
+	// has not yet picked it up, reading is the reader the run loop is
+	// currently using.
+	src     *PipeReader
+	r       syscall.RawConn
+	swapped bool
+	reading *PipeReader
 
-	buf [2]int
+	buf *pooledPipe
 
-	// This is used for teseting purposes
+	stats copierStats
+	// _lastErr is the error which caused the last eviction.
 	_lastErr error
+	// closed is set by Close, once set the copier can not be restarted.
+	closed  bool
+	onEvict func(*WriterEvictedError)
+	retry   *RetryPolicy
+
+	busyPoll time.Duration
+	thread   *ThreadPolicy
+	batch    bool
+	// reserve is the number of writers to make room for, see Reserve.
+	reserve int
+
+	// The state of the copy pass in progress, which is only used by the run
+	// loop. It is kept here so readFn, the callback passed to the reader's
+	// RawConn, is allocated once instead of once per pass.
+	readFn  func(uintptr) bool
+	passSrc *PipeReader
+	spin    spinner
+	evict   []int
 }
 
 func (c *Copier) run(ctx context.Context) {
 	defer func() {
-		unix.Close(c.buf[0])
-		unix.Close(c.buf[1])
+		pipeBufs.put(c.buf)
+		close(c.done)
 	}()
 
+	thread := copierThread{log: c.log}
 	for {
 		if err := c.wait(ctx); err != nil {
 			return
 		}
 
+		thread.apply(c.threadPolicy())
 		c.doCopy(ctx)
 	}
 }
@@ -92,17 +225,145 @@ func (c *Copier) Add(w *PipeWriter) error {
 		return err
 	}
 
-	wrc, err := w.SyscallConn()
+	cw, err := newCopierWriter(w)
+	if err != nil {
+		return err
+	}
+
+	c.pending = append(c.pending, cw)
+	c.addWriterStats(w)
+	c.cond.Broadcast()
+
+	return nil
+}
+
+// SetReader replaces the reader the copier is copying from without
+// disturbing any of the writers. This is useful, for instance, when the
+// producer of the original pipe has been restarted.
+//
+// If the copier stopped because the previous reader reached EOF, the copier
+// is restarted with the new reader.
+// The previous reader is not closed.
+//
+// To get the copier off the previous reader, SetReader sets an expired read
+// deadline on it and then clears it. Any read deadline set on the file
+// underlying the previous reader is lost.
+func (c *Copier) SetReader(r *PipeReader) error {
+	rc, err := r.SyscallConn()
 	if err != nil {
 		return err
 	}
 
-	c.pending = append(c.pending, wrc)
-	c.cond.Signal()
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return os.ErrClosed
+	}
+	if c.closedErr != nil {
+		err, done := c.closedErr, c.done
+		c.mu.Unlock()
+		if err != io.EOF {
+			return err
+		}
+		<-done
+		return c.restart(r, rc)
+	}
+
+	old := c.src
+	c.src = r
+	c.r = rc
+	c.swapped = true
+	c.cond.Broadcast()
+	c.mu.Unlock()
+
+	// Kick the run loop out of waiting on the old reader.
+	old.fd.SetReadDeadline(time.Unix(1, 0))
+
+	c.mu.Lock()
+	for c.reading == old {
+		c.cond.Wait()
+	}
+	c.mu.Unlock()
+
+	old.fd.SetReadDeadline(time.Time{})
+	return nil
+}
+
+func (c *Copier) restart(r *PipeReader, rc syscall.RawConn) error {
+	buf, err := pipeBufs.get()
+	if err != nil {
+		return fmt.Errorf("error creating pipe buffer: %w", err)
+	}
+
+	c.mu.Lock()
+	if c.closedErr != io.EOF || c.closed {
+		// Someone else already restarted (or stopped) the copier.
+		c.mu.Unlock()
+		pipeBufs.put(buf)
+		return c.SetReader(r)
+	}
+
+	c.src = r
+	c.r = rc
+	c.buf = buf
+	c.closedErr = nil
+	c.done = make(chan struct{})
+	c.mu.Unlock()
 
+	go c.run(c.ctx)
 	return nil
 }
 
+// SetMaxChunkSize sets the maximum number of bytes the copier moves from the
+// reader to the writers in a single pass.
+// By default (or if n is 0) there is no limit and each pass moves as much data
+// as is available.
+//
+// Bounding the chunk size bounds how long each writer can hold up the copy
+// loop, which is useful for latency-sensitive fan-out.
+// The limits set on individual writers with PipeWriter.SetMaxSpliceSize are
+// also taken into account.
+func (c *Copier) SetMaxChunkSize(n int64) {
+	c.mu.Lock()
+	c.maxChunk = n
+	c.mu.Unlock()
+}
+
+// chunkSize returns the number of bytes to move in a single pass, 0 meaning
+// no limit.
+// This must only be called from the run loop.
+func (c *Copier) chunkSize() int64 {
+	c.mu.Lock()
+	size := c.maxChunk
+	c.mu.Unlock()
+
+	for _, cw := range c.writers {
+		size = minChunk(size, cw.w.maxSpliceSize())
+	}
+	return size
+}
+
+// minChunk returns the smaller of two chunk sizes where 0 means unlimited.
+func minChunk(a, b int64) int64 {
+	if a <= 0 {
+		return b
+	}
+	if b <= 0 || a < b {
+		return a
+	}
+	return b
+}
+
+// pendingWriters returns the writers which were added but not yet picked up by
+// the run loop. c.mu must be held.
+func (c *Copier) pendingWriters() []*PipeWriter {
+	ls := make([]*PipeWriter, 0, len(c.pending))
+	for _, cw := range c.pending {
+		ls = append(ls, cw.w)
+	}
+	return ls
+}
+
 func (c *Copier) lastErr() error {
 	c.mu.Lock()
 	err := c._lastErr
@@ -111,7 +372,7 @@ func (c *Copier) lastErr() error {
 }
 
 func (c *Copier) shouldWait(ctx context.Context) bool {
-	return len(c.writers) == 0 && len(c.pending) == 0 && c.closedErr == nil && ctx.Err() == nil
+	return len(c.writers) == 0 && len(c.pending) == 0 && c.closedErr == nil && ctx.Err() == nil && !c.swapped
 }
 
 func (c *Copier) wait(ctx context.Context) error {
@@ -127,10 +388,20 @@ func (c *Copier) wait(ctx context.Context) error {
 	}
 
 	if ctx.Err() != nil {
-		return ctx.Err()
+		c.closedErr = c.canceledLocked(ctx.Err())
+		return c.closedErr
 	}
 
 	if len(c.pending) > 0 {
+		if need := len(c.writers) + len(c.pending); need > cap(c.writers) {
+			if need < c.reserve {
+				need = c.reserve
+			}
+			ls := make([]*copierWriter, len(c.writers), need)
+			copy(ls, c.writers)
+			c.writers = ls
+			c.evict = make([]int, 0, need)
+		}
 		c.writers = append(c.writers, c.pending...)
 		c.pending = c.pending[:0]
 	}
@@ -139,24 +410,67 @@ func (c *Copier) wait(ctx context.Context) error {
 
 func (c *Copier) doCopy(ctx context.Context) {
 	if ctx.Err() != nil {
-		c.setClosedErr(ctx.Err())
+		c.setCanceled(ctx.Err())
 		return
 	}
 
-	var (
-		evict []int
-	)
+	if !SpliceSupported() {
+		c.doCopyBuffer()
+		return
+	}
+
+	c.mu.Lock()
+	src, rc := c.src, c.r
+	c.swapped = false
+	c.reading = src
+	c.passSrc = src
+	c.spin = spinner{d: c.busyPoll}
+	c.evict = c.evict[:0]
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.reading = nil
+		c.cond.Broadcast()
+		c.mu.Unlock()
+	}()
+
+	err := rc.Read(c.readFn)
+
+	for n, i := range c.evict {
+		c.writers = append(c.writers[:i-n], c.writers[i-n+1:]...)
+	}
+
+	if err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) && c.readerSwapped(src) {
+			return
+		}
+		c.setClosedErr(err)
+	}
+}
+
+// readReady is called by the reader's RawConn while a pass of doCopy is
+// in progress, see readFn.
+func (c *Copier) readReady(rfd uintptr) bool {
+	ctx, src := c.ctx, c.passSrc
 
-	err := c.r.Read(func(rfd uintptr) bool {
+	for {
 		if err := c.wait(ctx); err != nil {
 			return true
 		}
 
-		var (
-			spliced bool
-		)
+		if c.readerSwapped(src) {
+			return true
+		}
 
-		total, err := splice(int(rfd), c.buf[1], 0)
+		c.trace.spliceStart()
+		chunk := c.chunkSize()
+		total, err := doSplice(int(rfd), nil, c.buf.wfd, nil, chunk, DefaultSpliceFlags, nil, &c.syscalls, c.log)
+		for total == 0 && err == unix.EAGAIN && ctx.Err() == nil && !c.readerSwapped(src) && c.spin.spin() {
+			total, err = doSplice(int(rfd), nil, c.buf.wfd, nil, chunk, DefaultSpliceFlags, nil, &c.syscalls, c.log)
+		}
+		c.spin.reset()
+		c.trace.spliceDone(total, err)
 		if err != nil && err != unix.EAGAIN {
 			c.setClosedErr(err)
 			return true
@@ -164,6 +478,7 @@ func (c *Copier) doCopy(ctx context.Context) {
 
 		if total == 0 {
 			if err == unix.EAGAIN {
+				c.trace.blocked()
 				return false
 			}
 			if err == nil {
@@ -171,29 +486,36 @@ func (c *Copier) doCopy(ctx context.Context) {
 				return true
 			}
 		}
+		c.recordRead(total)
 
-		for i, wrc := range c.writers {
+		// left is what is still in the buffer pipe once all the writers
+		// have been handled.
+		left := total
+		retry := c.retryPolicy()
+		for i, cw := range c.writers {
 			if ctx.Err() != nil {
-				c.setClosedErr(ctx.Err())
+				c.setCanceled(ctx.Err())
 				return true
 			}
 
 			if i == len(c.writers)-1 {
-				n, err := c.doSplice(uintptr(c.buf[0]), wrc, total)
+				c.trace.spliceStart()
+				n, err := c.doSplice(uintptr(c.buf.rfd), cw, total, retry)
+				c.trace.spliceDone(n, err)
+				c.recordWritten(cw.w, n)
+				left = total - n
 				if (err != nil && err != unix.EAGAIN) || (total > 0 && n < total) {
-					c.mu.Lock()
-					c._lastErr = err
-					c.mu.Unlock()
-					evict = append(evict, i)
+					c.recordEvicted(cw.w, err)
+					c.evict = append(c.evict, i)
 				}
 			} else {
-				n, err := c.doTee(uintptr(c.buf[0]), wrc, total)
+				n, err := c.doTee(uintptr(c.buf.rfd), cw, total, retry)
+				c.trace.teeDone(n, err)
+				c.recordWritten(cw.w, n)
 				if err != nil || (total > 0 && n < total) {
 					if err != unix.EAGAIN && total > 0 && n < total {
-						c.mu.Lock()
-						c._lastErr = err
-						c.mu.Unlock()
-						evict = append(evict, i)
+						c.recordEvicted(cw.w, err)
+						c.evict = append(c.evict, i)
 						continue
 					}
 				}
@@ -206,38 +528,97 @@ func (c *Copier) doCopy(ctx context.Context) {
 		// We only splice on the last writer
 		// If for some reason we couldn't do that then we need to drain that data
 		// from the buffer.
-		if !spliced && total > 0 {
-			buf := make([]byte, 32*1024)
-			nn := total
-			for nn > 0 {
-				if int64(len(buf)) > nn {
-					buf = buf[:nn]
-				}
-				n, err := unix.Read(c.buf[0], buf)
-				if n > 0 {
-					nn -= int64(n)
-				}
-				if err != nil {
-					if err != unix.EAGAIN {
-						c.setClosedErr(err)
-					}
-					return true
-				}
+		if left > 0 {
+			if err := c.drainBuf(left); err != nil && err != unix.EAGAIN {
+				c.setClosedErr(err)
+				return true
 			}
 		}
 
-		return true
-	})
+		// Evictions are applied once the pass is over, so the batch
+		// has to stop here.
+		if !c.batching() || len(c.evict) > 0 {
+			return true
+		}
+	}
+}
 
-	for n, i := range evict {
-		c.writers = append(c.writers[:i-n], c.writers[i-n+1:]...)
+// doCopyBuffer is used instead of doCopy when splice(2) and tee(2) are not
+// supported. Data is read into a pooled buffer and written to each writer.
+func (c *Copier) doCopyBuffer() {
+	buf := getBuf()
+	defer putBuf(buf)
+
+	b := *buf
+	if size := c.chunkSize(); size > 0 && int64(len(b)) > size {
+		b = b[:size]
+	}
+
+	c.mu.Lock()
+	src := c.src
+	c.swapped = false
+	c.reading = src
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.reading = nil
+		c.cond.Broadcast()
+		c.mu.Unlock()
+	}()
+
+	n, err := src.read(b)
+	if n > 0 {
+		c.recordRead(int64(n))
+		keep := c.writers[:0]
+		for _, cw := range c.writers {
+			nw, werr := cw.w.write(b[:n], &c.syscalls)
+			c.recordWritten(cw.w, int64(nw))
+			if werr != nil {
+				c.recordEvicted(cw.w, werr)
+				continue
+			}
+			keep = append(keep, cw)
+		}
+		c.writers = keep
 	}
 
 	if err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) && c.readerSwapped(src) {
+			return
+		}
 		c.setClosedErr(err)
 	}
 }
 
+// drainBuf discards up to n bytes left in the copier's buffer pipe.
+func (c *Copier) drainBuf(n int64) error {
+	pooled := getBuf()
+	defer putBuf(pooled)
+
+	buf := *pooled
+	for n > 0 {
+		if int64(len(buf)) > n {
+			buf = buf[:n]
+		}
+		nn, err := unix.Read(c.buf.rfd, buf)
+		countSyscall(&c.syscalls, syscallRead, err)
+		if nn > 0 {
+			n -= int64(nn)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Copier) readerSwapped(src *PipeReader) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.src != src
+}
+
 // Copier calls doSplice when it is copying to the last (or only) writer.
 //
 // When `total` is 0, this should be the *only* writer.
@@ -245,55 +626,23 @@ func (c *Copier) doCopy(ctx context.Context) {
 //
 // When `total` is greater than zero we need to keep trying until either
 // we have written `total` bytes OR some fatal error (*not* EGAIN).
-func (c *Copier) doSplice(rfd uintptr, wrc syscall.RawConn, total int64) (int64, error) {
-	var (
-		written   int64
-		spliceErr error
-	)
-
-	writeErr := wrc.Write(func(wfd uintptr) bool {
-		n, err := splice(int(rfd), int(wfd), total-written)
-		if n > 0 {
-			written += n
-		}
-		spliceErr = err
-
-		if n == 0 && spliceErr == nil {
-			spliceErr = io.EOF
-		}
-
-		return true
-	})
-	if writeErr != nil {
-		return written, writeErr
+//
+// Transient errors are retried according to retry, which may be nil.
+func (c *Copier) doSplice(rfd uintptr, cw *copierWriter, total int64, retry *RetryPolicy) (int64, error) {
+	cw.start(rfd, total, retry, &c.syscalls, c.log)
+	if err := cw.rc.Write(cw.spliceFn); err != nil {
+		return cw.written, err
 	}
-	return written, spliceErr
+	return cw.written, cw.err
 }
 
-func (c *Copier) doTee(rfd uintptr, wrc syscall.RawConn, total int64) (int64, error) {
-	var (
-		written int64
-		teeErr  error
-	)
-
-	writeErr := wrc.Write(func(wfd uintptr) bool {
-		n, err := tee(int(rfd), int(wfd), total-written)
-		if n > 0 {
-			written += n
-		}
-		teeErr = err
-
-		if n == 0 {
-			if err == nil {
-				teeErr = io.EOF
-			}
-		}
-
-		return true
-	})
-
-	if writeErr != nil {
-		return written, writeErr
+// doTee duplicates the data in the buffer pipe to a writer.
+// Only a tee which has not copied anything yet can be retried, since tee(2)
+// always starts from the beginning of the buffer.
+func (c *Copier) doTee(rfd uintptr, cw *copierWriter, total int64, retry *RetryPolicy) (int64, error) {
+	cw.start(rfd, total, retry, &c.syscalls, c.log)
+	if err := cw.rc.Write(cw.teeFn); err != nil {
+		return cw.written, err
 	}
-	return written, teeErr
+	return cw.written, cw.err
 }
@@ -3,11 +3,18 @@ package pipes
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 func TestCopier(t *testing.T) {
@@ -24,7 +31,7 @@ func TestCopier(t *testing.T) {
 		buf := make([]byte, 1e6)
 		runtime.Stack(buf, true)
 		fmt.Println(string(buf))
-		t.Logf("%+v", *c)
+		t.Logf("%+v", c)
 	}()
 
 	r1, w1 := newPipe(t)
@@ -32,9 +39,9 @@ func TestCopier(t *testing.T) {
 	r3, w3 := newPipe(t)
 	r4, w4 := newPipe(t)
 
-	buf1 := bytes.NewBuffer(nil)
-	buf2 := bytes.NewBuffer(nil)
-	buf3 := bytes.NewBuffer(nil)
+	buf1 := new(syncBuffer)
+	buf2 := new(syncBuffer)
+	buf3 := new(syncBuffer)
 
 	go io.Copy(buf1, r2)
 	go io.Copy(buf2, r3)
@@ -68,7 +75,26 @@ func TestCopier(t *testing.T) {
 	checkBuffer(t, buf3, " world")
 }
 
-func checkBuffer(t *testing.T, buf *bytes.Buffer, val string) {
+// syncBuffer is a bytes.Buffer which can be written to by one goroutine while
+// checkBuffer reads it from another.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func checkBuffer(t *testing.T, buf *syncBuffer, val string) {
 	t.Helper()
 
 	for i := 0; i < 100; i++ {
@@ -80,3 +106,604 @@ func checkBuffer(t *testing.T, buf *bytes.Buffer, val string) {
 
 	t.Errorf("expected %q, got %q", val, buf)
 }
+
+func TestCopierSetReader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r1, w1 := newPipe(t)
+	r2, w2 := newPipe(t)
+	r3, w3 := newPipe(t)
+	r4, w4 := newPipe(t)
+
+	buf := new(syncBuffer)
+	go io.Copy(buf, r2)
+
+	c, err := NewCopier(ctx, r1, w2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w1.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	checkBuffer(t, buf, "hello")
+
+	if err := c.SetReader(r3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w1.Write([]byte(" nobody")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w3.Write([]byte(" world")); err != nil {
+		t.Fatal(err)
+	}
+	checkBuffer(t, buf, "hello world")
+
+	// Closing the write side causes the copier to stop with EOF, setting a
+	// new reader should start it back up.
+	w3.Close()
+	c.mu.Lock()
+	done := c.done
+	c.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for copier to stop")
+	}
+
+	if err := c.SetReader(r4); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w4.Write([]byte("!")); err != nil {
+		t.Fatal(err)
+	}
+	checkBuffer(t, buf, "hello world!")
+}
+
+func TestCopierMaxChunkSize(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r1, w1 := newPipe(t)
+	r2, w2 := newPipe(t)
+	r3, w3 := newPipe(t)
+
+	buf1 := new(syncBuffer)
+	buf2 := new(syncBuffer)
+	go io.Copy(buf1, r2)
+	go io.Copy(buf2, r3)
+
+	w3.SetMaxSpliceSize(2)
+
+	c, err := NewCopier(ctx, r1, w2, w3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetMaxChunkSize(3)
+
+	if _, err := w1.Write([]byte("hello world")); err != nil {
+		t.Fatal(err)
+	}
+
+	checkBuffer(t, buf1, "hello world")
+	checkBuffer(t, buf2, "hello world")
+}
+
+func TestCopierStats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r1, w1 := newPipe(t)
+	r2, w2 := newPipe(t)
+	r3, w3 := newPipe(t)
+
+	// Nothing reads from w3, so it is evicted on the first write.
+	r3.Close()
+
+	c, err := NewCopier(ctx, r1, w3, w2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w1.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(r2, make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+	w1.Close()
+
+	var stats CopierStats
+	for i := 0; i < 100; i++ {
+		stats = c.Stats()
+		if stats.Err != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if stats.Err != io.EOF {
+		t.Fatalf("expected copier to stop with EOF, got: %v", stats.Err)
+	}
+	if stats.BytesRead != 5 {
+		t.Fatalf("expected 5 bytes read, got %d", stats.BytesRead)
+	}
+	if len(stats.BytesWritten) != 1 || stats.BytesWritten[w2] != 5 {
+		t.Fatalf("unexpected bytes written: %v", stats.BytesWritten)
+	}
+	if stats.Evictions != 1 || stats.LastErr == nil {
+		t.Fatalf("expected 1 eviction with an error, got %d: %v", stats.Evictions, stats.LastErr)
+	}
+	if SpliceSupported() && (stats.Syscalls.Splices == 0 || stats.Syscalls.Tees == 0) {
+		t.Fatalf("expected splice and tee calls to be counted: %+v", stats.Syscalls)
+	}
+}
+
+func TestCopierDebugString(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r1, w1 := newPipe(t)
+	r2, w2 := newPipe(t)
+	r3, w3 := newPipe(t)
+	r3.Close()
+
+	c, err := NewCopier(ctx, r1, w3, w2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w1.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(r2, make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+
+	s := c.DebugString()
+	for _, want := range []string{
+		"reader: fd " + strconv.Itoa(rawFd(t, r1)),
+		"writers: 1 (0 pending)",
+		"fd " + strconv.Itoa(rawFd(t, w2)) + ": written 5 bytes",
+		"evictions: 1",
+		"fd " + strconv.Itoa(rawFd(t, w3)) + ": written 0 bytes, evicted at",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("expected %q in debug string:\n%s", want, s)
+		}
+	}
+
+	w1.Close()
+	for i := 0; i < 100 && c.Stats().Err == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if s := c.DebugString(); !strings.Contains(s, "copier: stopped (EOF)") {
+		t.Fatalf("expected stopped copier:\n%s", s)
+	}
+}
+
+func TestCopierEvictedError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r1, w1 := newPipe(t)
+	r2, w2 := newPipe(t)
+	r3, w3 := newPipe(t)
+
+	c, err := NewCopier(ctx, r1, w3, w2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evicted := make(chan *WriterEvictedError, 1)
+	c.SetEvictHandler(func(e *WriterEvictedError) { evicted <- e })
+
+	if _, err := w1.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(r2, make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(r3, make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing reads from w3 anymore, so it is evicted on the next write.
+	r3.Close()
+	if _, err := w1.Write([]byte("world")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case e := <-evicted:
+		if e.Writer != w3 || e.Written != 5 {
+			t.Fatalf("unexpected eviction: %+v", e)
+		}
+		if !errors.Is(e, ErrWriterEvicted) || !errors.Is(e, io.ErrClosedPipe) {
+			t.Fatalf("unexpected eviction error: %v", e)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for eviction")
+	}
+
+	err = c.Close()
+	var evictErr *WriterEvictedError
+	if !errors.As(err, &evictErr) || evictErr.Writer != w3 {
+		t.Fatalf("expected eviction error from Close, got: %v", err)
+	}
+
+	if err := c.Add(w2); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("expected os.ErrClosed from Add after Close, got: %v", err)
+	}
+	if err := c.SetReader(r1); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("expected os.ErrClosed from SetReader after Close, got: %v", err)
+	}
+}
+
+func TestCopierCanceledError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r1, w1 := newPipe(t)
+	r2, w2 := newPipe(t)
+
+	c, err := NewCopier(ctx, r1, w2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w1.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(r2, make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	// Wake up the copier so it notices the cancellation.
+	if _, err := w1.Write([]byte("world")); err != nil {
+		t.Fatal(err)
+	}
+
+	var stats CopierStats
+	for i := 0; i < 100; i++ {
+		stats = c.Stats()
+		if stats.Err != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var cerr *CanceledError
+	if !errors.As(stats.Err, &cerr) || !errors.Is(stats.Err, context.Canceled) {
+		t.Fatalf("expected *CanceledError wrapping context.Canceled, got: %v", stats.Err)
+	}
+	if cerr.Read < 5 || cerr.Written[w2] < 5 {
+		t.Fatalf("expected at least 5 bytes copied to w2, got: %+v", cerr)
+	}
+}
+
+func TestCopierErr(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r1, w1 := newPipe(t)
+	r2, w2 := newPipe(t)
+	r3, w3 := newPipe(t)
+	r3.Close()
+
+	c, err := NewCopier(ctx, r1, w3, w2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w1.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(r2, make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Err(); err != nil {
+		t.Fatalf("expected no error while running, got: %v", err)
+	}
+
+	cancel()
+	if _, err := w1.Write([]byte("world")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100 && c.Stats().Err == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	err = c.Err()
+	var (
+		cerr     *CanceledError
+		evictErr *WriterEvictedError
+	)
+	if !errors.As(err, &cerr) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the cancellation in the error, got: %v", err)
+	}
+	if !errors.As(err, &evictErr) || evictErr.Writer != w3 {
+		t.Fatalf("expected the eviction of w3 in the error, got: %v", err)
+	}
+	if cerr.Written[w3] != 0 || cerr.Written[w2] < 5 {
+		t.Fatalf("unexpected progress: %v", cerr.Written)
+	}
+}
+
+func TestCopierRetryPolicy(t *testing.T) {
+	if !SpliceSupported() {
+		t.Skip("splice not supported")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r1, w1 := newPipe(t)
+	r2, w2 := newPipe(t)
+	r3, w3 := newPipe(t)
+
+	// Fill up w3 so copying to it fails with EAGAIN until r3 is drained.
+	var filled int
+	w3.fd.SetWriteDeadline(time.Now().Add(10 * time.Millisecond))
+	for {
+		n, err := w3.Write(make([]byte, 4096))
+		filled += n
+		if err != nil {
+			break
+		}
+	}
+	w3.fd.SetWriteDeadline(time.Time{})
+
+	c, err := NewCopier(ctx, r1, w3, w2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetRetryPolicy(&RetryPolicy{MaxRetries: -1, Backoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond})
+
+	if _, err := w1.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	r3.fd.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, filled+5)
+	if _, err := io.ReadFull(r3, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[filled:]) != "hello" {
+		t.Fatalf("expected hello after the filler, got %q", buf[filled:])
+	}
+	if _, err := io.ReadFull(r2, buf[:5]); err != nil {
+		t.Fatal(err)
+	}
+	if stats := c.Stats(); stats.Evictions != 0 {
+		t.Fatalf("expected no evictions, got %d: %v", stats.Evictions, stats.LastErr)
+	}
+}
+
+func TestCopierThreadPolicy(t *testing.T) {
+	if !SpliceSupported() {
+		t.Skip("splice not supported")
+	}
+
+	prio, err := unix.Getpriority(unix.PRIO_PROCESS, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := 20 - prio
+	if base >= 19 {
+		t.Skip("niceness can not be raised any further")
+	}
+
+	// The trace hooks run on the copier's goroutine, so this sees the
+	// niceness of the thread the copy runs on.
+	nice := make(chan int, 16)
+	trace := &SpliceTrace{
+		SpliceStart: func() {
+			prio, err := unix.Getpriority(unix.PRIO_PROCESS, unix.Gettid())
+			if err == nil {
+				select {
+				case nice <- 20 - prio:
+				default:
+				}
+			}
+		},
+	}
+	ctx, cancel := context.WithCancel(WithSpliceTrace(context.Background(), trace))
+	defer cancel()
+
+	r1, w1 := newPipe(t)
+	r2, w2 := newPipe(t)
+
+	c, err := NewCopier(ctx, r1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	want := base + 1
+	c.SetThreadPolicy(&ThreadPolicy{Nice: &want})
+	if err := c.Add(w2); err != nil {
+		t.Fatal(err)
+	}
+
+	copyOne := func() int {
+		t.Helper()
+
+		// Only keep what is seen for this write.
+		for len(nice) > 0 {
+			<-nice
+		}
+		if _, err := w1.Write([]byte("x")); err != nil {
+			t.Fatal(err)
+		}
+		r2.fd.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.ReadFull(r2, make([]byte, 1)); err != nil {
+			t.Fatal(err)
+		}
+		return <-nice
+	}
+
+	if n := copyOne(); n != want {
+		t.Fatalf("expected niceness %d, got %d", want, n)
+	}
+
+	// Unpinning is picked up on the next pass, the current one is already
+	// waiting for data.
+	c.SetThreadPolicy(nil)
+	copyOne()
+	if n := copyOne(); n != base {
+		t.Fatalf("expected niceness to be restored to %d, got %d", base, n)
+	}
+}
+
+func TestCopierBatch(t *testing.T) {
+	if !SpliceSupported() {
+		t.Skip("splice not supported")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r1, w1 := newPipe(t)
+	r2, w2 := newPipe(t)
+	r3, w3 := newPipe(t)
+
+	// Queue up several chunks so a single pass has to drain all of them.
+	data := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	go w1.Write(data)
+
+	c, err := NewCopier(ctx, r1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetBatch(true)
+	c.SetMaxChunkSize(4096)
+	if err := c.Add(w2); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Add(w3); err != nil {
+		t.Fatal(err)
+	}
+
+	r2.fd.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, len(data))
+	if _, err := io.ReadFull(r2, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data) {
+		t.Fatal("unexpected data")
+	}
+
+	// An eviction in the middle of a batch must not disturb the other
+	// writers.
+	r2.Close()
+	go w1.Write(data)
+
+	r3.fd.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf = make([]byte, 2*len(data))
+	if _, err := io.ReadFull(r3, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf[:len(data)], data) || !bytes.Equal(buf[len(data):], data) {
+		t.Fatal("unexpected data")
+	}
+	if stats := c.Stats(); stats.Evictions != 1 {
+		t.Fatalf("expected 1 eviction, got %d", stats.Evictions)
+	}
+}
+
+// copierSteadyState sets up a copier with two writers, so both tee(2) and
+// splice(2) are used, and returns a function which pushes a chunk through it,
+// along with the copier.
+func copierSteadyState(t testing.TB) (func(), *Copier) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	r, w := newPipe(t)
+	r1, w1 := newPipe(t)
+	r2, w2 := newPipe(t)
+
+	c, err := NewCopier(ctx, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	c.Reserve(2)
+	for _, w := range []*PipeWriter{w1, w2} {
+		if err := c.Add(w); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Pass the pipes as interfaces up front so the conversions are not
+	// counted as allocations.
+	var (
+		src io.Writer = w
+		dst           = []io.Reader{r1, r2}
+		in            = bytes.Repeat([]byte("x"), 4096)
+		out           = make([]byte, len(in))
+	)
+	step := func() {
+		if _, err := src.Write(in); err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range dst {
+			if _, err := io.ReadFull(r, out); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return step, c
+}
+
+func TestCopierSteadyStateAllocs(t *testing.T) {
+	if !SpliceSupported() {
+		t.Skip("splice not supported")
+	}
+
+	step, c := copierSteadyState(t)
+	// Warm up so the per-writer state is in place.
+	step()
+
+	before := c.Stats().Syscalls
+	if allocs := testing.AllocsPerRun(100, step); allocs != 0 {
+		t.Fatalf("expected no allocations copying a chunk, got %v", allocs)
+	}
+	after := c.Stats().Syscalls
+
+	// The last writer takes the chunk out of the buffer pipe, so there is
+	// nothing left to drain.
+	if n := after.Reads - before.Reads; n != 0 {
+		t.Fatalf("expected no reads draining the buffer pipe, got %d", n)
+	}
+	// AllocsPerRun does one more run to warm up.
+	const runs = 101
+	// Per chunk: two splices in, the second one finding the source empty, a
+	// tee and a splice out, and a splice finding the source empty before
+	// waiting for more.
+	if calls := after.Calls() - before.Calls(); calls > 5*runs {
+		t.Fatalf("expected at most %d syscalls for %d chunks, got %d", 5*runs, runs, calls)
+	}
+}
+
+func BenchmarkCopier(b *testing.B) {
+	if !SpliceSupported() {
+		b.Skip("splice not supported")
+	}
+
+	step, _ := copierSteadyState(b)
+	step()
+
+	b.ReportAllocs()
+	b.SetBytes(4096)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		step()
+	}
+}
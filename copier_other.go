@@ -0,0 +1,298 @@
+//go:build !linux
+// +build !linux
+
+package pipes
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// NewCopier creates a Copier which copies everything read from r to all of
+// the passed in writers.
+//
+// splice(2) and tee(2) are not available on this platform, so data is copied
+// through a pooled userspace buffer.
+func NewCopier(ctx context.Context, r *PipeReader, writers ...*PipeWriter) (*Copier, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	c := &Copier{
+		ctx:     ctx,
+		cancel:  cancel,
+		src:     r,
+		writers: append([]*PipeWriter(nil), writers...),
+		done:    make(chan struct{}),
+
+		log:      ContextLogger(ctx),
+		busyPoll: ContextBusyPoll(ctx),
+	}
+	fallbackTaken(ContextSpliceTrace(ctx), c.log, "Copier")
+	c.cond = sync.NewCond(&c.mu)
+	for _, w := range writers {
+		c.addWriterStats(w)
+	}
+
+	go c.run(ctx)
+
+	return c, nil
+}
+
+type Copier struct {
+	// syscalls is kept first so it is 64-bit aligned on 32-bit platforms.
+	syscalls syscallCounter
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	log     Logger
+	writers []*PipeWriter
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	pending   []*PipeWriter
+	closedErr error
+	done      chan struct{}
+	maxChunk  int64
+
+	// See the linux implementation for details on these.
+	src     *PipeReader
+	swapped bool
+	reading *PipeReader
+
+	stats copierStats
+	// _lastErr is the error which caused the last eviction.
+	_lastErr error
+	// closed is set by Close, once set the copier can not be restarted.
+	closed  bool
+	onEvict func(*WriterEvictedError)
+	retry   *RetryPolicy
+
+	busyPoll time.Duration
+	thread   *ThreadPolicy
+	batch    bool
+	// reserve is the number of writers to make room for, see Reserve.
+	reserve int
+}
+
+func (c *Copier) run(ctx context.Context) {
+	defer close(c.done)
+
+	buf := getBuf()
+	defer putBuf(buf)
+
+	thread := copierThread{log: c.log}
+	for {
+		if err := c.wait(ctx); err != nil {
+			return
+		}
+
+		thread.apply(c.threadPolicy())
+		c.doCopy(*buf)
+	}
+}
+
+func (c *Copier) setClosedErr(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err == nil || c.closedErr != nil {
+		return
+	}
+
+	c.closedErr = err
+}
+
+func (c *Copier) Add(w *PipeWriter) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.closedErr; err != nil {
+		return err
+	}
+
+	c.pending = append(c.pending, w)
+	c.addWriterStats(w)
+	c.cond.Broadcast()
+
+	return nil
+}
+
+// SetReader replaces the reader the copier is copying from without
+// disturbing any of the writers. This is useful, for instance, when the
+// producer of the original pipe has been restarted.
+//
+// If the copier stopped because the previous reader reached EOF, the copier
+// is restarted with the new reader.
+// The previous reader is not closed.
+//
+// To get the copier off the previous reader, SetReader sets an expired read
+// deadline on it and then clears it. Any read deadline set on the file
+// underlying the previous reader is lost.
+//
+// On platforms where the previous reader does not support deadlines the swap
+// only takes effect once a pending read on the previous reader returns.
+func (c *Copier) SetReader(r *PipeReader) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return os.ErrClosed
+	}
+	if c.closedErr != nil {
+		err, done := c.closedErr, c.done
+		c.mu.Unlock()
+		if err != io.EOF {
+			return err
+		}
+		<-done
+		return c.restart(r)
+	}
+
+	old := c.src
+	c.src = r
+	c.swapped = true
+	c.cond.Broadcast()
+	c.mu.Unlock()
+
+	// Kick the run loop out of waiting on the old reader.
+	old.fd.SetReadDeadline(time.Unix(1, 0))
+
+	c.mu.Lock()
+	for c.reading == old {
+		c.cond.Wait()
+	}
+	c.mu.Unlock()
+
+	old.fd.SetReadDeadline(time.Time{})
+	return nil
+}
+
+func (c *Copier) restart(r *PipeReader) error {
+	c.mu.Lock()
+	if c.closedErr != io.EOF || c.closed {
+		// Someone else already restarted (or stopped) the copier.
+		c.mu.Unlock()
+		return c.SetReader(r)
+	}
+
+	c.src = r
+	c.closedErr = nil
+	c.done = make(chan struct{})
+	c.mu.Unlock()
+
+	go c.run(c.ctx)
+	return nil
+}
+
+// SetMaxChunkSize sets the maximum number of bytes the copier moves from the
+// reader to the writers in a single pass.
+// By default (or if n is 0) each pass moves up to the size of the internal
+// buffer.
+func (c *Copier) SetMaxChunkSize(n int64) {
+	c.mu.Lock()
+	c.maxChunk = n
+	c.mu.Unlock()
+}
+
+// pendingWriters returns the writers which were added but not yet picked up by
+// the run loop. c.mu must be held.
+func (c *Copier) pendingWriters() []*PipeWriter {
+	return append([]*PipeWriter(nil), c.pending...)
+}
+
+func (c *Copier) lastErr() error {
+	c.mu.Lock()
+	err := c._lastErr
+	c.mu.Unlock()
+	return err
+}
+
+func (c *Copier) shouldWait(ctx context.Context) bool {
+	return len(c.writers) == 0 && len(c.pending) == 0 && c.closedErr == nil && ctx.Err() == nil && !c.swapped
+}
+
+func (c *Copier) wait(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for c.shouldWait(ctx) {
+		c.cond.Wait()
+	}
+
+	if c.closedErr != nil {
+		return c.closedErr
+	}
+
+	if ctx.Err() != nil {
+		c.closedErr = c.canceledLocked(ctx.Err())
+		return c.closedErr
+	}
+
+	if len(c.pending) > 0 {
+		if need := len(c.writers) + len(c.pending); need > cap(c.writers) {
+			if need < c.reserve {
+				need = c.reserve
+			}
+			ls := make([]*PipeWriter, len(c.writers), need)
+			copy(ls, c.writers)
+			c.writers = ls
+		}
+		c.writers = append(c.writers, c.pending...)
+		c.pending = c.pending[:0]
+	}
+	return nil
+}
+
+func (c *Copier) doCopy(buf []byte) {
+	c.mu.Lock()
+	src := c.src
+	c.swapped = false
+	c.reading = src
+	if c.maxChunk > 0 && int64(len(buf)) > c.maxChunk {
+		buf = buf[:c.maxChunk]
+	}
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.reading = nil
+		c.cond.Broadcast()
+		c.mu.Unlock()
+	}()
+
+	for _, w := range c.writers {
+		if max := w.maxSpliceSize(); max > 0 && int64(len(buf)) > max {
+			buf = buf[:max]
+		}
+	}
+
+	n, err := src.read(buf)
+	if n > 0 {
+		c.recordRead(int64(n))
+		keep := c.writers[:0]
+		for _, w := range c.writers {
+			nw, werr := w.write(buf[:n], &c.syscalls)
+			c.recordWritten(w, int64(nw))
+			if werr != nil {
+				c.recordEvicted(w, werr)
+				continue
+			}
+			keep = append(keep, w)
+		}
+		c.writers = keep
+	}
+
+	if err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) && c.readerSwapped(src) {
+			return
+		}
+		c.setClosedErr(err)
+	}
+}
+
+func (c *Copier) readerSwapped(src *PipeReader) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.src != src
+}
@@ -0,0 +1,453 @@
+package pipes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// uringEntries is the size of the submission queue of a UringCopier.
+	uringEntries = 64
+	// uringBatch is the most writers submitted to the ring at once.
+	// Each writer takes two entries (a poll and the op linked to it).
+	uringBatch = uringEntries / 2
+
+	// Completions with uringIgnore set in their user data are for polls
+	// and cancellations, which the run loop does not care about since the
+	// result is also reflected in the linked operation.
+	uringIgnore   = 1 << 63
+	uringReadOp   = 1 << 32
+	uringReadPoll = uringIgnore | uringReadOp
+)
+
+// UringCopier is like Copier but submits the splice(2) and tee(2) calls
+// through io_uring instead of calling them from the Go poller.
+//
+// For each chunk the read is submitted first, then the tees to all but the
+// last writer along with the final splice to the last writer are submitted
+// in a single batch, with the splice held back until all the tees have
+// completed. This saves a wakeup and a syscall per writer per chunk.
+//
+// Writers which fail or fall behind (a tee which could not duplicate the whole
+// chunk) are evicted, same as with Copier.
+//
+// io_uring may not be available, either because the kernel is too old (splice
+// requires 5.7, tee requires 5.8) or because it has been disabled. In that
+// case NewUringCopier returns an error and callers can fall back to
+// NewCopier.
+type UringCopier struct {
+	ring *ioUring
+	rfd  int
+	buf  *pooledPipe
+
+	writers []*uringWriter
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	pending   []*uringWriter
+	closedErr error
+	done      chan struct{}
+	maxChunk  int64
+
+	// This is used for teseting purposes
+	_lastErr error
+}
+
+// uringWriter is a writer the UringCopier is copying to.
+// The fd is a duplicate of the writer's fd so it stays valid for as long as
+// the copier needs it, even if the writer is closed.
+type uringWriter struct {
+	w  *PipeWriter
+	fd int
+}
+
+func (uw *uringWriter) close() {
+	unix.Close(uw.fd)
+}
+
+func newUringWriter(w *PipeWriter) (*uringWriter, error) {
+	fd, err := dupConn(w)
+	if err != nil {
+		return nil, err
+	}
+	return &uringWriter{w: w, fd: fd}, nil
+}
+
+// NewUringCopier creates a UringCopier which copies everything read from r to
+// all of the passed in writers.
+func NewUringCopier(ctx context.Context, r *PipeReader, writers ...*PipeWriter) (_ *UringCopier, retErr error) {
+	if !SpliceSupported() {
+		return nil, ErrNotSupported
+	}
+
+	ring, err := newIOUring(uringEntries)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if retErr != nil {
+			ring.close()
+		}
+	}()
+
+	ls := make([]*uringWriter, 0, len(writers))
+	defer func() {
+		if retErr != nil {
+			for _, uw := range ls {
+				uw.close()
+			}
+		}
+	}()
+	for _, w := range writers {
+		uw, err := newUringWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		ls = append(ls, uw)
+	}
+
+	rfd, err := dupConn(r)
+	if err != nil {
+		return nil, err
+	}
+
+	buf, err := pipeBufs.get()
+	if err != nil {
+		unix.Close(rfd)
+		return nil, fmt.Errorf("error creating pipe buffer: %w", err)
+	}
+
+	c := &UringCopier{
+		ring:    ring,
+		rfd:     rfd,
+		buf:     buf,
+		writers: ls,
+		done:    make(chan struct{}),
+	}
+	c.cond = sync.NewCond(&c.mu)
+
+	go c.run(ctx)
+	go c.cancelOnDone(ctx)
+
+	return c, nil
+}
+
+// Add adds a writer to the copier.
+func (c *UringCopier) Add(w *PipeWriter) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.closedErr; err != nil {
+		return err
+	}
+
+	uw, err := newUringWriter(w)
+	if err != nil {
+		return err
+	}
+
+	c.pending = append(c.pending, uw)
+	c.cond.Broadcast()
+
+	return nil
+}
+
+// SetMaxChunkSize sets the maximum number of bytes the copier moves from the
+// reader to the writers in a single pass.
+// See Copier.SetMaxChunkSize for details.
+func (c *UringCopier) SetMaxChunkSize(n int64) {
+	c.mu.Lock()
+	c.maxChunk = n
+	c.mu.Unlock()
+}
+
+// chunkSize returns the number of bytes to move in a single pass, 0 meaning
+// no limit.
+// This must only be called from the run loop.
+func (c *UringCopier) chunkSize() int64 {
+	c.mu.Lock()
+	size := c.maxChunk
+	c.mu.Unlock()
+
+	for _, uw := range c.writers {
+		size = minChunk(size, uw.w.maxSpliceSize())
+	}
+	return size
+}
+
+func (c *UringCopier) setClosedErr(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err == nil || c.closedErr != nil {
+		return
+	}
+
+	c.closedErr = err
+}
+
+func (c *UringCopier) setLastErr(err error) {
+	c.mu.Lock()
+	c._lastErr = err
+	c.mu.Unlock()
+}
+
+func (c *UringCopier) lastErr() error {
+	c.mu.Lock()
+	err := c._lastErr
+	c.mu.Unlock()
+	return err
+}
+
+// cancelOnDone wakes up the run loop when ctx is cancelled.
+func (c *UringCopier) cancelOnDone(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+	case <-c.done:
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cond.Broadcast()
+	// This fails if there is no pending read, or the ring has already been
+	// closed, which is fine.
+	c.ring.submit(cancelSqe(uringReadPoll, uringIgnore))
+}
+
+func (c *UringCopier) wait(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.writers) == 0 && len(c.pending) == 0 && c.closedErr == nil && ctx.Err() == nil {
+		c.cond.Wait()
+	}
+
+	if c.closedErr != nil {
+		return c.closedErr
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	c.addPending()
+	return nil
+}
+
+// addPending moves writers added while the run loop was busy over to the
+// list of writers being copied to.
+// This must be called with c.mu held.
+func (c *UringCopier) addPending() {
+	if len(c.pending) > 0 {
+		c.writers = append(c.writers, c.pending...)
+		c.pending = c.pending[:0]
+	}
+}
+
+func (c *UringCopier) run(ctx context.Context) {
+	defer func() {
+		c.mu.Lock()
+		for _, uw := range append(c.writers, c.pending...) {
+			uw.close()
+		}
+		c.writers, c.pending = nil, nil
+		c.mu.Unlock()
+
+		unix.Close(c.rfd)
+		c.ring.close()
+		pipeBufs.put(c.buf)
+		close(c.done)
+	}()
+
+	for {
+		if err := c.wait(ctx); err != nil {
+			return
+		}
+
+		n, err := c.read(ctx)
+		if err != nil {
+			c.setClosedErr(err)
+			return
+		}
+
+		// Pick up any writers added while waiting for data.
+		c.mu.Lock()
+		c.addPending()
+		c.mu.Unlock()
+
+		if err := c.fanOut(n); err != nil {
+			c.setClosedErr(err)
+			return
+		}
+	}
+}
+
+// read splices the next chunk from the reader into the buffer pipe.
+func (c *UringCopier) read(ctx context.Context) (int64, error) {
+	size := spliceLen(c.chunkSize())
+	if size == 0 {
+		size = maxSpliceSize
+	}
+
+	for {
+		// Submit with the lock held so cancelOnDone cannot miss the read.
+		c.mu.Lock()
+		err := ctx.Err()
+		if err == nil {
+			err = c.ring.submit(
+				pollSqe(c.rfd, unix.POLLIN, uringReadPoll),
+				spliceSqe(c.rfd, c.buf.wfd, uint32(size), uringReadOp),
+			)
+		}
+		c.mu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+
+		res, err := c.complete()
+		if err != nil {
+			return 0, err
+		}
+
+		switch {
+		case res > 0:
+			return int64(res), nil
+		case res == 0:
+			return 0, io.EOF
+		case res == -int32(unix.EAGAIN):
+			continue
+		case res == -int32(unix.ECANCELED) && ctx.Err() != nil:
+			return 0, ctx.Err()
+		default:
+			return 0, os.NewSyscallError("splice", cqeErr(res))
+		}
+	}
+}
+
+// complete waits for the next completion the run loop is interested in and
+// returns its result.
+func (c *UringCopier) complete() (int32, error) {
+	for {
+		cqe, err := c.ring.wait()
+		if err != nil {
+			return 0, err
+		}
+		if cqe.userData&uringIgnore == 0 {
+			return cqe.res, nil
+		}
+	}
+}
+
+// fanOut copies the n bytes in the buffer pipe to all the writers.
+// All but the last writer get the data duplicated with tee(2), the last
+// writer gets the data spliced which consumes it from the buffer.
+func (c *UringCopier) fanOut(n int64) error {
+	var (
+		last    = len(c.writers) - 1
+		results = make([]int32, len(c.writers))
+	)
+
+	for start := 0; start <= last; start += uringBatch {
+		end := start + uringBatch
+		if end > last+1 {
+			end = last + 1
+		}
+
+		sqes := make([]ioUringSqe, 0, 2*(end-start))
+		for i := start; i < end; i++ {
+			uw := c.writers[i]
+			poll := pollSqe(uw.fd, unix.POLLOUT, uringIgnore|uint64(i))
+			if i < last {
+				sqes = append(sqes, poll, teeSqe(c.buf.rfd, uw.fd, uint32(n), uint64(i)))
+				continue
+			}
+			// The splice must not consume the data until all the tees are done.
+			poll.flags |= iosqeIODrain
+			sqes = append(sqes, poll, spliceSqe(c.buf.rfd, uw.fd, uint32(n), uint64(i)))
+		}
+
+		if err := c.ring.submit(sqes...); err != nil {
+			return err
+		}
+
+		for pending := end - start; pending > 0; pending-- {
+			cqe, err := c.ring.wait()
+			if err != nil {
+				return err
+			}
+			if cqe.userData&uringIgnore != 0 {
+				pending++
+				continue
+			}
+			results[cqe.userData] = cqe.res
+		}
+	}
+
+	evict := make([]bool, len(c.writers))
+	for i := 0; i < last; i++ {
+		if res := results[i]; int64(res) < n {
+			evict[i] = true
+			c.setLastErr(writeResultErr("tee", res))
+		}
+	}
+
+	remain := n
+	if res := results[last]; res > 0 {
+		remain -= int64(res)
+	}
+	res := results[last]
+	for remain > 0 && (res > 0 || res == -int32(unix.EAGAIN)) {
+		uw := c.writers[last]
+		err := c.ring.submit(
+			pollSqe(uw.fd, unix.POLLOUT, uringIgnore|uint64(last)),
+			spliceSqe(c.buf.rfd, uw.fd, uint32(remain), uint64(last)),
+		)
+		if err != nil {
+			return err
+		}
+		res, err = c.complete()
+		if err != nil {
+			return err
+		}
+		if res > 0 {
+			remain -= int64(res)
+		}
+	}
+	if remain > 0 {
+		evict[last] = true
+		c.setLastErr(writeResultErr("splice", res))
+
+		// Nobody consumed the data so it needs to be drained from the
+		// buffer.
+		if err := drainFd(c.buf.rfd, remain); err != nil {
+			return err
+		}
+	}
+
+	keep := c.writers[:0]
+	for i, uw := range c.writers {
+		if evict[i] {
+			uw.close()
+			continue
+		}
+		keep = append(keep, uw)
+	}
+	c.writers = keep
+
+	return nil
+}
+
+// writeResultErr returns the error for a failed or short write.
+func writeResultErr(op string, res int32) error {
+	if res < 0 {
+		return os.NewSyscallError(op, mapErrno(cqeErr(res)))
+	}
+	return io.ErrShortWrite
+}
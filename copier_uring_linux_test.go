@@ -0,0 +1,144 @@
+package pipes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func newUringCopier(ctx context.Context, t *testing.T, r *PipeReader, writers ...*PipeWriter) *UringCopier {
+	t.Helper()
+
+	c, err := NewUringCopier(ctx, r, writers...)
+	if err != nil {
+		if errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EPERM) {
+			t.Skip("io_uring not available:", err)
+		}
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestUringCopier(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r1, w1 := newPipe(t)
+	r2, w2 := newPipe(t)
+	r3, w3 := newPipe(t)
+	r4, w4 := newPipe(t)
+
+	buf1 := new(syncBuffer)
+	buf2 := new(syncBuffer)
+	buf3 := new(syncBuffer)
+
+	go io.Copy(buf1, r2)
+	go io.Copy(buf2, r3)
+	go io.Copy(buf3, r4)
+
+	c := newUringCopier(ctx, t, r1, w2, w3)
+
+	if _, err := w1.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	checkBuffer(t, buf1, "hello")
+	checkBuffer(t, buf2, "hello")
+
+	if err := c.Add(w4); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w1.Write([]byte(" world")); err != nil {
+		t.Fatal(err)
+	}
+
+	checkBuffer(t, buf1, "hello world")
+	checkBuffer(t, buf2, "hello world")
+	checkBuffer(t, buf3, " world")
+
+	t.Run("evict closed writer", func(t *testing.T) {
+		r2.Close()
+
+		if _, err := w1.Write([]byte("!")); err != nil {
+			t.Fatal(err)
+		}
+
+		checkBuffer(t, buf2, "hello world!")
+		checkBuffer(t, buf3, " world!")
+
+		if err := c.lastErr(); !errors.Is(err, unix.EPIPE) {
+			t.Fatalf("expected EPIPE, got: %v", err)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		cancel()
+
+		select {
+		case <-c.done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("timeout waiting for copier to stop")
+		}
+
+		if err := c.Add(w4); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got: %v", err)
+		}
+	})
+}
+
+func TestUringCopierEOF(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r1, w1 := newPipe(t)
+	r2, w2 := newPipe(t)
+
+	c := newUringCopier(ctx, t, r1, w2)
+
+	data := bytes.Repeat([]byte("a"), 1<<20)
+	go func() {
+		w1.Write(data)
+		w1.Close()
+	}()
+
+	// Make sure the copier holds its own reference to the writer.
+	w2.Close()
+
+	buf := bytes.NewBuffer(nil)
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(buf, r2)
+		done <- err
+	}()
+
+	select {
+	case <-c.done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for copier to stop")
+	}
+
+	if err := c.Add(w2); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+
+	// The copier closed its reference to the writer, so the reader gets EOF.
+	select {
+	case err := <-done:
+		if err != nil && !errors.Is(err, os.ErrClosed) {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for EOF")
+	}
+
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatalf("expected %d bytes, got %d", len(data), buf.Len())
+	}
+}
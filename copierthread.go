@@ -0,0 +1,85 @@
+package pipes
+
+import "runtime"
+
+// ThreadPolicy pins the run loop of a Copier to an OS thread, see
+// Copier.SetThreadPolicy.
+type ThreadPolicy struct {
+	// Nice, if not nil, is the niceness the pinned thread runs with, from -20
+	// (highest priority) to 19 (lowest priority). Going below the niceness of
+	// the process needs CAP_SYS_NICE.
+	// This is only supported on Linux, where niceness is per thread.
+	Nice *int
+}
+
+// SetThreadPolicy pins the copier's run loop to an OS thread, so it is not
+// moved between threads by the Go scheduler, which reduces scheduling jitter
+// for latency critical streams. Pass nil, the default, to unpin it.
+//
+// The policy takes effect the next time the run loop goes around, which may
+// be after the next chunk has been copied. Failing to set the niceness does
+// not stop the copier, the thread stays pinned and an EventThreadPolicy is
+// logged with the error.
+func (c *Copier) SetThreadPolicy(p *ThreadPolicy) {
+	c.mu.Lock()
+	c.thread = p
+	c.mu.Unlock()
+}
+
+func (c *Copier) threadPolicy() *ThreadPolicy {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.thread
+}
+
+// copierThread is the state of the OS thread the run loop is pinned to.
+// It is only used from the run loop.
+type copierThread struct {
+	log    Logger
+	policy *ThreadPolicy
+	locked bool
+	// restore is the niceness to put back before unpinning the thread, if
+	// it was changed.
+	restore *int
+}
+
+// apply brings the run loop's thread in line with p.
+// If the run loop returns while still pinned the thread is thrown away by
+// the runtime, so there is no need to undo anything on the way out.
+func (t *copierThread) apply(p *ThreadPolicy) {
+	if p == t.policy {
+		return
+	}
+	t.policy = p
+
+	if t.restore != nil {
+		if _, err := setThreadNice(*t.restore); err != nil {
+			logEvent(t.log, EventThreadPolicy, "err", err)
+			// Keep the thread pinned rather than handing a thread with
+			// the wrong niceness back to the runtime.
+			return
+		}
+		t.restore = nil
+	}
+
+	if p == nil {
+		if t.locked {
+			runtime.UnlockOSThread()
+			t.locked = false
+		}
+		return
+	}
+
+	if !t.locked {
+		runtime.LockOSThread()
+		t.locked = true
+	}
+	if p.Nice != nil {
+		old, err := setThreadNice(*p.Nice)
+		if err != nil {
+			logEvent(t.log, EventThreadPolicy, "err", err)
+			return
+		}
+		t.restore = &old
+	}
+}
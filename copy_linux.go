@@ -0,0 +1,254 @@
+package pipes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxSendfileSize is the largest chunk passed to a single sendfile(2) call.
+// This is the same limit the net package uses.
+const maxSendfileSize = 4 << 20
+
+// Copy copies from src to dst until EOF is reached on src or an error occurs.
+// It has the same semantics as io.Copy, but picks the most efficient strategy
+// available for the passed in types:
+//
+//   - If src is a *PipeReader, data is spliced directly to dst where possible.
+//   - If src is a *BufferedPeeker, its buffered data is written to dst and
+//     the rest is copied from its PipeReader as above.
+//   - If dst is a *PipeWriter, data is spliced directly from src where possible.
+//   - If src is a regular file, sendfile(2) is used.
+//   - If both sides are backed by file descriptors (e.g. sockets), data is
+//     spliced through an internal pipe.
+//
+// Otherwise this falls back to io.Copy.
+func Copy(dst io.Writer, src io.Reader) (int64, error) {
+	return copyTrace(dst, src, nil, nil, 0)
+}
+
+// CopyContext is like Copy, but calls the hooks of the SpliceTrace attached
+// to ctx (see WithSpliceTrace) as the copy progresses, and busy-polls as set
+// with WithBusyPoll when splicing to or from a pipe.
+// ctx does not cancel the copy.
+func CopyContext(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	return copyTrace(dst, src, ContextSpliceTrace(ctx), ContextLogger(ctx), ContextBusyPoll(ctx))
+}
+
+func copyTrace(dst io.Writer, src io.Reader, trace *SpliceTrace, log Logger, busyPoll time.Duration) (int64, error) {
+	if pr, ok := src.(*PipeReader); ok {
+		return pr.copyResult(pr.writeToWriter(dst, nil, trace, log, busyPoll))
+	}
+	if bp, ok := src.(*BufferedPeeker); ok {
+		n, err := bp.flush(dst)
+		if err != nil {
+			return n, err
+		}
+		if err := bp.err; err != nil && err != io.EOF {
+			return n, bp.readErr()
+		}
+		m, err := copyTrace(dst, bp.r, trace, log, busyPoll)
+		return n + m, err
+	}
+	if pw, ok := dst.(*PipeWriter); ok {
+		n, err := pw.readFromReader(src, nil, trace, log, busyPoll)
+		pw.addWritten(n)
+		return n, pw.writeResult(err)
+	}
+
+	dc, ok := dst.(syscall.Conn)
+	if !ok {
+		return fallbackCopy(trace, log, "Copy", dst, src, nil)
+	}
+	sc, ok := src.(syscall.Conn)
+	if !ok {
+		return fallbackCopy(trace, log, "Copy", dst, src, nil)
+	}
+
+	draw, err := dc.SyscallConn()
+	if err != nil {
+		return fallbackCopy(trace, log, "Copy", dst, src, nil)
+	}
+	sraw, err := sc.SyscallConn()
+	if err != nil {
+		return fallbackCopy(trace, log, "Copy", dst, src, nil)
+	}
+
+	if isRegularFile(sraw) {
+		handled, n, err := sendfile(draw, sraw)
+		if handled {
+			return n, mapErrno(err)
+		}
+	} else if SpliceSupported() {
+		handled, n, err := relay(draw, sraw, trace)
+		if handled {
+			return n, mapErrno(err)
+		}
+	}
+
+	return fallbackCopy(trace, log, "Copy", dst, src, nil)
+}
+
+func isRegularFile(rc syscall.RawConn) bool {
+	var (
+		st      unix.Stat_t
+		statErr error
+	)
+	err := rc.Control(func(fd uintptr) {
+		statErr = unix.Fstat(int(fd), &st)
+	})
+	if err != nil || statErr != nil {
+		return false
+	}
+	return st.Mode&unix.S_IFMT == unix.S_IFREG
+}
+
+// sendfile copies from the regular file backing src to dst using sendfile(2).
+// The file offset of src is advanced by the number of bytes copied.
+func sendfile(dst, src syscall.RawConn) (bool, int64, error) {
+	var (
+		copied  int64
+		sendErr error
+	)
+
+	err := src.Control(func(sfd uintptr) {
+		for {
+			var n int
+			werr := dst.Write(func(wfd uintptr) bool {
+				n, sendErr = unix.Sendfile(int(wfd), int(sfd), nil, maxSendfileSize)
+				if n > 0 {
+					copied += int64(n)
+				}
+				if sendErr == unix.EINTR {
+					return false
+				}
+				return sendErr != unix.EAGAIN
+			})
+			if werr != nil {
+				sendErr = werr
+			}
+			if sendErr != nil || n == 0 {
+				return
+			}
+		}
+	})
+	if err != nil {
+		return copied > 0, copied, err
+	}
+
+	if sendErr != nil && copied == 0 {
+		// Let the caller fallback to a userspace copy.
+		return false, 0, sendErr
+	}
+	return true, copied, sendErr
+}
+
+// relay splices data from src to dst through an intermediate pipe.
+// This allows zero-copy transfers between two file descriptors where neither
+// side is a pipe, such as two sockets.
+func relay(dst, src syscall.RawConn, trace *SpliceTrace) (_ bool, copied int64, retErr error) {
+	buf, err := pipeBufs.get()
+	if err != nil {
+		return false, 0, fmt.Errorf("error creating pipe buffer: %w", err)
+	}
+	defer pipeBufs.put(buf)
+
+	trace.spliceStart()
+	defer func() { trace.spliceDone(copied, retErr) }()
+
+	for {
+		n, err := spliceFromConn(src, buf.wfd)
+		if err != nil {
+			return copied > 0, copied, err
+		}
+		if n == 0 {
+			return true, copied, nil
+		}
+
+		written, err := spliceToConn(buf.rfd, dst, n)
+		copied += written
+		if err != nil {
+			// Data has already been pulled from src so this must be
+			// reported as handled.
+			return true, copied, err
+		}
+	}
+}
+
+// CopyN copies exactly n bytes from src to dst using splice(2).
+// It returns the number of bytes copied and the earliest error encountered.
+// On return, written == n if and only if err == nil.
+// If src reaches EOF before n bytes are copied, io.EOF is returned.
+//
+// This mirrors io.CopyN, except the data never enters userspace.
+func CopyN(dst *PipeWriter, src *PipeReader, n int64) (int64, error) {
+	written, err := copyN(dst, src, n)
+	src.addRead(written)
+	dst.addWritten(written)
+	return written, dst.writeResult(err)
+}
+
+func copyN(dst *PipeWriter, src *PipeReader, n int64) (written int64, _ error) {
+	if n <= 0 {
+		return 0, nil
+	}
+
+	if !SpliceSupported() {
+		return copyNBuffer(dst.fd, src.fd, n)
+	}
+
+	rc, err := src.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	wc, err := dst.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		spliceErr error
+		writeErr  error
+	)
+
+	err = rc.Read(func(rfd uintptr) bool {
+		writeErr = wc.Write(func(wfd uintptr) bool {
+			var m int64
+			m, spliceErr = splice(int(rfd), int(wfd), n-written)
+			written += m
+			if spliceErr != unix.EAGAIN {
+				return true
+			}
+
+			// splice(2) does not tell us which side would block.
+			// If the reader still has data then it must be the writer that is
+			// full, so wait for it to become writable. Otherwise go back to
+			// waiting on the reader.
+			avail, err := unix.IoctlGetInt(int(rfd), unix.TIOCINQ) // FIONREAD
+			return err != nil || avail == 0
+		})
+		if writeErr != nil {
+			return true
+		}
+		if spliceErr == unix.EAGAIN {
+			return written >= n
+		}
+		return true
+	})
+
+	switch {
+	case err != nil:
+		return written, err
+	case writeErr != nil:
+		return written, writeErr
+	case spliceErr != nil && spliceErr != unix.EAGAIN:
+		return written, spliceErr
+	case written < n:
+		return written, io.EOF
+	}
+	return written, nil
+}
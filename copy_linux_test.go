@@ -0,0 +1,350 @@
+package pipes
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func newTCPPair(t testing.TB) (*net.TCPConn, *net.TCPConn) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	chConn := make(chan net.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			t.Error(err)
+		}
+		chConn <- c
+	}()
+
+	c1, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2 := <-chConn
+	if c2 == nil {
+		c1.Close()
+		t.FailNow()
+	}
+
+	t.Cleanup(func() {
+		c1.Close()
+		c2.Close()
+	})
+
+	return c1.(*net.TCPConn), c2.(*net.TCPConn)
+}
+
+func TestCopy(t *testing.T) {
+	data := bytes.Repeat([]byte("hello world"), 1e5)
+
+	t.Run("file to socket", func(t *testing.T) {
+		f := createFile(t)
+		if _, err := f.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		f.Seek(0, io.SeekStart)
+
+		c1, c2 := newTCPPair(t)
+
+		chBuf := make(chan []byte, 1)
+		go func() {
+			buf, _ := io.ReadAll(c2)
+			chBuf <- buf
+		}()
+
+		n, err := Copy(c1, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(len(data)) {
+			t.Fatalf("expected %d bytes, got %d", len(data), n)
+		}
+		c1.CloseWrite()
+
+		if buf := <-chBuf; !bytes.Equal(buf, data) {
+			t.Fatalf("got unexpected data: %d bytes", len(buf))
+		}
+	})
+
+	t.Run("socket to socket", func(t *testing.T) {
+		src1, src2 := newTCPPair(t)
+		dst1, dst2 := newTCPPair(t)
+
+		go func() {
+			src1.Write(data)
+			src1.CloseWrite()
+		}()
+
+		chBuf := make(chan []byte, 1)
+		go func() {
+			buf, _ := io.ReadAll(dst2)
+			chBuf <- buf
+		}()
+
+		n, err := Copy(dst1, src2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(len(data)) {
+			t.Fatalf("expected %d bytes, got %d", len(data), n)
+		}
+		dst1.CloseWrite()
+
+		if buf := <-chBuf; !bytes.Equal(buf, data) {
+			t.Fatalf("got unexpected data: %d bytes", len(buf))
+		}
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		n, err := Copy(buf, strings.NewReader("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 5 || buf.String() != "hello" {
+			t.Fatalf("unexpected copy result: %d, %q", n, buf)
+		}
+	})
+
+	t.Run("file to pipe", func(t *testing.T) {
+		f := createFile(t)
+		if _, err := f.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		f.Seek(0, io.SeekStart)
+
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+
+		chBuf := make(chan []byte, 1)
+		go func() {
+			buf, _ := io.ReadAll(r)
+			chBuf <- buf
+		}()
+
+		n, err := Copy(w, f)
+		w.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(len(data)) {
+			t.Fatalf("expected %d bytes, got %d", len(data), n)
+		}
+		if buf := <-chBuf; !bytes.Equal(buf, data) {
+			t.Fatalf("got unexpected data: %d bytes", len(buf))
+		}
+	})
+}
+
+func TestCopyN(t *testing.T) {
+	r1, w1 := newPipe(t)
+	r2, w2 := newPipe(t)
+
+	data := bytes.Repeat([]byte("hello world"), 1e4)
+
+	go func() {
+		w1.Write(data)
+		w1.Close()
+	}()
+
+	chBuf := make(chan []byte, 1)
+	go func() {
+		buf, _ := io.ReadAll(r2)
+		chBuf <- buf
+	}()
+
+	n, err := CopyN(w2, r1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Fatalf("expected 5 bytes, got %d", n)
+	}
+
+	n, err = CopyN(w2, r1, int64(len(data)))
+	if err != io.EOF {
+		t.Fatalf("expected EOF, got: %v", err)
+	}
+	if n != int64(len(data)-5) {
+		t.Fatalf("expected %d bytes, got %d", len(data)-5, n)
+	}
+	w2.Close()
+
+	if buf := <-chBuf; !bytes.Equal(buf, data) {
+		t.Fatalf("got unexpected data: %d bytes", len(buf))
+	}
+}
+
+// allocBytesPerRun returns the average number of bytes allocated by f.
+// Unlike testing.AllocsPerRun it catches a few large buffers being allocated
+// among small unrelated allocations.
+func allocBytesPerRun(runs int, f func()) uint64 {
+	var before, after runtime.MemStats
+	f()
+	runtime.ReadMemStats(&before)
+	for i := 0; i < runs; i++ {
+		f()
+	}
+	runtime.ReadMemStats(&after)
+	return (after.TotalAlloc - before.TotalAlloc) / uint64(runs)
+}
+
+func TestFallbackCopyAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the buffer pool drops buffers with the race detector on")
+	}
+
+	// Hide the WriterTo and ReaderFrom implementations so the data goes
+	// through a userspace buffer.
+	data := strings.Repeat("x", 3*defaultBufSize)
+	src := strings.NewReader(data)
+	var r io.Reader = struct{ io.Reader }{src}
+	var w io.Writer = struct{ io.Writer }{ioutil.Discard}
+
+	// io.Copy would allocate a 32K buffer for every copy, through the
+	// ReadFrom and WriteTo methods of the *os.File.
+	const limit = 16 * 1024
+
+	t.Run("ReadFrom", func(t *testing.T) {
+		pr, pw := newPipe(t)
+		go func() {
+			buf := make([]byte, defaultBufSize)
+			for {
+				if _, err := pr.Read(buf); err != nil {
+					return
+				}
+			}
+		}()
+
+		n := allocBytesPerRun(20, func() {
+			src.Seek(0, io.SeekStart)
+			if _, err := pw.ReadFrom(r); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if n >= limit {
+			t.Fatalf("expected the copy buffer to be pooled, got %d bytes allocated per copy", n)
+		}
+	})
+
+	t.Run("WriteTo", func(t *testing.T) {
+		chunk := []byte(data[:defaultBufSize])
+		n := allocBytesPerRun(20, func() {
+			pr, pw := newPipe(t)
+			go func() {
+				for i := 0; i < 3; i++ {
+					pw.Write(chunk)
+				}
+				pw.Close()
+			}()
+			if _, err := pr.WriteTo(w); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if n >= limit {
+			t.Fatalf("expected the copy buffer to be pooled, got %d bytes allocated per copy", n)
+		}
+	})
+}
+
+func TestCopyNBuffer(t *testing.T) {
+	src := strings.NewReader(strings.Repeat("x", 3*defaultBufSize))
+	var dst bytes.Buffer
+	var r io.Reader = struct{ io.Reader }{src}
+	var w io.Writer = struct{ io.Writer }{&dst}
+
+	n, err := copyNBuffer(w, r, 5)
+	if err != nil || n != 5 || dst.String() != "xxxxx" {
+		t.Fatalf("unexpected CopyN result: %d %v %q", n, err, dst.String())
+	}
+	src.Seek(0, io.SeekStart)
+	n, err = copyNBuffer(w, r, 4*defaultBufSize)
+	if err != io.EOF || n != 3*defaultBufSize {
+		t.Fatalf("expected EOF after %d bytes, got: %d %v", 3*defaultBufSize, n, err)
+	}
+}
+
+func TestVecCopy(t *testing.T) {
+	r1, w1 := newPipe(t)
+	r2, w2 := newPipe(t)
+
+	if handled, _, _ := vecCopy(struct{ io.Writer }{w2}, r1); handled {
+		t.Fatal("expected a writer without an fd not to be handled")
+	}
+
+	data := bytes.Repeat([]byte("0123456789"), vecCopyBufs*defaultBufSize/5)
+	go func() {
+		w1.Write(data)
+		w1.Close()
+	}()
+
+	type result struct {
+		buf []byte
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		buf, err := io.ReadAll(r2)
+		ch <- result{buf, err}
+	}()
+
+	before := Syscalls()
+	handled, n, err := vecCopy(w2, r1)
+	if !handled || err != nil {
+		t.Fatalf("expected copy to be handled, got: %v %v", handled, err)
+	}
+	if n != int64(len(data)) {
+		t.Fatalf("expected %d bytes copied, got %d", len(data), n)
+	}
+	w2.Close()
+	if reads := Syscalls().Reads - before.Reads; reads < 1 {
+		t.Fatalf("expected the readv calls to be counted, got %d", reads)
+	}
+
+	res := <-ch
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	if !bytes.Equal(res.buf, data) {
+		t.Fatal("copied data does not match")
+	}
+}
+
+func TestUseVecCopy(t *testing.T) {
+	f := createFile(t)
+	c1, _ := newTCPPair(t)
+	_, w := newPipe(t)
+
+	for _, tc := range []struct {
+		name     string
+		dst      io.Writer
+		src      io.Reader
+		expected bool
+	}{
+		{"files", w.fd, f, true},
+		{"plain", struct{ io.Writer }{c1}, struct{ io.Reader }{f}, true},
+		{"reader from", c1, f, false},
+		{"writer to", struct{ io.Writer }{c1}, f, false},
+		{"pipe writer", w, struct{ io.Reader }{f}, false},
+	} {
+		if useVecCopy(tc.dst, tc.src) != tc.expected {
+			t.Errorf("%s: expected useVecCopy to be %v", tc.name, tc.expected)
+		}
+	}
+}
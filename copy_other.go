@@ -0,0 +1,78 @@
+//go:build !linux
+// +build !linux
+
+package pipes
+
+import (
+	"context"
+	"io"
+)
+
+// Copy copies from src to dst until EOF is reached on src or an error occurs.
+// There are no zero-copy strategies available on this platform so this
+// copies through pooled userspace buffers, using readv(2) and writev(2) when
+// both sides are backed by fds.
+func Copy(dst io.Writer, src io.Reader) (int64, error) {
+	return userCopy(dst, src)
+}
+
+// CopyContext is like Copy, but calls the hooks of the SpliceTrace attached
+// to ctx (see WithSpliceTrace). Since every copy goes through a userspace
+// buffer on this platform, only FallbackTaken is ever called.
+// ctx is only used for tracing, it does not cancel the copy.
+func CopyContext(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	ContextSpliceTrace(ctx).fallbackTaken("Copy")
+	return Copy(dst, src)
+}
+
+// CopyN copies exactly n bytes from src to dst.
+// It returns the number of bytes copied and the earliest error encountered.
+// On return, written == n if and only if err == nil.
+// If src reaches EOF before n bytes are copied, io.EOF is returned.
+func CopyN(dst *PipeWriter, src *PipeReader, n int64) (int64, error) {
+	written, err := copyNBuffer(dst.fd, src.fd, n)
+	src.addRead(written)
+	dst.addWritten(written)
+	return written, dst.writeResult(err)
+}
+
+// TeeCopy copies everything from r to all of the passed in writers until r
+// returns EOF.
+// tee(2) is not available on this platform so data is copied through a
+// pooled userspace buffer.
+//
+// If a writer fails it is dropped and copying continues with the remaining
+// writers. The returned results are in the same order as the writers.
+// The returned error is only set for errors reading from r.
+func TeeCopy(r *PipeReader, writers ...*PipeWriter) ([]TeeResult, error) {
+	return teeCopyBuffer(r, writers)
+}
+
+// WriteBuffers writes the contents of bufs to the pipe.
+// vmsplice(2) is not available on this platform so each buffer is written
+// with a regular write.
+func (w *PipeWriter) WriteBuffers(bufs [][]byte) (int64, error) {
+	var written int64
+	for _, b := range bufs {
+		n, err := w.Write(b)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// BorrowPipe returns a new pipe.
+// There is no pool of pipes on this platform, so this is the same as New.
+//
+// The pipe should be returned with ReturnPipe when done.
+func BorrowPipe() (*PipeReader, *PipeWriter, error) {
+	return New()
+}
+
+// ReturnPipe closes a pipe obtained from BorrowPipe.
+func ReturnPipe(r *PipeReader, w *PipeWriter) {
+	r.Close()
+	w.Close()
+}
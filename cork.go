@@ -0,0 +1,200 @@
+package pipes
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultCorkSize is the default Size of a CorkedWriter. It is PIPE_BUF on
+// Linux, whatever the page size.
+const defaultCorkSize = 4096
+
+// CorkedWriter coalesces small writes to a PipeWriter into larger chunks,
+// which saves a syscall and a wakeup of the reader for every small write of a
+// chatty producer.
+//
+// Data is buffered until Size bytes have been written, Delay has passed since
+// the first byte was buffered, or Flush or Close is called.
+// Writes of at least Size bytes are not coalesced, they are written out
+// along with anything already buffered using a single writev(2) where
+// available.
+//
+// With the default Size, each chunk is at most PIPE_BUF bytes on Linux, so
+// chunks are still written atomically, but a single write may be split
+// between two chunks and so may be interleaved with other writers.
+//
+// A CorkedWriter is safe for concurrent use. Once writing to the pipe fails
+// the error is returned by all further calls.
+type CorkedWriter struct {
+	// Size is the number of bytes buffered before they are written to the
+	// pipe. If zero, 4096 bytes are used.
+	// It must not be changed after the first write.
+	Size int
+
+	// Delay is the longest time data is buffered before it is written to
+	// the pipe. If zero, data is only written once Size bytes are buffered,
+	// or on Flush or Close.
+	Delay time.Duration
+
+	w *PipeWriter
+
+	mu    sync.Mutex
+	buf   []byte
+	timer *time.Timer
+	armed bool
+	err   error
+}
+
+// NewCorkedWriter creates a CorkedWriter which writes to w.
+func NewCorkedWriter(w *PipeWriter) *CorkedWriter {
+	return &CorkedWriter{w: w}
+}
+
+func (c *CorkedWriter) size() int {
+	if c.Size > 0 {
+		return c.Size
+	}
+	return defaultCorkSize
+}
+
+// Write buffers p, writing out the buffer to the pipe whenever it fills up.
+func (c *CorkedWriter) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	size := c.size()
+	if len(p) >= size {
+		return c.writeThrough(p)
+	}
+
+	if c.buf == nil {
+		c.buf = make([]byte, 0, size)
+	}
+
+	var n int
+	for n < len(p) {
+		m := copy(c.buf[len(c.buf):size], p[n:])
+		c.buf = c.buf[:len(c.buf)+m]
+		n += m
+		if len(c.buf) == size {
+			if err := c.flushLocked(); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	if len(c.buf) > 0 {
+		c.arm()
+	}
+	return n, nil
+}
+
+// writeThrough writes p to the pipe, after anything already buffered.
+func (c *CorkedWriter) writeThrough(p []byte) (int, error) {
+	if len(c.buf) == 0 {
+		n, err := c.w.Write(p)
+		if err != nil {
+			c.err = err
+		}
+		return n, err
+	}
+
+	buffered := int64(len(c.buf))
+	total, err := c.w.WriteVec([][]byte{c.buf, p})
+	c.buf = c.buf[:0]
+	c.disarm()
+
+	n := total - buffered
+	if n < 0 {
+		n = 0
+	}
+	if err != nil {
+		c.err = err
+	}
+	return int(n), err
+}
+
+// Flush writes out any buffered data to the pipe.
+func (c *CorkedWriter) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+	return c.flushLocked()
+}
+
+func (c *CorkedWriter) flushLocked() error {
+	c.disarm()
+	if len(c.buf) == 0 {
+		return nil
+	}
+
+	_, err := c.w.Write(c.buf)
+	c.buf = c.buf[:0]
+	if err != nil {
+		c.err = err
+	}
+	return err
+}
+
+// arm starts the timer for flushing the buffer after Delay, unless it is
+// already running.
+func (c *CorkedWriter) arm() {
+	if c.Delay <= 0 || c.armed {
+		return
+	}
+	c.armed = true
+	if c.timer == nil {
+		c.timer = time.AfterFunc(c.Delay, c.flushTimer)
+		return
+	}
+	c.timer.Reset(c.Delay)
+}
+
+func (c *CorkedWriter) disarm() {
+	if c.armed {
+		c.timer.Stop()
+		c.armed = false
+	}
+}
+
+func (c *CorkedWriter) flushTimer() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The buffer may have been flushed, and even refilled, since the timer
+	// fired. Flushing early does no harm.
+	c.armed = false
+	if c.err == nil {
+		c.flushLocked()
+	}
+}
+
+// Close flushes any buffered data and closes the PipeWriter.
+// Further writes fail with ErrAlreadyClosed.
+func (c *CorkedWriter) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var flushErr error
+	if c.err == nil {
+		flushErr = c.flushLocked()
+	}
+	c.disarm()
+	if c.err == ErrAlreadyClosed {
+		return ErrAlreadyClosed
+	}
+	c.err = ErrAlreadyClosed
+
+	closeErr := c.w.Close()
+	if flushErr != nil {
+		return flushErr
+	}
+	return closeErr
+}
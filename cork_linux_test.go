@@ -0,0 +1,154 @@
+package pipes
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+// waitBuffered waits until n bytes are buffered in the pipe.
+func waitBuffered(t *testing.T, r *PipeReader, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := r.Buffered()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d bytes buffered in the pipe, got %d", n, got)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCorkedWriter(t *testing.T) {
+	t.Run("size", func(t *testing.T) {
+		r, w := newPipe(t)
+		c := NewCorkedWriter(w)
+		c.Size = 100
+
+		msg := []byte("0123456789")
+		for i := 0; i < 25; i++ {
+			if _, err := c.Write(msg); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Only the full chunks have made it to the pipe.
+		waitBuffered(t, r, 200)
+
+		if err := c.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		waitBuffered(t, r, 250)
+
+		buf := make([]byte, 250)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, bytes.Repeat(msg, 25)) {
+			t.Fatalf("unexpected data: %q", buf)
+		}
+	})
+
+	t.Run("default size", func(t *testing.T) {
+		r, w := newPipe(t)
+		c := NewCorkedWriter(w)
+
+		// PIPE_BUF, whatever the page size.
+		if _, err := c.Write(make([]byte, 4095)); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := r.Buffered(); err != nil || n != 0 {
+			t.Fatalf("expected the write to be held back, got %d bytes buffered: %v", n, err)
+		}
+		if _, err := c.Write([]byte("x")); err != nil {
+			t.Fatal(err)
+		}
+		waitBuffered(t, r, 4096)
+	})
+
+	t.Run("delay", func(t *testing.T) {
+		r, w := newPipe(t)
+		c := NewCorkedWriter(w)
+		c.Delay = 20 * time.Millisecond
+
+		if _, err := c.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := r.Buffered(); err != nil || n != 0 {
+			t.Fatalf("expected the write to be held back, got %d bytes buffered: %v", n, err)
+		}
+		waitBuffered(t, r, 5)
+
+		// The timer is started again for the next write.
+		if _, err := c.Write([]byte("world")); err != nil {
+			t.Fatal(err)
+		}
+		waitBuffered(t, r, 10)
+	})
+
+	t.Run("large write", func(t *testing.T) {
+		r, w := newPipe(t)
+		c := NewCorkedWriter(w)
+		c.Size = 10
+
+		if _, err := c.Write([]byte("abc")); err != nil {
+			t.Fatal(err)
+		}
+		n, err := c.Write([]byte("0123456789"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 10 {
+			t.Fatalf("expected 10 bytes written, got %d", n)
+		}
+		// Written right away, along with what was buffered.
+		waitBuffered(t, r, 13)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		r, w := newPipe(t)
+		c := NewCorkedWriter(w)
+
+		if _, err := c.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Write([]byte("hello")); err != ErrAlreadyClosed {
+			t.Fatalf("expected ErrAlreadyClosed, got: %v", err)
+		}
+
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "hello" {
+			t.Fatalf("unexpected data: %q", data)
+		}
+	})
+
+	t.Run("sticky error", func(t *testing.T) {
+		r, w := newPipe(t)
+		c := NewCorkedWriter(w)
+		r.Close()
+
+		if _, err := c.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		err := c.Flush()
+		if err == nil {
+			t.Fatal("expected flush to fail with the reader closed")
+		}
+		if _, err2 := c.Write([]byte("hello")); err2 != err {
+			t.Fatalf("expected %v, got: %v", err, err2)
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package pipes
+
+import "io"
+
+// Discard skips the next n bytes from the pipe, returning the number of
+// bytes discarded. It waits for data the same as Read, and returns io.EOF if
+// the pipe reaches EOF before n bytes have been discarded.
+//
+// Where splice(2) is supported the data is spliced to /dev/null, so it never
+// enters userspace. This makes skipping large payloads cheap.
+func (r *PipeReader) Discard(n int64) (int64, error) {
+	if n <= 0 {
+		return 0, nil
+	}
+
+	discarded, err := r.discard(n)
+	r.addRead(discarded)
+	return discarded, r.readResult(mapErrno(err))
+}
+
+// Drain consumes everything left in the pipe until EOF, returning the number
+// of bytes discarded. This is for protocol handlers which have to get rid of
+// the remainder of a stream before closing, so the writer does not block or
+// fail with EPIPE.
+// Reaching EOF is not an error.
+//
+// Like Discard, the data is spliced to /dev/null where splice(2) is
+// supported.
+func (r *PipeReader) Drain() (int64, error) {
+	return r.copyResult(r.discard(0))
+}
+
+// discardBuffer discards n bytes, or everything until EOF if n is 0, by
+// reading them into a pooled buffer.
+func (r *PipeReader) discardBuffer(n int64) (int64, error) {
+	if n <= 0 {
+		return copyBuffer(io.Discard, r.fd)
+	}
+	discarded, err := copyNBuffer(io.Discard, r.fd, n)
+	if err == nil && discarded < n {
+		err = io.EOF
+	}
+	return discarded, err
+}
@@ -0,0 +1,75 @@
+package pipes
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// devNull is /dev/null opened for writing, which discarded data is spliced
+// to. It is opened on first use and kept open.
+var devNull struct {
+	once sync.Once
+	fd   int
+	err  error
+}
+
+func devNullFD() (int, error) {
+	devNull.once.Do(func() {
+		devNull.fd, devNull.err = unix.Open(os.DevNull, unix.O_WRONLY|unix.O_CLOEXEC, 0)
+		if devNull.err != nil {
+			devNull.err = &os.PathError{Op: "open", Path: os.DevNull, Err: devNull.err}
+		}
+	})
+	return devNull.fd, devNull.err
+}
+
+// discard splices n bytes, or everything until EOF if n is 0, from the pipe
+// to /dev/null, falling back to reading them if that is not possible.
+func (r *PipeReader) discard(n int64) (int64, error) {
+	if !SpliceSupported() {
+		return r.discardBuffer(n)
+	}
+	null, err := devNullFD()
+	if err != nil {
+		return r.discardBuffer(n)
+	}
+
+	rc, err := r.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		discarded int64
+		spliceErr error
+	)
+	err = rc.Read(func(rfd uintptr) bool {
+		var remain, m int64
+		if n > 0 {
+			remain = n - discarded
+		}
+		m, spliceErr = doSplice(int(rfd), nil, null, nil, remain, DefaultSpliceFlags, nil, nil, nil)
+		discarded += m
+		if spliceErr == unix.EAGAIN {
+			return n > 0 && discarded >= n
+		}
+		return true
+	})
+
+	switch {
+	case err != nil:
+		return discarded, err
+	case spliceErr == unix.EAGAIN:
+	case discarded == 0 && isSpliceUnsupported(spliceErr):
+		return r.discardBuffer(n)
+	case spliceErr != nil:
+		return discarded, spliceErr
+	}
+	if n > 0 && discarded < n {
+		return discarded, io.EOF
+	}
+	return discarded, nil
+}
@@ -0,0 +1,104 @@
+package pipes
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestDiscard(t *testing.T) {
+	t.Run("skip", func(t *testing.T) {
+		r, w := newPipe(t)
+
+		if _, err := w.Write([]byte("skip me, keep me")); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+
+		n, err := r.Discard(int64(len("skip me, ")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 9 {
+			t.Fatalf("expected 9 bytes discarded, got %d", n)
+		}
+
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "keep me" {
+			t.Fatalf("unexpected data: %q", data)
+		}
+		if r.BytesRead() != 16 {
+			t.Fatalf("expected discarded bytes to count as read, got %d", r.BytesRead())
+		}
+	})
+
+	t.Run("waits for data", func(t *testing.T) {
+		r, w := newPipe(t)
+
+		go func() {
+			for _, s := range []string{"hello", " ", "world"} {
+				time.Sleep(10 * time.Millisecond)
+				w.Write([]byte(s))
+			}
+		}()
+
+		r.fd.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, err := r.Discard(11)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 11 {
+			t.Fatalf("expected 11 bytes discarded, got %d", n)
+		}
+		if buffered, _ := r.Buffered(); buffered != 0 {
+			t.Fatalf("expected nothing left in the pipe, got %d bytes", buffered)
+		}
+	})
+
+	t.Run("eof", func(t *testing.T) {
+		r, w := newPipe(t)
+
+		if _, err := w.Write([]byte("short")); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+
+		n, err := r.Discard(100)
+		if err != io.EOF {
+			t.Fatalf("expected io.EOF, got: %v", err)
+		}
+		if n != 5 {
+			t.Fatalf("expected 5 bytes discarded, got %d", n)
+		}
+	})
+}
+
+func TestDrain(t *testing.T) {
+	r, w := newPipe(t)
+
+	data := make([]byte, 256<<10)
+	go func() {
+		// More than fits in the pipe, so this only returns once the pipe is
+		// being drained.
+		w.Write(data)
+		w.Close()
+	}()
+
+	r.fd.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := r.Drain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) {
+		t.Fatalf("expected %d bytes drained, got %d", len(data), n)
+	}
+
+	// Draining at EOF is not an error.
+	n, err = r.Drain()
+	if err != nil || n != 0 {
+		t.Fatalf("expected nothing left to drain, got %d: %v", n, err)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package pipes
+
+// discard reads n bytes, or everything until EOF if n is 0, from the pipe and
+// throws them away, since splice(2) is not available on this platform.
+func (r *PipeReader) discard(n int64) (int64, error) {
+	return r.discardBuffer(n)
+}
@@ -0,0 +1,94 @@
+package pipes
+
+import (
+	"context"
+	"io"
+	"os"
+	"syscall"
+)
+
+// Duplex is one end of a bidirectional pipe created with NewDuplex.
+// Data written to one end is read from the other end, and vice versa.
+//
+// Both the PipeReader and PipeWriter refer to the same underlying file, so
+// closing either one closes the whole endpoint. Use CloseRead and CloseWrite
+// to shut down a single direction.
+type Duplex struct {
+	*PipeReader
+	*PipeWriter
+}
+
+func newDuplex(fd *os.File) *Duplex {
+	// Only the reader is tracked for leaks, both ends share the same file.
+	return &Duplex{PipeReader: newReader(fd), PipeWriter: &PipeWriter{fd: fd}}
+}
+
+// Close closes the endpoint.
+func (d *Duplex) Close() error {
+	d.PipeWriter.notify.stop()
+	return d.PipeReader.Close()
+}
+
+func (d *Duplex) SyscallConn() (syscall.RawConn, error) {
+	return d.PipeReader.SyscallConn()
+}
+
+// NewDuplexFifo opens a bidirectional connection made of two fifos, one for
+// each direction. The fifo at rp is read from and the fifo at wp is written
+// to, so the peer must call NewDuplexFifo with the paths swapped.
+// Either fifo is created with the passed in mode if it does not exist yet.
+//
+// The ends are opened in an order which can not deadlock regardless of which
+// side shows up first: the read end is opened without blocking, then the
+// write end is opened once the peer has opened its read end. Each side then
+// writes a handshake byte and waits for the one from its peer, so that reads
+// on the returned connection do not see EOF before the peer has connected.
+//
+// NewDuplexFifo returns once the peer is connected, or ctx is done.
+func NewDuplexFifo(ctx context.Context, rp, wp string, mode os.FileMode) (_ *FifoConn, retErr error) {
+	for _, p := range []string{rp, wp} {
+		if err := mkfifo(p, mode); err != nil && !os.IsExist(err) {
+			return nil, err
+		}
+	}
+
+	r, err := openReader(rp)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if retErr != nil {
+			r.Close()
+		}
+	}()
+
+	w, err := openWriterRetry(ctx, wp)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if retErr != nil {
+			w.Close()
+		}
+	}()
+
+	// This can not block since nothing else is written to the fifo yet.
+	if _, err := w.Write([]byte{0}); err != nil {
+		return nil, err
+	}
+	if err := readHandshake(ctx, r); err != nil {
+		return nil, err
+	}
+
+	return &FifoConn{PipeReader: newReader(r), PipeWriter: newWriter(w)}, nil
+}
+
+// readHandshake waits for the peer to write a handshake byte to r, which was
+// opened with openReader, and consumes it.
+func readHandshake(ctx context.Context, r *os.File) error {
+	if err := waitWriterContext(ctx, r); err != nil {
+		return err
+	}
+	_, err := io.ReadFull(r, make([]byte, 1))
+	return err
+}
@@ -0,0 +1,198 @@
+package pipes
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDuplex(t *testing.T) {
+	a, b, err := NewDuplex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	defer b.Close()
+
+	roundTrip := func(t *testing.T, from, to *Duplex, msg string) {
+		t.Helper()
+
+		if _, err := from.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, len(msg))
+		if _, err := io.ReadFull(to, buf); err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != msg {
+			t.Fatalf("expected %q, got %q", msg, buf)
+		}
+	}
+
+	roundTrip(t, a, b, "request")
+	roundTrip(t, b, a, "response")
+
+	t.Run("splice", func(t *testing.T) {
+		r, w := newPipe(t)
+		if _, err := w.Write([]byte("spliced")); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+
+		if _, err := a.ReadFrom(r); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 7)
+		if _, err := io.ReadFull(b, buf); err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != "spliced" {
+			t.Fatalf("expected spliced, got %q", buf)
+		}
+	})
+
+	t.Run("close write", func(t *testing.T) {
+		if err := a.CloseWrite(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := b.Read(make([]byte, 1)); err != io.EOF {
+			t.Fatalf("expected io.EOF, got: %v", err)
+		}
+
+		// The other direction still works.
+		roundTrip(t, b, a, "still open")
+	})
+}
+
+func TestNewDuplexFifo(t *testing.T) {
+	dir := t.TempDir()
+	a2b := filepath.Join(dir, "a2b")
+	b2a := filepath.Join(dir, "b2a")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	type result struct {
+		c   *FifoConn
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		c, err := NewDuplexFifo(ctx, a2b, b2a, 0600)
+		ch <- result{c, err}
+	}()
+
+	// Give the peer a head start to make sure neither order deadlocks.
+	time.Sleep(10 * time.Millisecond)
+	a, err := NewDuplexFifo(ctx, b2a, a2b, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	res := <-ch
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	b := res.c
+	defer b.Close()
+
+	if _, err := a.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(b, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Fatalf("expected hello, got: %q", buf)
+	}
+
+	if _, err := b.Write([]byte("world")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(a, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "world" {
+		t.Fatalf("expected world, got: %q", buf)
+	}
+
+	b.Close()
+	if _, err := a.Read(buf); err != io.EOF {
+		t.Fatalf("expected EOF, got: %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := NewDuplexFifo(ctx, filepath.Join(dir, "c1"), filepath.Join(dir, "c2"), 0600); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded without a peer, got: %v", err)
+	}
+}
+
+func TestDuplexFifoHalfClose(t *testing.T) {
+	dir := t.TempDir()
+	a2b := filepath.Join(dir, "a2b")
+	b2a := filepath.Join(dir, "b2a")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ch := make(chan *FifoConn, 1)
+	go func() {
+		c, err := NewDuplexFifo(ctx, a2b, b2a, 0600)
+		if err != nil {
+			t.Error(err)
+		}
+		ch <- c
+	}()
+
+	client, err := NewDuplexFifo(ctx, b2a, a2b, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	server := <-ch
+	if server == nil {
+		t.FailNow()
+	}
+	defer server.Close()
+
+	if _, err := client.Write([]byte("request")); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := io.ReadAll(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(req) != "request" {
+		t.Fatalf("expected request, got: %q", req)
+	}
+
+	if _, err := server.Write([]byte("response")); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp) != "response" {
+		t.Fatalf("expected response, got: %q", resp)
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatalf("expected Close after CloseWrite to succeed, got: %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package pipes
+
+// NewDuplex is not supported on this platform and always returns
+// ErrNotSupported.
+func NewDuplex() (*Duplex, *Duplex, error) {
+	return nil, nil, ErrNotSupported
+}
+
+// CloseRead is not supported on this platform and always returns
+// ErrNotSupported.
+func (d *Duplex) CloseRead() error {
+	return ErrNotSupported
+}
+
+// CloseWrite is not supported on this platform and always returns
+// ErrNotSupported.
+func (d *Duplex) CloseWrite() error {
+	return ErrNotSupported
+}
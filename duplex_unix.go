@@ -0,0 +1,54 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package pipes
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// NewDuplex creates a pair of connected bidirectional endpoints, useful for
+// request/response style communication without managing two pipes.
+//
+// The endpoints are backed by a unix socketpair(2), so data can still be
+// spliced in and out of them. Both ends are non-blocking and close-on-exec.
+func NewDuplex() (*Duplex, *Duplex, error) {
+	p, err := mkSocketpair()
+	if err != nil {
+		return nil, nil, os.NewSyscallError("socketpair", err)
+	}
+	return newDuplex(os.NewFile(uintptr(p[0]), "duplex")), newDuplex(os.NewFile(uintptr(p[1]), "duplex")), nil
+}
+
+// CloseRead shuts down the reading side of the endpoint.
+func (d *Duplex) CloseRead() error {
+	return d.shutdown(unix.SHUT_RD)
+}
+
+// CloseWrite shuts down the writing side of the endpoint.
+// The other end reads EOF once it has read all the data written before the
+// call.
+func (d *Duplex) CloseWrite() error {
+	return d.shutdown(unix.SHUT_WR)
+}
+
+func (d *Duplex) shutdown(how int) error {
+	rc, err := d.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var shutErr error
+	err = rc.Control(func(fd uintptr) {
+		shutErr = unix.Shutdown(int(fd), how)
+	})
+	if err != nil {
+		return err
+	}
+	if shutErr != nil {
+		return os.NewSyscallError("shutdown", shutErr)
+	}
+	return nil
+}
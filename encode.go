@@ -0,0 +1,118 @@
+package pipes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// EncodeFunc encodes v to w, such as EncodeJSON.
+type EncodeFunc func(w io.Writer, v interface{}) error
+
+// DecodeFunc decodes a value encoded by the matching EncodeFunc from r into
+// v, such as DecodeJSON.
+type DecodeFunc func(r io.Reader, v interface{}) error
+
+// EncodeJSON encodes v as JSON.
+func EncodeJSON(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// DecodeJSON decodes JSON into v.
+func DecodeJSON(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+// EncodeGob encodes v with encoding/gob. Each message carries its own type
+// information, so messages can be decoded independently.
+func EncodeGob(w io.Writer, v interface{}) error {
+	return gob.NewEncoder(w).Encode(v)
+}
+
+// DecodeGob decodes a message encoded with EncodeGob into v.
+func DecodeGob(r io.Reader, v interface{}) error {
+	return gob.NewDecoder(r).Decode(v)
+}
+
+// encodeHeaderSize is the size of the length prefix of encoded messages, the
+// same as a Framer using PrefixUint32.
+const encodeHeaderSize = 4
+
+var encodeBufPool = sync.Pool{
+	New: func() interface{} {
+		return bytes.NewBuffer(make([]byte, 0, defaultBufSize))
+	},
+}
+
+// EncodeTo encodes v with enc and writes it to w as a single frame.
+//
+// Encoders write their output in many small pieces, which makes for many
+// small writes (and wakeups of the reader) when writing to a pipe directly.
+// EncodeTo encodes into a pooled buffer sized to the default pipe capacity
+// and writes the whole message with one write, prefixed with its length so
+// DecodeFrom knows where it ends. Messages of up to PIPE_BUF bytes are not
+// interleaved with other writers.
+//
+// Messages larger than DefaultMaxFrameSize fail with ErrFrameTooLarge.
+// The framing is compatible with a Framer using PrefixUint32.
+func EncodeTo(w *PipeWriter, enc EncodeFunc, v interface{}) error {
+	buf := encodeBufPool.Get().(*bytes.Buffer)
+	defer func() {
+		// Don't keep buffers grown by unusually large messages around.
+		if buf.Cap() <= 4*defaultBufSize {
+			encodeBufPool.Put(buf)
+		}
+	}()
+
+	buf.Reset()
+	buf.Write(make([]byte, encodeHeaderSize))
+	if err := enc(buf, v); err != nil {
+		return err
+	}
+
+	b := buf.Bytes()
+	if len(b)-encodeHeaderSize > DefaultMaxFrameSize {
+		return ErrFrameTooLarge
+	}
+	binary.BigEndian.PutUint32(b, uint32(len(b)-encodeHeaderSize))
+	_, err := w.Write(b)
+	return err
+}
+
+// DecodeFrom reads a single message written by EncodeTo from r and decodes it
+// into v with dec.
+//
+// Only the bytes of the message are read from r, so other reads from r may
+// be mixed with calls to DecodeFrom. The message is read into a pooled buffer
+// when it fits in one. io.EOF is returned if r is at EOF before the message.
+func DecodeFrom(r *PipeReader, dec DecodeFunc, v interface{}) error {
+	var hdr [encodeHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return err
+	}
+
+	size := binary.BigEndian.Uint32(hdr[:])
+	if size > DefaultMaxFrameSize {
+		return ErrFrameTooLarge
+	}
+
+	var msg []byte
+	if size <= defaultBufSize {
+		buf := getBuf()
+		defer putBuf(buf)
+		msg = (*buf)[:size]
+	} else {
+		msg = make([]byte, size)
+	}
+
+	if _, err := io.ReadFull(r, msg); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return dec(bytes.NewReader(msg), v)
+}
@@ -0,0 +1,69 @@
+package pipes
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeToDecodeFrom(t *testing.T) {
+	type msg struct {
+		ID   int
+		Data string
+	}
+
+	codecs := map[string]struct {
+		enc EncodeFunc
+		dec DecodeFunc
+	}{
+		"json": {EncodeJSON, DecodeJSON},
+		"gob":  {EncodeGob, DecodeGob},
+	}
+
+	for name, c := range codecs {
+		t.Run(name, func(t *testing.T) {
+			r, w, err := New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			msgs := []msg{
+				{ID: 1, Data: "hello"},
+				{ID: 2, Data: strings.Repeat("x", 200<<10)},
+				{ID: 3, Data: "world"},
+			}
+
+			errCh := make(chan error, 1)
+			go func() {
+				defer w.Close()
+				for _, m := range msgs {
+					if err := EncodeTo(w, c.enc, m); err != nil {
+						errCh <- err
+						return
+					}
+				}
+				errCh <- nil
+			}()
+
+			for _, expected := range msgs {
+				var m msg
+				if err := DecodeFrom(r, c.dec, &m); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(m, expected) {
+					t.Fatalf("unexpected message %d", m.ID)
+				}
+			}
+			if err := <-errCh; err != nil {
+				t.Fatal(err)
+			}
+
+			var m msg
+			if err := DecodeFrom(r, c.dec, &m); err != io.EOF {
+				t.Fatalf("expected EOF, got: %v", err)
+			}
+		})
+	}
+}
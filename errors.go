@@ -0,0 +1,149 @@
+package pipes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// The errors below are returned consistently across the package, possibly
+// wrapped in an *os.PathError or *os.SyscallError, so they should be checked
+// with errors.Is.
+
+// ErrNotSupported is returned by functions which are not supported on the
+// current platform.
+var ErrNotSupported = errors.New("operation not supported on this platform")
+
+// ErrNotFifo is returned when opening a path which is expected to be a fifo,
+// but is something else, such as a regular file.
+var ErrNotFifo = errors.New("not a fifo")
+
+// ErrClosedPipe is returned when writing to a pipe whose read end has been
+// closed, or when using a stream which has been closed. It is the same as
+// io.ErrClosedPipe, so errors from this package can be handled the same way as
+// those from io.Pipe.
+// When the error comes from a syscall failing with EPIPE, whether write(2),
+// splice(2), tee(2) or vmsplice(2), the original error is wrapped so it can
+// still be checked with errors.Is(err, syscall.EPIPE).
+var ErrClosedPipe = io.ErrClosedPipe
+
+// ErrWouldBlock is returned by non-blocking operations, such as Splice and Tee
+// without a retry policy, when they cannot make progress without blocking.
+// It is the same as syscall.EAGAIN, so it also matches the errors returned by
+// the raw syscalls.
+var ErrWouldBlock error = syscall.EAGAIN
+
+// ErrAlreadyClosed is returned when closing a pipe end which has already been
+// closed. It matches os.ErrClosed, so callers which treat a double close as
+// harmless can check for either.
+var ErrAlreadyClosed = fmt.Errorf("pipe already closed: %w", os.ErrClosed)
+
+// ErrMessageTooLarge is returned by SendMsg when the message is larger than
+// MaxMessageSize.
+var ErrMessageTooLarge = errors.New("message too large")
+
+// multiError is used to report multiple errors as a single error.
+type multiError []error
+
+func (e multiError) Error() string {
+	s := make([]string, 0, len(e))
+	for _, err := range e {
+		s = append(s, err.Error())
+	}
+	return strings.Join(s, "; ")
+}
+
+func (e multiError) Unwrap() []error {
+	return e
+}
+
+// joinErrors combines the passed in errors into a single error, ignoring any
+// nil errors.
+// If there is only one error it is returned as is.
+func joinErrors(errs ...error) error {
+	var out multiError
+	for _, err := range errs {
+		if err != nil {
+			out = append(out, err)
+		}
+	}
+
+	switch len(out) {
+	case 0:
+		return nil
+	case 1:
+		return out[0]
+	default:
+		return out
+	}
+}
+
+// errnoError is an errno which also matches one of the package's sentinel
+// errors with errors.Is, such as EPIPE matching ErrClosedPipe.
+// It still matches the errno itself.
+type errnoError struct {
+	errno    syscall.Errno
+	sentinel error
+}
+
+func (e *errnoError) Error() string {
+	return e.errno.Error()
+}
+
+func (e *errnoError) Unwrap() error {
+	return e.errno
+}
+
+func (e *errnoError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+// mapErrno returns err wrapped so it matches the package's sentinel error
+// for its errno, if there is one:
+//
+//   - ENOSYS matches ErrNotSupported
+//   - EPIPE matches ErrClosedPipe, so writes to a pipe whose reader is gone
+//     fail the same way as with io.Pipe regardless of the syscall used
+//
+// The errno may be wrapped in an *os.PathError or *os.SyscallError, in which
+// case a copy with the errno replaced is returned.
+// Other errors are returned as is.
+func mapErrno(err error) error {
+	switch e := err.(type) {
+	case syscall.Errno:
+		switch e {
+		case syscall.ENOSYS:
+			return &errnoError{errno: e, sentinel: ErrNotSupported}
+		case syscall.EPIPE:
+			return &errnoError{errno: e, sentinel: ErrClosedPipe}
+		}
+	case *os.PathError:
+		if mapped := mapErrno(e.Err); mapped != e.Err {
+			return &os.PathError{Op: e.Op, Path: e.Path, Err: mapped}
+		}
+	case *os.SyscallError:
+		if mapped := mapErrno(e.Err); mapped != e.Err {
+			return &os.SyscallError{Syscall: e.Syscall, Err: mapped}
+		}
+	}
+	return err
+}
+
+// pathError wraps err in an *os.PathError for op on path, like the os package
+// does, so the error shows which file failed and during which operation.
+// An err which already is an *os.PathError is returned as is, and the syscall
+// of an *os.SyscallError is used as the op.
+func pathError(op, path string, err error) error {
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *os.PathError:
+		return e
+	case *os.SyscallError:
+		return &os.PathError{Op: e.Syscall, Path: path, Err: e.Err}
+	}
+	return &os.PathError{Op: op, Path: path, Err: err}
+}
@@ -0,0 +1,164 @@
+package pipes
+
+import (
+	"io"
+	"os"
+	"os/exec"
+)
+
+// AttachCmd sets the passed in pipe ends as the stdin, stdout, and stderr of
+// cmd. Any of them may be nil to leave the corresponding field of cmd alone.
+//
+// Most programs expect their stdio to be in blocking mode, while the pipes in
+// this package are non-blocking. Since the blocking mode is shared by every
+// fd referring to the same open file, simply handing the pipe to the child
+// would either leave the child with a non-blocking fd, or switch the pipe to
+// blocking mode for this process as well.
+// On Linux, AttachCmd gives the child its own blocking open file for the
+// pipe, so the ends kept by this process (including other fds opened on the
+// same fifo) stay non-blocking. On darwin and FreeBSD the child gets a
+// duplicate of the fd in blocking mode, which also affects the end passed
+// in, but not the other end of the pipe. Elsewhere pipes are always
+// blocking, and are handed to the child as is.
+//
+// The files handed to the child are closed along with the ends passed in,
+// which should be closed once cmd has started. The same writer may be passed
+// for both stdout and stderr, in which case the child gets the same file for
+// both.
+func AttachCmd(cmd *exec.Cmd, stdin *PipeReader, stdout, stderr *PipeWriter) error {
+	if stdin != nil {
+		f, err := childFile(stdin.fd, os.O_RDONLY)
+		if err != nil {
+			return err
+		}
+		if f != stdin.fd {
+			stdin.child = f
+		}
+		cmd.Stdin = f
+	}
+
+	if stdout != nil {
+		f, err := attachWriter(stdout)
+		if err != nil {
+			return err
+		}
+		cmd.Stdout = f
+	}
+	if stderr != nil {
+		f, err := attachWriter(stderr)
+		if err != nil {
+			return err
+		}
+		cmd.Stderr = f
+	}
+	return nil
+}
+
+func attachWriter(w *PipeWriter) (*os.File, error) {
+	if w.child != nil {
+		// Already attached, such as for both stdout and stderr.
+		return w.child, nil
+	}
+	f, err := childFile(w.fd, os.O_WRONLY)
+	if err != nil {
+		return nil, err
+	}
+	if f != w.fd {
+		w.child = f
+	}
+	return f, nil
+}
+
+// closeFile closes f if it is not nil.
+func closeFile(f *os.File) error {
+	if f == nil {
+		return nil
+	}
+	return f.Close()
+}
+
+// Stdio holds the parent side of the pipes created by StdioPipes.
+type Stdio struct {
+	// Stdin is connected to the command's stdin.
+	Stdin *PipeWriter
+	// Stdout is connected to the command's stdout.
+	Stdout *PipeReader
+	// Stderr is connected to the command's stderr.
+	Stderr *PipeReader
+
+	cmd   *exec.Cmd
+	child []io.Closer
+}
+
+// StdioPipes creates a pipe for each of the stdin, stdout, and stderr of cmd
+// and sets them up with AttachCmd. The returned ends are non-blocking, and
+// can be spliced straight to files, sockets, or other pipes.
+//
+// The command must be started with Stdio.Start rather than cmd.Start, which
+// also closes the child's ends of the pipes in this process so that reads
+// see EOF once the command exits.
+func StdioPipes(cmd *exec.Cmd) (_ *Stdio, retErr error) {
+	s := &Stdio{cmd: cmd}
+	defer func() {
+		if retErr != nil {
+			s.Close()
+		}
+	}()
+
+	stdinR, stdinW, err := New()
+	if err != nil {
+		return nil, err
+	}
+	s.Stdin = stdinW
+	s.child = append(s.child, stdinR)
+
+	stdoutR, stdoutW, err := New()
+	if err != nil {
+		return nil, err
+	}
+	s.Stdout = stdoutR
+	s.child = append(s.child, stdoutW)
+
+	stderrR, stderrW, err := New()
+	if err != nil {
+		return nil, err
+	}
+	s.Stderr = stderrR
+	s.child = append(s.child, stderrW)
+
+	if err := AttachCmd(cmd, stdinR, stdoutW, stderrW); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Start starts the command and closes the child's ends of the pipes in this
+// process.
+func (s *Stdio) Start() error {
+	err := s.cmd.Start()
+	return joinErrors(err, s.closeChild())
+}
+
+func (s *Stdio) closeChild() error {
+	var errs []error
+	for _, c := range s.child {
+		errs = append(errs, c.Close())
+	}
+	s.child = nil
+	return joinErrors(errs...)
+}
+
+// Close closes all of the pipes.
+func (s *Stdio) Close() error {
+	errs := []error{s.closeChild()}
+	if s.Stdin != nil {
+		errs = append(errs, s.Stdin.Close())
+	}
+	if s.Stdout != nil {
+		errs = append(errs, s.Stdout.Close())
+	}
+	if s.Stderr != nil {
+		errs = append(errs, s.Stderr.Close())
+	}
+	return joinErrors(errs...)
+}
@@ -0,0 +1,158 @@
+package pipes
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestAttachCmd(t *testing.T) {
+	stdinR, stdinW := newPipe(t)
+	stdoutR, stdoutW := newPipe(t)
+
+	// Print the flags of the child's stdin, then echo stdin back.
+	cmd := exec.Command("sh", "-c", "grep flags /proc/self/fdinfo/0; cat")
+	if err := AttachCmd(cmd, stdinR, stdoutW, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The end passed in must still be non-blocking.
+	rc, err := stdinR.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var flags int
+	rc.Control(func(fd uintptr) {
+		flags, err = unix.FcntlInt(fd, unix.F_GETFL, 0)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags&unix.O_NONBLOCK == 0 {
+		t.Fatal("expected the parent's end to stay non-blocking")
+	}
+
+	stdinR.Close()
+	stdoutW.Close()
+
+	if _, err := stdinW.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	stdinW.Close()
+
+	out, err := io.ReadAll(stdoutR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.SplitN(string(out), "\n", 2)
+	if len(lines) != 2 || lines[1] != "hello" {
+		t.Fatalf("unexpected output: %q", out)
+	}
+	childFlags, err := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(lines[0], "flags:")), 8, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if childFlags&unix.O_NONBLOCK != 0 {
+		t.Fatal("expected the child's stdin to be blocking")
+	}
+}
+
+func TestAttachCmdDetach(t *testing.T) {
+	r, _ := newPipe(t)
+	_, w := newPipe(t)
+
+	cmd := exec.Command("true")
+	if err := AttachCmd(cmd, r, w, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Detach().Close()
+	w.Detach().Close()
+
+	// The files handed to the child are not handed back, so Detach must
+	// close them.
+	for _, f := range []*os.File{cmd.Stdin.(*os.File), cmd.Stdout.(*os.File)} {
+		if _, err := f.Stat(); !errors.Is(err, os.ErrClosed) {
+			t.Fatalf("expected the child's file to be closed, got: %v", err)
+		}
+	}
+}
+
+func TestAttachCmdSameWriter(t *testing.T) {
+	r, w := newPipe(t)
+
+	cmd := exec.Command("sh", "-c", "echo out; echo err >&2")
+	if err := AttachCmd(cmd, nil, w, w); err != nil {
+		t.Fatal(err)
+	}
+	if cmd.Stdout != cmd.Stderr {
+		t.Fatal("expected stdout and stderr to share the child's file")
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "out\nerr\n" {
+		t.Fatalf("unexpected output: %q", out)
+	}
+}
+
+func TestStdioPipes(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "cat; echo error >&2")
+	s, err := StdioPipes(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Stdin.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	s.Stdin.Close()
+
+	stderr := make(chan []byte, 1)
+	go func() {
+		b, _ := io.ReadAll(s.Stderr)
+		stderr <- b
+	}()
+
+	out, err := io.ReadAll(s.Stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "hello" {
+		t.Fatalf("expected hello on stdout, got: %q", out)
+	}
+	if b := <-stderr; string(b) != "error\n" {
+		t.Fatalf("expected error on stderr, got: %q", b)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,64 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package pipes
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// childFile returns a blocking file for f to hand to a child process.
+// flag is the access mode the child needs.
+func childFile(f *os.File, flag int) (*os.File, error) {
+	if runtime.GOOS == "linux" {
+		if cf, err := reopenFile(f, flag); err == nil {
+			return cf, nil
+		}
+	}
+
+	fd, err := dupConn(f)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.SetNonblock(fd, false); err != nil {
+		unix.Close(fd)
+		return nil, os.NewSyscallError("fcntl", err)
+	}
+	return os.NewFile(uintptr(fd), f.Name()), nil
+}
+
+// reopenFile opens f again through /proc, which gives a new open file
+// with its own blocking mode, unlike dup(2).
+func reopenFile(f *os.File, flag int) (*os.File, error) {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		fd    int
+		opErr error
+	)
+	err = rc.Control(func(pfd uintptr) {
+		p := "/proc/self/fd/" + strconv.Itoa(int(pfd))
+		// Open non-blocking so this does not wait for the other end of a
+		// fifo, then switch the new open file to blocking mode.
+		fd, opErr = unix.Open(p, flag|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if opErr != nil {
+		return nil, opErr
+	}
+
+	if err := unix.SetNonblock(fd, false); err != nil {
+		unix.Close(fd)
+		return nil, os.NewSyscallError("fcntl", err)
+	}
+	return os.NewFile(uintptr(fd), f.Name()), nil
+}
@@ -0,0 +1,160 @@
+package pipes
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// OpenFifoResult is used by AsyncOpenFifo to send the results of OpenFifo to a
+// caller.
+type OpenFifoResult struct {
+	R   *PipeReader
+	W   *PipeWriter
+	Err error
+}
+
+// FifoOptions are used to customize fifos created with OpenFifoWithOptions.
+// Unless noted otherwise, the options are only applied when the fifo is
+// created, not when opening an existing fifo.
+type FifoOptions struct {
+	// ExactMode sets the permissions of the fifo to exactly the requested
+	// mode after it is created. Otherwise the mode is filtered by the umask
+	// of the process, same as for regular files.
+	ExactMode bool
+
+	// Chown changes the owner of the fifo to UID and GID after it is
+	// created. This is needed, for instance, when a privileged daemon creates
+	// fifos which an unprivileged service must open.
+	Chown bool
+	// UID and GID are the owner set when Chown is true. An id of -1 is left
+	// unchanged.
+	UID, GID int
+
+	// Label is the SELinux label to set on the fifo after it is created,
+	// for example "system_u:object_r:container_file_t:s0". This lets container
+	// runtimes create fifos which a confined workload is allowed to open.
+	// Labels are only supported on Linux.
+	Label string
+
+	// HoldOpen keeps a hidden read-write fd on the fifo for as long as the
+	// returned reader is open, so the reader never sees EOF as writers come
+	// and go. The fd is released when the reader is closed.
+	// This applies whether or not the fifo is created, and has no effect if
+	// no reader is returned.
+	HoldOpen bool
+
+	// Lock serializes creating the fifo and applying the options with other
+	// processes which set Lock for the same path, using flock(2) on a lock
+	// file next to the fifo (the fifo path with ".lock" appended).
+	// Without it, a process racing to open the fifo may open it before the
+	// creator has applied the options. The lock file is not removed.
+	Lock bool
+
+	// AllowNonFifo allows opening paths which are not fifos, such as
+	// character devices, which would otherwise fail with ErrNotFifo.
+	// This applies whether or not the fifo is created.
+	AllowNonFifo bool
+}
+
+// fifoLockSuffix is appended to the path of a fifo to get the path of its
+// lock file, see FifoOptions.Lock.
+const fifoLockSuffix = ".lock"
+
+// errNoReader is returned when opening a fifo for writing without blocking
+// while nothing has it open for reading.
+var errNoReader = errors.New("no reader for fifo")
+
+// tempFifoRetries is the number of times CreateTempFifo retries when a
+// generated name is already taken.
+const tempFifoRetries = 100
+
+var errPatternHasSeparator = errors.New("pattern contains path separator")
+
+// CreateTempFifo creates a new fifo in the directory dir and opens it in
+// read-write mode, returning the path of the fifo along with both ends.
+// This mirrors os.CreateTemp: the fifo name is generated by taking pattern
+// and replacing the last "*" with a random string, or appending the random
+// string if pattern has no "*". If dir is the empty string, the default
+// directory for temporary files (see os.TempDir) is used.
+//
+// The fifo is created with 0600 permissions, and creation is retried with a
+// new name if the name is already taken. It is the caller's responsibility
+// to remove the fifo when it is no longer needed.
+func CreateTempFifo(dir, pattern string) (string, *PipeReader, *PipeWriter, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	prefix, suffix, err := splitTempPattern(pattern)
+	if err != nil {
+		return "", nil, nil, &os.PathError{Op: "createtemp", Path: pattern, Err: err}
+	}
+	prefix = filepath.Join(dir, prefix)
+
+	for try := 0; ; try++ {
+		id, err := randomFifoID()
+		if err != nil {
+			return "", nil, nil, err
+		}
+		p := prefix + id + suffix
+
+		err = mkfifo(p, 0600)
+		if os.IsExist(err) && try < tempFifoRetries {
+			continue
+		}
+		if err != nil {
+			return "", nil, nil, err
+		}
+
+		r, w, err := OpenFifo(p, os.O_RDWR, 0)
+		if err != nil {
+			os.Remove(p)
+			return "", nil, nil, err
+		}
+		return p, r, w, nil
+	}
+}
+
+// splitTempPattern splits pattern around its last "*", as os.CreateTemp
+// does.
+func splitTempPattern(pattern string) (prefix, suffix string, _ error) {
+	for i := 0; i < len(pattern); i++ {
+		if os.IsPathSeparator(pattern[i]) {
+			return "", "", errPatternHasSeparator
+		}
+	}
+	if i := strings.LastIndex(pattern, "*"); i != -1 {
+		return pattern[:i], pattern[i+1:], nil
+	}
+	return pattern, "", nil
+}
+
+// waitWriterContext is like waitWriter, but returns early with ctx.Err() once
+// ctx is done.
+func waitWriterContext(ctx context.Context, f *os.File) error {
+	stop := make(chan struct{})
+	kicked := make(chan struct{})
+	go func() {
+		defer close(kicked)
+		select {
+		case <-ctx.Done():
+			// Kick the wait below out of the Go poller.
+			f.SetReadDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+
+	err := waitWriter(f)
+
+	close(stop)
+	<-kicked
+	if ctx.Err() != nil {
+		f.SetReadDeadline(time.Time{})
+		return ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,272 @@
+// Package fifo provides an API compatible with github.com/containerd/fifo,
+// implemented on top of github.com/cpuguy83/pipes.
+//
+// Projects using containerd/fifo can switch their imports to this package
+// without changing call sites. The returned fifos implement io.ReaderFrom and
+// io.WriterTo using the splice(2) based implementations from the pipes
+// package, so copies to and from them do not need to go through userspace.
+package fifo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/cpuguy83/pipes"
+)
+
+var (
+	// ErrClosed is returned when operating on a closed fifo.
+	ErrClosed = errors.New("fifo closed")
+	// ErrRdFrmWRONLY is returned when reading from a fifo opened write-only.
+	ErrRdFrmWRONLY = errors.New("reading from write-only fifo")
+	// ErrReadClosed is returned when reading from a closed fifo.
+	ErrReadClosed = errors.New("reading from a closed fifo")
+	// ErrWrToRDONLY is returned when writing to a fifo opened read-only.
+	ErrWrToRDONLY = errors.New("writing to read-only fifo")
+	// ErrWriteClosed is returned when writing to a closed fifo.
+	ErrWriteClosed = errors.New("writing to a closed fifo")
+)
+
+type fifo struct {
+	path   string
+	flag   int
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	opened chan struct{}
+	r      *pipes.PipeReader
+	w      *pipes.PipeWriter
+	err    error
+	closed bool
+}
+
+// OpenFifo opens a fifo, with the same semantics as the function of the same
+// name in containerd/fifo.
+//
+// If flag includes os.O_CREATE the fifo is created with perm if it does not
+// exist, and an existing file which is not a fifo is an error. Opening with
+// os.O_RDONLY or os.O_WRONLY waits for the other side to open the fifo, or
+// for ctx to be done. If flag includes syscall.O_NONBLOCK, OpenFifo returns
+// right away and the wait happens on the first read or write instead.
+// Opening with os.O_RDWR never waits.
+//
+// While waiting for a writer, a read-only open ties up a thread in a blocking
+// open(2), as containerd/fifo does.
+func OpenFifo(ctx context.Context, fn string, flag int, perm os.FileMode) (io.ReadWriteCloser, error) {
+	if flag&os.O_CREATE != 0 {
+		if err := mkfifo(fn, perm); err != nil {
+			if !os.IsExist(err) {
+				return nil, err
+			}
+			if ok, err := IsFifo(fn); err != nil {
+				return nil, err
+			} else if !ok {
+				return nil, &os.PathError{Op: "open", Path: fn, Err: pipes.ErrNotFifo}
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	f := &fifo{
+		path:   fn,
+		flag:   flag,
+		ctx:    ctx,
+		cancel: cancel,
+		opened: make(chan struct{}),
+	}
+
+	if flag&oNonblock != 0 {
+		go f.open()
+		return f, nil
+	}
+
+	f.open()
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f, nil
+}
+
+// OpenFifoDup2 is OpenFifo, but also duplicates the fifo's file descriptor
+// onto fd with dup2(2), as the function of the same name in containerd/fifo.
+// It waits for the fifo to be opened even if flag includes
+// syscall.O_NONBLOCK, as there is no file descriptor to duplicate before
+// then.
+func OpenFifoDup2(ctx context.Context, fn string, flag int, perm os.FileMode, fd int) (io.ReadWriteCloser, error) {
+	rw, err := OpenFifo(ctx, fn, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	rc, err := rw.(*fifo).SyscallConn()
+	if err == nil {
+		err = dup2(rc, fd)
+	}
+	if err != nil {
+		rw.Close()
+		return nil, err
+	}
+	return rw, nil
+}
+
+// IsFifo checks if the file at path is a fifo.
+func IsFifo(path string) (bool, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	return fi.Mode()&os.ModeNamedPipe != 0, nil
+}
+
+func (f *fifo) open() {
+	defer close(f.opened)
+
+	var (
+		r   *pipes.PipeReader
+		w   *pipes.PipeWriter
+		err error
+	)
+	switch accMode(f.flag) {
+	case os.O_RDONLY:
+		r, err = openReader(f.ctx, f.path)
+	case os.O_WRONLY:
+		w, err = pipes.OpenWriter(f.ctx, f.path)
+	default:
+		r, w, err = pipes.OpenFifo(f.path, os.O_RDWR, 0)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		// Closed while opening.
+		closeAll(r, w)
+		f.err = ErrClosed
+		return
+	}
+	f.r, f.w, f.err = r, w, err
+}
+
+// wait waits for the fifo to be opened.
+func (f *fifo) wait() error {
+	<-f.opened
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return ErrClosed
+	}
+	return f.err
+}
+
+func (f *fifo) reader() (*pipes.PipeReader, error) {
+	if accMode(f.flag) == os.O_WRONLY {
+		return nil, ErrRdFrmWRONLY
+	}
+	if err := f.wait(); err != nil {
+		if err == ErrClosed {
+			return nil, ErrReadClosed
+		}
+		return nil, err
+	}
+	return f.r, nil
+}
+
+func (f *fifo) writer() (*pipes.PipeWriter, error) {
+	if accMode(f.flag) == os.O_RDONLY {
+		return nil, ErrWrToRDONLY
+	}
+	if err := f.wait(); err != nil {
+		if err == ErrClosed {
+			return nil, ErrWriteClosed
+		}
+		return nil, err
+	}
+	return f.w, nil
+}
+
+func (f *fifo) Read(p []byte) (int, error) {
+	r, err := f.reader()
+	if err != nil {
+		return 0, err
+	}
+	return r.Read(p)
+}
+
+func (f *fifo) Write(p []byte) (int, error) {
+	w, err := f.writer()
+	if err != nil {
+		return 0, err
+	}
+	return w.Write(p)
+}
+
+// WriteTo implements io.WriterTo using the splice(2) based implementation
+// from the pipes package where possible.
+func (f *fifo) WriteTo(dst io.Writer) (int64, error) {
+	r, err := f.reader()
+	if err != nil {
+		return 0, err
+	}
+	return r.WriteTo(dst)
+}
+
+// ReadFrom implements io.ReaderFrom using the splice(2) based implementation
+// from the pipes package where possible.
+func (f *fifo) ReadFrom(src io.Reader) (int64, error) {
+	w, err := f.writer()
+	if err != nil {
+		return 0, err
+	}
+	return w.ReadFrom(src)
+}
+
+// SyscallConn returns a raw connection to the underlying fifo.
+// It waits for the fifo to be opened.
+func (f *fifo) SyscallConn() (syscall.RawConn, error) {
+	if err := f.wait(); err != nil {
+		return nil, err
+	}
+	if f.r != nil {
+		return f.r.SyscallConn()
+	}
+	return f.w.SyscallConn()
+}
+
+// Close closes the fifo. If the fifo is still being opened, the open is
+// cancelled.
+func (f *fifo) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	r, w := f.r, f.w
+	f.mu.Unlock()
+
+	f.cancel()
+	return closeAll(r, w)
+}
+
+// accMode returns the access mode portion of flag.
+func accMode(flag int) int {
+	return flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR)
+}
+
+func closeAll(r *pipes.PipeReader, w *pipes.PipeWriter) error {
+	var err error
+	if r != nil {
+		err = r.Close()
+	}
+	if w != nil {
+		if werr := w.Close(); err == nil {
+			err = werr
+		}
+	}
+	return err
+}
@@ -0,0 +1,206 @@
+package fifo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cpuguy83/pipes"
+)
+
+func TestOpenFifo(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p := filepath.Join(t.TempDir(), "fifo")
+
+	type result struct {
+		rw  io.ReadWriteCloser
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		r, err := OpenFifo(ctx, p, syscall.O_RDONLY|syscall.O_CREAT, 0600)
+		ch <- result{r, err}
+	}()
+
+	// Wait for the reader to create the fifo.
+	for {
+		if ok, _ := IsFifo(p); ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	w, err := OpenFifo(ctx, p, syscall.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	res := <-ch
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	r := res.rw
+	defer r.Close()
+
+	if _, err := r.Write([]byte("hello")); err != ErrWrToRDONLY {
+		t.Fatalf("expected ErrWrToRDONLY, got: %v", err)
+	}
+	if _, err := w.Read(make([]byte, 1)); err != ErrRdFrmWRONLY {
+		t.Fatalf("expected ErrRdFrmWRONLY, got: %v", err)
+	}
+
+	if _, err := w.(io.ReaderFrom).ReadFrom(bytes.NewReader([]byte(" world"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if _, err := r.(io.WriterTo).WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "hello world" {
+		t.Fatalf("expected hello world, got: %q", buf.String())
+	}
+
+	if _, err := w.Write([]byte("x")); err != ErrWriteClosed {
+		t.Fatalf("expected ErrWriteClosed, got: %v", err)
+	}
+}
+
+func TestOpenFifoNonblock(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "fifo")
+
+	// With O_NONBLOCK this returns right away even though there is no reader.
+	w, err := OpenFifo(context.Background(), p, syscall.O_WRONLY|syscall.O_CREAT|syscall.O_NONBLOCK, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	written := make(chan error, 1)
+	go func() {
+		_, err := w.Write([]byte("hello"))
+		written <- err
+	}()
+
+	r, err := OpenFifo(context.Background(), p, syscall.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Fatalf("expected hello, got: %q", buf)
+	}
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenFifoCancel(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "fifo")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := OpenFifo(ctx, p, syscall.O_WRONLY|syscall.O_CREAT, 0600); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got: %v", err)
+	}
+
+	// Closing a fifo which is still being opened cancels the open.
+	r, err := OpenFifo(context.Background(), p, syscall.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(10*time.Millisecond, func() { r.Close() })
+	if _, err := r.Read(make([]byte, 1)); err != ErrReadClosed {
+		t.Fatalf("expected ErrReadClosed, got: %v", err)
+	}
+
+	// A read-only open blocked waiting for a writer is released as well.
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := OpenFifo(ctx, p, syscall.O_RDONLY, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got: %v", err)
+	}
+}
+
+func TestOpenFifoSilentWriter(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p := filepath.Join(t.TempDir(), "fifo")
+	w, err := OpenFifo(ctx, p, syscall.O_WRONLY|syscall.O_CREAT|syscall.O_NONBLOCK, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// The writer opening the fifo is enough, it does not have to write.
+	r, err := OpenFifo(ctx, p, syscall.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+}
+
+func TestOpenFifoNotFifo(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(p, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenFifo(context.Background(), p, syscall.O_RDWR|syscall.O_CREAT, 0600); !errors.Is(err, pipes.ErrNotFifo) {
+		t.Fatalf("expected ErrNotFifo, got: %v", err)
+	}
+}
+
+func TestOpenFifoDup2(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p := filepath.Join(t.TempDir(), "fifo")
+
+	// Any open fd will do as the target, it is replaced by the fifo.
+	target, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	fd := int(target.Fd())
+
+	rw, err := OpenFifoDup2(ctx, p, os.O_RDWR|os.O_CREATE, 0600, fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rw.Close()
+
+	if _, err := syscall.Write(fd, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(rw, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Fatalf("expected hello, got %q", buf)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package fifo
+
+import (
+	"context"
+	"os"
+	"syscall"
+
+	"github.com/cpuguy83/pipes"
+)
+
+// oNonblock is the O_NONBLOCK open flag. There are no fifos on this
+// platform, so it is never set.
+const oNonblock = 0
+
+func mkfifo(p string, perm os.FileMode) error {
+	return &os.PathError{Op: "mkfifo", Path: p, Err: pipes.ErrNotSupported}
+}
+
+func dup2(rc syscall.RawConn, fd int) error {
+	return pipes.ErrNotSupported
+}
+
+func openReader(ctx context.Context, p string) (*pipes.PipeReader, error) {
+	return nil, &os.PathError{Op: "open", Path: p, Err: pipes.ErrNotSupported}
+}
@@ -0,0 +1,86 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package fifo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/cpuguy83/pipes"
+	"golang.org/x/sys/unix"
+)
+
+// oNonblock is the O_NONBLOCK open flag.
+const oNonblock = unix.O_NONBLOCK
+
+func mkfifo(p string, perm os.FileMode) error {
+	if err := unix.Mkfifo(p, uint32(perm.Perm())); err != nil {
+		return &os.PathError{Op: "mkfifo", Path: p, Err: err}
+	}
+	return nil
+}
+
+func dup2(rc syscall.RawConn, fd int) error {
+	var dupErr error
+	if err := rc.Control(func(oldfd uintptr) {
+		dupErr = unix.Dup2(int(oldfd), fd)
+	}); err != nil {
+		return err
+	}
+	if dupErr != nil {
+		return os.NewSyscallError("dup2", dupErr)
+	}
+	return nil
+}
+
+// openReader opens the fifo at p read-only, waiting until a writer opens it
+// or ctx is done.
+//
+// The wait is a blocking open(2) in its own goroutine. If ctx is done first,
+// the open is released by briefly opening the fifo for writing.
+func openReader(ctx context.Context, p string) (*pipes.PipeReader, error) {
+	type result struct {
+		r   *pipes.PipeReader
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		r, _, err := pipes.OpenFifoBlocking(p, os.O_RDONLY, 0)
+		ch <- result{r, err}
+	}()
+
+	select {
+	case res := <-ch:
+		return res.r, res.err
+	case <-ctx.Done():
+	}
+
+	closeResult := func(res result) {
+		if res.r != nil {
+			res.r.Close()
+		}
+	}
+	for {
+		// This fails with ENXIO until the goroutine is blocked in open(2),
+		// so keep trying until it returns.
+		f, err := os.OpenFile(p, os.O_WRONLY|unix.O_NONBLOCK, 0)
+		if err == nil {
+			f.Close()
+		} else if !errors.Is(err, unix.ENXIO) {
+			// The fifo is gone, so the open cannot be released. Leave it to
+			// finish whenever something else opens the fifo.
+			go func() { closeResult(<-ch) }()
+			return nil, ctx.Err()
+		}
+		select {
+		case res := <-ch:
+			closeResult(res)
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
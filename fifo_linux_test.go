@@ -0,0 +1,421 @@
+package pipes
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func mkTestFifo(t *testing.T) string {
+	t.Helper()
+
+	p := filepath.Join(t.TempDir(), "fifo")
+	if err := unix.Mkfifo(p, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestWaitForReader(t *testing.T) {
+	p := mkTestFifo(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := WaitForReader(ctx, p); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got: %v", err)
+	}
+
+	ch := make(chan error, 1)
+	go func() {
+		ch <- WaitForReader(context.Background(), p)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	r, err := os.OpenFile(p, os.O_RDONLY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	select {
+	case err := <-ch:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for reader")
+	}
+
+	if err := WaitForReader(context.Background(), filepath.Join(t.TempDir(), "missing")); !os.IsNotExist(err) {
+		t.Fatalf("expected not exist error, got: %v", err)
+	}
+}
+
+func TestOpenWriter(t *testing.T) {
+	p := mkTestFifo(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := OpenWriter(ctx, p); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got: %v", err)
+	}
+
+	type result struct {
+		w   *PipeWriter
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		w, err := OpenWriter(context.Background(), p)
+		ch <- result{w, err}
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	r, err := os.OpenFile(p, os.O_RDONLY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var w *PipeWriter
+	select {
+	case res := <-ch:
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		w = res.w
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for open")
+	}
+
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Fatalf("expected hello, got %q", buf)
+	}
+}
+
+func TestOpenReader(t *testing.T) {
+	p := mkTestFifo(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := OpenReader(ctx, p); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got: %v", err)
+	}
+
+	type result struct {
+		r   *PipeReader
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		r, err := OpenReader(context.Background(), p)
+		ch <- result{r, err}
+	}()
+
+	w, err := OpenWriter(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	var r *PipeReader
+	select {
+	case res := <-ch:
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		r = res.r
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for open")
+	}
+	defer r.Close()
+
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Fatalf("expected hello, got %q", buf)
+	}
+}
+
+func TestCreateTempFifo(t *testing.T) {
+	dir := t.TempDir()
+
+	p, r, w, err := CreateTempFifo(dir, "test-*.fifo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if filepath.Dir(p) != dir {
+		t.Fatalf("expected fifo in %s, got: %s", dir, p)
+	}
+	name := filepath.Base(p)
+	if !strings.HasPrefix(name, "test-") || !strings.HasSuffix(name, ".fifo") {
+		t.Fatalf("name does not match pattern: %s", name)
+	}
+
+	fi, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&os.ModeNamedPipe == 0 {
+		t.Fatalf("expected a fifo, got: %v", fi.Mode())
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("expected 0600 permissions, got: %v", fi.Mode().Perm())
+	}
+
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Fatalf("expected hello, got: %q", buf)
+	}
+
+	p2, r2, w2, err := CreateTempFifo(dir, "test-*.fifo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2.Close()
+	w2.Close()
+	if p2 == p {
+		t.Fatal("expected a unique name")
+	}
+
+	if _, _, _, err := CreateTempFifo(dir, "a/b*"); err == nil {
+		t.Fatal("expected error for pattern with a path separator")
+	}
+}
+
+func TestOpenFifoAt(t *testing.T) {
+	dir := t.TempDir()
+	d, err := os.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	r, w, err := OpenFifoAt(d, "fifo", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Fatalf("expected hello, got: %q", buf)
+	}
+
+	if _, _, err := OpenFifoAt(d, "fifo", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600); !os.IsExist(err) {
+		t.Fatalf("expected exist error with O_EXCL, got: %v", err)
+	}
+
+	r2, w2, err := OpenFifoAt(d, "fifo", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2.Close()
+	if w2 != nil {
+		t.Fatal("expected no writer for a read-only open")
+	}
+
+	if err := os.Symlink(filepath.Join(dir, "fifo"), filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := OpenFifoAt(d, "link", os.O_RDWR|os.O_CREATE, 0600); err == nil {
+		t.Fatal("expected error opening through a symlink")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "regular"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := OpenFifoAt(d, "regular", os.O_RDWR|os.O_CREATE, 0600); !errors.Is(err, ErrNotFifo) {
+		t.Fatalf("expected ErrNotFifo, got: %v", err)
+	}
+
+	if _, _, err := OpenFifoAt(d, "../fifo", os.O_RDWR, 0); err == nil {
+		t.Fatal("expected error for a name with a path separator")
+	}
+}
+
+func TestNotifyOpen(t *testing.T) {
+	p := mkTestFifo(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := NotifyOpen(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-ch:
+		t.Fatal("unexpected notification before the fifo was opened")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	r, err := os.OpenFile(p, os.O_RDONLY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	select {
+	case _, ok := <-ch:
+		if !ok {
+			t.Fatal("channel closed unexpectedly")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for open notification")
+	}
+
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			// Drain a coalesced notification, if any.
+			<-ch
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for channel to be closed")
+	}
+
+	if _, err := NotifyOpen(context.Background(), filepath.Join(t.TempDir(), "missing")); !os.IsNotExist(err) {
+		t.Fatalf("expected not exist error, got: %v", err)
+	}
+}
+
+func TestRemoveOrphanedFifos(t *testing.T) {
+	dir := t.TempDir()
+
+	// Start and reap a process so we have a pid which is known to be gone.
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	deadPid := cmd.ProcessState.Pid()
+
+	mk := func(name string) string {
+		t.Helper()
+		p := filepath.Join(dir, name)
+		if err := unix.Mkfifo(p, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	orphan := mk(OwnedFifoName("stdout", deadPid))
+	live := mk(OwnedFifoName("stdout", os.Getpid()))
+	unowned := mk("stdin")
+	regular := filepath.Join(dir, OwnedFifoName("file", deadPid))
+	if err := os.WriteFile(regular, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := RemoveOrphanedFifos(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0] != orphan {
+		t.Fatalf("expected only %s to be removed, got: %v", orphan, removed)
+	}
+
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Fatalf("expected orphaned fifo to be removed, got: %v", err)
+	}
+	for _, p := range []string{live, unowned, regular} {
+		if _, err := os.Stat(p); err != nil {
+			t.Fatalf("expected %s to be kept: %v", p, err)
+		}
+	}
+}
+
+func TestFifoPathErrors(t *testing.T) {
+	dir := t.TempDir()
+	regular := filepath.Join(dir, "regular")
+	if err := os.WriteFile(regular, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing")
+	fifo := mkTestFifo(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, tc := range []struct {
+		name string
+		path string
+		op   string
+		err  error
+		open func() error
+	}{
+		{"OpenWriter", fifo, "open", context.Canceled, func() error {
+			_, err := OpenWriter(ctx, fifo)
+			return err
+		}},
+		{"OpenReader", fifo, "open", context.Canceled, func() error {
+			_, err := OpenReader(ctx, fifo)
+			return err
+		}},
+		{"Open", missing, "open", os.ErrNotExist, func() error {
+			_, err := Open(missing)
+			return err
+		}},
+		{"OpenFifo", regular, "open", ErrNotFifo, func() error {
+			_, _, err := OpenFifo(regular, os.O_RDWR, 0)
+			return err
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.open()
+			var pe *os.PathError
+			if !errors.As(err, &pe) {
+				t.Fatalf("expected *os.PathError, got: %T %v", err, err)
+			}
+			if pe.Op != tc.op || pe.Path != tc.path {
+				t.Fatalf("expected op %q on %s, got: %v", tc.op, tc.path, pe)
+			}
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got: %v", tc.err, err)
+			}
+		})
+	}
+}
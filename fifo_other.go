@@ -0,0 +1,39 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package pipes
+
+import (
+	"context"
+	"os"
+)
+
+// WaitForReader is not supported on this platform and always returns
+// ErrNotSupported.
+func WaitForReader(ctx context.Context, p string) error {
+	return &os.PathError{Op: "open", Path: p, Err: ErrNotSupported}
+}
+
+func openWriter(p string) (*os.File, error) {
+	return nil, &os.PathError{Op: "open", Path: p, Err: ErrNotSupported}
+}
+
+func openWriterRetry(ctx context.Context, p string) (*os.File, error) {
+	return openWriter(p)
+}
+
+func openReader(p string) (*os.File, error) {
+	return nil, &os.PathError{Op: "open", Path: p, Err: ErrNotSupported}
+}
+
+func waitWriter(f *os.File) error {
+	return ErrNotSupported
+}
+
+func mkfifo(p string, mode os.FileMode) error {
+	return &os.PathError{Op: "mkfifo", Path: p, Err: ErrNotSupported}
+}
+
+func openRDWR(p string) (*os.File, error) {
+	return nil, &os.PathError{Op: "open", Path: p, Err: ErrNotSupported}
+}
@@ -0,0 +1,162 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package pipes
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// fifoRetryMin and fifoRetryMax bound the backoff used when polling a
+	// fifo for a reader.
+	fifoRetryMin = time.Millisecond
+	fifoRetryMax = 100 * time.Millisecond
+)
+
+// openWriter opens the fifo at p in non-blocking write-only mode.
+// Such an open fails with ENXIO while nothing has the fifo open for reading,
+// which is returned as an error wrapping errNoReader.
+func openWriter(p string) (*os.File, error) {
+	return openWriterFlag(p, os.O_WRONLY)
+}
+
+// openWriterFlag is like openWriter, with other open flags, such as
+// os.O_APPEND, taken from flag.
+func openWriterFlag(p string, flag int) (*os.File, error) {
+	f, err := os.OpenFile(p, flag|os.O_WRONLY|unix.O_NONBLOCK, 0)
+	if errors.Is(err, unix.ENXIO) {
+		return nil, &os.PathError{Op: "open", Path: p, Err: errNoReader}
+	}
+	return f, err
+}
+
+// openWriterRetry is like openWriter, but retries with backoff while there is
+// no reader until it succeeds or ctx is done.
+func openWriterRetry(ctx context.Context, p string) (*os.File, error) {
+	backoff := fifoRetryMin
+	for {
+		f, err := openWriter(p)
+		if !errors.Is(err, errNoReader) {
+			return f, err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, &os.PathError{Op: "open", Path: p, Err: ctx.Err()}
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > fifoRetryMax {
+			backoff = fifoRetryMax
+		}
+	}
+}
+
+// WaitForReader waits until something has the fifo at p open for reading, or
+// ctx is done. This lets writers delay producing output until someone is
+// listening.
+//
+// This works by probing the fifo with a non-blocking write-only open, which
+// fails with ENXIO while there are no readers. Note that the fifo being open
+// in read-write mode (including by this process, see OpenFifo) counts as
+// having a reader.
+// When the probe succeeds it is closed right away. A reader blocked opening
+// the fifo (see OpenFifoBlocking) is released by the probe, and will read EOF
+// if nothing else has the fifo open for writing.
+//
+// The fifo must already exist.
+func WaitForReader(ctx context.Context, p string) error {
+	f, err := openWriterRetry(ctx, p)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// OpenWriter opens the fifo at p in write-only mode without blocking the
+// calling thread, waiting until something has the fifo open for reading or
+// ctx is done.
+//
+// A non-blocking write-only open of a fifo fails with ENXIO while there are
+// no readers, so this retries the open with backoff until it succeeds.
+// Unlike opening with OpenFifoBlocking, this can be cancelled.
+//
+// The fifo must already exist.
+func OpenWriter(ctx context.Context, p string) (*PipeWriter, error) {
+	f, err := openWriterRetry(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return newWriter(f), nil
+}
+
+// OpenReader opens the fifo at p in read-only mode without blocking the
+// calling thread, waiting until a writer shows up or ctx is done.
+//
+// Reading a fifo which has no writers returns EOF, so reading right after
+// opening can return EOF before the writer had a chance to open the fifo.
+// OpenReader avoids this by waiting until a writer has written to the fifo,
+// or has opened and closed it again. Note that a writer which opens the fifo
+// but does not write anything does not cause OpenReader to return.
+//
+// The fifo must already exist.
+func OpenReader(ctx context.Context, p string) (*PipeReader, error) {
+	f, err := openReader(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := waitWriterContext(ctx, f); err != nil {
+		f.Close()
+		return nil, pathError("open", p, err)
+	}
+	return newReader(f), nil
+}
+
+// openReader opens the fifo at p in non-blocking read-only mode, which never
+// blocks.
+func openReader(p string) (*os.File, error) {
+	return os.OpenFile(p, os.O_RDONLY|unix.O_NONBLOCK, 0)
+}
+
+// waitWriter waits for a writer to show up on a fifo freshly opened with
+// openReader.
+//
+// Reading a fifo which has no writers returns EOF right away rather than
+// blocking. However, a fifo opened in non-blocking mode does not report a
+// hangup until it has seen a writer, so polling it only returns once a
+// writer has written something or has come and gone.
+func waitWriter(f *os.File) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	return rc.Read(func(fd uintptr) bool {
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, 0)
+		return err != nil && err != unix.EINTR || n > 0
+	})
+}
+
+// mkfifo creates a fifo at p, failing if something already exists there.
+func mkfifo(p string, mode os.FileMode) error {
+	if err := unix.Mkfifo(p, uint32(mode.Perm())); err != nil {
+		return &os.PathError{Op: "mkfifo", Path: p, Err: err}
+	}
+	return nil
+}
+
+// openRDWR opens the fifo at p in non-blocking read-write mode.
+// Since the fifo is then open for writing, reads never return EOF.
+func openRDWR(p string) (*os.File, error) {
+	return os.OpenFile(p, os.O_RDWR|unix.O_NONBLOCK, 0)
+}
@@ -0,0 +1,124 @@
+package pipes
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// OpenFifoAt is like OpenFifo, but opens (and optionally creates) the fifo
+// name relative to the already open directory dir.
+//
+// OpenFifo checks whether the fifo exists, creates it, and then opens it by
+// path, so in a shared directory the path can be swapped out between those
+// steps, for example for a symlink pointing somewhere else.
+// OpenFifoAt avoids this by working relative to dir with mkfifoat(2) and
+// openat2(2), refusing to follow symlinks (RESOLVE_NO_SYMLINKS) or to leave
+// dir (RESOLVE_BENEATH), and by checking that what it opened is actually a
+// fifo.
+// On kernels without openat2 (before 5.6) this falls back to openat(2) with
+// O_NOFOLLOW, which is equivalent since name must be a single path
+// component.
+//
+// If flag includes os.O_CREATE the fifo is created with mode if it does not
+// already exist. If flag also includes os.O_EXCL, an existing file is an
+// error.
+//
+// The access mode in flag determines which ends are returned. Like OpenFifo,
+// opening write-only blocks until something has the fifo open for reading.
+// The returned ends are non-blocking.
+func OpenFifoAt(dir *os.File, name string, flag int, mode os.FileMode) (pr *PipeReader, pw *PipeWriter, retErr error) {
+	p := filepath.Join(dir.Name(), name)
+	if name == "" || name == "." || name == ".." || strings.ContainsRune(name, os.PathSeparator) {
+		return nil, nil, &os.PathError{Op: "openat", Path: p, Err: unix.EINVAL}
+	}
+
+	rc, err := dir.SyscallConn()
+	if err != nil {
+		return nil, nil, pathError("openat", p, err)
+	}
+
+	var (
+		fd    int
+		opErr error
+	)
+	err = rc.Control(func(dirfd uintptr) {
+		fd, opErr = openFifoAt(int(dirfd), name, flag, mode)
+	})
+	if err != nil {
+		return nil, nil, pathError("openat", p, err)
+	}
+	if opErr != nil {
+		return nil, nil, &os.PathError{Op: "openat", Path: p, Err: opErr}
+	}
+	defer func() {
+		if retErr != nil {
+			unix.Close(fd)
+		}
+	}()
+
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return nil, nil, &os.PathError{Op: "fstat", Path: p, Err: err}
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFIFO {
+		return nil, nil, &os.PathError{Op: "openat", Path: p, Err: ErrNotFifo}
+	}
+
+	if err := unix.SetNonblock(fd, true); err != nil {
+		return nil, nil, &os.PathError{Op: "fcntl", Path: p, Err: err}
+	}
+
+	switch flag & unix.O_ACCMODE {
+	case unix.O_RDONLY:
+		return newReader(os.NewFile(uintptr(fd), p)), nil, nil
+	case unix.O_WRONLY:
+		return nil, newWriter(os.NewFile(uintptr(fd), p)), nil
+	}
+
+	// The reader and writer each need their own fd so they can be closed
+	// independently.
+	nfd, err := unix.FcntlInt(uintptr(fd), unix.F_DUPFD_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, &os.PathError{Op: "fcntl", Path: p, Err: err}
+	}
+	return newReader(os.NewFile(uintptr(fd), p)), newWriter(os.NewFile(uintptr(nfd), p)), nil
+}
+
+// openFifoAt creates (if requested) and opens the fifo name relative to
+// dirfd without following symlinks.
+func openFifoAt(dirfd int, name string, flag int, mode os.FileMode) (int, error) {
+	if flag&os.O_CREATE != 0 {
+		err := unix.Mkfifoat(dirfd, name, uint32(mode.Perm()))
+		if err != nil && !(err == unix.EEXIST && flag&os.O_EXCL == 0) {
+			return -1, err
+		}
+	}
+
+	flags := flag&^(os.O_CREATE|os.O_EXCL|os.O_TRUNC) | unix.O_CLOEXEC | unix.O_NOFOLLOW
+	for {
+		fd, err := unix.Openat2(dirfd, name, &unix.OpenHow{
+			Flags:   uint64(flags),
+			Resolve: unix.RESOLVE_NO_SYMLINKS | unix.RESOLVE_BENEATH,
+		})
+		if err == unix.EINTR {
+			continue
+		}
+		if err == unix.ENOSYS {
+			return openatNoFollow(dirfd, name, flags)
+		}
+		return fd, err
+	}
+}
+
+func openatNoFollow(dirfd int, name string, flags int) (int, error) {
+	for {
+		fd, err := unix.Openat(dirfd, name, flags, 0)
+		if err == unix.EINTR {
+			continue
+		}
+		return fd, err
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package pipes
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// OpenFifoAt is not supported on this platform and always returns
+// ErrNotSupported.
+func OpenFifoAt(dir *os.File, name string, flag int, mode os.FileMode) (*PipeReader, *PipeWriter, error) {
+	return nil, nil, &os.PathError{Op: "openat", Path: filepath.Join(dir.Name(), name), Err: ErrNotSupported}
+}
@@ -0,0 +1,14 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package pipes
+
+// fifoWatch does nothing on this platform, a fifoWaiter only retries the
+// pending opens periodically.
+type fifoWatch struct{}
+
+func (w *fifoWatch) add(fw *fifoWaiter, p string) int { return -1 }
+
+func (w *fifoWatch) remove(wd int) {}
+
+func (w *fifoWatch) close() {}
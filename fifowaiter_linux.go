@@ -0,0 +1,88 @@
+package pipes
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// fifoWatch watches the fifos a fifoWaiter is waiting on with inotify(7), so
+// the waiter is woken up whenever one of them is opened.
+type fifoWatch struct {
+	f *os.File
+	// refs counts the pending opens using each watch descriptor. Opens of the
+	// same fifo share a watch descriptor.
+	refs map[int]int
+}
+
+// add watches the fifo at p, starting the watch if needed, and returns the
+// watch descriptor to pass to remove. It must be called with fw.mu held.
+// Failing to watch the fifo is not an error, the waiter then falls back to
+// retrying the open periodically.
+func (w *fifoWatch) add(fw *fifoWaiter, p string) int {
+	if w.f == nil {
+		fd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+		if err != nil {
+			return -1
+		}
+		w.f = os.NewFile(uintptr(fd), "inotify")
+		w.refs = make(map[int]int)
+		go w.read(fw, w.f)
+	}
+
+	rc, err := w.f.SyscallConn()
+	if err != nil {
+		return -1
+	}
+	wd := -1
+	rc.Control(func(fd uintptr) {
+		if n, err := unix.InotifyAddWatch(int(fd), p, unix.IN_OPEN); err == nil {
+			wd = n
+		}
+	})
+	if wd >= 0 {
+		w.refs[wd]++
+	}
+	return wd
+}
+
+// remove stops watching the fifo behind wd, as returned by add, once no
+// other pending open uses it. It must be called with fw.mu held.
+func (w *fifoWatch) remove(wd int) {
+	if wd < 0 || w.f == nil {
+		return
+	}
+	w.refs[wd]--
+	if w.refs[wd] > 0 {
+		return
+	}
+	delete(w.refs, wd)
+
+	rc, err := w.f.SyscallConn()
+	if err != nil {
+		return
+	}
+	rc.Control(func(fd uintptr) {
+		unix.InotifyRmWatch(int(fd), uint32(wd))
+	})
+}
+
+// read wakes up fw for every batch of events until f is closed.
+func (w *fifoWatch) read(fw *fifoWaiter, f *os.File) {
+	buf := make([]byte, 4096)
+	for {
+		if _, err := f.Read(buf); err != nil {
+			return
+		}
+		fw.kick()
+	}
+}
+
+// close stops watching all the fifos. It must be called with fw.mu held.
+func (w *fifoWatch) close() {
+	if w.f != nil {
+		w.f.Close()
+		w.f = nil
+		w.refs = nil
+	}
+}
@@ -0,0 +1,133 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package pipes
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// fifoWaiter completes the write-only opens started by AsyncOpenFifo which
+// are waiting for a reader to show up.
+//
+// A single goroutine retries all the pending opens with a non-blocking open,
+// which fails while the fifo has no reader (see openWriter), whenever it is
+// woken up. Where the platform supports it, the fifos are watched for being
+// opened so the goroutine is woken up as soon as a reader shows up.
+// Otherwise, or if the reader is itself blocked opening the fifo, which does
+// not trigger the watch, the opens are retried every fifoRetryMax.
+//
+// The goroutine exits once there is nothing left to wait for.
+type fifoWaiter struct {
+	mu      sync.Mutex
+	pending []*fifoOpen
+	running bool
+	// wake is sent to, without blocking, to make the goroutine retry the
+	// pending opens.
+	wake chan struct{}
+
+	// watch is the platform specific state used to watch the fifos.
+	watch fifoWatch
+}
+
+// fifoOpen is an open waiting for a reader.
+type fifoOpen struct {
+	p    string
+	flag int
+	ch   chan OpenFifoResult
+	// wd is the watch descriptor for the fifo, or -1 if it is not watched.
+	wd int
+}
+
+var asyncFifos = fifoWaiter{wake: make(chan struct{}, 1)}
+
+// add queues an open of the fifo at p, whose result is sent on ch.
+func (fw *fifoWaiter) add(p string, flag int, ch chan OpenFifoResult) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	// The watch must be in place before the open is first tried so a
+	// reader showing up in between is not missed.
+	wd := fw.watch.add(fw, p)
+	fw.pending = append(fw.pending, &fifoOpen{p: p, flag: flag, ch: ch, wd: wd})
+	if !fw.running {
+		fw.running = true
+		go fw.run()
+	}
+	fw.kick()
+}
+
+// kick wakes up the goroutine.
+func (fw *fifoWaiter) kick() {
+	select {
+	case fw.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (fw *fifoWaiter) run() {
+	var ls []*fifoOpen
+	for {
+		fw.mu.Lock()
+		ls = append(ls[:0], fw.pending...)
+		fw.mu.Unlock()
+
+		for _, o := range ls {
+			if o.try() {
+				fw.remove(o)
+			}
+		}
+
+		fw.mu.Lock()
+		if len(fw.pending) == 0 {
+			fw.running = false
+			fw.watch.close()
+			fw.mu.Unlock()
+			return
+		}
+		fw.mu.Unlock()
+
+		timer := time.NewTimer(fifoRetryMax)
+		select {
+		case <-fw.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+func (fw *fifoWaiter) remove(o *fifoOpen) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	for i, p := range fw.pending {
+		if p == o {
+			fw.pending = append(fw.pending[:i], fw.pending[i+1:]...)
+			fw.watch.remove(o.wd)
+			return
+		}
+	}
+}
+
+// try attempts the open, reporting whether it is done, in which case the
+// result has been sent.
+func (o *fifoOpen) try() bool {
+	f, err := openWriterFlag(o.p, o.flag&^os.O_CREATE)
+	if errors.Is(err, errNoReader) {
+		return false
+	}
+	if err == nil {
+		if err = checkIsFifo(f); err != nil {
+			f.Close()
+		}
+	}
+	if err != nil {
+		o.ch <- OpenFifoResult{Err: err}
+		return true
+	}
+	o.ch <- OpenFifoResult{W: newWriter(f)}
+	return true
+}
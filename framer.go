@@ -0,0 +1,142 @@
+package pipes
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// FramePrefix selects how the length of each frame is encoded by a Framer.
+type FramePrefix int
+
+const (
+	// PrefixUvarint encodes the frame length as an unsigned varint, as in
+	// encoding/binary. This is the default.
+	PrefixUvarint FramePrefix = iota
+	// PrefixUint32 encodes the frame length as a 4 byte big endian integer.
+	PrefixUint32
+)
+
+// DefaultMaxFrameSize is the maximum frame size used by a Framer when
+// MaxFrameSize is not set.
+const DefaultMaxFrameSize = 4 << 20
+
+// maxFrameBuf is the largest write buffer a Framer keeps around between
+// frames. Larger frames are written with a separate write for the prefix.
+const maxFrameBuf = 64 << 10
+
+// Framer reads and writes length prefixed frames, for exchanging messages
+// over a byte stream such as a pipe or fifo.
+//
+// Both sides must use the same Prefix.
+// A Framer is not safe for concurrent use, though one goroutine may read
+// frames while another writes them.
+type Framer struct {
+	r *bufio.Reader
+	w io.Writer
+
+	rbuf []byte
+	wbuf []byte
+
+	// Prefix is the encoding of the frame length.
+	Prefix FramePrefix
+
+	// MaxFrameSize is the largest frame, not counting the prefix, which can
+	// be written or read. Reading a frame with a larger length fails with
+	// ErrFrameTooLarge before the frame is read, so a bad peer cannot make
+	// the reader allocate arbitrary amounts of memory.
+	// If zero, DefaultMaxFrameSize is used.
+	MaxFrameSize int
+}
+
+// NewFramer creates a Framer reading frames from r and writing frames to w.
+// Either may be nil if the Framer is only used in one direction.
+//
+// Reads from r are buffered, so r should not be read from directly once it is
+// passed to the Framer.
+func NewFramer(r io.Reader, w io.Writer) *Framer {
+	f := &Framer{w: w}
+	if r != nil {
+		f.r = bufio.NewReader(r)
+	}
+	return f
+}
+
+func (f *Framer) maxFrameSize() int {
+	if f.MaxFrameSize > 0 {
+		return f.MaxFrameSize
+	}
+	return DefaultMaxFrameSize
+}
+
+// WriteFrame writes p as a single frame.
+//
+// The prefix and payload are written with a single call to Write where
+// possible, so frames up to PIPE_BUF bytes (including the prefix) written to
+// the same pipe by different writers are not interleaved.
+func (f *Framer) WriteFrame(p []byte) error {
+	if len(p) > f.maxFrameSize() {
+		return ErrFrameTooLarge
+	}
+
+	var hdr [binary.MaxVarintLen64]byte
+	var n int
+	switch f.Prefix {
+	case PrefixUint32:
+		binary.BigEndian.PutUint32(hdr[:], uint32(len(p)))
+		n = 4
+	default:
+		n = binary.PutUvarint(hdr[:], uint64(len(p)))
+	}
+
+	if n+len(p) > maxFrameBuf {
+		if _, err := f.w.Write(hdr[:n]); err != nil {
+			return err
+		}
+		_, err := f.w.Write(p)
+		return err
+	}
+
+	f.wbuf = append(append(f.wbuf[:0], hdr[:n]...), p...)
+	_, err := f.w.Write(f.wbuf)
+	return err
+}
+
+// ReadFrame reads the next frame.
+//
+// The returned slice is only valid until the next call to ReadFrame, as the
+// buffer is reused. io.EOF is returned if the stream ends between frames,
+// and io.ErrUnexpectedEOF if it ends in the middle of one.
+func (f *Framer) ReadFrame() ([]byte, error) {
+	var size uint64
+	switch f.Prefix {
+	case PrefixUint32:
+		var hdr [4]byte
+		if _, err := io.ReadFull(f.r, hdr[:]); err != nil {
+			return nil, err
+		}
+		size = uint64(binary.BigEndian.Uint32(hdr[:]))
+	default:
+		var err error
+		size, err = binary.ReadUvarint(f.r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if size > uint64(f.maxFrameSize()) {
+		return nil, ErrFrameTooLarge
+	}
+
+	if uint64(cap(f.rbuf)) < size {
+		f.rbuf = make([]byte, size)
+	}
+	buf := f.rbuf[:size]
+	if _, err := io.ReadFull(f.r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
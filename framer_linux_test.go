@@ -0,0 +1,76 @@
+package pipes
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestFramer(t *testing.T) {
+	for _, prefix := range []FramePrefix{PrefixUvarint, PrefixUint32} {
+		r, w, err := New()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fw := NewFramer(nil, w)
+		fw.Prefix = prefix
+		fw.MaxFrameSize = 1 << 20
+		fr := NewFramer(r, nil)
+		fr.Prefix = prefix
+
+		frames := [][]byte{
+			[]byte("hello"),
+			{},
+			bytes.Repeat([]byte("x"), 200<<10),
+			[]byte("world"),
+		}
+
+		errCh := make(chan error, 1)
+		go func() {
+			defer w.Close()
+			for _, f := range frames {
+				if err := fw.WriteFrame(f); err != nil {
+					errCh <- err
+					return
+				}
+			}
+			errCh <- fw.WriteFrame(make([]byte, 1<<20+1))
+		}()
+
+		for _, expected := range frames {
+			got, err := fr.ReadFrame()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, expected) {
+				t.Fatalf("prefix %d: expected frame of %d bytes, got %d bytes", prefix, len(expected), len(got))
+			}
+		}
+		if err := <-errCh; err != ErrFrameTooLarge {
+			t.Fatalf("expected ErrFrameTooLarge, got: %v", err)
+		}
+		if _, err := fr.ReadFrame(); err != io.EOF {
+			t.Fatalf("expected EOF, got: %v", err)
+		}
+		r.Close()
+	}
+}
+
+func TestFramerMaxFrameSize(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewFramer(nil, &buf).WriteFrame(make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+
+	fr := NewFramer(bytes.NewReader(buf.Bytes()), nil)
+	fr.MaxFrameSize = 10
+	if _, err := fr.ReadFrame(); err != ErrFrameTooLarge {
+		t.Fatalf("expected ErrFrameTooLarge, got: %v", err)
+	}
+
+	fr = NewFramer(bytes.NewReader(buf.Bytes()[:50]), nil)
+	if _, err := fr.ReadFrame(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got: %v", err)
+	}
+}
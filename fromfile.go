@@ -0,0 +1,75 @@
+package pipes
+
+import "os"
+
+// NewReaderFromFile wraps f, which must be a pipe or fifo, in a PipeReader so
+// it can be used with the optimized methods in this package. This is useful
+// for existing descriptors such as the read end from os.Pipe or os.Stdin.
+// If f is not a pipe or fifo, an error wrapping ErrNotFifo is returned.
+//
+// The reader takes ownership of f. The file is used as is, so if it is in
+// blocking mode reads tie up an OS thread. Use NewReaderFromFD to also put
+// the fd into non-blocking mode.
+func NewReaderFromFile(f *os.File) (*PipeReader, error) {
+	if err := checkIsFifo(f); err != nil {
+		return nil, err
+	}
+	return newReader(f), nil
+}
+
+// NewWriterFromFile wraps f, which must be a pipe or fifo, in a PipeWriter.
+// See NewReaderFromFile for details.
+func NewWriterFromFile(f *os.File) (*PipeWriter, error) {
+	if err := checkIsFifo(f); err != nil {
+		return nil, err
+	}
+	return newWriter(f), nil
+}
+
+// NewReaderFromFD creates a PipeReader from an existing fd, such as one
+// inherited from the parent process. If fd is not a pipe or fifo, an error
+// wrapping ErrNotFifo is returned and fd is left open.
+//
+// On success the reader takes ownership of fd. Where supported, fd is put
+// into non-blocking mode so it can be used with the Go poller.
+func NewReaderFromFD(fd uintptr, name string) (*PipeReader, error) {
+	f, err := fileFromFD(fd, name)
+	if err != nil {
+		return nil, err
+	}
+	return newReader(f), nil
+}
+
+// NewWriterFromFD creates a PipeWriter from an existing fd.
+// See NewReaderFromFD for details.
+func NewWriterFromFD(fd uintptr, name string) (*PipeWriter, error) {
+	f, err := fileFromFD(fd, name)
+	if err != nil {
+		return nil, err
+	}
+	return newWriter(f), nil
+}
+
+func fileFromFD(fd uintptr, name string) (*os.File, error) {
+	// Validate before changing any flags on the fd, since it is left alone
+	// on error.
+	if err := checkFDIsFifo(fd, name); err != nil {
+		return nil, err
+	}
+	if err := setNonblock(fd); err != nil {
+		return nil, err
+	}
+	return os.NewFile(fd, name), nil
+}
+
+// checkIsFifo returns an error wrapping ErrNotFifo if f is not a pipe or fifo.
+func checkIsFifo(f *os.File) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeNamedPipe == 0 {
+		return &os.PathError{Op: "open", Path: f.Name(), Err: ErrNotFifo}
+	}
+	return nil
+}
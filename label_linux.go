@@ -0,0 +1,31 @@
+package pipes
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// selinuxXattr is the extended attribute holding the SELinux label of a file.
+const selinuxXattr = "security.selinux"
+
+// setLabel sets the SELinux label of f.
+func setLabel(f *os.File, label string) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var xattrErr error
+	err = rc.Control(func(fd uintptr) {
+		// libselinux stores labels NUL terminated, so do the same.
+		xattrErr = unix.Fsetxattr(int(fd), selinuxXattr, []byte(label+"\x00"), 0)
+	})
+	if err != nil {
+		return err
+	}
+	if xattrErr != nil {
+		return &os.PathError{Op: "fsetxattr", Path: f.Name(), Err: xattrErr}
+	}
+	return nil
+}
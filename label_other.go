@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package pipes
+
+import "os"
+
+func setLabel(f *os.File, label string) error {
+	return &os.PathError{Op: "fsetxattr", Path: f.Name(), Err: ErrNotSupported}
+}
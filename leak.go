@@ -0,0 +1,224 @@
+package pipes
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Leak describes a pipe end which was not closed, see EnableLeakDetection.
+type Leak struct {
+	// Name is the name of the file backing the pipe end, such as the path of
+	// a fifo.
+	Name string
+	// Kind is either "reader" or "writer".
+	Kind string
+	// Stack is the stack trace of the goroutine which created the pipe end.
+	Stack string
+}
+
+func (l Leak) String() string {
+	return fmt.Sprintf("unclosed pipe %s %q created at:\n%s", l.Kind, l.Name, l.Stack)
+}
+
+// leakEntry is a pipe end tracked for leaks.
+type leakEntry struct {
+	f     *os.File
+	kind  string
+	stack string
+}
+
+// leakTracking is set to 1 when leak detection is enabled. It is checked
+// before taking the lock so that creating pipes stays cheap otherwise.
+var leakTracking int32
+
+var leaks struct {
+	mu      sync.Mutex
+	onLeak  func(Leak)
+	entries map[*leakEntry]struct{}
+}
+
+// EnableLeakDetection starts tracking the pipe ends created from now on,
+// recording where each one was created. Since this captures a stack trace
+// for every pipe end, it is meant for tests and debugging.
+//
+// If onLeak is not nil, it is called for pipe ends which are garbage collected
+// without having been closed. It is called from the finalizer goroutine, so it
+// should not block.
+// Pipe ends which are still open can also be listed with OpenPipes, see also
+// LeakCheck.
+func EnableLeakDetection(onLeak func(Leak)) {
+	leaks.mu.Lock()
+	leaks.onLeak = onLeak
+	if leaks.entries == nil {
+		leaks.entries = make(map[*leakEntry]struct{})
+	}
+	atomic.StoreInt32(&leakTracking, 1)
+	leaks.mu.Unlock()
+}
+
+// DisableLeakDetection stops tracking pipe ends and forgets about the ones
+// tracked so far.
+func DisableLeakDetection() {
+	leaks.mu.Lock()
+	atomic.StoreInt32(&leakTracking, 0)
+	leaks.onLeak = nil
+	leaks.entries = nil
+	leaks.mu.Unlock()
+}
+
+// OpenPipes returns the pipe ends created while leak detection was enabled
+// which are still open.
+func OpenPipes() []Leak {
+	var ls []Leak
+	for _, e := range openLeakEntries() {
+		ls = append(ls, e.leak())
+	}
+	return ls
+}
+
+// LeakTB is the subset of testing.TB used by LeakCheck.
+type LeakTB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Cleanup(func())
+}
+
+// LeakCheck enables leak detection for the duration of a test, and fails the
+// test if pipe ends created during the test are still open once it is done.
+// The failure includes the stack trace of where each pipe end was created.
+//
+//	func TestFoo(t *testing.T) {
+//		pipes.LeakCheck(t)
+//		...
+//	}
+//
+// The check runs as a test cleanup, so pipes closed by cleanups registered
+// after calling LeakCheck are not reported.
+// Pipes created by other tests running in parallel are reported as well, so
+// LeakCheck should not be used with parallel tests.
+func LeakCheck(t LeakTB) {
+	t.Helper()
+
+	enabled := atomic.LoadInt32(&leakTracking) == 1
+	if !enabled {
+		EnableLeakDetection(nil)
+	}
+
+	before := make(map[*leakEntry]bool)
+	leaks.mu.Lock()
+	for e := range leaks.entries {
+		before[e] = true
+	}
+	leaks.mu.Unlock()
+
+	t.Cleanup(func() {
+		t.Helper()
+		for _, e := range openLeakEntries() {
+			if !before[e] {
+				t.Errorf("%s", e.leak())
+			}
+		}
+		if !enabled {
+			DisableLeakDetection()
+		}
+	})
+}
+
+// trackLeak starts tracking obj, which is a pipe end wrapping f, if leak
+// detection is enabled. It returns nil otherwise.
+func trackLeak(obj interface{}, f *os.File, kind string) *leakEntry {
+	if atomic.LoadInt32(&leakTracking) == 0 || f == nil {
+		return nil
+	}
+
+	e := &leakEntry{f: f, kind: kind, stack: leakStack()}
+
+	leaks.mu.Lock()
+	if leaks.entries == nil {
+		// Detection was disabled in the meantime.
+		leaks.mu.Unlock()
+		return nil
+	}
+	leaks.entries[e] = struct{}{}
+	leaks.mu.Unlock()
+
+	runtime.SetFinalizer(obj, func(interface{}) { e.finalize() })
+	return e
+}
+
+// forget stops tracking the entry, such as when the file is detached from
+// the pipe end. It is safe to call on a nil entry.
+func (e *leakEntry) forget() {
+	if e == nil {
+		return
+	}
+	leaks.mu.Lock()
+	delete(leaks.entries, e)
+	leaks.mu.Unlock()
+}
+
+// finalize is called when the pipe end the entry belongs to is garbage
+// collected.
+func (e *leakEntry) finalize() {
+	leaks.mu.Lock()
+	_, tracked := leaks.entries[e]
+	delete(leaks.entries, e)
+	onLeak := leaks.onLeak
+	leaks.mu.Unlock()
+
+	if tracked && onLeak != nil && fileOpen(e.f) {
+		onLeak(e.leak())
+	}
+}
+
+func (e *leakEntry) leak() Leak {
+	return Leak{Name: e.f.Name(), Kind: e.kind, Stack: e.stack}
+}
+
+func openLeakEntries() []*leakEntry {
+	leaks.mu.Lock()
+	entries := make([]*leakEntry, 0, len(leaks.entries))
+	for e := range leaks.entries {
+		entries = append(entries, e)
+	}
+	leaks.mu.Unlock()
+
+	open := entries[:0]
+	for _, e := range entries {
+		if fileOpen(e.f) {
+			open = append(open, e)
+		}
+	}
+	return open
+}
+
+// fileOpen reports whether f has not been closed yet.
+func fileOpen(f *os.File) bool {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return false
+	}
+	return rc.Control(func(uintptr) {}) == nil
+}
+
+// leakStack returns the stack trace of the caller creating a pipe end.
+func leakStack() string {
+	pcs := make([]uintptr, 32)
+	// Skip runtime.Callers, leakStack, trackLeak and newReader/newWriter.
+	n := runtime.Callers(4, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var b strings.Builder
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
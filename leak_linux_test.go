@@ -0,0 +1,105 @@
+package pipes
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeTB records the errors reported by LeakCheck.
+type fakeTB struct {
+	errors   []string
+	cleanups []func()
+}
+
+func (tb *fakeTB) Helper() {}
+
+func (tb *fakeTB) Errorf(format string, args ...interface{}) {
+	tb.errors = append(tb.errors, fmt.Sprintf(format, args...))
+}
+
+func (tb *fakeTB) Cleanup(f func()) {
+	tb.cleanups = append(tb.cleanups, f)
+}
+
+func (tb *fakeTB) done() {
+	for i := len(tb.cleanups) - 1; i >= 0; i-- {
+		tb.cleanups[i]()
+	}
+}
+
+func TestLeakCheck(t *testing.T) {
+	tb := &fakeTB{}
+	LeakCheck(tb)
+
+	r1, w1, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r1.Close()
+	w1.Close()
+
+	r2, w2, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2.Close()
+	w2.Close()
+
+	// Detached files are owned by the caller.
+	r3, w3, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w3.Close()
+	f := r3.Detach()
+	defer f.Close()
+
+	tb.done()
+
+	if len(tb.errors) != 1 {
+		t.Fatalf("expected 1 leak, got %d: %v", len(tb.errors), tb.errors)
+	}
+	if !strings.Contains(tb.errors[0], "unclosed pipe reader") || !strings.Contains(tb.errors[0], "TestLeakCheck") {
+		t.Fatalf("unexpected leak report: %s", tb.errors[0])
+	}
+	if len(OpenPipes()) != 0 {
+		t.Fatal("expected leak detection to be disabled after the check")
+	}
+}
+
+func TestLeakFinalizer(t *testing.T) {
+	leaked := make(chan Leak, 2)
+	EnableLeakDetection(func(l Leak) { leaked <- l })
+	defer DisableLeakDetection()
+
+	func() {
+		r, w, err := New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+		// w is dropped without being closed.
+		_ = w
+	}()
+
+	timeout := time.After(10 * time.Second)
+	for {
+		runtime.GC()
+		select {
+		case l := <-leaked:
+			if l.Kind != "writer" {
+				t.Fatalf("expected the writer to leak, got %s", l.Kind)
+			}
+			if !strings.Contains(l.Stack, "TestLeakFinalizer") {
+				t.Fatalf("expected creation stack, got:\n%s", l.Stack)
+			}
+			return
+		case <-timeout:
+			t.Fatal("timeout waiting for leak to be reported")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package pipes
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// fifoControlName is the name of the control fifo in a listener's
+	// directory.
+	fifoControlName = "control"
+	// fifoIDLen is the length of the hex encoded ids clients pick for their
+	// connections.
+	fifoIDLen = 16
+	// fifoHandshakeTimeout bounds how long Accept waits for a client to open
+	// its ends of a connection.
+	fifoHandshakeTimeout = 5 * time.Second
+)
+
+// FifoConn is a bidirectional connection made of a pair of fifos, returned by
+// FifoListener.Accept and DialFifo.
+type FifoConn struct {
+	*PipeReader
+	*PipeWriter
+}
+
+// Close closes both ends of the connection.
+// Ends which were already closed with CloseRead or CloseWrite are skipped.
+func (c *FifoConn) Close() error {
+	return joinErrors(ignoreClosed(c.PipeReader.Close()), ignoreClosed(c.PipeWriter.Close()))
+}
+
+// CloseRead closes the reading side of the connection. The peer gets EPIPE
+// on further writes.
+func (c *FifoConn) CloseRead() error {
+	return c.PipeReader.Close()
+}
+
+// CloseWrite closes the writing side of the connection, similar to
+// net.TCPConn.CloseWrite. The peer reads EOF once it has read all the data
+// written before the call, while this side can keep reading the response.
+func (c *FifoConn) CloseWrite() error {
+	return c.PipeWriter.Close()
+}
+
+// ignoreClosed returns nil if err is because the file was already closed.
+func ignoreClosed(err error) error {
+	if errors.Is(err, os.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// FifoListener hands out connections made of fifos, similar to a
+// net.Listener. This is useful for environments where only a filesystem is
+// shared between processes.
+//
+// The listener owns a directory containing a well-known control fifo.
+// To connect, a client (see DialFifo) creates a pair of fifos in the
+// directory and announces them on the control fifo. The listener then opens
+// the other ends of the pair and returns them from Accept.
+// Once both sides are connected, the fifos are removed from the directory.
+type FifoListener struct {
+	dir     string
+	control *os.File
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	mu  sync.Mutex
+	buf *bufio.Reader
+}
+
+// ListenFifo creates a FifoListener in dir, which must already exist.
+// The control fifo is created with 0600 permissions.
+func ListenFifo(dir string) (*FifoListener, error) {
+	p := filepath.Join(dir, fifoControlName)
+	if err := mkfifo(p, 0600); err != nil {
+		return nil, err
+	}
+
+	// Hold the control fifo in read-write mode so it does not hit EOF when
+	// clients close it, and so clients can always open it for writing.
+	f, err := openRDWR(p)
+	if err != nil {
+		os.Remove(p)
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &FifoListener{
+		dir:     dir,
+		control: f,
+		ctx:     ctx,
+		cancel:  cancel,
+		buf:     bufio.NewReader(f),
+	}, nil
+}
+
+// Addr returns the directory the listener is serving.
+func (l *FifoListener) Addr() string {
+	return l.dir
+}
+
+// Accept waits for the next client to connect and returns the connection.
+func (l *FifoListener) Accept() (*FifoConn, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for {
+		line, err := l.buf.ReadString('\n')
+		if err != nil {
+			if l.ctx.Err() != nil {
+				return nil, os.ErrClosed
+			}
+			return nil, err
+		}
+
+		id := strings.TrimSuffix(line, "\n")
+		if !validFifoID(id) {
+			continue
+		}
+
+		c, err := l.accept(id)
+		if err != nil {
+			if l.ctx.Err() != nil {
+				return nil, os.ErrClosed
+			}
+			// The client went away or misbehaved, wait for the next one.
+			continue
+		}
+		return c, nil
+	}
+}
+
+func (l *FifoListener) accept(id string) (_ *FifoConn, retErr error) {
+	inPath, outPath := fifoConnPaths(l.dir, id)
+	defer os.Remove(inPath)
+	defer os.Remove(outPath)
+
+	ctx, cancel := context.WithTimeout(l.ctx, fifoHandshakeTimeout)
+	defer cancel()
+
+	in, err := openReader(inPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if retErr != nil {
+			in.Close()
+		}
+	}()
+
+	out, err := openWriterRetry(ctx, outPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if retErr != nil {
+			out.Close()
+		}
+	}()
+
+	// Reading the fifo before the client has opened it for writing would
+	// return EOF, so wait for the client to write its handshake byte.
+	in.SetReadDeadline(time.Now().Add(fifoHandshakeTimeout))
+	if err := waitWriter(in); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(in, make([]byte, 1)); err != nil {
+		return nil, err
+	}
+	in.SetReadDeadline(time.Time{})
+
+	return &FifoConn{PipeReader: newReader(in), PipeWriter: newWriter(out)}, nil
+}
+
+// Close stops the listener and removes the control fifo.
+// Connections which have already been accepted are not affected.
+func (l *FifoListener) Close() error {
+	l.cancel()
+	return joinErrors(l.control.Close(), os.Remove(filepath.Join(l.dir, fifoControlName)))
+}
+
+// DialFifo connects to the FifoListener serving dir.
+// It waits for the listener to accept the connection, or for ctx to be done.
+func DialFifo(ctx context.Context, dir string) (_ *FifoConn, retErr error) {
+	id, err := randomFifoID()
+	if err != nil {
+		return nil, err
+	}
+
+	inPath, outPath := fifoConnPaths(dir, id)
+	if err := mkfifo(inPath, 0600); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if retErr != nil {
+			os.Remove(inPath)
+		}
+	}()
+	if err := mkfifo(outPath, 0600); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if retErr != nil {
+			os.Remove(outPath)
+		}
+	}()
+
+	// The listener's ends of the connection are opened from the other
+	// direction, so the client reads from out and writes to in.
+	r, err := openReader(outPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if retErr != nil {
+			r.Close()
+		}
+	}()
+
+	control, err := openWriterRetry(ctx, filepath.Join(dir, fifoControlName))
+	if err != nil {
+		return nil, err
+	}
+	// This is smaller than PIPE_BUF, so the write is atomic and can't be
+	// interleaved with other clients.
+	_, err = control.Write([]byte(id + "\n"))
+	control.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := openWriterRetry(ctx, inPath)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write([]byte{0}); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	return &FifoConn{PipeReader: newReader(r), PipeWriter: newWriter(w)}, nil
+}
+
+func fifoConnPaths(dir, id string) (in, out string) {
+	return filepath.Join(dir, id+".in"), filepath.Join(dir, id+".out")
+}
+
+// randomFifoID returns a random hex encoded id of fifoIDLen characters.
+func randomFifoID() (string, error) {
+	b := make([]byte, fifoIDLen/2)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func validFifoID(id string) bool {
+	if len(id) != fifoIDLen {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
@@ -0,0 +1,132 @@
+package pipes
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFifoListener(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := ListenFifo(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	type acceptResult struct {
+		c   *FifoConn
+		err error
+	}
+	accepted := make(chan acceptResult, 1)
+	go func() {
+		for {
+			c, err := l.Accept()
+			accepted <- acceptResult{c, err}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i := 0; i < 3; i++ {
+		client, err := DialFifo(ctx, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var res acceptResult
+		select {
+		case res = <-accepted:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for accept")
+		}
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		server := res.c
+
+		if _, err := client.Write([]byte("ping")); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(server, buf); err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != "ping" {
+			t.Fatalf("expected ping, got: %q", buf)
+		}
+
+		if _, err := server.Write([]byte("pong")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(client, buf); err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != "pong" {
+			t.Fatalf("expected pong, got: %q", buf)
+		}
+
+		if err := client.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := server.Read(buf); err != io.EOF {
+			t.Fatalf("expected EOF after client close, got: %v", err)
+		}
+		server.Close()
+	}
+
+	// Only the control fifo should be left.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != fifoControlName {
+		t.Fatalf("unexpected entries left in listener dir: %v", entries)
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case res := <-accepted:
+		if res.err != os.ErrClosed {
+			t.Fatalf("expected os.ErrClosed, got: %v", res.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for accept to return")
+	}
+	if _, err := os.Stat(filepath.Join(dir, fifoControlName)); !os.IsNotExist(err) {
+		t.Fatalf("expected control fifo to be removed, got: %v", err)
+	}
+}
+
+func TestDialFifoNoListener(t *testing.T) {
+	dir := t.TempDir()
+	if err := mkfifo(filepath.Join(dir, fifoControlName), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := DialFifo(ctx, dir); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected client fifos to be cleaned up, got: %v", entries)
+	}
+}
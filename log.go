@@ -0,0 +1,96 @@
+package pipes
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+)
+
+// Events passed to a Logger.
+const (
+	// EventWriterAdded is logged when a writer is added to a Copier.
+	EventWriterAdded = "writer_added"
+	// EventWriterEvicted is logged when a Copier drops a writer because
+	// writing to it failed. The error is passed under the "err" key.
+	EventWriterEvicted = "writer_evicted"
+	// EventFallback is logged when a copy goes through a userspace buffer
+	// instead of splice(2) or sendfile(2). The operation is passed under the
+	// "op" key.
+	EventFallback = "fallback"
+	// EventRetry is logged when a splice(2) or tee(2) call is retried after
+	// an error. The operation, error and number of retries so far are passed
+	// under the "op", "err" and "attempt" keys.
+	EventRetry = "retry"
+	// EventThreadPolicy is logged when a Copier fails to apply its
+	// ThreadPolicy. The error is passed under the "err" key.
+	EventThreadPolicy = "thread_policy"
+)
+
+// Logger receives events about what the package is doing internally, which
+// otherwise happens silently.
+//
+// Log is called with the event name followed by alternating keys and values,
+// the same convention as log/slog and go-kit/log, so loggers from those
+// packages are easy to adapt. Log may be called concurrently from many
+// goroutines, sometimes while internal locks are held, so it should not
+// block.
+type Logger interface {
+	Log(event string, keyvals ...interface{})
+}
+
+type loggerHolder struct {
+	l Logger
+}
+
+var logger atomic.Value // loggerHolder
+
+// SetLogger sets the Logger which receives events from the package, for
+// operations whose context carries no Logger (see WithLogger).
+// Pass nil to disable logging, which is the default.
+func SetLogger(l Logger) {
+	logger.Store(loggerHolder{l})
+}
+
+type loggerKey struct{}
+
+// WithLogger returns a new context based on ctx which carries l. Operations
+// which take that context, such as CopyContext and NewCopier, log their
+// events to l rather than to the Logger set with SetLogger, so different
+// users of the package can keep their events apart.
+// A nil l falls back to the Logger set with SetLogger.
+func WithLogger(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// ContextLogger returns the Logger attached to ctx, or nil if there is none.
+func ContextLogger(ctx context.Context) Logger {
+	l, _ := ctx.Value(loggerKey{}).(Logger)
+	return l
+}
+
+// logEvent logs event to l, or to the Logger set with SetLogger if l is nil.
+func logEvent(l Logger, event string, keyvals ...interface{}) {
+	if l == nil {
+		h, _ := logger.Load().(loggerHolder)
+		l = h.l
+	}
+	if l != nil {
+		l.Log(event, keyvals...)
+	}
+}
+
+// fallbackCopy copies through buf, or pooled userspace buffers if buf is
+// empty (see userCopyBuffer), for when the optimized copy paths are not
+// available, logging that the fallback was taken.
+func fallbackCopy(trace *SpliceTrace, log Logger, op string, dst io.Writer, src io.Reader, buf []byte) (int64, error) {
+	fallbackTaken(trace, log, op)
+	return userCopyBuffer(dst, src, buf)
+}
+
+// fallbackTaken reports that op is copying through a userspace buffer to the
+// logger, the trace and the package metrics.
+func fallbackTaken(trace *SpliceTrace, log Logger, op string) {
+	atomic.AddInt64(&metrics.fallbacks, 1)
+	logEvent(log, EventFallback, "op", op)
+	trace.fallbackTaken(op)
+}
@@ -0,0 +1,111 @@
+package pipes
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testLogger struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *testLogger) Log(event string, keyvals ...interface{}) {
+	if len(keyvals)%2 != 0 {
+		panic("odd number of keyvals")
+	}
+	l.mu.Lock()
+	l.events = append(l.events, event)
+	l.mu.Unlock()
+}
+
+func (l *testLogger) has(event string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, e := range l.events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLogger(t *testing.T) {
+	l := &testLogger{}
+	SetLogger(l)
+	defer SetLogger(nil)
+
+	r1, w1 := newPipe(t)
+	_, w2 := newPipe(t)
+	r3, w3 := newPipe(t)
+	r3.Close()
+
+	// Not backed by an fd, so this can't be spliced.
+	if _, err := w1.ReadFrom(bytes.NewReader([]byte("hello"))); err != nil {
+		t.Fatal(err)
+	}
+	if !l.has(EventFallback) {
+		t.Fatal("expected fallback event")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := NewCopier(ctx, r1, w3, w2); err != nil {
+		t.Fatal(err)
+	}
+	if !l.has(EventWriterAdded) {
+		t.Fatal("expected writer added event")
+	}
+
+	for i := 0; i < 100 && !l.has(EventWriterEvicted); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !l.has(EventWriterEvicted) {
+		t.Fatal("expected writer evicted event")
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	global := &testLogger{}
+	SetLogger(global)
+	defer SetLogger(nil)
+
+	l := &testLogger{}
+	ctx, cancel := context.WithCancel(WithLogger(context.Background(), l))
+	defer cancel()
+
+	r1, w1 := newPipe(t)
+	_, w2 := newPipe(t)
+	r3, w3 := newPipe(t)
+	r3.Close()
+
+	if _, err := CopyContext(ctx, w1, bytes.NewReader([]byte("hello"))); err != nil {
+		t.Fatal(err)
+	}
+	if !l.has(EventFallback) {
+		t.Fatal("expected fallback event")
+	}
+
+	if _, err := NewCopier(ctx, r1, w3, w2); err != nil {
+		t.Fatal(err)
+	}
+	if !l.has(EventWriterAdded) {
+		t.Fatal("expected writer added event")
+	}
+
+	for i := 0; i < 100 && !l.has(EventWriterEvicted); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !l.has(EventWriterEvicted) {
+		t.Fatal("expected writer evicted event")
+	}
+
+	for _, e := range []string{EventFallback, EventWriterAdded, EventWriterEvicted} {
+		if global.has(e) {
+			t.Fatalf("expected %s to not be logged to the global logger", e)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package pipes
+
+import "sync/atomic"
+
+// Metrics are package wide aggregates, see ReadMetrics.
+type Metrics struct {
+	// ActivePipes is the number of pipe ends which are open.
+	ActivePipes int64
+	// BytesSpliced is the number of bytes moved with splice(2).
+	BytesSpliced int64
+	// FallbackCopies is the number of copies which went through a userspace
+	// buffer because no zero-copy path was available.
+	FallbackCopies int64
+	// Syscalls are the syscall counts, see Syscalls.
+	Syscalls SyscallStats
+}
+
+// metrics holds the counters for Metrics.
+var metrics struct {
+	active    int64
+	spliced   int64
+	fallbacks int64
+}
+
+// ReadMetrics returns the package wide metrics for this process.
+// See the pipesvar package to publish them with expvar.
+func ReadMetrics() Metrics {
+	return Metrics{
+		ActivePipes:    atomic.LoadInt64(&metrics.active),
+		BytesSpliced:   atomic.LoadInt64(&metrics.spliced),
+		FallbackCopies: atomic.LoadInt64(&metrics.fallbacks),
+		Syscalls:       Syscalls(),
+	}
+}
@@ -0,0 +1,50 @@
+package pipes
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReadMetrics(t *testing.T) {
+	before := ReadMetrics()
+
+	r, w, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := ReadMetrics().ActivePipes - before.ActivePipes; n != 2 {
+		t.Fatalf("expected 2 more active pipes, got %d", n)
+	}
+
+	// Not backed by an fd, so this goes through a userspace buffer.
+	if _, err := w.ReadFrom(bytes.NewReader([]byte("hello"))); err != nil {
+		t.Fatal(err)
+	}
+
+	r2, w2 := newPipe(t)
+	if _, err := Splice(rawFd(t, w2), rawFd(t, r), 5, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r2.Read(make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Close()
+	w.Close()
+	// Closing again must not change the count.
+	w.Close()
+
+	after := ReadMetrics()
+	if after.ActivePipes != before.ActivePipes+2 {
+		// The pipe from newPipe is still open.
+		t.Fatalf("expected %d active pipes, got %d", before.ActivePipes+2, after.ActivePipes)
+	}
+	if n := after.FallbackCopies - before.FallbackCopies; n != 1 {
+		t.Fatalf("expected 1 fallback copy, got %d", n)
+	}
+	if SpliceSupported() {
+		if n := after.BytesSpliced - before.BytesSpliced; n != 5 {
+			t.Fatalf("expected 5 bytes spliced, got %d", n)
+		}
+	}
+}
@@ -0,0 +1,437 @@
+package pipes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// Mux message types, sent in the first byte of each frame.
+const (
+	muxData byte = iota
+	muxWindowUpdate
+	muxOpen
+	muxFin
+	muxReset
+)
+
+const (
+	// muxHeaderSize is the size of the header of each message: the message
+	// type followed by a 4 byte big endian stream ID. For window updates the
+	// payload is the 4 byte big endian window increment.
+	muxHeaderSize = 5
+	// muxWindowSize is how much data may be in flight on a stream before the
+	// receiver has read it.
+	muxWindowSize = 256 << 10
+	// muxMaxFrame is the largest payload sent in one data frame, so streams
+	// share the connection fairly.
+	muxMaxFrame = 32 << 10
+	// muxAcceptBacklog is the number of streams opened by the peer which can
+	// be waiting for Accept.
+	muxAcceptBacklog = 64
+)
+
+// ErrStreamReset is returned by MuxStream when the peer closed the stream
+// without reading everything sent on it, or refused the stream because too
+// many streams were already waiting for Accept.
+var ErrStreamReset = errors.New("stream reset by peer")
+
+var errBadMuxFrame = errors.New("malformed mux frame")
+
+// Mux carries many independent, bidirectional streams over a single
+// connection, such as a FifoConn, so one pair of fifos can serve multiple
+// logical channels.
+//
+// Messages are framed with a Framer. Each stream has its own flow control
+// window, so a stream which is not being read from only holds up writers on
+// that stream and not the whole connection.
+type Mux struct {
+	conn io.ReadWriteCloser
+	fr   *Framer
+
+	wmu  sync.Mutex
+	fw   *Framer
+	wbuf []byte
+
+	accept chan *MuxStream
+	done   chan struct{}
+
+	mu      sync.Mutex
+	streams map[uint32]*MuxStream
+	nextID  uint32
+	err     error
+}
+
+// NewMux starts multiplexing streams over conn. One side of the connection
+// must pass client as true and the other as false, so the two sides pick
+// different IDs for the streams they open.
+//
+// The Mux owns conn and closes it when the Mux is closed.
+func NewMux(conn io.ReadWriteCloser, client bool) *Mux {
+	m := &Mux{
+		conn:    conn,
+		fr:      NewFramer(conn, nil),
+		fw:      NewFramer(nil, conn),
+		accept:  make(chan *MuxStream, muxAcceptBacklog),
+		done:    make(chan struct{}),
+		streams: make(map[uint32]*MuxStream),
+		nextID:  2,
+	}
+	if client {
+		m.nextID = 1
+	}
+	m.fr.MaxFrameSize = muxHeaderSize + muxMaxFrame
+	go m.readLoop()
+	return m
+}
+
+// Open opens a new stream to the other side, which receives it from Accept.
+// If too many streams are already waiting for Accept on the other side, the
+// stream is reset and reading from or writing to it fails with
+// ErrStreamReset.
+func (m *Mux) Open() (*MuxStream, error) {
+	m.mu.Lock()
+	if m.err != nil {
+		m.mu.Unlock()
+		return nil, m.err
+	}
+	s := newMuxStream(m, m.nextID)
+	m.nextID += 2
+	m.streams[s.id] = s
+	m.mu.Unlock()
+
+	if err := m.writeFrame(muxOpen, s.id, nil); err != nil {
+		m.remove(s.id)
+		return nil, err
+	}
+	return s, nil
+}
+
+// Accept waits for the other side to open a stream and returns it.
+// Once the Mux is closed, Accept returns os.ErrClosed, or the error which
+// caused the connection to fail.
+func (m *Mux) Accept() (*MuxStream, error) {
+	select {
+	case s := <-m.accept:
+		return s, nil
+	case <-m.done:
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return nil, m.err
+	}
+}
+
+// Close closes the Mux, all of its streams and the underlying connection.
+func (m *Mux) Close() error {
+	m.fail(os.ErrClosed)
+	return nil
+}
+
+// fail shuts down the Mux with err, if it has not been shut down already.
+func (m *Mux) fail(err error) {
+	m.mu.Lock()
+	if m.err != nil {
+		m.mu.Unlock()
+		return
+	}
+	m.err = err
+	streams := m.streams
+	m.streams = make(map[uint32]*MuxStream)
+	close(m.done)
+	m.mu.Unlock()
+
+	// A connection which ends without the streams being closed is not a
+	// normal end of the streams.
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	for _, s := range streams {
+		s.setErr(err)
+	}
+	m.conn.Close()
+}
+
+func (m *Mux) remove(id uint32) {
+	m.mu.Lock()
+	delete(m.streams, id)
+	m.mu.Unlock()
+}
+
+func (m *Mux) stream(id uint32) *MuxStream {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.streams[id]
+}
+
+func (m *Mux) writeFrame(typ byte, id uint32, payload []byte) error {
+	m.wmu.Lock()
+	defer m.wmu.Unlock()
+
+	var hdr [muxHeaderSize]byte
+	hdr[0] = typ
+	binary.BigEndian.PutUint32(hdr[1:], id)
+
+	m.wbuf = append(append(m.wbuf[:0], hdr[:]...), payload...)
+	if err := m.fw.WriteFrame(m.wbuf); err != nil {
+		m.fail(err)
+		return err
+	}
+	return nil
+}
+
+func (m *Mux) writeWindowUpdate(id, delta uint32) error {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], delta)
+	return m.writeFrame(muxWindowUpdate, id, b[:])
+}
+
+func (m *Mux) readLoop() {
+	for {
+		msg, err := m.fr.ReadFrame()
+		if err != nil {
+			m.fail(err)
+			return
+		}
+		if len(msg) < muxHeaderSize {
+			m.fail(errBadMuxFrame)
+			return
+		}
+		typ := msg[0]
+		id := binary.BigEndian.Uint32(msg[1:muxHeaderSize])
+		payload := msg[muxHeaderSize:]
+
+		switch typ {
+		case muxData:
+			if s := m.stream(id); s != nil {
+				s.received(payload)
+			}
+		case muxWindowUpdate:
+			if len(payload) != 4 {
+				m.fail(errBadMuxFrame)
+				return
+			}
+			if s := m.stream(id); s != nil {
+				s.addWindow(binary.BigEndian.Uint32(payload))
+			}
+		case muxOpen:
+			m.mu.Lock()
+			if m.err != nil || m.streams[id] != nil {
+				m.mu.Unlock()
+				continue
+			}
+			s := newMuxStream(m, id)
+			m.streams[id] = s
+			m.mu.Unlock()
+
+			select {
+			case m.accept <- s:
+			default:
+				// Refuse the stream rather than holding up every other
+				// stream until Accept is called. The reset is sent from
+				// another goroutine so a peer which is not reading cannot
+				// block the read loop either.
+				m.remove(id)
+				go m.writeFrame(muxReset, id, nil)
+			}
+		case muxFin:
+			if s := m.stream(id); s != nil {
+				s.finished()
+			}
+		case muxReset:
+			if s := m.stream(id); s != nil {
+				m.remove(id)
+				s.setErr(ErrStreamReset)
+			}
+		}
+	}
+}
+
+// MuxStream is a single bidirectional stream of a Mux.
+// It is safe to read from and write to a stream concurrently.
+//
+// Streams must be closed with Close once they are no longer used.
+type MuxStream struct {
+	m  *Mux
+	id uint32
+
+	mu         sync.Mutex
+	cond       *sync.Cond
+	buf        bytes.Buffer
+	sendWindow uint32
+	unacked    uint32
+	recvFin    bool
+	sentFin    bool
+	closed     bool
+	err        error
+}
+
+func newMuxStream(m *Mux, id uint32) *MuxStream {
+	s := &MuxStream{m: m, id: id, sendWindow: muxWindowSize}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// ID returns the ID of the stream, which is the same on both sides.
+func (s *MuxStream) ID() uint32 {
+	return s.id
+}
+
+// Read reads data sent by the other side of the stream.
+// Once the other side has closed the stream for writing and all its data has
+// been read, Read returns io.EOF.
+func (s *MuxStream) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	for s.buf.Len() == 0 && !s.recvFin && s.err == nil && !s.closed {
+		s.cond.Wait()
+	}
+	if s.closed {
+		s.mu.Unlock()
+		return 0, os.ErrClosed
+	}
+	if s.buf.Len() == 0 {
+		err := s.err
+		s.mu.Unlock()
+		if err == nil {
+			err = io.EOF
+		}
+		return 0, err
+	}
+
+	n, _ := s.buf.Read(p)
+	s.unacked += uint32(n)
+	var delta uint32
+	// Batch window updates rather than sending one for every read.
+	if s.unacked >= muxWindowSize/2 {
+		delta = s.unacked
+		s.unacked = 0
+	}
+	s.mu.Unlock()
+
+	if delta > 0 {
+		s.m.writeWindowUpdate(s.id, delta)
+	}
+	return n, nil
+}
+
+// Write writes p to the stream. It blocks while the other side has not read
+// enough of the data already written.
+func (s *MuxStream) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		s.mu.Lock()
+		for s.sendWindow == 0 && s.err == nil && !s.sentFin {
+			s.cond.Wait()
+		}
+		if s.sentFin {
+			s.mu.Unlock()
+			return written, ErrClosedPipe
+		}
+		if s.err != nil {
+			err := s.err
+			s.mu.Unlock()
+			return written, err
+		}
+
+		n := len(p)
+		if n > muxMaxFrame {
+			n = muxMaxFrame
+		}
+		if uint32(n) > s.sendWindow {
+			n = int(s.sendWindow)
+		}
+		s.sendWindow -= uint32(n)
+		s.mu.Unlock()
+
+		if err := s.m.writeFrame(muxData, s.id, p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// CloseWrite closes the writing side of the stream. The other side reads EOF
+// once it has read all the data written before the call.
+func (s *MuxStream) CloseWrite() error {
+	s.mu.Lock()
+	if s.sentFin || s.err != nil {
+		s.mu.Unlock()
+		return nil
+	}
+	s.sentFin = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	return s.m.writeFrame(muxFin, s.id, nil)
+}
+
+// Close closes the stream. If the other side has not finished writing to the
+// stream, it is reset, so further writes from the other side fail with
+// ErrStreamReset.
+func (s *MuxStream) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.buf.Reset()
+	reset := !s.recvFin && s.err == nil
+	fin := !s.sentFin && s.err == nil
+	s.sentFin = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	s.m.remove(s.id)
+	switch {
+	case reset:
+		return s.m.writeFrame(muxReset, s.id, nil)
+	case fin:
+		return s.m.writeFrame(muxFin, s.id, nil)
+	}
+	return nil
+}
+
+func (s *MuxStream) received(p []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed || s.recvFin {
+		return
+	}
+	if s.buf.Len()+len(p) > muxWindowSize {
+		// The peer ignored the flow control window.
+		s.err = ErrFrameTooLarge
+		s.cond.Broadcast()
+		return
+	}
+	s.buf.Write(p)
+	s.cond.Broadcast()
+}
+
+func (s *MuxStream) addWindow(n uint32) {
+	s.mu.Lock()
+	s.sendWindow += n
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
+
+func (s *MuxStream) finished() {
+	s.mu.Lock()
+	s.recvFin = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
+
+func (s *MuxStream) setErr(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
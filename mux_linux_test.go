@@ -0,0 +1,177 @@
+package pipes
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMux(t *testing.T) {
+	a, b := newSessionConns(t)
+	client := NewMux(a, true)
+	defer client.Close()
+	server := NewMux(b, false)
+	defer server.Close()
+
+	// Echo server.
+	go func() {
+		for {
+			s, err := server.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer s.Close()
+				io.Copy(s, s)
+				s.CloseWrite()
+			}()
+		}
+	}()
+
+	const streams = 8
+	// Larger than the window so flow control kicks in.
+	payload := bytes.Repeat([]byte("x"), 1<<20)
+
+	var wg sync.WaitGroup
+	for i := 0; i < streams; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			s, err := client.Open()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer s.Close()
+
+			data := append([]byte{byte(i)}, payload...)
+			go func() {
+				s.Write(data)
+				s.CloseWrite()
+			}()
+
+			got, err := io.ReadAll(s)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("stream %d: expected %d bytes, got %d", s.ID(), len(data), len(got))
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestMuxStreamReset(t *testing.T) {
+	a, b := newSessionConns(t)
+	client := NewMux(a, true)
+	defer client.Close()
+	server := NewMux(b, false)
+	defer server.Close()
+
+	s, err := client.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ss, err := server.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Close without reading what the client sends.
+	ss.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		var err error
+		for err == nil {
+			_, err = s.Write(make([]byte, 32<<10))
+		}
+		errCh <- err
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != ErrStreamReset {
+			t.Fatalf("expected ErrStreamReset, got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for write to fail")
+	}
+
+	// Closing the mux ends the other side's streams and Accept.
+	s2, err := client.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Accept(); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if _, err := s2.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected error reading from a stream of a closed mux")
+	}
+	if _, err := server.Accept(); err == nil {
+		t.Fatal("expected Accept to fail once the peer is gone")
+	}
+}
+
+func TestMuxAcceptBacklog(t *testing.T) {
+	a, b := newSessionConns(t)
+	client := NewMux(a, true)
+	defer client.Close()
+	server := NewMux(b, false)
+	defer server.Close()
+
+	// Fill the backlog without accepting anything.
+	streams := make(map[uint32]*MuxStream)
+	for i := 0; i < muxAcceptBacklog; i++ {
+		s, err := client.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		streams[s.ID()] = s
+	}
+
+	// One more stream is refused instead of stalling the connection.
+	refused, err := client.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		_, err := refused.Read(make([]byte, 1))
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		if err != ErrStreamReset {
+			t.Fatalf("expected ErrStreamReset, got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the stream to be refused")
+	}
+
+	// Streams which were accepted keep working.
+	s, err := server.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	s.CloseWrite()
+
+	got, err := io.ReadAll(streams[s.ID()])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello" {
+		t.Fatalf("expected hello, got %q", got)
+	}
+}
@@ -0,0 +1,75 @@
+package pipes
+
+import (
+	"context"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// NotifyOpen watches the fifo at p and sends on the returned channel whenever
+// it is opened, which lets servers hold off producing output until a client
+// is attached.
+//
+// This uses inotify(7), which does not report whether the fifo was opened for
+// reading or writing, and also reports opens by this process.
+// Notifications are coalesced: if the receiver has not yet received a pending
+// notification, further opens do not queue up more.
+// Use WaitForReader to wait specifically for a reader.
+//
+// The channel is closed once ctx is done or the fifo is removed.
+func NotifyOpen(ctx context.Context, p string) (<-chan struct{}, error) {
+	fd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	if _, err := unix.InotifyAddWatch(fd, p, unix.IN_OPEN|unix.IN_DELETE_SELF); err != nil {
+		unix.Close(fd)
+		return nil, &os.PathError{Op: "inotify_add_watch", Path: p, Err: err}
+	}
+
+	f := os.NewFile(uintptr(fd), "inotify")
+	ch := make(chan struct{}, 1)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		// Closing the file unblocks the read below.
+		f.Close()
+	}()
+
+	go func() {
+		defer close(ch)
+		defer close(done)
+
+		buf := make([]byte, 4096)
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				return
+			}
+
+			for off := 0; off+unix.SizeofInotifyEvent <= n; {
+				ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+				off += unix.SizeofInotifyEvent + int(ev.Len)
+
+				if ev.Mask&(unix.IN_DELETE_SELF|unix.IN_IGNORED) != 0 {
+					return
+				}
+				if ev.Mask&unix.IN_OPEN != 0 {
+					select {
+					case ch <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package pipes
+
+import (
+	"context"
+	"os"
+)
+
+// NotifyOpen is not supported on this platform and always returns
+// ErrNotSupported.
+func NotifyOpen(ctx context.Context, p string) (<-chan struct{}, error) {
+	return nil, &os.PathError{Op: "inotify_add_watch", Path: p, Err: ErrNotSupported}
+}
@@ -0,0 +1,81 @@
+package pipes
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// fifoOwnerMarker separates the name of a fifo from the pid of its owner.
+const fifoOwnerMarker = ".pid"
+
+// OwnedFifoName returns the file name to use for a fifo owned by the process
+// with the given pid, so that RemoveOrphanedFifos can clean it up if the
+// process goes away without removing it.
+//
+// The name is name followed by ".pid" and the pid, for example
+// "stdout.pid1234".
+func OwnedFifoName(name string, pid int) string {
+	return name + fifoOwnerMarker + strconv.Itoa(pid)
+}
+
+// fifoOwner returns the pid encoded in a name created by OwnedFifoName.
+func fifoOwner(name string) (int, bool) {
+	i := strings.LastIndex(name, fifoOwnerMarker)
+	if i == -1 {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(name[i+len(fifoOwnerMarker):])
+	if err != nil || pid <= 0 {
+		return 0, false
+	}
+	return pid, true
+}
+
+// RemoveOrphanedFifos removes the fifos in dir which are named with
+// OwnedFifoName and whose owning process no longer exists. This is useful for
+// daemons which accumulate stale fifos after crashing.
+// It returns the paths of the fifos which were removed.
+//
+// Entries which are not fifos, or are not named with OwnedFifoName, are left
+// alone. Note that pids can be reused, so a fifo whose owner has exited can
+// be kept around if an unrelated process now has the same pid.
+func RemoveOrphanedFifos(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		removed []string
+		errs    []error
+	)
+	for _, e := range entries {
+		if e.Type()&os.ModeNamedPipe == 0 {
+			continue
+		}
+		pid, ok := fifoOwner(e.Name())
+		if !ok {
+			continue
+		}
+
+		alive, err := processAlive(pid)
+		if err != nil {
+			return removed, err
+		}
+		if alive {
+			continue
+		}
+
+		p := filepath.Join(dir, e.Name())
+		if err := os.Remove(p); err != nil {
+			if !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		removed = append(removed, p)
+	}
+	return removed, joinErrors(errs...)
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package pipes
+
+func processAlive(pid int) (bool, error) {
+	return false, ErrNotSupported
+}
@@ -0,0 +1,23 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package pipes
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// processAlive reports whether a process with the given pid exists.
+func processAlive(pid int) (bool, error) {
+	switch err := unix.Kill(pid, 0); err {
+	case nil, unix.EPERM:
+		// EPERM means the process exists but belongs to someone else.
+		return true, nil
+	case unix.ESRCH:
+		return false, nil
+	default:
+		return false, os.NewSyscallError("kill", err)
+	}
+}
@@ -0,0 +1,67 @@
+//go:build windows && !go1.25
+// +build windows,!go1.25
+
+package pipes
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// pipeOverlapped is added to the flags of named pipe handles.
+// Before Go 1.25 os.File only supports handles opened for synchronous I/O, so
+// named pipes do not support deadlines.
+const pipeOverlapped = 0
+
+var procCancelSynchronousIo = windows.NewLazySystemDLL("kernel32.dll").NewProc("CancelSynchronousIo")
+
+// waitConnect waits for a client to connect to the named pipe instance h, or
+// for ctx to be done, in which case the pending connect is cancelled with
+// CancelSynchronousIo and ctx.Err() is returned.
+func waitConnect(ctx context.Context, h windows.Handle) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	thread, err := windows.OpenThread(windows.THREAD_TERMINATE, false, windows.GetCurrentThreadId())
+	if err != nil {
+		return os.NewSyscallError("OpenThread", err)
+	}
+	defer windows.CloseHandle(thread)
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+		// A cancel which lands before ConnectNamedPipe starts waiting is
+		// lost, so keep trying until it returns.
+		for {
+			procCancelSynchronousIo.Call(uintptr(thread))
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+
+	err = windows.ConnectNamedPipe(h, nil)
+	close(done)
+	<-stopped
+
+	if err == windows.ERROR_OPERATION_ABORTED && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err == windows.ERROR_PIPE_CONNECTED {
+		return nil
+	}
+	return err
+}
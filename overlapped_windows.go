@@ -0,0 +1,57 @@
+//go:build windows && go1.25
+// +build windows,go1.25
+
+package pipes
+
+import (
+	"context"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// pipeOverlapped is added to the flags of named pipe handles.
+// Since Go 1.25 os.NewFile associates handles opened for overlapped I/O with
+// the runtime poller, which gives them deadlines and lets Close interrupt
+// pending reads and writes.
+const pipeOverlapped = windows.FILE_FLAG_OVERLAPPED
+
+// waitConnect waits for a client to connect to the named pipe instance h, or
+// for ctx to be done, in which case the pending connect is cancelled with
+// CancelIoEx and ctx.Err() is returned.
+func waitConnect(ctx context.Context, h windows.Handle) error {
+	ev, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return os.NewSyscallError("CreateEvent", err)
+	}
+	defer windows.CloseHandle(ev)
+
+	ov := &windows.Overlapped{HEvent: ev}
+	err = windows.ConnectNamedPipe(h, ov)
+	if err == windows.ERROR_IO_PENDING {
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			select {
+			case <-ctx.Done():
+				windows.CancelIoEx(h, ov)
+			case <-done:
+			}
+		}()
+
+		var n uint32
+		err = windows.GetOverlappedResult(h, ov, &n, true)
+		close(done)
+		// ov must outlive the CancelIoEx call.
+		<-stopped
+
+		if err == windows.ERROR_OPERATION_ABORTED && ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	if err == windows.ERROR_PIPE_CONNECTED {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,43 @@
+package pipes
+
+import "io"
+
+// MaxMessageSize is the largest message which can be sent with SendMsg.
+// This is PIPE_BUF, the largest write the kernel keeps in one piece: 4096
+// bytes on Linux and 512 bytes on darwin and FreeBSD, which is also used on
+// other platforms.
+const MaxMessageSize = pipeBuf
+
+// SendMsg writes b to the pipe as a single message.
+// If b is larger than MaxMessageSize, ErrMessageTooLarge is returned and
+// nothing is written. An empty message is not delivered to the reader.
+//
+// Messages are only delivered as such on pipes created with NewPacketPipe.
+// On other pipes, messages sent with SendMsg are never interleaved with
+// writes from other writers, but the reader sees them as a byte stream.
+func (w *PipeWriter) SendMsg(b []byte) error {
+	if len(b) > MaxMessageSize {
+		return ErrMessageTooLarge
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	n, err := w.Write(b)
+	if err == nil && n != len(b) {
+		err = io.ErrShortWrite
+	}
+	return err
+}
+
+// RecvMsg reads a single message sent with SendMsg into b and returns its
+// length. b must be at least MaxMessageSize long, as any part of a message
+// which does not fit in b is discarded; io.ErrShortBuffer is returned
+// otherwise.
+//
+// See SendMsg for the pipes which preserve message boundaries.
+func (r *PipeReader) RecvMsg(b []byte) (int, error) {
+	if len(b) < MaxMessageSize {
+		return 0, io.ErrShortBuffer
+	}
+	return r.Read(b)
+}
@@ -0,0 +1,26 @@
+package pipes
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// NewPacketPipe creates a pipe in "packet mode" (see O_DIRECT in pipe(2)),
+// which keeps the boundaries between writes. Use SendMsg and RecvMsg to
+// exchange messages over it.
+//
+// Each write of up to MaxMessageSize bytes is one packet, and each read
+// returns at most one packet. Plain writes larger than MaxMessageSize are
+// split into several packets.
+//
+// Both ends of the pipe are non-blocking and close-on-exec.
+// Packet mode requires Linux 3.4 or later.
+func NewPacketPipe() (*PipeReader, *PipeWriter, error) {
+	var p [2]int
+	if err := unix.Pipe2(p[:], unix.O_CLOEXEC|unix.O_NONBLOCK|unix.O_DIRECT); err != nil {
+		return nil, nil, os.NewSyscallError("pipe2", err)
+	}
+	pr, pw := newPipePair(os.NewFile(uintptr(p[0]), "read"), os.NewFile(uintptr(p[1]), "write"))
+	return pr, pw, nil
+}
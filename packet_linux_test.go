@@ -0,0 +1,50 @@
+package pipes
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestPacketPipe(t *testing.T) {
+	r, w, err := NewPacketPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	msgs := [][]byte{
+		[]byte("hello"),
+		[]byte("world"),
+		bytes.Repeat([]byte("x"), MaxMessageSize),
+	}
+	for _, m := range msgs {
+		if err := w.SendMsg(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.SendMsg(make([]byte, MaxMessageSize+1)); err != ErrMessageTooLarge {
+		t.Fatalf("expected ErrMessageTooLarge, got: %v", err)
+	}
+	if _, err := r.RecvMsg(make([]byte, 10)); err != io.ErrShortBuffer {
+		t.Fatalf("expected io.ErrShortBuffer, got: %v", err)
+	}
+
+	buf := make([]byte, MaxMessageSize)
+	for _, m := range msgs {
+		n, err := r.RecvMsg(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:n], m) {
+			t.Fatalf("expected message %q, got %q", m, buf[:n])
+		}
+	}
+
+	w.Close()
+	if _, err := r.RecvMsg(buf); err != io.EOF {
+		t.Fatalf("expected EOF, got: %v", err)
+	}
+}
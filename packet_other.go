@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package pipes
+
+// NewPacketPipe is not supported on this platform and always returns
+// ErrNotSupported.
+func NewPacketPipe() (*PipeReader, *PipeWriter, error) {
+	return nil, nil, ErrNotSupported
+}
@@ -0,0 +1,8 @@
+package pipes
+
+import "errors"
+
+// ErrNotPageAligned is returned when a buffer passed to
+// PipeWriter.GiftBuffers does not start on a page boundary or is not a
+// multiple of the page size.
+var ErrNotPageAligned = errors.New("buffer is not page aligned")
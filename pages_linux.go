@@ -0,0 +1,46 @@
+package pipes
+
+import (
+	"errors"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// AllocPages allocates a page-aligned buffer of at least size bytes outside of
+// the Go heap. The length of the returned buffer is rounded up to a multiple
+// of the page size.
+//
+// Buffers from AllocPages are suitable for use with PipeWriter.GiftBuffers.
+// Buffers which have not been gifted should be released with FreePages.
+func AllocPages(size int) ([]byte, error) {
+	if size <= 0 {
+		return nil, errors.New("invalid size")
+	}
+
+	pageSize := os.Getpagesize()
+	size = (size + pageSize - 1) &^ (pageSize - 1)
+
+	b, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, os.NewSyscallError("mmap", err)
+	}
+	return b, nil
+}
+
+// FreePages releases a buffer allocated by AllocPages.
+func FreePages(b []byte) error {
+	if err := unix.Munmap(b); err != nil {
+		return os.NewSyscallError("munmap", err)
+	}
+	return nil
+}
+
+func isPageAligned(b []byte) bool {
+	pageSize := os.Getpagesize()
+	if len(b)%pageSize != 0 {
+		return false
+	}
+	return uintptr(unsafe.Pointer(&b[0]))%uintptr(pageSize) == 0
+}
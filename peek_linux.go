@@ -0,0 +1,75 @@
+package pipes
+
+import (
+	"fmt"
+	"io"
+
+	"golang.org/x/sys/unix"
+)
+
+// Peek returns up to the next n bytes in the pipe without consuming them,
+// so the stream can be sniffed (for instance for the magic bytes of a
+// compressed format) and still be spliced as a whole afterwards.
+//
+// Peek waits until the pipe has data, same as Read, but then returns what
+// is available, which may be fewer than n bytes if the writer has not
+// written more yet. It returns io.EOF if the pipe is empty and all writers
+// are gone. n is capped at the size of the pipe.
+//
+// The data is duplicated with tee(2) into an internal scratch pipe, which is
+// then read, so the pipe itself is left untouched. Peek returns
+// ErrNotSupported if tee(2) is not available.
+func (r *PipeReader) Peek(n int) ([]byte, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	if !SpliceSupported() {
+		return nil, ErrNotSupported
+	}
+
+	scratch, err := pipeBufs.get()
+	if err != nil {
+		return nil, fmt.Errorf("error creating pipe buffer: %w", err)
+	}
+	// Anything left in the scratch pipe is discarded when it is put back.
+	defer pipeBufs.put(scratch)
+
+	if n > scratch.size {
+		n = scratch.size
+	}
+
+	rc, err := r.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		teed   int64
+		teeErr error
+	)
+	err = rc.Read(func(rfd uintptr) bool {
+		// The scratch pipe is empty and large enough, so this only blocks
+		// on the pipe being empty.
+		teed, teeErr = doTee(int(rfd), scratch.wfd, int64(n), unix.SPLICE_F_NONBLOCK, nil, nil, nil)
+		return teeErr != unix.EAGAIN
+	})
+	if err != nil {
+		return nil, err
+	}
+	if teeErr != nil {
+		return nil, mapErrno(teeErr)
+	}
+	if teed == 0 {
+		return nil, r.readResult(io.EOF)
+	}
+
+	buf := make([]byte, teed)
+	for off := 0; off < len(buf); {
+		m, err := unix.Read(scratch.rfd, buf[off:])
+		if err != nil {
+			return nil, mapErrno(err)
+		}
+		off += m
+	}
+	return buf, nil
+}
@@ -0,0 +1,53 @@
+package pipes
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestPeek(t *testing.T) {
+	if !SpliceSupported() {
+		t.Skip("splice not supported")
+	}
+
+	r, w := newPipe(t)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte("\x1f\x8bpayload"))
+		w.Close()
+	}()
+
+	// Waits for the data to show up.
+	r.fd.SetReadDeadline(time.Now().Add(5 * time.Second))
+	magic, err := r.Peek(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(magic) != "\x1f\x8b" {
+		t.Fatalf("unexpected peeked data: %q", magic)
+	}
+
+	// Peeking again sees the same data, capped at what is there.
+	all, err := r.Peek(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(all) != "\x1f\x8bpayload" {
+		t.Fatalf("unexpected peeked data: %q", all)
+	}
+
+	// Nothing was consumed.
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "\x1f\x8bpayload" {
+		t.Fatalf("unexpected data: %q", data)
+	}
+
+	if _, err := r.Peek(1); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package pipes
+
+// Peek is not supported on this platform since it needs tee(2), and always
+// returns ErrNotSupported.
+func (r *PipeReader) Peek(n int) ([]byte, error) {
+	return nil, ErrNotSupported
+}
@@ -0,0 +1,202 @@
+package pipes
+
+import (
+	"bufio"
+	"io"
+)
+
+// defaultPeekerSize is the buffer size of a BufferedPeeker when none is
+// given.
+const defaultPeekerSize = 4096
+
+// BufferedPeeker wraps a PipeReader with a buffer so the start of a stream
+// can be inspected with Peek, ReadByte and UnreadByte, such as to sniff a
+// protocol, without giving up on splice(2) for the rest of the stream.
+//
+// Unlike with a bufio.Reader, copying out of a BufferedPeeker (with WriteTo,
+// Copy or io.Copy) writes out whatever is buffered and then hands the pipe
+// itself to the copy, so the remainder is still spliced. Release hands the
+// buffered data and the pipe over to the caller for the same purpose.
+//
+// A BufferedPeeker is not safe for concurrent use.
+type BufferedPeeker struct {
+	r    *PipeReader
+	buf  []byte
+	rpos int
+	wpos int
+	// lastByte is the last byte read, for UnreadByte, or -1.
+	lastByte int
+	err      error
+}
+
+// NewBufferedPeeker creates a BufferedPeeker reading from r with a buffer of
+// size bytes, which is also the most that can be peeked at once.
+// If size is zero or less, 4096 bytes are used.
+func NewBufferedPeeker(r *PipeReader, size int) *BufferedPeeker {
+	if size <= 0 {
+		size = defaultPeekerSize
+	}
+	return &BufferedPeeker{r: r, buf: make([]byte, size), lastByte: -1}
+}
+
+// Buffered returns the number of bytes which have been read from the pipe
+// into the buffer but not yet consumed.
+func (b *BufferedPeeker) Buffered() int {
+	return b.wpos - b.rpos
+}
+
+// fill reads once from the pipe into the free space of the buffer.
+func (b *BufferedPeeker) fill() {
+	if b.rpos > 0 {
+		copy(b.buf, b.buf[b.rpos:b.wpos])
+		b.wpos -= b.rpos
+		b.rpos = 0
+	}
+
+	n, err := b.r.Read(b.buf[b.wpos:])
+	b.wpos += n
+	if err != nil {
+		b.err = err
+	}
+}
+
+// readErr returns the pending read error, if any, and clears it.
+func (b *BufferedPeeker) readErr() error {
+	err := b.err
+	b.err = nil
+	return err
+}
+
+// Peek returns the next n bytes without consuming them, reading from the pipe
+// as needed. The bytes are only valid until the next read.
+// If fewer than n bytes are returned, so is the error which caused it, which
+// is bufio.ErrBufferFull if n is larger than the buffer.
+func (b *BufferedPeeker) Peek(n int) ([]byte, error) {
+	if n < 0 {
+		return nil, bufio.ErrNegativeCount
+	}
+
+	b.lastByte = -1
+	for b.wpos-b.rpos < n && b.wpos-b.rpos < len(b.buf) && b.err == nil {
+		b.fill()
+	}
+
+	if n > len(b.buf) {
+		return b.buf[b.rpos:b.wpos], bufio.ErrBufferFull
+	}
+
+	var err error
+	if avail := b.wpos - b.rpos; avail < n {
+		n = avail
+		err = b.readErr()
+	}
+	return b.buf[b.rpos : b.rpos+n], err
+}
+
+// Read reads data into p, from the buffer if it has anything in it or from
+// the pipe otherwise.
+func (b *BufferedPeeker) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		if b.Buffered() > 0 {
+			return 0, nil
+		}
+		return 0, b.readErr()
+	}
+
+	if b.rpos == b.wpos {
+		if b.err != nil {
+			return 0, b.readErr()
+		}
+		if len(p) >= len(b.buf) {
+			// Large read, skip the buffer.
+			n, err := b.r.Read(p)
+			if n > 0 {
+				b.lastByte = int(p[n-1])
+			}
+			return n, err
+		}
+		b.fill()
+		if b.rpos == b.wpos {
+			return 0, b.readErr()
+		}
+	}
+
+	n := copy(p, b.buf[b.rpos:b.wpos])
+	b.rpos += n
+	b.lastByte = int(b.buf[b.rpos-1])
+	return n, nil
+}
+
+// ReadByte reads and returns a single byte.
+func (b *BufferedPeeker) ReadByte() (byte, error) {
+	for b.rpos == b.wpos {
+		if b.err != nil {
+			return 0, b.readErr()
+		}
+		b.fill()
+	}
+
+	c := b.buf[b.rpos]
+	b.rpos++
+	b.lastByte = int(c)
+	return c, nil
+}
+
+// UnreadByte unreads the last byte read. Only the most recently read byte can
+// be unread, and not after a Peek.
+func (b *BufferedPeeker) UnreadByte() error {
+	if b.lastByte < 0 || b.rpos == 0 && b.wpos > 0 {
+		return bufio.ErrInvalidUnreadByte
+	}
+
+	if b.rpos > 0 {
+		b.rpos--
+	} else {
+		b.wpos = 1
+	}
+	b.buf[b.rpos] = byte(b.lastByte)
+	b.lastByte = -1
+	return nil
+}
+
+// flush writes out the buffered data to w.
+func (b *BufferedPeeker) flush(w io.Writer) (int64, error) {
+	b.lastByte = -1
+	if b.rpos == b.wpos {
+		return 0, nil
+	}
+
+	n, err := w.Write(b.buf[b.rpos:b.wpos])
+	b.rpos += n
+	if err == nil && b.rpos < b.wpos {
+		err = io.ErrShortWrite
+	}
+	return int64(n), err
+}
+
+// WriteTo implements io.WriterTo. It writes out the buffered data to w, and
+// then copies the rest of the pipe to w with PipeReader.WriteTo, which
+// splices the data where possible.
+func (b *BufferedPeeker) WriteTo(w io.Writer) (int64, error) {
+	n, err := b.flush(w)
+	if err != nil {
+		return n, err
+	}
+	if err := b.err; err != nil && err != io.EOF {
+		return n, b.readErr()
+	}
+
+	m, err := b.r.WriteTo(w)
+	return n + m, err
+}
+
+// Release returns the data which is buffered but not yet consumed, along
+// with the underlying PipeReader, so the caller can write out the data and
+// then use the pipe directly, for instance to splice the rest of it.
+// The BufferedPeeker must not be used afterwards.
+func (b *BufferedPeeker) Release() ([]byte, *PipeReader) {
+	buffered := b.buf[b.rpos:b.wpos]
+	b.buf = nil
+	b.rpos, b.wpos = 0, 0
+	return buffered, b.r
+}
@@ -0,0 +1,126 @@
+package pipes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"testing"
+)
+
+func TestBufferedPeeker(t *testing.T) {
+	t.Run("peek", func(t *testing.T) {
+		r, w := newPipe(t)
+		if _, err := w.Write([]byte("hello world")); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+
+		bp := NewBufferedPeeker(r, 8)
+		p, err := bp.Peek(5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(p) != "hello" {
+			t.Fatalf("unexpected peeked data: %q", p)
+		}
+		if _, err := bp.Peek(9); err != bufio.ErrBufferFull {
+			t.Fatalf("expected bufio.ErrBufferFull, got: %v", err)
+		}
+
+		c, err := bp.ReadByte()
+		if err != nil || c != 'h' {
+			t.Fatalf("unexpected ReadByte result: %q %v", c, err)
+		}
+		if err := bp.UnreadByte(); err != nil {
+			t.Fatal(err)
+		}
+		if err := bp.UnreadByte(); err != bufio.ErrInvalidUnreadByte {
+			t.Fatalf("expected bufio.ErrInvalidUnreadByte, got: %v", err)
+		}
+
+		data, err := io.ReadAll(bp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "hello world" {
+			t.Fatalf("unexpected data: %q", data)
+		}
+		if _, err := bp.Peek(1); err != io.EOF {
+			t.Fatalf("expected io.EOF, got: %v", err)
+		}
+	})
+
+	t.Run("copy keeps splicing", func(t *testing.T) {
+		if !SpliceSupported() {
+			t.Skip("splice not supported")
+		}
+
+		r1, w1 := newPipe(t)
+		r2, w2 := newPipe(t)
+
+		data := bytes.Repeat([]byte("x"), 32<<10)
+		copy(data, "\x1f\x8b")
+		if _, err := w1.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		w1.Close()
+
+		bp := NewBufferedPeeker(r1, 0)
+		magic, err := bp.Peek(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(magic) != "\x1f\x8b" {
+			t.Fatalf("unexpected magic: %q", magic)
+		}
+		buffered := bp.Buffered()
+
+		tr := &traceRecorder{}
+		ch := make(chan []byte)
+		go func() {
+			b, _ := io.ReadAll(r2)
+			ch <- b
+		}()
+		n, err := CopyContext(WithSpliceTrace(context.Background(), tr.trace()), w2, bp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w2.Close()
+		if n != int64(len(data)) {
+			t.Fatalf("expected %d bytes copied, got %d", len(data), n)
+		}
+		if got := <-ch; !bytes.Equal(got, data) {
+			t.Fatal("unexpected data")
+		}
+
+		tr.mu.Lock()
+		defer tr.mu.Unlock()
+		if tr.spliced != int64(len(data)-buffered) {
+			t.Fatalf("expected everything past the buffer to be spliced, got %d of %d bytes", tr.spliced, len(data)-buffered)
+		}
+		if len(tr.fallbacks) != 0 {
+			t.Fatalf("unexpected fallbacks: %v", tr.fallbacks)
+		}
+	})
+
+	t.Run("release", func(t *testing.T) {
+		r, w := newPipe(t)
+		if _, err := w.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+
+		bp := NewBufferedPeeker(r, 0)
+		if _, err := bp.ReadByte(); err != nil {
+			t.Fatal(err)
+		}
+		buffered, pr := bp.Release()
+		if string(buffered) != "ello" {
+			t.Fatalf("unexpected buffered data: %q", buffered)
+		}
+		if pr != r {
+			t.Fatal("expected the wrapped reader")
+		}
+	})
+}
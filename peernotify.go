@@ -0,0 +1,116 @@
+package pipes
+
+import (
+	"os"
+	"sync"
+)
+
+// peerNotify watches for the other end of a pipe going away, see
+// PipeWriter.CloseNotify and PipeReader.EOFNotify.
+//
+// The watch is started on first use, and runs on a duplicate of the pipe's
+// fd so it does not hold up reads or writes on the pipe itself. Since the
+// duplicate keeps the pipe open, it must be closed along with the pipe end
+// with stop.
+type peerNotify struct {
+	mu      sync.Mutex
+	ch      chan struct{}
+	f       *os.File // duplicate of the watched fd, nil if not watching
+	stopped bool
+}
+
+// channel returns the channel which is closed once the peer of f goes away,
+// starting the watch if needed. write is whether f is the write end of the
+// pipe.
+func (n *peerNotify) channel(f *os.File, write bool) <-chan struct{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.ch == nil {
+		n.ch = make(chan struct{})
+		if n.stopped || f == nil {
+			n.closeLocked()
+		} else {
+			n.start(f, write)
+		}
+	}
+	return n.ch
+}
+
+// stop ends the watch, closing the channel, because the pipe end is being
+// closed or detached.
+func (n *peerNotify) stop() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.stopped = true
+	if n.f != nil {
+		n.f.Close()
+		n.f = nil
+	}
+	if n.ch != nil {
+		n.closeLocked()
+	}
+}
+
+// done closes the channel once the watch has seen the peer go away, or has
+// been stopped.
+func (n *peerNotify) done() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.f != nil {
+		n.f.Close()
+		n.f = nil
+	}
+	n.closeLocked()
+}
+
+func (n *peerNotify) closeLocked() {
+	select {
+	case <-n.ch:
+	default:
+		close(n.ch)
+	}
+}
+
+// started reports whether the channel was handed out.
+func (n *peerNotify) started() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.ch != nil
+}
+
+func (n *peerNotify) isStopped() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.stopped
+}
+
+// CloseNotify returns a channel which is closed once the read end of the pipe
+// has gone away, so a producer can stop work promptly instead of finding out
+// from the next write failing with EPIPE.
+// The channel is also closed when the writer is closed or detached.
+//
+// All calls return the same channel. The first call starts watching the
+// pipe, which uses a duplicate of its fd until the writer is closed.
+// On platforms without poll(2) support the channel is only closed when the
+// writer is closed.
+func (w *PipeWriter) CloseNotify() <-chan struct{} {
+	return w.notify.channel(w.fd, true)
+}
+
+// EOFNotify returns a channel which is closed once all writers of the pipe
+// have gone away, so a consumer knows the stream is over without waiting in
+// Read. There may still be data buffered in the pipe which has not been read.
+// The channel is also closed when the reader is closed or detached.
+//
+// Note that a fifo which has never been opened for writing is not reported
+// as having lost its writers.
+//
+// All calls return the same channel. The first call starts watching the
+// pipe, which uses a duplicate of its fd until the reader is closed.
+// On platforms without poll(2) support the channel is only closed when the
+// reader is closed.
+func (r *PipeReader) EOFNotify() <-chan struct{} {
+	return r.notify.channel(r.fd, false)
+}
@@ -0,0 +1,143 @@
+package pipes
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func waitClosed(t *testing.T, ch <-chan struct{}) {
+	t.Helper()
+
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for notification")
+	}
+}
+
+func assertOpen(t *testing.T, ch <-chan struct{}) {
+	t.Helper()
+
+	select {
+	case <-ch:
+		t.Fatal("unexpected notification")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestCloseNotify(t *testing.T) {
+	t.Run("reader closed", func(t *testing.T) {
+		r, w := newPipe(t)
+
+		ch := w.CloseNotify()
+		if w.CloseNotify() != ch {
+			t.Fatal("expected the same channel from every call")
+		}
+
+		// Reads and writes must not wake up the notification.
+		if _, err := w.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(r, make([]byte, 5)); err != nil {
+			t.Fatal(err)
+		}
+		assertOpen(t, ch)
+
+		r.Close()
+		waitClosed(t, ch)
+	})
+
+	t.Run("writer closed", func(t *testing.T) {
+		r, w := newPipe(t)
+
+		ch := w.CloseNotify()
+		w.Close()
+		waitClosed(t, ch)
+
+		// The watch must not keep the pipe open.
+		if _, err := r.Read(make([]byte, 1)); err != io.EOF {
+			t.Fatalf("expected EOF, got: %v", err)
+		}
+	})
+}
+
+func TestEOFNotify(t *testing.T) {
+	t.Run("writer closed", func(t *testing.T) {
+		r, w := newPipe(t)
+
+		ch := r.EOFNotify()
+		if _, err := w.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		assertOpen(t, ch)
+
+		w.Close()
+		waitClosed(t, ch)
+
+		// Buffered data is still there to be read.
+		buf, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != "hello" {
+			t.Fatalf("expected hello, got %q", buf)
+		}
+	})
+
+	t.Run("reader closed", func(t *testing.T) {
+		r, w := newPipe(t)
+
+		ch := r.EOFNotify()
+		r.Close()
+		waitClosed(t, ch)
+
+		// The watch must not keep the pipe open.
+		if _, err := w.Write([]byte("hello")); err == nil {
+			t.Fatal("expected write to fail with the reader closed")
+		}
+	})
+
+	t.Run("after close", func(t *testing.T) {
+		r, _ := newPipe(t)
+
+		r.Close()
+		waitClosed(t, r.EOFNotify())
+	})
+}
+
+func TestIsPeerClosed(t *testing.T) {
+	r, w := newPipe(t)
+
+	if closed, err := w.IsReaderClosed(); err != nil || closed {
+		t.Fatalf("expected reader open, got: %v %v", closed, err)
+	}
+	if closed, err := r.IsWriterClosed(); err != nil || closed {
+		t.Fatalf("expected writer open, got: %v %v", closed, err)
+	}
+
+	// Probing must not consume anything from the pipe.
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	if closed, err := r.IsWriterClosed(); err != nil || !closed {
+		t.Fatalf("expected writer closed, got: %v %v", closed, err)
+	}
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Fatalf("expected hello, got %q", buf)
+	}
+
+	r2, w2 := newPipe(t)
+	r2.Close()
+	if closed, err := w2.IsReaderClosed(); err != nil || !closed {
+		t.Fatalf("expected reader closed, got: %v %v", closed, err)
+	}
+	if _, err := r2.IsWriterClosed(); err == nil {
+		t.Fatal("expected an error probing a closed reader")
+	}
+}
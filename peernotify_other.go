@@ -0,0 +1,22 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package pipes
+
+import "os"
+
+// start does nothing since there is no poll(2) on this platform, the channel
+// is only closed by stop.
+func (n *peerNotify) start(f *os.File, write bool) {}
+
+// IsReaderClosed is not supported on this platform and always returns
+// ErrNotSupported.
+func (w *PipeWriter) IsReaderClosed() (bool, error) {
+	return false, ErrNotSupported
+}
+
+// IsWriterClosed is not supported on this platform and always returns
+// ErrNotSupported.
+func (r *PipeReader) IsWriterClosed() (bool, error) {
+	return false, ErrNotSupported
+}
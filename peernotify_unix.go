@@ -0,0 +1,137 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package pipes
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerPollInterval is how often a pipe which is not supported by the Go
+// poller is checked for its peer going away.
+const peerPollInterval = 100 * time.Millisecond
+
+// start watches for the peer of f going away. It must be called with n.mu
+// held.
+func (n *peerNotify) start(f *os.File, write bool) {
+	fd, err := dupConn(f)
+	if err != nil {
+		// f is already closed or unusable, there is nothing to watch.
+		n.closeLocked()
+		return
+	}
+	n.f = os.NewFile(uintptr(fd), f.Name())
+	go n.watch(n.f, write)
+}
+
+func (n *peerNotify) watch(f *os.File, write bool) {
+	defer n.done()
+
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return
+	}
+
+	// The Go poller wakes us up on every readiness change, as well as on a
+	// hangup or error, so check which one it was.
+	hangup := func(fd uintptr) bool {
+		return peerGone(fd, 0)
+	}
+	if write {
+		err = rc.Write(hangup)
+	} else {
+		err = rc.Read(hangup)
+	}
+	if err == nil || n.isStopped() {
+		return
+	}
+
+	// The fd is not supported by the Go poller, such as a pipe in blocking
+	// mode, so poll it directly. This ties up a thread for up to
+	// peerPollInterval at a time.
+	timeout := int(peerPollInterval / time.Millisecond)
+	for {
+		var gone bool
+		err := rc.Control(func(fd uintptr) {
+			gone = peerGone(fd, timeout)
+		})
+		if err != nil || gone || n.isStopped() {
+			return
+		}
+	}
+}
+
+// peerGone polls fd for up to timeout milliseconds and reports whether the
+// other end of the pipe has gone away. A failing poll also counts as gone
+// since there is nothing left to watch.
+func peerGone(fd uintptr, timeout int) bool {
+	gone, err := pollHangup(fd, timeout)
+	if err != nil {
+		return err != unix.EINTR
+	}
+	return gone
+}
+
+// pollHangup polls fd for up to timeout milliseconds and reports whether it
+// has a hangup or error condition.
+func pollHangup(fd uintptr, timeout int) (bool, error) {
+	fds := []unix.PollFd{{Fd: int32(fd)}}
+	if _, err := unix.Poll(fds, timeout); err != nil {
+		return false, err
+	}
+	return fds[0].Revents&(unix.POLLHUP|unix.POLLERR|unix.POLLNVAL) != 0, nil
+}
+
+// IsReaderClosed reports whether the read end of the pipe has gone away,
+// without writing to the pipe. This is useful as a health check before
+// starting expensive work whose output would be thrown away.
+//
+// The result is only a snapshot, the reader may go away right after the
+// call. Use CloseNotify to be told when that happens.
+func (w *PipeWriter) IsReaderClosed() (bool, error) {
+	return probePeer(w.fd)
+}
+
+// IsWriterClosed reports whether all writers of the pipe have gone away,
+// without reading from the pipe. There may still be data buffered in the
+// pipe which has not been read.
+//
+// Note that a fifo which has never been opened for writing is not reported
+// as closed. The result is only a snapshot, use EOFNotify to be told when
+// the writers go away.
+func (r *PipeReader) IsWriterClosed() (bool, error) {
+	return probePeer(r.fd)
+}
+
+func probePeer(f *os.File) (bool, error) {
+	if f == nil {
+		return false, os.ErrInvalid
+	}
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return false, err
+	}
+
+	var (
+		gone    bool
+		pollErr error
+	)
+	err = rc.Control(func(fd uintptr) {
+		for {
+			gone, pollErr = pollHangup(fd, 0)
+			if pollErr != unix.EINTR {
+				return
+			}
+		}
+	})
+	if err != nil {
+		return false, err
+	}
+	if pollErr != nil {
+		return false, os.NewSyscallError("poll", pollErr)
+	}
+	return gone, nil
+}
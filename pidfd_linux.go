@@ -0,0 +1,83 @@
+package pipes
+
+import (
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// OpenProcessPipe gets a copy of the pipe or fifo open as fd in the process
+// pid, using pidfd_getfd(2). The fd number can be found by inspecting
+// /proc/<pid>/fd. This is useful for debugging tools which want to tap into
+// the pipes of a running process.
+//
+// pidfd_getfd(2) requires Linux 5.6 or later, and the caller must be allowed
+// to ptrace the process. If the fd is not a pipe or fifo, an error wrapping
+// ErrNotFifo is returned.
+//
+// The returned ends match the access mode the process has the fd open with:
+// a reader if it is open for reading, a writer if it is open for writing,
+// or both. Where possible the pipe is opened again through /proc so that
+// making it non-blocking does not affect the process. Otherwise the copy is
+// used as is, which shares its blocking mode with the process.
+//
+// Note that reading from the pipe consumes data the process would have read.
+func OpenProcessPipe(pid, fd int) (*PipeReader, *PipeWriter, error) {
+	name := "/proc/" + strconv.Itoa(pid) + "/fd/" + strconv.Itoa(fd)
+
+	pidfd, err := pidfdOpen(pid)
+	if err != nil {
+		return nil, nil, &os.PathError{Op: "pidfd_open", Path: name, Err: err}
+	}
+	defer unix.Close(pidfd)
+
+	nfd, err := pidfdGetfd(pidfd, fd)
+	if err != nil {
+		return nil, nil, &os.PathError{Op: "pidfd_getfd", Path: name, Err: err}
+	}
+
+	if err := checkFDIsFifo(uintptr(nfd), name); err != nil {
+		unix.Close(nfd)
+		return nil, nil, err
+	}
+
+	flags, err := unix.FcntlInt(uintptr(nfd), unix.F_GETFL, 0)
+	if err != nil {
+		unix.Close(nfd)
+		return nil, nil, os.NewSyscallError("fcntl", err)
+	}
+
+	// The copy shares its open file with the process, including the
+	// blocking mode, so get a new one to make non-blocking.
+	p := "/proc/self/fd/" + strconv.Itoa(nfd)
+	if rfd, err := unix.Open(p, flags&unix.O_ACCMODE|unix.O_NONBLOCK|unix.O_CLOEXEC, 0); err == nil {
+		unix.Close(nfd)
+		nfd = rfd
+	}
+
+	pr, pw, err := pipeEndsFromFD(nfd, flags, name)
+	if err != nil {
+		unix.Close(nfd)
+		return nil, nil, err
+	}
+	return pr, pw, nil
+}
+
+func pidfdOpen(pid int) (int, error) {
+	fd, _, errno := unix.Syscall(unix.SYS_PIDFD_OPEN, uintptr(pid), 0, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// pidfdGetfd returns a copy of targetfd in the process referred to by pidfd.
+// The new fd is close-on-exec.
+func pidfdGetfd(pidfd, targetfd int) (int, error) {
+	fd, _, errno := unix.Syscall(unix.SYS_PIDFD_GETFD, uintptr(pidfd), uintptr(targetfd), 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
@@ -0,0 +1,70 @@
+package pipes
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestOpenProcessPipe(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	cmd := exec.Command("sleep", "30")
+	cmd.Stdin = r
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	pr, pw, err := OpenProcessPipe(cmd.Process.Pid, 0)
+	if errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EPERM) {
+		t.Skipf("pidfd_getfd not available: %v", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	if pw != nil {
+		t.Fatal("expected only a reader for the process stdin")
+	}
+
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	pr.fd.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(pr, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Fatalf("expected hello, got %q", buf)
+	}
+
+	// Stdin of this process is not a pipe.
+	devnull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devnull.Close()
+	cmd2 := exec.Command("sleep", "30")
+	cmd2.Stdin = devnull
+	if err := cmd2.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd2.Wait()
+	defer cmd2.Process.Kill()
+	if _, _, err := OpenProcessPipe(cmd2.Process.Pid, 0); !errors.Is(err, ErrNotFifo) {
+		t.Fatalf("expected ErrNotFifo, got %v", err)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package pipes
+
+// OpenProcessPipe is not supported on this platform and always returns
+// ErrNotSupported.
+func OpenProcessPipe(pid, fd int) (*PipeReader, *PipeWriter, error) {
+	return nil, nil, ErrNotSupported
+}
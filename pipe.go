@@ -0,0 +1,185 @@
+package pipes
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// pipeState is shared between the two ends of a pipe which were created
+// together in this process, to pass the errors given to CloseWithError from
+// one end to the other.
+type pipeState struct {
+	mu   sync.Mutex
+	rerr error // returned by the reader instead of EOF
+	werr error // returned by the writer instead of EPIPE
+}
+
+func (s *pipeState) readErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rerr
+}
+
+func (s *pipeState) writeErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.werr
+}
+
+// newPipePair wraps r and w, which must be the two ends of the same pipe, so
+// that CloseWithError on one end is seen by the other.
+func newPipePair(r, w *os.File) (*PipeReader, *PipeWriter) {
+	s := &pipeState{}
+	pr, pw := newReader(r), newWriter(w)
+	pr.state, pw.state = s, s
+	return pr, pw
+}
+
+// newReader wraps f, which must be the read end of a pipe or fifo.
+// All readers should be created with newReader so leak detection can track
+// them.
+func newReader(f *os.File) *PipeReader {
+	r := &PipeReader{fd: f, active: 1}
+	r.leak = trackLeak(r, f, "reader")
+	atomic.AddInt64(&metrics.active, 1)
+	return r
+}
+
+// newWriter wraps f, which must be the write end of a pipe or fifo.
+// All writers should be created with newWriter so leak detection can track
+// them.
+func newWriter(f *os.File) *PipeWriter {
+	w := &PipeWriter{fd: f, active: 1}
+	w.leak = trackLeak(w, f, "writer")
+	atomic.AddInt64(&metrics.active, 1)
+	return w
+}
+
+// rawConnCache caches the syscall.RawConn of a pipe end, since os.File
+// allocates a new one on every call to SyscallConn.
+type rawConnCache struct {
+	once sync.Once
+	rc   syscall.RawConn
+	err  error
+}
+
+// get returns the RawConn for f, which must be the same file on every call.
+func (c *rawConnCache) get(f *os.File) (syscall.RawConn, error) {
+	c.once.Do(func() {
+		c.rc, c.err = f.SyscallConn()
+	})
+	return c.rc, c.err
+}
+
+// release drops a pipe end from the count of active pipes the first time it
+// is closed or detached. active must point to the pipe end's active field.
+func release(active *int32) {
+	if atomic.CompareAndSwapInt32(active, 1, 0) {
+		atomic.AddInt64(&metrics.active, -1)
+	}
+}
+
+// CloseWithError closes the reader. Subsequent writes to the write end of the
+// pipe return err instead of failing with EPIPE.
+// If err is nil this is the same as Close.
+//
+// The error is only passed along when both ends were created together with
+// New. Otherwise, such as for a fifo shared with another process, the peer
+// only sees the pipe being closed.
+func (r *PipeReader) CloseWithError(err error) error {
+	if err != nil && r.state != nil {
+		r.state.mu.Lock()
+		if r.state.werr == nil {
+			r.state.werr = err
+		}
+		r.state.mu.Unlock()
+	}
+	return r.Close()
+}
+
+// CloseWithError closes the writer. Once all data written before the call has
+// been read, reads from the read end of the pipe return err instead of EOF.
+// If err is nil this is the same as Close.
+//
+// The error is only passed along when both ends were created together with
+// New. Otherwise, such as for a fifo shared with another process, the peer
+// only sees the pipe being closed.
+func (w *PipeWriter) CloseWithError(err error) error {
+	if err != nil && w.state != nil {
+		w.state.mu.Lock()
+		if w.state.rerr == nil {
+			w.state.rerr = err
+		}
+		w.state.mu.Unlock()
+	}
+	return w.Close()
+}
+
+// readResult replaces an EOF with the error the writer was closed with, if
+// any.
+func (r *PipeReader) readResult(err error) error {
+	if err == io.EOF && r.state != nil {
+		if cerr := r.state.readErr(); cerr != nil {
+			return cerr
+		}
+	}
+	return err
+}
+
+// copyResult returns the error the writer was closed with, if any, for a
+// copy out of the pipe which stopped at EOF.
+// An EPIPE from the destination is made to match ErrClosedPipe.
+func (r *PipeReader) copyResult(n int64, err error) (int64, error) {
+	r.addRead(n)
+	if err == nil && r.state != nil {
+		err = r.state.readErr()
+	}
+	return n, mapErrno(err)
+}
+
+// writeResult replaces an EPIPE with the error the reader was closed with,
+// if any. Otherwise EPIPE is made to match ErrClosedPipe, see mapErrno.
+func (w *PipeWriter) writeResult(err error) error {
+	if err != nil && w.state != nil && errors.Is(err, syscall.EPIPE) {
+		if cerr := w.state.writeErr(); cerr != nil {
+			return cerr
+		}
+	}
+	return mapErrno(err)
+}
+
+// BytesRead returns the total number of bytes read from the pipe through the
+// reader, including data spliced out of the pipe by WriteTo and CopyN, and data
+// thrown away by Discard and Drain.
+//
+// Data moved by helpers which operate on the fd directly, such as TeeCopy and
+// Copier, is not counted.
+func (r *PipeReader) BytesRead() int64 {
+	return atomic.LoadInt64(&r.nread)
+}
+
+func (r *PipeReader) addRead(n int64) {
+	if n > 0 {
+		atomic.AddInt64(&r.nread, n)
+	}
+}
+
+// BytesWritten returns the total number of bytes written to the pipe through
+// the writer, including data spliced into the pipe by ReadFrom, CopyN and
+// WriteBuffers.
+//
+// Data moved by helpers which operate on the fd directly, such as TeeCopy and
+// Copier, is not counted.
+func (w *PipeWriter) BytesWritten() int64 {
+	return atomic.LoadInt64(&w.nwritten)
+}
+
+func (w *PipeWriter) addWritten(n int64) {
+	if n > 0 {
+		atomic.AddInt64(&w.nwritten, n)
+	}
+}
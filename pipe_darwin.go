@@ -0,0 +1,57 @@
+package pipes
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// mkPipe creates a non-blocking, close-on-exec pipe.
+// pipe2(2) is not available on darwin so the flags are set after the fact,
+// holding syscall.ForkLock so the fds cannot leak into a child process in
+// between.
+func mkPipe() ([2]int, error) {
+	var p [2]int
+
+	syscall.ForkLock.RLock()
+	defer syscall.ForkLock.RUnlock()
+
+	if err := unix.Pipe(p[:]); err != nil {
+		return p, err
+	}
+	unix.CloseOnExec(p[0])
+	unix.CloseOnExec(p[1])
+
+	for _, fd := range p {
+		if err := unix.SetNonblock(fd, true); err != nil {
+			unix.Close(p[0])
+			unix.Close(p[1])
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// mkSocketpair creates a pair of connected, non-blocking, close-on-exec unix
+// stream sockets.
+// See mkPipe for why syscall.ForkLock is held.
+func mkSocketpair() ([2]int, error) {
+	syscall.ForkLock.RLock()
+	defer syscall.ForkLock.RUnlock()
+
+	p, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		return p, err
+	}
+	unix.CloseOnExec(p[0])
+	unix.CloseOnExec(p[1])
+
+	for _, fd := range p {
+		if err := unix.SetNonblock(fd, true); err != nil {
+			unix.Close(p[0])
+			unix.Close(p[1])
+			return p, err
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,19 @@
+//go:build linux || freebsd
+// +build linux freebsd
+
+package pipes
+
+import "golang.org/x/sys/unix"
+
+// mkPipe creates a non-blocking, close-on-exec pipe using pipe2(2).
+func mkPipe() ([2]int, error) {
+	var p [2]int
+	err := unix.Pipe2(p[:], unix.O_CLOEXEC|unix.O_NONBLOCK)
+	return p, err
+}
+
+// mkSocketpair creates a pair of connected, non-blocking, close-on-exec unix
+// stream sockets.
+func mkSocketpair() ([2]int, error) {
+	return unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, 0)
+}
@@ -0,0 +1,4 @@
+package pipes
+
+// pipeBuf is PIPE_BUF, the largest write the kernel keeps in one piece.
+const pipeBuf = 4096
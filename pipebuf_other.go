@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package pipes
+
+// pipeBuf is PIPE_BUF on darwin and FreeBSD. It is also the smallest PIPE_BUF
+// POSIX allows, so it is used for other platforms as well.
+const pipeBuf = 512
@@ -0,0 +1,202 @@
+package pipes
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Pipeline wires a source to a destination through a sequence of stages,
+// each connected by a pipe.
+//
+// Data is moved between the source, the pipes, and the destination using
+// ReadFrom/WriteTo so splice(2) is used whenever both ends support it.
+// Only the stages themselves need to touch the data in userspace.
+type Pipeline struct {
+	src    io.Reader
+	dst    io.Writer
+	stages []Stage
+
+	mu      sync.Mutex
+	started bool
+	cancel  context.CancelFunc
+	closers []io.Closer
+	errs    []error
+	wg      sync.WaitGroup
+	// finished is set once all the hops have exited.
+	finished bool
+	// interrupted is set when the deadlines of src and dst were expired to
+	// tear the pipeline down, see closeAll.
+	interrupted bool
+}
+
+// NewPipeline creates a pipeline which copies from src to dst, passing the
+// data through each of the provided stages in order.
+// If there are no stages, data is copied directly from src to dst through a
+// single pipe.
+func NewPipeline(src io.Reader, dst io.Writer, stages ...Stage) *Pipeline {
+	return &Pipeline{src: src, dst: dst, stages: stages}
+}
+
+// Start creates all the pipes and starts the pipeline.
+// Use Wait to wait for the pipeline to complete or Stop to tear it down early.
+func (p *Pipeline) Start(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.started {
+		return errors.New("pipeline already started")
+	}
+
+	readers := make([]*PipeReader, 0, len(p.stages)+1)
+	writers := make([]*PipeWriter, 0, len(p.stages)+1)
+	for i := 0; i <= len(p.stages); i++ {
+		r, w, err := New()
+		if err != nil {
+			for j := range readers {
+				readers[j].Close()
+				writers[j].Close()
+			}
+			return err
+		}
+		readers = append(readers, r)
+		writers = append(writers, w)
+		p.closers = append(p.closers, r, w)
+	}
+
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.started = true
+
+	p.goHop(func() error {
+		defer writers[0].Close()
+		_, err := writers[0].ReadFrom(p.src)
+		return err
+	})
+
+	for i, stage := range p.stages {
+		stage, r, w := stage, readers[i], writers[i+1]
+		p.goHop(func() error {
+			defer w.Close()
+			return stage.RunStage(ctx, r, w)
+		})
+	}
+
+	last := readers[len(readers)-1]
+	p.goHop(func() error {
+		defer last.Close()
+		_, err := last.WriteTo(p.dst)
+		return err
+	})
+
+	go func() {
+		<-ctx.Done()
+		p.closeAll()
+	}()
+
+	return nil
+}
+
+func (p *Pipeline) goHop(f func() error) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		if err := f(); err != nil {
+			p.mu.Lock()
+			p.errs = append(p.errs, err)
+			p.mu.Unlock()
+			// Tear everything down so other hops are not left blocked forever.
+			p.cancel()
+		}
+	}()
+}
+
+func (p *Pipeline) closeAll() {
+	p.mu.Lock()
+	closers := p.closers
+	// Closing the pipes does not unblock a hop stuck reading from src or
+	// writing to dst, so interrupt those too where they support deadlines.
+	// This is done with p.mu held so Wait cannot clear the deadlines before
+	// they are set.
+	if !p.finished {
+		p.interrupted = true
+		p.setDeadlines(time.Unix(1, 0))
+	}
+	p.mu.Unlock()
+
+	for _, c := range closers {
+		c.Close()
+	}
+}
+
+// Wait waits for the pipeline to complete and returns all errors encountered
+// by the individual hops.
+// Errors caused by the pipeline being torn down are not included.
+func (p *Pipeline) Wait() error {
+	p.mu.Lock()
+	started := p.started
+	p.mu.Unlock()
+	if !started {
+		return errors.New("pipeline not started")
+	}
+
+	p.wg.Wait()
+
+	p.mu.Lock()
+	p.finished = true
+	if p.interrupted {
+		p.setDeadlines(time.Time{})
+	}
+	p.mu.Unlock()
+
+	p.cancel()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var errs []error
+	for _, err := range p.errs {
+		if errors.Is(err, os.ErrClosed) || errors.Is(err, context.Canceled) {
+			continue
+		}
+		if p.interrupted && errors.Is(err, os.ErrDeadlineExceeded) {
+			continue
+		}
+		errs = append(errs, err)
+	}
+	return joinErrors(errs...)
+}
+
+// setDeadlines sets the read deadline of src and the write deadline of dst to
+// t, where they support deadlines.
+func (p *Pipeline) setDeadlines(t time.Time) {
+	if d, ok := p.src.(interface{ SetReadDeadline(time.Time) error }); ok {
+		d.SetReadDeadline(t)
+	}
+	if d, ok := p.dst.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		d.SetWriteDeadline(t)
+	}
+}
+
+// Stop tears down the pipeline and waits for all hops to exit.
+//
+// Closing the pipes between the hops does not interrupt a hop blocked reading
+// from the source or writing to the destination. If they support deadlines,
+// such as a net.Conn or an *os.File pipe, Stop expires the read deadline of
+// the source and the write deadline of the destination, and clears them once
+// the hops have exited; any deadline set on them before is lost. Otherwise
+// Stop blocks until the source and destination return.
+// The same applies when the pipeline is torn down because a hop failed or
+// the context passed to Start is done.
+func (p *Pipeline) Stop() error {
+	p.mu.Lock()
+	cancel := p.cancel
+	p.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	return p.Wait()
+}
@@ -0,0 +1,153 @@
+package pipes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPipeline(t *testing.T) {
+	upper := TransformStage(func(p []byte) ([]byte, error) {
+		return bytes.ToUpper(p), nil
+	})
+
+	t.Run("no stages", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		p := NewPipeline(strings.NewReader("hello"), buf)
+		if err := p.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Wait(); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != "hello" {
+			t.Fatalf("expected %q, got %q", "hello", buf)
+		}
+	})
+
+	t.Run("stages", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		p := NewPipeline(strings.NewReader("hello"), buf, upper, PassthroughStage(), upper)
+		if err := p.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Wait(); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != "HELLO" {
+			t.Fatalf("expected %q, got %q", "HELLO", buf)
+		}
+	})
+
+	t.Run("stage error", func(t *testing.T) {
+		errStage := errors.New("boom")
+		fail := StageFunc(func(ctx context.Context, r *PipeReader, w *PipeWriter) error {
+			return errStage
+		})
+
+		p := NewPipeline(strings.NewReader("hello"), io.Discard, fail)
+		if err := p.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Wait(); !errors.Is(err, errStage) {
+			t.Fatalf("expected %v, got %v", errStage, err)
+		}
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		src, _ := newPipe(t)
+
+		p := NewPipeline(src, io.Discard)
+		if err := p.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		chErr := make(chan error, 1)
+		go func() { chErr <- p.Stop() }()
+
+		select {
+		case err := <-chErr:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for pipeline to stop")
+		}
+	})
+}
+
+func TestPipelineStopBlocked(t *testing.T) {
+	stop := func(t *testing.T, p *Pipeline) {
+		t.Helper()
+
+		chErr := make(chan error, 1)
+		go func() { chErr <- p.Stop() }()
+
+		select {
+		case err := <-chErr:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for pipeline to stop")
+		}
+	}
+
+	t.Run("source", func(t *testing.T) {
+		// The peer never writes, so the source hop is blocked reading.
+		src, peer := newTCPPair(t)
+
+		p := NewPipeline(src, io.Discard)
+		if err := p.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+		stop(t, p)
+
+		// The deadline is cleared again once the pipeline is stopped.
+		if _, err := peer.Write([]byte("x")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := src.Read(make([]byte, 1)); err != nil {
+			t.Fatalf("expected the read deadline to be cleared: %v", err)
+		}
+	})
+
+	t.Run("destination", func(t *testing.T) {
+		// Nothing reads from the other end, so the destination hop is
+		// blocked writing.
+		dst, peer := net.Pipe()
+		defer dst.Close()
+		defer peer.Close()
+
+		p := NewPipeline(strings.NewReader("hello"), dst)
+		if err := p.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+		stop(t, p)
+	})
+}
+
+func TestFilterStage(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	filter := FilterStage(func(p []byte) bool {
+		return !bytes.Contains(p, []byte("drop"))
+	})
+
+	p := NewPipeline(strings.NewReader("drop me"), buf, filter)
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected no data, got %q", buf)
+	}
+}
@@ -0,0 +1,261 @@
+package pipes
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxIdlePipes is the default maximum number of idle pipes kept in a pool.
+const maxIdlePipes = 32
+
+// pooledPipe is a pipe which can be reused across copy operations.
+// The raw file descriptors are cached so internal users can use them directly
+// without going through the *os.File wrappers.
+type pooledPipe struct {
+	r    *PipeReader
+	w    *PipeWriter
+	rfd  int
+	wfd  int
+	size int
+}
+
+func (p *pooledPipe) close() {
+	p.r.Close()
+	p.w.Close()
+}
+
+// reset makes sure the pipe is in a usable state to hand out again.
+// It returns false if the pipe should be discarded.
+func (p *pooledPipe) reset() bool {
+	rc, err := p.r.SyscallConn()
+	if err != nil {
+		return false
+	}
+	wc, err := p.w.SyscallConn()
+	if err != nil {
+		return false
+	}
+
+	// A pipe which is being watched for its peer going away has handed out
+	// a notification channel which would be stale for the next user.
+	if p.r.notify.started() || p.w.notify.started() {
+		return false
+	}
+
+	// Go through Control so we know the fds have not been closed (and
+	// potentially re-used) out from under us.
+	var ok bool
+	err = wc.Control(func(wfd uintptr) {
+		err := rc.Control(func(rfd uintptr) {
+			ok = resetPipe(int(rfd), int(wfd), p.size)
+		})
+		if err != nil {
+			ok = false
+		}
+	})
+	if err != nil || !ok {
+		return false
+	}
+
+	// A deadline left behind would make the next user's reads or writes
+	// fail right away.
+	if p.r.fd.SetDeadline(time.Time{}) != nil || p.w.fd.SetDeadline(time.Time{}) != nil {
+		return false
+	}
+
+	atomic.StoreInt64(&p.r.nread, 0)
+	atomic.StoreInt64(&p.w.nwritten, 0)
+	p.w.SetMaxSpliceSize(0)
+	return true
+}
+
+func resetPipe(rfd, wfd, size int) bool {
+	cur, err := unix.FcntlInt(uintptr(wfd), unix.F_GETPIPE_SZ, 0)
+	if err != nil {
+		return false
+	}
+	if cur != size {
+		if _, err := unix.FcntlInt(uintptr(wfd), unix.F_SETPIPE_SZ, size); err != nil {
+			return false
+		}
+	}
+
+	for _, fd := range []int{rfd, wfd} {
+		flags, err := unix.FcntlInt(uintptr(fd), unix.F_GETFL, 0)
+		if err != nil {
+			return false
+		}
+		if flags&unix.O_NONBLOCK == 0 {
+			if err := unix.SetNonblock(fd, true); err != nil {
+				return false
+			}
+		}
+	}
+
+	// Make sure there is no residual data left in the pipe.
+	n, err := unix.IoctlGetInt(rfd, unix.TIOCINQ) // FIONREAD
+	if err != nil {
+		return false
+	}
+	if n > 0 {
+		if err := drainFd(rfd, int64(n)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// PipePool is a pool of pipes, which amortizes the cost of creating and
+// closing pipes for applications which need pipes for short-lived operations,
+// such as a copy per request.
+//
+// Pipes are reset when they are put back: any data left in the pipe is
+// discarded, the pipe size, non-blocking mode and byte counters are restored,
+// any read or write deadlines are cleared, and pipes which were closed are
+// dropped.
+//
+// The zero value is an empty pool ready to use. A PipePool must not be copied
+// after first use.
+type PipePool struct {
+	// MaxIdle is the maximum number of idle pipes kept in the pool, any
+	// pipes put back beyond that are closed. If zero, 32 pipes are kept.
+	MaxIdle int
+
+	mu       sync.Mutex
+	free     []*pooledPipe
+	borrowed map[*PipeReader]*pooledPipe
+	closed   bool
+}
+
+// pipeBufs is the pool used for all pipes created internally by the package.
+var pipeBufs = &PipePool{}
+
+// Get returns a pipe from the pool, creating a new one if the pool is empty.
+// The pipe should be returned with Put when done rather than closed.
+func (pp *PipePool) Get() (*PipeReader, *PipeWriter, error) {
+	p, err := pp.get()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pp.mu.Lock()
+	if pp.borrowed == nil {
+		pp.borrowed = make(map[*PipeReader]*pooledPipe)
+	}
+	pp.borrowed[p.r] = p
+	pp.mu.Unlock()
+
+	return p.r, p.w, nil
+}
+
+// Put returns a pipe obtained from Get to the pool.
+//
+// If the pipe was closed or is otherwise unusable it is discarded.
+// Passing a pipe which did not come from Get on this pool is a no-op.
+func (pp *PipePool) Put(r *PipeReader, w *PipeWriter) {
+	pp.mu.Lock()
+	p, ok := pp.borrowed[r]
+	if ok {
+		delete(pp.borrowed, r)
+	}
+	pp.mu.Unlock()
+
+	if !ok || p.w != w {
+		return
+	}
+	pp.put(p)
+}
+
+// Close closes the idle pipes in the pool. Pipes which are currently
+// borrowed are closed when they are put back.
+func (pp *PipePool) Close() error {
+	pp.mu.Lock()
+	free := pp.free
+	pp.free = nil
+	pp.closed = true
+	pp.mu.Unlock()
+
+	for _, p := range free {
+		p.close()
+	}
+	return nil
+}
+
+func (pp *PipePool) get() (*pooledPipe, error) {
+	pp.mu.Lock()
+	if len(pp.free) > 0 {
+		p := pp.free[len(pp.free)-1]
+		pp.free = pp.free[:len(pp.free)-1]
+		pp.mu.Unlock()
+		return p, nil
+	}
+	pp.mu.Unlock()
+
+	r, w, err := New()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &pooledPipe{r: r, w: w, rfd: -1, wfd: -1}
+	if rc, err := r.SyscallConn(); err == nil {
+		rc.Control(func(fd uintptr) { p.rfd = int(fd) })
+	}
+	if wc, err := w.SyscallConn(); err == nil {
+		wc.Control(func(fd uintptr) { p.wfd = int(fd) })
+	}
+	if p.rfd == -1 || p.wfd == -1 {
+		p.close()
+		return nil, unix.EBADF
+	}
+
+	size, err := unix.FcntlInt(uintptr(p.wfd), unix.F_GETPIPE_SZ, 0)
+	if err != nil {
+		p.close()
+		return nil, err
+	}
+	p.size = size
+
+	return p, nil
+}
+
+func (pp *PipePool) put(p *pooledPipe) {
+	if !p.reset() {
+		p.close()
+		return
+	}
+
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+
+	maxIdle := pp.MaxIdle
+	if maxIdle == 0 {
+		maxIdle = maxIdlePipes
+	}
+	if pp.closed || len(pp.free) >= maxIdle {
+		p.close()
+		return
+	}
+	pp.free = append(pp.free, p)
+}
+
+// BorrowPipe returns a pipe from the package's internal pool of pipes.
+// This is the same pool used for the intermediate pipes in Copy, TeeCopy, and
+// Copier, and is much cheaper than calling New when pipes are needed for
+// short-lived operations.
+//
+// The pipe must be returned with ReturnPipe when done rather than closed.
+func BorrowPipe() (*PipeReader, *PipeWriter, error) {
+	return pipeBufs.Get()
+}
+
+// ReturnPipe returns a pipe obtained from BorrowPipe to the pool.
+//
+// Any data left in the pipe is discarded and the pipe size is reset.
+// If the pipe was closed or is otherwise unusable it is discarded.
+// Passing a pipe which did not come from BorrowPipe is a no-op.
+func ReturnPipe(r *PipeReader, w *PipeWriter) {
+	pipeBufs.Put(r, w)
+}
@@ -0,0 +1,144 @@
+package pipes
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestBorrowPipe(t *testing.T) {
+	r, w, err := BorrowPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.Write([]byte("leftover")); err != nil {
+		t.Fatal(err)
+	}
+	ReturnPipe(r, w)
+
+	r2, w2, err := BorrowPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReturnPipe(r2, w2)
+
+	if r2 != r || w2 != w {
+		t.Fatal("expected pipe to be reused")
+	}
+
+	rc, err := r2.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		n        int
+		ioctlErr error
+	)
+	rc.Control(func(fd uintptr) {
+		n, ioctlErr = unix.IoctlGetInt(int(fd), unix.TIOCINQ)
+	})
+	if ioctlErr != nil {
+		t.Fatal(ioctlErr)
+	}
+	if n != 0 {
+		t.Fatalf("expected reused pipe to be empty, has %d bytes", n)
+	}
+}
+
+func TestReturnClosedPipe(t *testing.T) {
+	r, w, err := BorrowPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	ReturnPipe(r, w)
+
+	r2, w2, err := BorrowPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReturnPipe(r2, w2)
+
+	if r2 == r {
+		t.Fatal("closed pipe should not be reused")
+	}
+}
+
+func TestPipePool(t *testing.T) {
+	var pool PipePool
+	pool.MaxIdle = 1
+	defer pool.Close()
+
+	r, w, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, w2, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.Write([]byte("leftover")); err != nil {
+		t.Fatal(err)
+	}
+	pool.Put(r, w)
+	// Over MaxIdle, so this one is closed.
+	pool.Put(r2, w2)
+	if _, err := w2.Write([]byte("x")); err == nil {
+		t.Fatal("expected pipe beyond MaxIdle to be closed")
+	}
+
+	r3, w3, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r3 != r || w3 != w {
+		t.Fatal("expected pipe to be reused")
+	}
+	if r3.BytesRead() != 0 || w3.BytesWritten() != 0 {
+		t.Fatalf("expected counters to be reset, got %d read, %d written", r3.BytesRead(), w3.BytesWritten())
+	}
+	if n, err := r3.Buffered(); err != nil || n != 0 {
+		t.Fatalf("expected reused pipe to be empty, got: %d %v", n, err)
+	}
+
+	// Deadlines are cleared for the next user.
+	r3.fd.SetReadDeadline(time.Unix(1, 0))
+	w3.fd.SetWriteDeadline(time.Unix(1, 0))
+	pool.Put(r3, w3)
+	r3, w3, err = pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r3 != r || w3 != w {
+		t.Fatal("expected pipe with an expired deadline to be reused")
+	}
+	if _, err := w3.Write([]byte("x")); err != nil {
+		t.Fatalf("expected write deadline to be cleared: %v", err)
+	}
+	if _, err := r3.Read(make([]byte, 1)); err != nil {
+		t.Fatalf("expected read deadline to be cleared: %v", err)
+	}
+
+	// Pipes handed out notification channels are not reused.
+	w3.CloseNotify()
+	pool.Put(r3, w3)
+	r4, w4, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r4 == r3 {
+		t.Fatal("expected watched pipe to be discarded")
+	}
+	pool.Put(r4, w4)
+
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w4.Write([]byte("x")); err == nil {
+		t.Fatal("expected idle pipe to be closed by Close")
+	}
+}
@@ -0,0 +1,29 @@
+//go:build !linux
+// +build !linux
+
+package pipes
+
+// PipePool is a pool of pipes.
+// There is no pooling on this platform, Get creates a new pipe and Put
+// closes it.
+type PipePool struct {
+	// MaxIdle is the maximum number of idle pipes kept in the pool.
+	// It has no effect on this platform.
+	MaxIdle int
+}
+
+// Get returns a new pipe, the same as New.
+func (pp *PipePool) Get() (*PipeReader, *PipeWriter, error) {
+	return New()
+}
+
+// Put closes a pipe obtained from Get.
+func (pp *PipePool) Put(r *PipeReader, w *PipeWriter) {
+	r.Close()
+	w.Close()
+}
+
+// Close does nothing on this platform since no pipes are kept idle.
+func (pp *PipePool) Close() error {
+	return nil
+}
@@ -2,12 +2,22 @@ package pipes
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 func newPipe(t testing.TB) (*PipeReader, *PipeWriter) {
@@ -52,6 +62,51 @@ func TestReadFrom(t *testing.T) {
 		})
 	})
 
+	t.Run("max splice size", func(t *testing.T) {
+		f := createFile(t)
+		pr, pw := newPipe(t)
+		pw.SetMaxSpliceSize(4096)
+
+		go drainPipe(pr)
+
+		prepareReadFrom(t, f, 1e6)
+		f.Seek(0, io.SeekStart)
+
+		doReadFromTest(t, pw, f, 1e6)
+	})
+
+	t.Run("section reader", func(t *testing.T) {
+		f := createFile(t)
+		pr, pw := newPipe(t)
+
+		if _, err := f.Write([]byte("hello world")); err != nil {
+			t.Fatal(err)
+		}
+
+		sr := io.NewSectionReader(f, 6, 5)
+		if _, err := sr.Seek(1, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+
+		doReadFromTest(t, pw, sr, 4)
+		pw.Close()
+
+		buf, err := io.ReadAll(pr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != "orld" {
+			t.Fatalf("expected %q, got %q", "orld", buf)
+		}
+
+		if pos, _ := sr.Seek(0, io.SeekCurrent); pos != 5 {
+			t.Fatalf("expected section reader to be advanced to 5, got %d", pos)
+		}
+		if pos, _ := f.Seek(0, io.SeekCurrent); pos != 11 {
+			t.Fatalf("expected file offset to be untouched, got %d", pos)
+		}
+	})
+
 	t.Run("userspace", func(t *testing.T) {
 		t.Run("fallback copy", func(t *testing.T) {
 			pr, pw := newPipe(t)
@@ -73,6 +128,135 @@ func TestReadFrom(t *testing.T) {
 	})
 }
 
+func TestReadFromBuffer(t *testing.T) {
+	pr, pw := newPipe(t)
+
+	done := make(chan []byte, 1)
+	go func() {
+		data, _ := io.ReadAll(pr)
+		done <- data
+	}()
+
+	// Hide the WriteTo method of the source so the copy must go through the
+	// buffer.
+	data := bytes.Repeat([]byte("hello"), 1000)
+	src := struct{ io.Reader }{bytes.NewReader(data)}
+
+	buf := make([]byte, 64)
+	n, err := pw.ReadFromBuffer(src, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) {
+		t.Fatalf("expected %d bytes, got %d", len(data), n)
+	}
+	if pw.BytesWritten() != n {
+		t.Fatalf("expected %d bytes written, got %d", n, pw.BytesWritten())
+	}
+	if !bytes.Contains(buf, []byte("hello")) {
+		t.Fatalf("expected the copy to go through the passed in buffer, got %q", buf)
+	}
+
+	pw.Close()
+	if got := <-done; !bytes.Equal(got, data) {
+		t.Fatal("data mismatch")
+	}
+}
+
+func TestWriteToBuffer(t *testing.T) {
+	pr, pw := newPipe(t)
+
+	data := bytes.Repeat([]byte("hello"), 1000)
+	go func() {
+		pw.Write(data)
+		pw.Close()
+	}()
+
+	// Hide the ReadFrom method of the destination so the copy must go
+	// through the buffer.
+	var out bytes.Buffer
+	dst := struct{ io.Writer }{&out}
+
+	buf := make([]byte, 64)
+	n, err := pr.WriteToBuffer(dst, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) || !bytes.Equal(out.Bytes(), data) {
+		t.Fatalf("expected %d bytes, got %d", len(data), n)
+	}
+	if !bytes.Contains(buf, []byte("hello")) {
+		t.Fatalf("expected the copy to go through the passed in buffer, got %q", buf)
+	}
+}
+
+func TestWriteBuffers(t *testing.T) {
+	r, w := newPipe(t)
+
+	bufs := [][]byte{
+		[]byte("hello "),
+		{},
+		bytes.Repeat([]byte("a"), 1e6),
+		[]byte(" world"),
+	}
+	expected := bytes.Join(bufs, nil)
+
+	chBuf := make(chan []byte, 1)
+	go func() {
+		buf, _ := io.ReadAll(r)
+		chBuf <- buf
+	}()
+
+	n, err := w.WriteBuffers(bufs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(expected)) {
+		t.Fatalf("expected %d bytes, got %d", len(expected), n)
+	}
+	w.Close()
+
+	if buf := <-chBuf; !bytes.Equal(buf, expected) {
+		t.Fatalf("got unexpected data: %d bytes", len(buf))
+	}
+}
+
+func TestGiftBuffers(t *testing.T) {
+	r, w := newPipe(t)
+
+	b, err := AllocPages(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer FreePages(b)
+
+	if _, err := w.GiftBuffers([][]byte{b[:1]}); err != ErrNotPageAligned {
+		t.Fatalf("expected ErrNotPageAligned, got: %v", err)
+	}
+
+	copy(b, "hello")
+	expected := append([]byte(nil), b...)
+
+	chBuf := make(chan []byte, 1)
+	go func() {
+		buf, _ := io.ReadAll(r)
+		chBuf <- buf
+	}()
+
+	n, err := w.GiftBuffers([][]byte{b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(b)) {
+		t.Fatalf("expected %d bytes, got %d", len(b), n)
+	}
+	w.Close()
+
+	if buf := <-chBuf; !bytes.Equal(buf, expected) {
+		t.Fatalf("got unexpected data: %d bytes", len(buf))
+	}
+}
+
 func TestOpenFifo(t *testing.T) {
 	t.Run("async", func(t *testing.T) {
 		dir := t.TempDir()
@@ -156,6 +340,135 @@ func TestOpenFifo(t *testing.T) {
 	})
 }
 
+func TestAsyncOpenFifoShared(t *testing.T) {
+	dir := t.TempDir()
+
+	const n = 20
+	before := runtime.NumGoroutine()
+
+	var results []<-chan OpenFifoResult
+	for i := 0; i < n; i++ {
+		ch, err := AsyncOpenFifo(filepath.Join(dir, strconv.Itoa(i)), os.O_WRONLY|os.O_CREATE, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, ch)
+	}
+
+	// The waiter and the inotify reader.
+	if after := runtime.NumGoroutine(); after-before > 2 {
+		t.Fatalf("expected pending opens to share a goroutine, got %d new goroutines", after-before)
+	}
+
+	for i, ch := range results {
+		select {
+		case r := <-ch:
+			t.Fatalf("unexpected result before there is a reader: %v", r.Err)
+		default:
+		}
+
+		r, _, err := OpenFifo(filepath.Join(dir, strconv.Itoa(i)), os.O_RDONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+
+		select {
+		case result := <-ch:
+			if result.Err != nil {
+				t.Fatal(result.Err)
+			}
+			if result.R != nil || result.W == nil {
+				t.Fatal("expected only a writer for a write only request")
+			}
+			result.W.Close()
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for async open")
+		}
+
+		// The completed open's fifo is no longer watched.
+		deadline := time.Now().Add(5 * time.Second)
+		for watched := asyncFifoWatches(); watched != n-i-1; watched = asyncFifoWatches() {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d watched fifos, got %d", n-i-1, watched)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// The waiter goes away once there is nothing left to wait for.
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the waiter to exit, have %d goroutines, started with %d", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func asyncFifoWatches() int {
+	asyncFifos.mu.Lock()
+	defer asyncFifos.mu.Unlock()
+	return len(asyncFifos.watch.refs)
+}
+
+func TestOpenFifoBlocking(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, filepath.Base(t.Name()))
+
+	if err := unix.Mkfifo(p, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		r   *PipeReader
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		r, _, err := OpenFifoBlocking(p, os.O_RDONLY, 0)
+		ch <- result{r, err}
+	}()
+
+	select {
+	case res := <-ch:
+		t.Fatalf("open should block until there is a writer: %v", res.err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	_, w, err := OpenFifoBlocking(p, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	var r *PipeReader
+	select {
+	case res := <-ch:
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		r = res.r
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for open")
+	}
+	defer r.Close()
+
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	// The reader is read-only, so it sees EOF once the writer is closed.
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Fatalf("expected hello, got %q", buf)
+	}
+}
+
 func TestOpenFifoCloseRDWR(t *testing.T) {
 	dir := t.TempDir()
 	p := filepath.Join(dir, filepath.Base(t.Name()))
@@ -167,9 +480,458 @@ func TestOpenFifoCloseRDWR(t *testing.T) {
 	if err := r.Close(); err != nil {
 		t.Fatal(err)
 	}
+
+	// Closing the reader must not affect the writer.
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	r2, err := os.OpenFile(p, os.O_RDONLY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(r2, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Fatalf("expected hello, got %q", buf)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, w, err = OpenFifo(p, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
 	if err := w.Close(); err != nil {
 		t.Fatal(err)
 	}
+
+	// Closing the writer must not affect the reader.
+	if err := r.fd.SetReadDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Read(buf); !os.IsTimeout(err) {
+		t.Fatalf("expected timeout reading with the writer closed, got %v", err)
+	}
+}
+
+func TestOpenFifoWithOptions(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("chown", func(t *testing.T) {
+		if os.Geteuid() != 0 {
+			t.Skip("chown requires root")
+		}
+
+		p := filepath.Join(dir, "chown")
+		r, w, err := OpenFifoWithOptions(p, os.O_RDWR|os.O_CREATE, 0600, &FifoOptions{Chown: true, UID: 65534, GID: 65534})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+		w.Close()
+
+		var st unix.Stat_t
+		if err := unix.Stat(p, &st); err != nil {
+			t.Fatal(err)
+		}
+		if st.Uid != 65534 || st.Gid != 65534 {
+			t.Fatalf("expected owner 65534:65534, got %d:%d", st.Uid, st.Gid)
+		}
+	})
+
+	t.Run("exact mode", func(t *testing.T) {
+		old := unix.Umask(0077)
+		defer unix.Umask(old)
+
+		p := filepath.Join(dir, "umask")
+		r, w, err := OpenFifoWithOptions(p, os.O_RDWR|os.O_CREATE, 0660, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+		w.Close()
+
+		fi, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != 0600 {
+			t.Fatalf("expected umask to apply without ExactMode, got %v", fi.Mode().Perm())
+		}
+
+		p = filepath.Join(dir, "exact")
+		r, w, err = OpenFifoWithOptions(p, os.O_RDWR|os.O_CREATE, 0660, &FifoOptions{ExactMode: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+		w.Close()
+
+		fi, err = os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != 0660 {
+			t.Fatalf("expected exact mode 0660, got %v", fi.Mode().Perm())
+		}
+	})
+
+	t.Run("symlink", func(t *testing.T) {
+		target := filepath.Join(dir, "target")
+		if err := os.WriteFile(target, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		p := filepath.Join(dir, "swapped")
+		if err := os.Symlink(target, p); err != nil {
+			t.Fatal(err)
+		}
+
+		// The fifo being swapped for a symlink after it was created must not
+		// get the options applied to the symlink's target.
+		if err := applyFifoOptions(p, 0666, &FifoOptions{ExactMode: true}); err == nil {
+			t.Fatal("expected applying options through a symlink to fail")
+		}
+		fi, err := os.Stat(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != 0600 {
+			t.Fatalf("expected target mode to be untouched, got %v", fi.Mode().Perm())
+		}
+	})
+
+	t.Run("label", func(t *testing.T) {
+		const label = "system_u:object_r:container_file_t:s0"
+
+		p := filepath.Join(dir, "label")
+		r, w, err := OpenFifoWithOptions(p, os.O_RDWR|os.O_CREATE, 0600, &FifoOptions{Label: label})
+		if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.EPERM) || errors.Is(err, unix.EACCES) || errors.Is(err, unix.EINVAL) {
+			t.Skipf("labels not supported: %v", err)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+		w.Close()
+
+		buf := make([]byte, 256)
+		n, err := unix.Lgetxattr(p, selinuxXattr, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSuffix(string(buf[:n]), "\x00"); got != label {
+			t.Fatalf("expected label %q, got %q", label, got)
+		}
+	})
+
+	t.Run("hold open", func(t *testing.T) {
+		p := filepath.Join(dir, "hold")
+		r, w, err := OpenFifoWithOptions(p, os.O_RDWR|os.O_CREATE, 0600, &FifoOptions{HoldOpen: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// A writer coming and going must not cause EOF.
+		w2, err := os.OpenFile(p, os.O_WRONLY|unix.O_NONBLOCK, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w2.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		w2.Close()
+
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			t.Fatal(err)
+		}
+		r.fd.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+		if _, err := r.Read(buf); !os.IsTimeout(err) {
+			t.Fatalf("expected timeout after the writer went away, got %v", err)
+		}
+
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+		// With the reader and the hold released nothing has the fifo open
+		// for reading anymore.
+		if _, err := os.OpenFile(p, os.O_WRONLY|unix.O_NONBLOCK, 0); !errors.Is(err, unix.ENXIO) {
+			t.Fatalf("expected ENXIO after closing the reader, got %v", err)
+		}
+	})
+
+	t.Run("existing fifo is not changed", func(t *testing.T) {
+		p := filepath.Join(dir, "existing")
+		if err := unix.Mkfifo(p, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		r, w, err := OpenFifoWithOptions(p, os.O_RDWR|os.O_CREATE, 0600, &FifoOptions{Chown: true, UID: os.Geteuid() + 1, GID: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+		w.Close()
+
+		var st unix.Stat_t
+		if err := unix.Stat(p, &st); err != nil {
+			t.Fatal(err)
+		}
+		if int(st.Uid) != os.Geteuid() {
+			t.Fatalf("expected owner to be unchanged, got %d", st.Uid)
+		}
+	})
+}
+
+func TestCreateFifo(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "fifo")
+
+	r, w, created, err := CreateFifo(p, os.O_RDWR, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	w.Close()
+	if !created {
+		t.Fatal("expected fifo to be created")
+	}
+
+	r, w, created, err = CreateFifo(p, os.O_RDWR, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	w.Close()
+	if created {
+		t.Fatal("expected existing fifo to be opened")
+	}
+
+	if _, _, _, err := CreateFifo(p, os.O_RDWR|os.O_EXCL, 0600, nil); !os.IsExist(err) {
+		t.Fatalf("expected exist error with O_EXCL, got %v", err)
+	}
+
+	// Race several creators on a new path: exactly one of them creates the
+	// fifo and none of them fail.
+	p = filepath.Join(dir, "race")
+	const n = 8
+	results := make(chan error, n)
+	var createdCount int32
+	for i := 0; i < n; i++ {
+		go func() {
+			r, w, created, err := CreateFifo(p, os.O_RDWR, 0600, &FifoOptions{Lock: true, ExactMode: true})
+			if err == nil {
+				r.Close()
+				w.Close()
+				if created {
+					atomic.AddInt32(&createdCount, 1)
+				}
+			}
+			results <- err
+		}()
+	}
+	for i := 0; i < n; i++ {
+		if err := <-results; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if createdCount != 1 {
+		t.Fatalf("expected exactly one creator, got %d", createdCount)
+	}
+	if _, err := os.Stat(p + ".lock"); err != nil {
+		t.Fatalf("expected lock file: %v", err)
+	}
+}
+
+func TestOpenFifoNotFifo(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "regular")
+	if err := os.WriteFile(p, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := OpenFifo(p, os.O_RDWR|os.O_CREATE, 0600); !errors.Is(err, ErrNotFifo) {
+		t.Fatalf("expected ErrNotFifo, got %v", err)
+	}
+	if _, _, err := OpenFifoBlocking(p, os.O_RDONLY, 0); !errors.Is(err, ErrNotFifo) {
+		t.Fatalf("expected ErrNotFifo, got %v", err)
+	}
+
+	r, w, err := OpenFifoWithOptions(p, os.O_RDWR, 0, &FifoOptions{AllowNonFifo: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	w.Close()
+
+	r, w, err = OpenFifoWithOptions("/dev/null", os.O_RDWR, 0, &FifoOptions{AllowNonFifo: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCloseWithError(t *testing.T) {
+	errTest := errors.New("test error")
+
+	t.Run("writer", func(t *testing.T) {
+		r, w := newPipe(t)
+
+		if _, err := w.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.CloseWithError(errTest); err != nil {
+			t.Fatal(err)
+		}
+
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Read(buf); err != errTest {
+			t.Fatalf("expected test error instead of EOF, got %v", err)
+		}
+	})
+
+	t.Run("writer WriteTo", func(t *testing.T) {
+		r, w := newPipe(t)
+
+		if _, err := w.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		w.CloseWithError(errTest)
+
+		out := createFile(t)
+		n, err := r.WriteTo(out)
+		if err != errTest {
+			t.Fatalf("expected test error, got %v", err)
+		}
+		if n != 5 {
+			t.Fatalf("expected 5 bytes copied, got %d", n)
+		}
+	})
+
+	t.Run("reader", func(t *testing.T) {
+		r, w := newPipe(t)
+
+		if err := r.CloseWithError(errTest); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte("hello")); err != errTest {
+			t.Fatalf("expected test error instead of EPIPE, got %v", err)
+		}
+	})
+
+	t.Run("nil error", func(t *testing.T) {
+		r, w := newPipe(t)
+
+		w.CloseWithError(nil)
+		if _, err := r.Read(make([]byte, 1)); err != io.EOF {
+			t.Fatalf("expected EOF, got %v", err)
+		}
+	})
+}
+
+func TestDoubleClose(t *testing.T) {
+	r, w := newPipe(t)
+
+	for _, c := range []io.Closer{r, w} {
+		errs := make(chan error, 4)
+		for i := 0; i < cap(errs); i++ {
+			go func() { errs <- c.Close() }()
+		}
+
+		var closed int
+		for i := 0; i < cap(errs); i++ {
+			switch err := <-errs; {
+			case err == nil:
+				closed++
+			case err != ErrAlreadyClosed:
+				t.Fatalf("%T: expected ErrAlreadyClosed, got: %v", c, err)
+			}
+		}
+		if closed != 1 {
+			t.Fatalf("%T: expected exactly one Close to succeed, got %d", c, closed)
+		}
+
+		if err := c.Close(); !errors.Is(err, os.ErrClosed) {
+			t.Fatalf("%T: expected ErrAlreadyClosed to match os.ErrClosed, got: %v", c, err)
+		}
+	}
+}
+
+func TestSyscallConnCached(t *testing.T) {
+	r, w := newPipe(t)
+
+	for _, c := range []syscall.Conn{r, w} {
+		rc1, err := c.SyscallConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc2, err := c.SyscallConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rc1 != rc2 {
+			t.Fatalf("%T: expected the same RawConn from every call", c)
+		}
+
+		allocs := testing.AllocsPerRun(100, func() {
+			c.SyscallConn()
+		})
+		if allocs != 0 {
+			t.Fatalf("%T: expected no allocations, got %v", c, allocs)
+		}
+
+		c.(io.Closer).Close()
+		if err := rc1.Control(func(uintptr) {}); err == nil {
+			t.Fatalf("%T: expected the RawConn to fail after Close", c)
+		}
+	}
+}
+
+func TestDetach(t *testing.T) {
+	r, w := newPipe(t)
+
+	f := w.Detach()
+	if _, err := w.Write([]byte("hello")); !errors.Is(err, os.ErrInvalid) {
+		t.Fatalf("expected os.ErrInvalid after Detach, got %v", err)
+	}
+
+	cmd := exec.Command("sh", "-c", "echo hello >&3")
+	cmd.ExtraFiles = []*os.File{f}
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello\n" {
+		t.Fatalf("expected hello, got %q", buf)
+	}
+
+	rf := r.Detach()
+	defer rf.Close()
+	if _, err := r.Read(buf); !errors.Is(err, os.ErrInvalid) {
+		t.Fatalf("expected os.ErrInvalid after Detach, got %v", err)
+	}
 }
 
 func BenchmarkReadFrom(b *testing.B) {
@@ -289,3 +1051,205 @@ func prepareReadFrom(t testing.TB, w io.Writer, total int64) {
 		t.Fatalf("wrote unexpected amount of data to test file, expected: %d, got: %d", total, copied)
 	}
 }
+
+func TestNewFromFile(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pr, err := NewReaderFromFile(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	pw, err := NewWriterFromFile(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pw.Close()
+
+	if _, err := pw.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	pw.Close()
+	buf, err := io.ReadAll(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Fatalf("expected hello, got %q", buf)
+	}
+
+	f := createFile(t)
+	if _, err := NewReaderFromFile(f); !errors.Is(err, ErrNotFifo) {
+		t.Fatalf("expected ErrNotFifo, got %v", err)
+	}
+	if _, err := NewWriterFromFD(f.Fd(), f.Name()); !errors.Is(err, ErrNotFifo) {
+		t.Fatalf("expected ErrNotFifo, got %v", err)
+	}
+	// The fd must be left alone on error.
+	if _, err := f.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewFromFD(t *testing.T) {
+	var p [2]int
+	if err := unix.Pipe2(p[:], unix.O_CLOEXEC); err != nil {
+		t.Fatal(err)
+	}
+
+	pr, err := NewReaderFromFD(uintptr(p[0]), "read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	pw, err := NewWriterFromFD(uintptr(p[1]), "write")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pw.Close()
+
+	flags, err := unix.FcntlInt(uintptr(p[0]), unix.F_GETFL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags&unix.O_NONBLOCK == 0 {
+		t.Fatal("expected fd to be non-blocking")
+	}
+
+	// The reader is registered with the Go poller, so deadlines work.
+	pr.fd.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := pr.Read(make([]byte, 1)); !os.IsTimeout(err) {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+	pr.fd.SetReadDeadline(time.Time{})
+
+	out := createFile(t)
+	if _, err := pw.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	pw.Close()
+	if n, err := pr.WriteTo(out); err != nil || n != 5 {
+		t.Fatalf("expected 5 bytes copied, got %d: %v", n, err)
+	}
+}
+
+func TestByteCounters(t *testing.T) {
+	r1, w1 := newPipe(t)
+	r2, w2 := newPipe(t)
+
+	if _, err := w1.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w1.WriteBuffers([][]byte{[]byte("world")}); err != nil {
+		t.Fatal(err)
+	}
+	if n := w1.BytesWritten(); n != 10 {
+		t.Fatalf("expected 10 bytes written, got %d", n)
+	}
+
+	// Spliced between the pipes.
+	if _, err := CopyN(w2, r1, 8); err != nil {
+		t.Fatal(err)
+	}
+	if n := r1.BytesRead(); n != 8 {
+		t.Fatalf("expected 8 bytes read, got %d", n)
+	}
+	if n := w2.BytesWritten(); n != 8 {
+		t.Fatalf("expected 8 bytes written, got %d", n)
+	}
+
+	if _, err := io.ReadFull(r1, make([]byte, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if n := r1.BytesRead(); n != 10 {
+		t.Fatalf("expected 10 bytes read, got %d", n)
+	}
+
+	w2.Close()
+	out := createFile(t)
+	if _, err := r2.WriteTo(out); err != nil {
+		t.Fatal(err)
+	}
+	if n := r2.BytesRead(); n != 8 {
+		t.Fatalf("expected 8 bytes read, got %d", n)
+	}
+}
+
+func TestBuffered(t *testing.T) {
+	r, w := newPipe(t)
+
+	if n, err := r.Buffered(); err != nil || n != 0 {
+		t.Fatalf("expected empty pipe, got %d: %v", n, err)
+	}
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.Buffered(); err != nil || n != 5 {
+		t.Fatalf("expected 5 bytes buffered, got %d: %v", n, err)
+	}
+}
+
+func TestClosedPipeErrors(t *testing.T) {
+	checkClosed := func(t *testing.T, err error) {
+		t.Helper()
+		if !errors.Is(err, io.ErrClosedPipe) {
+			t.Fatalf("expected io.ErrClosedPipe, got: %v", err)
+		}
+		if !errors.Is(err, unix.EPIPE) {
+			t.Fatalf("expected the original EPIPE to be wrapped, got: %v", err)
+		}
+	}
+
+	t.Run("write", func(t *testing.T) {
+		r, w := newPipe(t)
+		r.Close()
+		_, err := w.Write([]byte("hello"))
+		checkClosed(t, err)
+	})
+
+	t.Run("splice", func(t *testing.T) {
+		r1, w1 := newPipe(t)
+		r2, w2 := newPipe(t)
+		r2.Close()
+
+		if _, err := w1.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		w1.Close()
+
+		_, err := w2.ReadFrom(r1)
+		checkClosed(t, err)
+	})
+
+	t.Run("vmsplice", func(t *testing.T) {
+		r, w := newPipe(t)
+		r.Close()
+		_, err := w.WriteBuffers([][]byte{[]byte("hello")})
+		checkClosed(t, err)
+	})
+
+	t.Run("copier", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		r1, w1 := newPipe(t)
+		r2, w2 := newPipe(t)
+		r3, w3 := newPipe(t)
+		r3.Close()
+
+		c, err := NewCopier(ctx, r1, w3, w2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w1.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(r2, make([]byte, 5)); err != nil {
+			t.Fatal(err)
+		}
+		checkClosed(t, c.Stats().LastErr)
+	})
+}
@@ -0,0 +1,86 @@
+//go:build !linux && !darwin && !freebsd && !windows
+// +build !linux,!darwin,!freebsd,!windows
+
+package pipes
+
+import (
+	"context"
+	"os"
+)
+
+// New creates a pipe with a read and a write end.
+// Writes on one end are met with reads on the other.
+//
+// There is no native backend for this platform so this uses os.Pipe.
+func New() (*PipeReader, *PipeWriter, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	pr, pw := newPipePair(r, w)
+	return pr, pw, nil
+}
+
+// Open is not supported on this platform and always returns ErrNotSupported.
+func Open(p string) (*PipeReader, error) {
+	return nil, &os.PathError{Op: "open", Path: p, Err: ErrNotSupported}
+}
+
+// Create is not supported on this platform and always returns
+// ErrNotSupported.
+func Create(p string) (*PipeReader, *PipeWriter, error) {
+	return nil, nil, &os.PathError{Op: "open", Path: p, Err: ErrNotSupported}
+}
+
+// AsyncOpenFifo is not supported on this platform and always returns
+// ErrNotSupported.
+func AsyncOpenFifo(p string, flag int, mode os.FileMode) (<-chan OpenFifoResult, error) {
+	return nil, &os.PathError{Op: "open", Path: p, Err: ErrNotSupported}
+}
+
+// OpenFifo is not supported on this platform and always returns
+// ErrNotSupported.
+func OpenFifo(p string, flag int, mode os.FileMode) (*PipeReader, *PipeWriter, error) {
+	return nil, nil, &os.PathError{Op: "open", Path: p, Err: ErrNotSupported}
+}
+
+// OpenFifoBlocking is not supported on this platform and always returns
+// ErrNotSupported.
+func OpenFifoBlocking(p string, flag int, mode os.FileMode) (*PipeReader, *PipeWriter, error) {
+	return nil, nil, &os.PathError{Op: "open", Path: p, Err: ErrNotSupported}
+}
+
+// OpenWriter is not supported on this platform and always returns
+// ErrNotSupported.
+func OpenWriter(ctx context.Context, p string) (*PipeWriter, error) {
+	return nil, &os.PathError{Op: "open", Path: p, Err: ErrNotSupported}
+}
+
+// OpenReader is not supported on this platform and always returns
+// ErrNotSupported.
+func OpenReader(ctx context.Context, p string) (*PipeReader, error) {
+	return nil, &os.PathError{Op: "open", Path: p, Err: ErrNotSupported}
+}
+
+// OpenFifoWithOptions is not supported on this platform and always returns
+// ErrNotSupported.
+func OpenFifoWithOptions(p string, flag int, mode os.FileMode, opts *FifoOptions) (*PipeReader, *PipeWriter, error) {
+	return nil, nil, &os.PathError{Op: "open", Path: p, Err: ErrNotSupported}
+}
+
+// CreateFifo is not supported on this platform and always returns
+// ErrNotSupported.
+func CreateFifo(p string, flag int, mode os.FileMode, opts *FifoOptions) (*PipeReader, *PipeWriter, bool, error) {
+	return nil, nil, false, &os.PathError{Op: "open", Path: p, Err: ErrNotSupported}
+}
+
+// checkFDIsFifo always returns ErrNotSupported, since there is no way to
+// check the type of an fd on this platform without taking ownership of it.
+func checkFDIsFifo(fd uintptr, name string) error {
+	return &os.PathError{Op: "fstat", Path: name, Err: ErrNotSupported}
+}
+
+// setNonblock is a no-op on this platform, fds are used in blocking mode.
+func setNonblock(fd uintptr) error {
+	return nil
+}
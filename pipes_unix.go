@@ -0,0 +1,400 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package pipes
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// New creates a pipe with a read and a write end.
+// Writes on one end are met with reads on the other.
+//
+// Both ends of the pipe are non-blocking and close-on-exec.
+func New() (*PipeReader, *PipeWriter, error) {
+	p, err := mkPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	pr, pw := newPipePair(os.NewFile(uintptr(p[0]), "read"), os.NewFile(uintptr(p[1]), "write"))
+	return pr, pw, nil
+}
+
+// Open opens a fifo in read only mode
+// It *does not* block when opening.
+// This should have smiliar semantics to os.Open, except this is for a fifo.
+//
+// See OpenFifo more more granular control.
+func Open(p string) (*PipeReader, error) {
+	pr, _, err := OpenFifo(p, os.O_RDONLY, 0)
+	return pr, err
+}
+
+// Create opens the fifo with RDWR mode. If the fifo does not exist it will
+// create it with 0666 (before umask) permissions.
+//
+// This should have similar semnatics to os.Create, except for fifos.
+func Create(p string) (*PipeReader, *PipeWriter, error) {
+	return OpenFifo(p, os.O_RDWR|os.O_CREATE, 0666)
+}
+
+// AsyncOpenFifo opens the fifo without blocking and sends the result on a
+// channel. This is usefull, for instance, if you want to open in write-only
+// mode and the read side is not yet open.
+//
+// Write-only opens waiting for a reader are completed by a single goroutine
+// shared by all calls, which is woken up when a reader opens the fifo (on
+// Linux) or otherwise retries every 100ms. Other opens never block and
+// their result is sent right away.
+//
+// Unlike a blocking open, which returns as soon as a reader shows up, a
+// write-only open may take up to 100ms longer to complete: on platforms other
+// than Linux, and on Linux when the reader is itself blocked opening the
+// fifo, which does not trigger the watch.
+//
+// Note that this will create the fifo *before* returning *if* you have passed os.O_CREATE.
+func AsyncOpenFifo(p string, flag int, mode os.FileMode) (<-chan OpenFifoResult, error) {
+	if err := mkFifo(p, flag, mode); err != nil {
+		return nil, err
+	}
+
+	ch := make(chan OpenFifoResult, 1)
+	if flag&(os.O_WRONLY|os.O_RDWR) == os.O_WRONLY {
+		asyncFifos.add(p, flag, ch)
+		return ch, nil
+	}
+
+	pr, pw, err := OpenFifo(p, flag, mode)
+	ch <- OpenFifoResult{R: pr, W: pw, Err: err}
+	return ch, nil
+}
+
+func mkFifo(p string, flag int, mode os.FileMode) error {
+	_, err := mkFifoWithOptions(p, flag, mode, nil)
+	return err
+}
+
+// mkFifoWithOptions creates the fifo at p if flag includes os.O_CREATE,
+// reporting whether it was created by this call.
+// An existing fifo is only an error if flag also includes os.O_EXCL.
+func mkFifoWithOptions(p string, flag int, mode os.FileMode, opts *FifoOptions) (bool, error) {
+	if flag&os.O_CREATE == 0 {
+		// nothing to do
+		return false, nil
+	}
+
+	if opts != nil && opts.Lock {
+		unlock, err := lockFifo(p)
+		if err != nil {
+			return false, err
+		}
+		defer unlock()
+	}
+
+	if err := unix.Mkfifo(p, uint32(mode.Perm())); err != nil {
+		if err == unix.EEXIST && flag&os.O_EXCL == 0 {
+			return false, nil
+		}
+		return false, &os.PathError{Op: "mkfifo", Path: p, Err: err}
+	}
+
+	if err := applyFifoOptions(p, mode, opts); err != nil {
+		os.Remove(p)
+		return false, err
+	}
+	return true, nil
+}
+
+// lockFifo takes an exclusive flock(2) on the lock file for the fifo at p,
+// returning a function to release it.
+func lockFifo(p string) (func(), error) {
+	f, err := os.OpenFile(p+fifoLockSuffix, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := flock(f, unix.LOCK_EX); err != nil {
+		f.Close()
+		return nil, pathError("flock", f.Name(), err)
+	}
+
+	// Closing the file releases the lock.
+	return func() { f.Close() }, nil
+}
+
+// flock applies or removes an advisory lock on f, see flock(2).
+func flock(f *os.File, how int) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var lockErr error
+	err = rc.Control(func(fd uintptr) {
+		for {
+			lockErr = unix.Flock(int(fd), how)
+			if lockErr != unix.EINTR {
+				return
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if lockErr != nil {
+		return os.NewSyscallError("flock", lockErr)
+	}
+	return nil
+}
+
+// applyFifoOptions applies opts to the freshly created fifo at p.
+//
+// The options are applied through an fd for the fifo rather than by path, so
+// the fifo cannot be swapped for something else, such as a symlink, while
+// they are being applied.
+func applyFifoOptions(p string, mode os.FileMode, opts *FifoOptions) error {
+	if opts == nil || (!opts.ExactMode && !opts.Chown && opts.Label == "") {
+		return nil
+	}
+
+	// Opening a fifo for reading with O_NONBLOCK does not wait for a writer.
+	f, err := os.OpenFile(p, os.O_RDONLY|unix.O_NONBLOCK|unix.O_NOFOLLOW, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeNamedPipe == 0 {
+		return &os.PathError{Op: "open", Path: p, Err: ErrNotFifo}
+	}
+
+	if opts.ExactMode {
+		if err := f.Chmod(mode.Perm()); err != nil {
+			return err
+		}
+	}
+	if opts.Chown {
+		if err := f.Chown(opts.UID, opts.GID); err != nil {
+			return err
+		}
+	}
+	if opts.Label != "" {
+		if err := setLabel(f, opts.Label); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OpenFifoWithOptions is like OpenFifo, but applies opts to the fifo if it
+// is created. opts may be nil, in which case this is the same as OpenFifo.
+// If applying the options fails, the newly created fifo is removed.
+func OpenFifoWithOptions(p string, flag int, mode os.FileMode, opts *FifoOptions) (*PipeReader, *PipeWriter, error) {
+	pr, pw, _, err := openFifoWithOptions(p, flag, mode, opts)
+	return pr, pw, err
+}
+
+// CreateFifo is like OpenFifoWithOptions with os.O_CREATE, but also reports
+// whether the fifo was created by this call or an existing fifo was opened.
+// If flag includes os.O_EXCL, an existing fifo is an error instead.
+//
+// When several processes may race to create the same fifo, set
+// FifoOptions.Lock so that none of them opens the fifo before the options
+// have been applied by the process which created it.
+func CreateFifo(p string, flag int, mode os.FileMode, opts *FifoOptions) (*PipeReader, *PipeWriter, bool, error) {
+	return openFifoWithOptions(p, flag|os.O_CREATE, mode, opts)
+}
+
+func openFifoWithOptions(p string, flag int, mode os.FileMode, opts *FifoOptions) (*PipeReader, *PipeWriter, bool, error) {
+	created, err := mkFifoWithOptions(p, flag, mode, opts)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	checkFifo := opts == nil || !opts.AllowNonFifo
+	pr, pw, err := openFifo(p, flag&^(os.O_CREATE|os.O_EXCL), mode, checkFifo)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	if opts != nil && opts.HoldOpen && pr != nil {
+		pr.hold, err = os.OpenFile(p, os.O_RDWR|unix.O_NONBLOCK, 0)
+		if err != nil {
+			pr.Close()
+			if pw != nil {
+				pw.Close()
+			}
+			return nil, nil, false, err
+		}
+	}
+	return pr, pw, created, nil
+}
+
+// OpenFifo opens a fifo from the provided path.
+// The fifo is always opened in non-blocking mode.
+//
+// If flag includes os.O_CREATE this will create the fifo.
+// The mode parameter should be used to set fifo permissions.
+//
+// Note, according to Linux fifo semantics, this will block if you are trying
+// to open as os.O_WRONLY and nothing has the fifo opened in read-mode. To
+// ensure a non-blocking experience, use os.O_RDWR.
+// You can open once with RDWR, then open again with O_WRONLY to get around
+// this semantic.
+//
+// If no open mode is specified (RDWR, RDONLY, WRONLY), then RDWR is used.
+// When opened with RDWR, the returned reader and writer each have their own
+// file descriptor, so they can be closed independently.
+//
+// If p exists but is not a fifo, an error wrapping ErrNotFifo is returned.
+// Use OpenFifoWithOptions with FifoOptions.AllowNonFifo to open other types
+// of files.
+func OpenFifo(p string, flag int, mode os.FileMode) (*PipeReader, *PipeWriter, error) {
+	return openFifo(p, flag, mode, true)
+}
+
+func openFifo(p string, flag int, mode os.FileMode, checkFifo bool) (pr *PipeReader, pw *PipeWriter, _ error) {
+	if flag&os.O_RDWR == 0 && flag&os.O_RDONLY == 0 && flag&os.O_WRONLY == 0 {
+		flag |= os.O_RDWR
+	}
+
+	if err := mkFifo(p, flag, mode); err != nil {
+		return nil, nil, err
+	}
+
+	flag &= ^os.O_CREATE
+
+	f, err := os.OpenFile(p, flag, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if checkFifo {
+		if err := checkIsFifo(f); err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+	}
+
+	var maybeDup bool
+	if flag&os.O_RDONLY != 0 || flag&os.O_RDWR != 0 {
+		maybeDup = true
+		pr = newReader(f)
+	}
+	if flag&os.O_WRONLY != 0 || flag&os.O_RDWR != 0 {
+		if maybeDup {
+			// The reader and writer each get their own fd for the fifo so
+			// that either one can be closed without affecting the other.
+			nfd, err := dupConn(f)
+			if err != nil {
+				f.Close()
+				return nil, nil, pathError("dup", p, err)
+			}
+			f = os.NewFile(uintptr(nfd), p)
+		}
+		pw = newWriter(f)
+	}
+	return pr, pw, nil
+}
+
+// OpenFifoBlocking opens a fifo with the classic blocking fifo semantics:
+// opening in os.O_RDONLY mode blocks until a writer opens the fifo, and
+// opening in os.O_WRONLY mode blocks until a reader opens the fifo.
+//
+// Unlike OpenFifo, the access mode in flag is honored as is, so a flag with no
+// access mode means os.O_RDONLY. Opening with os.O_RDWR never blocks.
+// If flag includes os.O_CREATE this will create the fifo.
+//
+// Only the open itself blocks. The returned reader or writer is still
+// non-blocking and uses the Go poller, same as with OpenFifo.
+// Use AsyncOpenFifo if the open should not block the calling goroutine.
+func OpenFifoBlocking(p string, flag int, mode os.FileMode) (*PipeReader, *PipeWriter, error) {
+	if flag&os.O_RDWR != 0 {
+		return OpenFifo(p, flag, mode)
+	}
+
+	if err := mkFifo(p, flag, mode); err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.OpenFile(p, flag&^os.O_CREATE, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkIsFifo(f); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	if flag&os.O_WRONLY != 0 {
+		return nil, newWriter(f), nil
+	}
+	return newReader(f), nil, nil
+}
+
+// dupConn duplicates the fd backing c.
+func dupConn(c syscall.Conn) (int, error) {
+	rc, err := c.SyscallConn()
+	if err != nil {
+		return -1, err
+	}
+
+	var (
+		fd     int
+		dupErr error
+	)
+	err = rc.Control(func(f uintptr) {
+		fd, dupErr = unix.FcntlInt(f, unix.F_DUPFD_CLOEXEC, 0)
+	})
+	if err != nil {
+		return -1, err
+	}
+	if dupErr != nil {
+		return -1, os.NewSyscallError("fcntl", dupErr)
+	}
+	return fd, nil
+}
+
+// pipeEndsFromFD wraps fd according to the access mode in flags. If fd is
+// open for both reading and writing, the writer gets a duplicate of fd so
+// the ends can be closed independently.
+func pipeEndsFromFD(fd, flags int, name string) (*PipeReader, *PipeWriter, error) {
+	switch flags & unix.O_ACCMODE {
+	case unix.O_RDONLY:
+		return newReader(os.NewFile(uintptr(fd), name)), nil, nil
+	case unix.O_WRONLY:
+		return nil, newWriter(os.NewFile(uintptr(fd), name)), nil
+	default:
+		nfd, err := unix.FcntlInt(uintptr(fd), unix.F_DUPFD_CLOEXEC, 0)
+		if err != nil {
+			return nil, nil, os.NewSyscallError("fcntl", err)
+		}
+		return newReader(os.NewFile(uintptr(fd), name)), newWriter(os.NewFile(uintptr(nfd), name)), nil
+	}
+}
+
+// checkFDIsFifo returns an error wrapping ErrNotFifo if fd is not a pipe or
+// fifo.
+func checkFDIsFifo(fd uintptr, name string) error {
+	var st unix.Stat_t
+	if err := unix.Fstat(int(fd), &st); err != nil {
+		return &os.PathError{Op: "fstat", Path: name, Err: err}
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFIFO {
+		return &os.PathError{Op: "open", Path: name, Err: ErrNotFifo}
+	}
+	return nil
+}
+
+func setNonblock(fd uintptr) error {
+	if err := unix.SetNonblock(int(fd), true); err != nil {
+		return os.NewSyscallError("fcntl", err)
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package pipes
+
+import (
+	"context"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// pipeBufferSize is the size of the input and output buffers requested for
+// named pipes.
+const pipeBufferSize = 64 * 1024
+
+// New creates a pipe with a read and a write end.
+// Writes on one end are met with reads on the other.
+//
+// On Windows this creates a uniquely named pipe opened for overlapped I/O,
+// so both ends support deadlines and can be interrupted by Close. When built
+// with a Go release older than 1.25, which cannot use overlapped handles with
+// os.File, this creates an anonymous pipe with CreatePipe instead.
+func New() (*PipeReader, *PipeWriter, error) {
+	if pipeOverlapped == 0 {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, nil, err
+		}
+		pr, pw := newPipePair(r, w)
+		return pr, pw, nil
+	}
+
+	id, err := randomFifoID()
+	if err != nil {
+		return nil, nil, err
+	}
+	p := `\\.\pipe\pipes-` + id
+	h, err := createNamedPipe(p, os.O_RDONLY, windows.FILE_FLAG_FIRST_PIPE_INSTANCE)
+	if err != nil {
+		return nil, nil, err
+	}
+	wh, err := dialNamedPipe(p, os.O_WRONLY)
+	if err != nil {
+		windows.CloseHandle(h)
+		return nil, nil, err
+	}
+	// The client is already connected, so this returns right away.
+	if err := waitConnect(context.Background(), h); err != nil {
+		windows.CloseHandle(h)
+		windows.CloseHandle(wh)
+		return nil, nil, &os.PathError{Op: "ConnectNamedPipe", Path: p, Err: err}
+	}
+	pr, pw := newPipePair(os.NewFile(uintptr(h), p), os.NewFile(uintptr(wh), p))
+	return pr, pw, nil
+}
+
+// Open opens a named pipe in read only mode.
+// This should have smiliar semantics to os.Open, except this is for a fifo.
+//
+// See OpenFifo more more granular control.
+func Open(p string) (*PipeReader, error) {
+	pr, _, err := OpenFifo(p, os.O_RDONLY, 0)
+	return pr, err
+}
+
+// Create creates a named pipe with RDWR mode and waits for a client to
+// connect.
+//
+// This should have similar semnatics to os.Create, except for fifos.
+func Create(p string) (*PipeReader, *PipeWriter, error) {
+	return OpenFifo(p, os.O_RDWR|os.O_CREATE, 0666)
+}
+
+// AsyncOpenFifo opens the fifo in a goroutine and sends the result on a channel.
+// This is usefull, for instance, if you are creating the named pipe and do not
+// want to block until a client connects.
+//
+// Note that this will create the named pipe *before* returning *if* you have
+// passed os.O_CREATE.
+func AsyncOpenFifo(p string, flag int, mode os.FileMode) (<-chan OpenFifoResult, error) {
+	ch := make(chan OpenFifoResult, 1)
+
+	if flag&os.O_CREATE == 0 {
+		go func() {
+			pr, pw, err := OpenFifo(p, flag, mode)
+			ch <- OpenFifoResult{R: pr, W: pw, Err: err}
+		}()
+		return ch, nil
+	}
+
+	h, err := createNamedPipe(p, flag, 0)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		pr, pw, err := connectNamedPipe(context.Background(), h, p, flag)
+		ch <- OpenFifoResult{R: pr, W: pw, Err: err}
+	}()
+	return ch, nil
+}
+
+// OpenFifo opens a named pipe from the provided path, which must be a pipe
+// path such as `\\.\pipe\name`.
+//
+// If flag includes os.O_CREATE, this creates a new instance of the named pipe
+// with CreateNamedPipe and blocks until a client connects to it, similar to
+// opening a fifo with os.O_WRONLY on Linux. Use AsyncOpenFifo to avoid
+// blocking.
+// Otherwise this connects to an existing named pipe as a client.
+//
+// The mode parameter is ignored on Windows.
+// Handles are opened for overlapped I/O, so they support deadlines, unless
+// built with a Go release older than 1.25 (see New).
+// Use OpenWriter or OpenReader to wait for a client with a context.
+//
+// If os.O_CREATE is passed without an open mode (RDWR, WRONLY), then RDWR is
+// used.
+func OpenFifo(p string, flag int, mode os.FileMode) (*PipeReader, *PipeWriter, error) {
+	if flag&os.O_CREATE != 0 {
+		h, err := createNamedPipe(p, flag, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		return connectNamedPipe(context.Background(), h, p, flag)
+	}
+
+	h, err := dialNamedPipe(p, flag)
+	if err != nil {
+		return nil, nil, err
+	}
+	return wrapHandle(h, p, flag)
+}
+
+// OpenWriter creates a new outbound instance of the named pipe at p and waits
+// until a client connects to it to read, or ctx is done.
+//
+// Unlike OpenFifo with os.O_CREATE, a pending connect can be cancelled: the
+// instance is closed and the error wraps ctx.Err().
+func OpenWriter(ctx context.Context, p string) (*PipeWriter, error) {
+	h, err := createNamedPipe(p, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	_, pw, err := connectNamedPipe(ctx, h, p, os.O_WRONLY)
+	return pw, err
+}
+
+// OpenReader creates a new inbound instance of the named pipe at p and waits
+// until a client connects to it to write, or ctx is done.
+//
+// Unlike OpenFifo with os.O_CREATE, a pending connect can be cancelled: the
+// instance is closed and the error wraps ctx.Err().
+func OpenReader(ctx context.Context, p string) (*PipeReader, error) {
+	h, err := createNamedPipe(p, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	pr, _, err := connectNamedPipe(ctx, h, p, os.O_RDONLY)
+	return pr, err
+}
+
+// OpenFifoWithOptions is the same as OpenFifo on Windows, where named pipes
+// do not have an owner, mode, or label which can be set. Passing any of the
+// options returns ErrNotSupported.
+func OpenFifoWithOptions(p string, flag int, mode os.FileMode, opts *FifoOptions) (*PipeReader, *PipeWriter, error) {
+	if opts != nil && (opts.Chown || opts.ExactMode || opts.Label != "" || opts.HoldOpen) {
+		return nil, nil, &os.PathError{Op: "open", Path: p, Err: ErrNotSupported}
+	}
+	return OpenFifo(p, flag, mode)
+}
+
+// CreateFifo is the same as OpenFifoWithOptions with os.O_CREATE on Windows.
+// Creating a named pipe always creates a new instance of it, so the fifo is
+// always reported as created.
+func CreateFifo(p string, flag int, mode os.FileMode, opts *FifoOptions) (*PipeReader, *PipeWriter, bool, error) {
+	pr, pw, err := OpenFifoWithOptions(p, flag|os.O_CREATE, mode, opts)
+	return pr, pw, err == nil, err
+}
+
+// OpenFifoBlocking is the same as OpenFifo on Windows, where creating a named
+// pipe already blocks until a client connects.
+func OpenFifoBlocking(p string, flag int, mode os.FileMode) (*PipeReader, *PipeWriter, error) {
+	return OpenFifo(p, flag, mode)
+}
+
+// accessMode returns the access mode portion of flag.
+// Since os.O_RDONLY is 0, a flag with no access mode is treated as read-only
+// unless os.O_CREATE is set, in which case it is treated as read-write.
+func accessMode(flag int) int {
+	switch {
+	case flag&os.O_RDWR != 0:
+		return os.O_RDWR
+	case flag&os.O_WRONLY != 0:
+		return os.O_WRONLY
+	case flag&os.O_CREATE != 0:
+		return os.O_RDWR
+	default:
+		return os.O_RDONLY
+	}
+}
+
+// createNamedPipe creates a new instance of the named pipe p, with the access
+// mode in flag. openMode is added to the open mode of the pipe.
+func createNamedPipe(p string, flag int, openMode uint32) (windows.Handle, error) {
+	name, err := windows.UTF16PtrFromString(p)
+	if err != nil {
+		return windows.InvalidHandle, &os.PathError{Op: "CreateNamedPipe", Path: p, Err: err}
+	}
+
+	var access uint32
+	switch accessMode(flag) {
+	case os.O_RDONLY:
+		access = windows.PIPE_ACCESS_INBOUND
+	case os.O_WRONLY:
+		access = windows.PIPE_ACCESS_OUTBOUND
+	default:
+		access = windows.PIPE_ACCESS_DUPLEX
+	}
+
+	pipeMode := uint32(windows.PIPE_TYPE_BYTE | windows.PIPE_READMODE_BYTE | windows.PIPE_WAIT | windows.PIPE_REJECT_REMOTE_CLIENTS)
+	h, err := windows.CreateNamedPipe(name, access|openMode|pipeOverlapped, pipeMode, windows.PIPE_UNLIMITED_INSTANCES, pipeBufferSize, pipeBufferSize, 0, nil)
+	if err != nil {
+		return windows.InvalidHandle, &os.PathError{Op: "CreateNamedPipe", Path: p, Err: err}
+	}
+	return h, nil
+}
+
+// connectNamedPipe waits for a client to connect to the named pipe instance
+// h, or for ctx to be done, and wraps h according to flag.
+// h is closed if the connect fails.
+func connectNamedPipe(ctx context.Context, h windows.Handle, p string, flag int) (*PipeReader, *PipeWriter, error) {
+	if err := waitConnect(ctx, h); err != nil {
+		windows.CloseHandle(h)
+		return nil, nil, &os.PathError{Op: "ConnectNamedPipe", Path: p, Err: err}
+	}
+	return wrapHandle(h, p, flag)
+}
+
+// dialNamedPipe connects to an existing instance of the named pipe p as a
+// client, with the access mode in flag.
+func dialNamedPipe(p string, flag int) (windows.Handle, error) {
+	name, err := windows.UTF16PtrFromString(p)
+	if err != nil {
+		return windows.InvalidHandle, &os.PathError{Op: "open", Path: p, Err: err}
+	}
+
+	var access uint32
+	switch accessMode(flag) {
+	case os.O_RDONLY:
+		access = windows.GENERIC_READ
+	case os.O_WRONLY:
+		access = windows.GENERIC_WRITE
+	default:
+		access = windows.GENERIC_READ | windows.GENERIC_WRITE
+	}
+
+	h, err := windows.CreateFile(name, access, 0, nil, windows.OPEN_EXISTING, pipeOverlapped, 0)
+	if err != nil {
+		return windows.InvalidHandle, &os.PathError{Op: "open", Path: p, Err: err}
+	}
+	return h, nil
+}
+
+// wrapHandle wraps the pipe handle in a PipeReader and/or PipeWriter
+// depending on the access mode in flag.
+// With os.O_RDWR the handle is duplicated so each end can be closed
+// independently.
+func wrapHandle(h windows.Handle, p string, flag int) (*PipeReader, *PipeWriter, error) {
+	switch accessMode(flag) {
+	case os.O_RDONLY:
+		return newReader(os.NewFile(uintptr(h), p)), nil, nil
+	case os.O_WRONLY:
+		return nil, newWriter(os.NewFile(uintptr(h), p)), nil
+	}
+
+	proc := windows.CurrentProcess()
+	var dup windows.Handle
+	if err := windows.DuplicateHandle(proc, h, proc, &dup, 0, false, windows.DUPLICATE_SAME_ACCESS); err != nil {
+		windows.CloseHandle(h)
+		return nil, nil, &os.PathError{Op: "DuplicateHandle", Path: p, Err: err}
+	}
+	return newReader(os.NewFile(uintptr(h), p)), newWriter(os.NewFile(uintptr(dup), p)), nil
+}
+
+// checkFDIsFifo returns an error wrapping ErrNotFifo if the handle fd is not
+// a pipe.
+func checkFDIsFifo(fd uintptr, name string) error {
+	t, err := windows.GetFileType(windows.Handle(fd))
+	if err != nil {
+		return &os.PathError{Op: "GetFileType", Path: name, Err: err}
+	}
+	if t != windows.FILE_TYPE_PIPE {
+		return &os.PathError{Op: "open", Path: name, Err: ErrNotFifo}
+	}
+	return nil
+}
+
+// setNonblock is a no-op on Windows, where whether a handle uses overlapped
+// I/O is fixed when it is opened.
+func setNonblock(fd uintptr) error {
+	return nil
+}
@@ -0,0 +1,126 @@
+package pipes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestOpenFifo(t *testing.T) {
+	p := fmt.Sprintf(`\\.\pipe\pipes-test-%d`, time.Now().UnixNano())
+
+	results, err := AsyncOpenFifo(p, os.O_WRONLY|os.O_CREATE, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, _, err := OpenFifo(p, os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var result OpenFifoResult
+	select {
+	case result = <-results:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for async open")
+	}
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if result.R != nil {
+		t.Error("got unexpected pipe reader for write only request")
+		result.R.Close()
+	}
+	defer result.W.Close()
+
+	data := []byte("hello")
+	if _, err := result.W.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, len(data))
+	if _, err := r.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data) {
+		t.Fatalf("expected %q, got %q", string(data), string(buf))
+	}
+}
+
+func TestOpenWriterCancel(t *testing.T) {
+	p := fmt.Sprintf(`\\.\pipe\pipes-test-%d`, time.Now().UnixNano())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errc := make(chan error, 1)
+	go func() {
+		w, err := OpenWriter(ctx, p)
+		if w != nil {
+			w.Close()
+		}
+		errc <- err
+	}()
+
+	select {
+	case err := <-errc:
+		t.Fatalf("expected OpenWriter to wait for a client, got: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	cancel()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for cancelled connect to return")
+	}
+
+	// The cancelled instance must be gone.
+	if r, _, err := OpenFifo(p, os.O_RDONLY, 0); err == nil {
+		r.Close()
+		t.Fatal("expected connecting to the cancelled pipe to fail")
+	}
+}
+
+func TestReadDeadline(t *testing.T) {
+	if pipeOverlapped == 0 {
+		t.Skip("pipes do not support deadlines before Go 1.25")
+	}
+
+	r, w, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if err := r.fd.SetReadDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected os.ErrDeadlineExceeded, got: %v", err)
+	}
+
+	if err := r.fd.SetReadDeadline(time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1)
+	if _, err := r.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf[0] != 'x' {
+		t.Fatalf("expected %q, got %q", "x", buf)
+	}
+}
@@ -0,0 +1,44 @@
+// Package pipesvar publishes the package wide metrics of
+// github.com/cpuguy83/pipes with expvar, for services which already serve
+// /debug/vars.
+//
+// This is a separate package since importing expvar registers its handler on
+// http.DefaultServeMux.
+package pipesvar
+
+import (
+	"expvar"
+
+	"github.com/cpuguy83/pipes"
+)
+
+// Publish publishes the metrics returned by pipes.ReadMetrics under name.
+// The published value is an object with these keys:
+//
+//   - active_pipes: the number of pipe ends which are open
+//   - bytes_spliced: the number of bytes moved with splice(2)
+//   - fallback_copies: the number of copies which went through a userspace
+//     buffer
+//   - splice_calls, tee_calls, write_calls, read_calls, eagain: see
+//     pipes.SyscallStats
+//
+// Like expvar.Publish, this panics if name is already published.
+func Publish(name string) {
+	expvar.Publish(name, expvar.Func(Func))
+}
+
+// Func returns the current metrics in the format used by Publish. It can be
+// used to publish the metrics as part of an existing expvar.Map.
+func Func() interface{} {
+	m := pipes.ReadMetrics()
+	return map[string]int64{
+		"active_pipes":    m.ActivePipes,
+		"bytes_spliced":   m.BytesSpliced,
+		"fallback_copies": m.FallbackCopies,
+		"splice_calls":    m.Syscalls.Splices,
+		"tee_calls":       m.Syscalls.Tees,
+		"write_calls":     m.Syscalls.Writes,
+		"read_calls":      m.Syscalls.Reads,
+		"eagain":          m.Syscalls.EAGAIN,
+	}
+}
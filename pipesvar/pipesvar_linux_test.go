@@ -0,0 +1,43 @@
+package pipesvar
+
+import (
+	"encoding/json"
+	"expvar"
+	"sync"
+	"testing"
+
+	"github.com/cpuguy83/pipes"
+)
+
+// publishOnce guards Publish, which panics when a name is published twice,
+// such as when the test is run with -count.
+var publishOnce sync.Once
+
+func TestPublish(t *testing.T) {
+	publishOnce.Do(func() { Publish("pipes_test") })
+
+	r, w, err := pipes.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	v := expvar.Get("pipes_test")
+	if v == nil {
+		t.Fatal("expected metrics to be published")
+	}
+
+	var m map[string]int64
+	if err := json.Unmarshal([]byte(v.String()), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["active_pipes"] < 2 {
+		t.Fatalf("expected at least 2 active pipes, got %d", m["active_pipes"])
+	}
+	for _, k := range []string{"bytes_spliced", "fallback_copies", "splice_calls", "tee_calls", "write_calls", "read_calls", "eagain"} {
+		if _, ok := m[k]; !ok {
+			t.Errorf("missing %s", k)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package pipes
+
+// PollEvent is the readiness of a pipe registered with a Poller.
+// Exactly one of Reader or Writer is set.
+type PollEvent struct {
+	Reader *PipeReader
+	Writer *PipeWriter
+
+	// Readable is set when a read from Reader will not block.
+	Readable bool
+	// Writable is set when a write to Writer will not block.
+	Writable bool
+	// Closed is set when the other end of the pipe has been closed.
+	// Note a reader may still have buffered data to read.
+	Closed bool
+}
@@ -0,0 +1,247 @@
+package pipes
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxPollEvents is the most events returned by a single call to Poller.Wait.
+const maxPollEvents = 128
+
+// pollEntry is a pipe registered with a Poller.
+// The fd is a duplicate of the pipe's fd so the registration can not be
+// affected by the pipe being closed (and the fd re-used) out from under the
+// poller.
+type pollEntry struct {
+	r  *PipeReader
+	w  *PipeWriter
+	fd int
+}
+
+// Poller waits for many pipes at once to be ready for reading or writing
+// using epoll(7).
+// This is useful for servers managing a large number of pipes, which would
+// otherwise need a goroutine per pipe.
+//
+// Pipes are registered level-triggered, so a pipe keeps being reported for
+// as long as it is ready.
+//
+// The epoll instance is itself registered with the Go poller, so Wait does not
+// tie up an OS thread.
+type Poller struct {
+	f  *os.File
+	rc syscall.RawConn
+
+	mu      sync.Mutex
+	nextID  int32
+	entries map[int32]*pollEntry
+	ids     map[interface{}]int32
+}
+
+// NewPoller creates a new Poller.
+func NewPoller() (*Poller, error) {
+	fd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, os.NewSyscallError("epoll_create1", err)
+	}
+	if err := unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return nil, os.NewSyscallError("fcntl", err)
+	}
+
+	f := os.NewFile(uintptr(fd), "epoll")
+	rc, err := f.SyscallConn()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &Poller{
+		f:       f,
+		rc:      rc,
+		entries: make(map[int32]*pollEntry),
+		ids:     make(map[interface{}]int32),
+	}, nil
+}
+
+// AddReader registers r with the poller to be notified when it is readable.
+func (p *Poller) AddReader(r *PipeReader) error {
+	return p.add(r, &pollEntry{r: r}, unix.EPOLLIN)
+}
+
+// AddWriter registers w with the poller to be notified when it is writable.
+func (p *Poller) AddWriter(w *PipeWriter) error {
+	return p.add(w, &pollEntry{w: w}, unix.EPOLLOUT)
+}
+
+func (p *Poller) add(c syscall.Conn, e *pollEntry, events uint32) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.entries == nil {
+		return os.ErrClosed
+	}
+	if _, ok := p.ids[c]; ok {
+		return errors.New("already registered with the poller")
+	}
+
+	fd, err := dupConn(c)
+	if err != nil {
+		return err
+	}
+	e.fd = fd
+
+	id := p.nextID
+	p.nextID++
+
+	var ctlErr error
+	err = p.rc.Control(func(epfd uintptr) {
+		ev := unix.EpollEvent{Events: events, Fd: id}
+		ctlErr = unix.EpollCtl(int(epfd), unix.EPOLL_CTL_ADD, fd, &ev)
+	})
+	if err == nil && ctlErr != nil {
+		err = os.NewSyscallError("epoll_ctl", ctlErr)
+	}
+	if err != nil {
+		unix.Close(fd)
+		return err
+	}
+
+	p.entries[id] = e
+	p.ids[c] = id
+	return nil
+}
+
+// RemoveReader removes r from the poller.
+func (p *Poller) RemoveReader(r *PipeReader) error {
+	return p.remove(r)
+}
+
+// RemoveWriter removes w from the poller.
+func (p *Poller) RemoveWriter(w *PipeWriter) error {
+	return p.remove(w)
+}
+
+func (p *Poller) remove(c syscall.Conn) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.entries == nil {
+		return os.ErrClosed
+	}
+	id, ok := p.ids[c]
+	if !ok {
+		return errors.New("not registered with the poller")
+	}
+
+	e := p.entries[id]
+	delete(p.ids, c)
+	delete(p.entries, id)
+
+	// The dup shares the file description with the pipe, which is still
+	// open, so closing it does not remove it from the epoll set.
+	var ctlErr error
+	err := p.rc.Control(func(epfd uintptr) {
+		ctlErr = unix.EpollCtl(int(epfd), unix.EPOLL_CTL_DEL, e.fd, nil)
+	})
+	unix.Close(e.fd)
+	if err != nil {
+		return err
+	}
+	if ctlErr != nil {
+		return os.NewSyscallError("epoll_ctl", ctlErr)
+	}
+	return nil
+}
+
+// Wait waits until at least one of the registered pipes is ready, or ctx is
+// cancelled, and returns the ready pipes.
+//
+// Wait must not be called concurrently.
+func (p *Poller) Wait(ctx context.Context) ([]PollEvent, error) {
+	stop := make(chan struct{})
+	kicked := make(chan struct{})
+	go func() {
+		defer close(kicked)
+		select {
+		case <-ctx.Done():
+			// Kick the wait below out of the Go poller.
+			p.f.SetReadDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+
+	var (
+		events  = make([]unix.EpollEvent, maxPollEvents)
+		n       int
+		waitErr error
+	)
+	err := p.rc.Read(func(epfd uintptr) bool {
+		for {
+			n, waitErr = unix.EpollWait(int(epfd), events, 0)
+			if waitErr == unix.EINTR {
+				continue
+			}
+			return waitErr != nil || n > 0
+		}
+	})
+
+	close(stop)
+	<-kicked
+	if ctx.Err() != nil {
+		p.f.SetReadDeadline(time.Time{})
+		return nil, ctx.Err()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	if waitErr != nil {
+		return nil, os.NewSyscallError("epoll_wait", waitErr)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ready := make([]PollEvent, 0, n)
+	for _, ev := range events[:n] {
+		e, ok := p.entries[ev.Fd]
+		if !ok {
+			// Removed while we were waiting.
+			continue
+		}
+		ready = append(ready, PollEvent{
+			Reader:   e.r,
+			Writer:   e.w,
+			Readable: ev.Events&unix.EPOLLIN != 0,
+			Writable: ev.Events&unix.EPOLLOUT != 0,
+			Closed:   ev.Events&(unix.EPOLLHUP|unix.EPOLLERR) != 0,
+		})
+	}
+	return ready, nil
+}
+
+// Close closes the poller and removes all registered pipes.
+// The pipes themselves are not closed.
+func (p *Poller) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.entries == nil {
+		return nil
+	}
+
+	for _, e := range p.entries {
+		unix.Close(e.fd)
+	}
+	p.entries = nil
+	p.ids = nil
+
+	return p.f.Close()
+}
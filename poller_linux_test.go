@@ -0,0 +1,103 @@
+package pipes
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPoller(t *testing.T) {
+	p, err := NewPoller()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	r1, w1 := newPipe(t)
+	r2, w2 := newPipe(t)
+
+	if err := p.AddReader(r1); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddReader(r2); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddReader(r2); err == nil {
+		t.Fatal("expected error adding the same reader twice")
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if _, err := p.Wait(ctx); err != context.DeadlineExceeded {
+			t.Fatalf("expected context.DeadlineExceeded, got: %v", err)
+		}
+	})
+
+	t.Run("readable", func(t *testing.T) {
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			w2.Write([]byte("hello"))
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		events, err := p.Wait(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("expected 1 event, got %d", len(events))
+		}
+		if events[0].Reader != r2 || !events[0].Readable {
+			t.Fatalf("unexpected event: %+v", events[0])
+		}
+
+		buf := make([]byte, 5)
+		if _, err := r2.Read(buf); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		if err := p.RemoveReader(r2); err != nil {
+			t.Fatal(err)
+		}
+		w2.Write([]byte("hello"))
+		w1.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		events, err := p.Wait(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("expected 1 event, got %d", len(events))
+		}
+		if events[0].Reader != r1 || !events[0].Closed {
+			t.Fatalf("unexpected event: %+v", events[0])
+		}
+	})
+
+	t.Run("writable", func(t *testing.T) {
+		_, w3 := newPipe(t)
+		if err := p.RemoveReader(r1); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.AddWriter(w3); err != nil {
+			t.Fatal(err)
+		}
+
+		events, err := p.Wait(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 || events[0].Writer != w3 || !events[0].Writable {
+			t.Fatalf("unexpected events: %+v", events)
+		}
+	})
+}
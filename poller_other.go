@@ -0,0 +1,42 @@
+//go:build !linux
+// +build !linux
+
+package pipes
+
+import "context"
+
+// Poller waits for many pipes at once to be ready for reading or writing.
+//
+// This is only implemented on Linux. On this platform NewPoller always returns
+// ErrNotSupported.
+type Poller struct{}
+
+// NewPoller is not supported on this platform and always returns
+// ErrNotSupported.
+func NewPoller() (*Poller, error) {
+	return nil, ErrNotSupported
+}
+
+func (p *Poller) AddReader(r *PipeReader) error {
+	return ErrNotSupported
+}
+
+func (p *Poller) AddWriter(w *PipeWriter) error {
+	return ErrNotSupported
+}
+
+func (p *Poller) RemoveReader(r *PipeReader) error {
+	return ErrNotSupported
+}
+
+func (p *Poller) RemoveWriter(w *PipeWriter) error {
+	return ErrNotSupported
+}
+
+func (p *Poller) Wait(ctx context.Context) ([]PollEvent, error) {
+	return nil, ErrNotSupported
+}
+
+func (p *Poller) Close() error {
+	return nil
+}
@@ -0,0 +1,168 @@
+// Package prom provides a Prometheus collector for pipes and copiers from
+// github.com/cpuguy83/pipes.
+//
+// It lives in its own module so that the pipes package itself does not depend
+// on the Prometheus client.
+package prom
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/cpuguy83/pipes"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector implements prometheus.Collector over a set of registered pipes
+// and copiers. Each pipe and copier is registered with a name, which is used
+// as the value of the "pipe" or "copier" label.
+//
+// Register the collector with a prometheus.Registerer to export:
+//
+//   - <namespace>_pipe_read_bytes_total and <namespace>_pipe_written_bytes_total,
+//     from PipeReader.BytesRead and PipeWriter.BytesWritten
+//   - <namespace>_pipe_buffered_bytes, the fill level of the pipe, where
+//     supported
+//   - <namespace>_copier_read_bytes_total, <namespace>_copier_writers,
+//     <namespace>_copier_evictions_total and <namespace>_copier_running,
+//     from Copier.Stats
+//   - <namespace>_copier_errors_total, the number of errors the copier ran
+//     into: each eviction of a writer, plus the copier stopping with an
+//     error other than reaching EOF, being closed, or its context being done
+type Collector struct {
+	mu      sync.Mutex
+	readers map[string]*pipes.PipeReader
+	writers map[string]*pipes.PipeWriter
+	copiers map[string]*pipes.Copier
+
+	readBytes     *prometheus.Desc
+	writtenBytes  *prometheus.Desc
+	bufferedBytes *prometheus.Desc
+	copierRead    *prometheus.Desc
+	copierWriters *prometheus.Desc
+	copierEvicted *prometheus.Desc
+	copierRunning *prometheus.Desc
+	copierErrors  *prometheus.Desc
+}
+
+// NewCollector creates a Collector whose metric names are prefixed with
+// namespace.
+func NewCollector(namespace string) *Collector {
+	pipeLabels := []string{"pipe"}
+	copierLabels := []string{"copier"}
+	return &Collector{
+		readers: make(map[string]*pipes.PipeReader),
+		writers: make(map[string]*pipes.PipeWriter),
+		copiers: make(map[string]*pipes.Copier),
+
+		readBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "pipe", "read_bytes_total"),
+			"Total bytes read from the pipe.", pipeLabels, nil),
+		writtenBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "pipe", "written_bytes_total"),
+			"Total bytes written to the pipe.", pipeLabels, nil),
+		bufferedBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "pipe", "buffered_bytes"),
+			"Bytes written to the pipe which have not been read yet.", pipeLabels, nil),
+		copierRead: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "copier", "read_bytes_total"),
+			"Total bytes read by the copier.", copierLabels, nil),
+		copierWriters: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "copier", "writers"),
+			"Number of writers the copier is copying to.", copierLabels, nil),
+		copierEvicted: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "copier", "evictions_total"),
+			"Total writers dropped by the copier because writing to them failed.", copierLabels, nil),
+		copierRunning: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "copier", "running"),
+			"Whether the copier is running (1) or has stopped (0).", copierLabels, nil),
+		copierErrors: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "copier", "errors_total"),
+			"Total errors the copier ran into, including evictions.", copierLabels, nil),
+	}
+}
+
+// AddReader registers the read end of a pipe under name.
+func (c *Collector) AddReader(name string, r *pipes.PipeReader) {
+	c.mu.Lock()
+	c.readers[name] = r
+	c.mu.Unlock()
+}
+
+// AddWriter registers the write end of a pipe under name.
+func (c *Collector) AddWriter(name string, w *pipes.PipeWriter) {
+	c.mu.Lock()
+	c.writers[name] = w
+	c.mu.Unlock()
+}
+
+// AddCopier registers a copier under name.
+func (c *Collector) AddCopier(name string, cp *pipes.Copier) {
+	c.mu.Lock()
+	c.copiers[name] = cp
+	c.mu.Unlock()
+}
+
+// Remove unregisters the pipe ends and copier registered under name.
+func (c *Collector) Remove(name string) {
+	c.mu.Lock()
+	delete(c.readers, name)
+	delete(c.writers, name)
+	delete(c.copiers, name)
+	c.mu.Unlock()
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.readBytes
+	ch <- c.writtenBytes
+	ch <- c.bufferedBytes
+	ch <- c.copierRead
+	ch <- c.copierWriters
+	ch <- c.copierEvicted
+	ch <- c.copierRunning
+	ch <- c.copierErrors
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name, r := range c.readers {
+		ch <- prometheus.MustNewConstMetric(c.readBytes, prometheus.CounterValue, float64(r.BytesRead()), name)
+		if n, err := r.Buffered(); err == nil {
+			ch <- prometheus.MustNewConstMetric(c.bufferedBytes, prometheus.GaugeValue, float64(n), name)
+		}
+	}
+	for name, w := range c.writers {
+		ch <- prometheus.MustNewConstMetric(c.writtenBytes, prometheus.CounterValue, float64(w.BytesWritten()), name)
+	}
+	for name, cp := range c.copiers {
+		stats := cp.Stats()
+		running := 1.0
+		if stats.Err != nil {
+			running = 0
+		}
+		ch <- prometheus.MustNewConstMetric(c.copierRead, prometheus.CounterValue, float64(stats.BytesRead), name)
+		ch <- prometheus.MustNewConstMetric(c.copierWriters, prometheus.GaugeValue, float64(len(stats.BytesWritten)), name)
+		ch <- prometheus.MustNewConstMetric(c.copierEvicted, prometheus.CounterValue, float64(stats.Evictions), name)
+		ch <- prometheus.MustNewConstMetric(c.copierRunning, prometheus.GaugeValue, running, name)
+		ch <- prometheus.MustNewConstMetric(c.copierErrors, prometheus.CounterValue, copierErrors(stats), name)
+	}
+}
+
+// copierErrors returns the number of errors the copier ran into, see
+// Collector.
+func copierErrors(stats pipes.CopierStats) float64 {
+	n := float64(stats.Evictions)
+	var canceled *pipes.CanceledError
+	switch err := stats.Err; {
+	case err == nil, err == io.EOF, errors.Is(err, os.ErrClosed), errors.As(err, &canceled):
+	default:
+		n++
+	}
+	return n
+}
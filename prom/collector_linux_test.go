@@ -0,0 +1,94 @@
+package prom
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cpuguy83/pipes"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	r, w, err := pipes.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	c := NewCollector("test")
+	c.AddReader("p", r)
+	c.AddWriter("p", w)
+
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Read(make([]byte, 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `
+# HELP test_pipe_buffered_bytes Bytes written to the pipe which have not been read yet.
+# TYPE test_pipe_buffered_bytes gauge
+test_pipe_buffered_bytes{pipe="p"} 3
+# HELP test_pipe_read_bytes_total Total bytes read from the pipe.
+# TYPE test_pipe_read_bytes_total counter
+test_pipe_read_bytes_total{pipe="p"} 2
+# HELP test_pipe_written_bytes_total Total bytes written to the pipe.
+# TYPE test_pipe_written_bytes_total counter
+test_pipe_written_bytes_total{pipe="p"} 5
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r2, w2, err := pipes.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+	cp, err := pipes.NewCopier(ctx, r, w2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Remove("p")
+	c.AddCopier("cp", cp)
+
+	expected = `
+# HELP test_copier_running Whether the copier is running (1) or has stopped (0).
+# TYPE test_copier_running gauge
+test_copier_running{copier="cp"} 1
+# HELP test_copier_writers Number of writers the copier is copying to.
+# TYPE test_copier_writers gauge
+test_copier_writers{copier="cp"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "test_copier_running", "test_copier_writers"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writing to a pipe whose reader went away evicts the writer, which
+	// counts as an error.
+	r2.Close()
+	if _, err := w.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; cp.Stats().Evictions == 0; i++ {
+		if i == 500 {
+			t.Fatal("timeout waiting for the writer to be evicted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	expected = `
+# HELP test_copier_errors_total Total errors the copier ran into, including evictions.
+# TYPE test_copier_errors_total counter
+test_copier_errors_total{copier="cp"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "test_copier_errors_total"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,13 @@
+module github.com/cpuguy83/pipes/prom
+
+go 1.16
+
+require (
+	github.com/cpuguy83/pipes v0.0.0-20261015124131-7039a81a051f
+	github.com/prometheus/client_golang v1.11.1
+)
+
+// Build against the pipes package in this repository when working on it.
+// Replace directives are ignored by modules depending on this one, they get
+// the version required above.
+replace github.com/cpuguy83/pipes => ../
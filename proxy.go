@@ -0,0 +1,58 @@
+package pipes
+
+import (
+	"net"
+)
+
+// SpliceConn copies from src to dst until EOF is reached on src or an error
+// occurs.
+//
+// Data is spliced from src into an internal pipe and from the pipe into dst so
+// it never enters userspace. This works for any connection backed by a file
+// descriptor, such as *net.TCPConn and *net.UnixConn.
+// If either connection is not backed by a file descriptor this falls back to
+// io.Copy.
+func SpliceConn(dst, src net.Conn) (int64, error) {
+	return Copy(dst, src)
+}
+
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// Proxy copies data in both directions between a and b using SpliceConn.
+//
+// When one direction reaches EOF the write side of the receiving connection
+// is closed (if it supports CloseWrite, like *net.TCPConn) so the peer sees
+// EOF, and the other direction is allowed to finish.
+// If a direction fails, both connections are closed so the other direction
+// does not block forever.
+//
+// Proxy returns once both directions are done along with the number of bytes
+// copied in each direction.
+func Proxy(a, b net.Conn) (aToB, bToA int64, _ error) {
+	type result struct {
+		n   int64
+		err error
+	}
+
+	copyHalf := func(dst, src net.Conn, ch chan<- result) {
+		n, err := SpliceConn(dst, src)
+		if err != nil {
+			a.Close()
+			b.Close()
+		} else if cw, ok := dst.(closeWriter); ok {
+			cw.CloseWrite()
+		}
+		ch <- result{n, err}
+	}
+
+	chAB := make(chan result, 1)
+	chBA := make(chan result, 1)
+	go copyHalf(b, a, chAB)
+	go copyHalf(a, b, chBA)
+
+	ab := <-chAB
+	ba := <-chBA
+	return ab.n, ba.n, joinErrors(ab.err, ba.err)
+}
@@ -0,0 +1,59 @@
+package pipes
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestProxy(t *testing.T) {
+	client, proxyFront := newTCPPair(t)
+	proxyBack, server := newTCPPair(t)
+
+	type result struct {
+		ab, ba int64
+		err    error
+	}
+	chResult := make(chan result, 1)
+	go func() {
+		ab, ba, err := Proxy(proxyFront, proxyBack)
+		chResult <- result{ab, ba, err}
+	}()
+
+	request := bytes.Repeat([]byte("ping"), 1e5)
+	response := []byte("pong")
+
+	go func() {
+		client.Write(request)
+		client.CloseWrite()
+	}()
+
+	got, err := io.ReadAll(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, request) {
+		t.Fatalf("got unexpected request: %d bytes", len(got))
+	}
+
+	if _, err := server.Write(response); err != nil {
+		t.Fatal(err)
+	}
+	server.CloseWrite()
+
+	got, err = io.ReadAll(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, response) {
+		t.Fatalf("expected %q, got %q", response, got)
+	}
+
+	res := <-chResult
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	if res.ab != int64(len(request)) || res.ba != int64(len(response)) {
+		t.Fatalf("unexpected byte counts: %d, %d", res.ab, res.ba)
+	}
+}
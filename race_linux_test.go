@@ -0,0 +1,8 @@
+//go:build race
+// +build race
+
+package pipes
+
+// raceEnabled is set when the race detector is on, which makes sync.Pool
+// drop some of the items put back.
+const raceEnabled = true
@@ -2,21 +2,95 @@ package pipes
 
 import (
 	"os"
+	"sync/atomic"
 	"syscall"
 )
 
 type PipeReader struct {
+	// nread is accessed atomically, it is kept first so it is 64-bit aligned
+	// on 32-bit platforms.
+	nread int64
+
 	fd *os.File
+
+	// hold is a hidden fd keeping the fifo open for writing, see
+	// FifoOptions.HoldOpen.
+	hold *os.File
+	// child is the file handed to a child process by AttachCmd.
+	child *os.File
+
+	state *pipeState
+	// leak is set when leak detection is enabled, see EnableLeakDetection.
+	leak *leakEntry
+	// active is 1 until the reader is closed or detached, see release.
+	active int32
+	// closed is set to 1 by the first call to Close.
+	closed int32
+
+	rc rawConnCache
+
+	// notify backs EOFNotify.
+	notify peerNotify
 }
 
 func (r *PipeReader) Read(p []byte) (int, error) {
-	return r.fd.Read(p)
+	n, err := r.read(p)
+	r.addRead(int64(n))
+	return n, err
 }
 
+// read is Read without adding to BytesRead, for helpers which do not count
+// toward it, such as Copier.
+func (r *PipeReader) read(p []byte) (int, error) {
+	n, err := r.fd.Read(p)
+	return n, r.readResult(err)
+}
+
+// Close closes the reader.
+// It is safe to call Close more than once, including concurrently. Only the
+// first call closes the pipe, any others return ErrAlreadyClosed.
 func (r *PipeReader) Close() error {
+	if !atomic.CompareAndSwapInt32(&r.closed, 0, 1) {
+		return ErrAlreadyClosed
+	}
+	release(&r.active)
+	r.notify.stop()
+	if r.hold != nil || r.child != nil {
+		return joinErrors(r.fd.Close(), closeFile(r.hold), closeFile(r.child))
+	}
 	return r.fd.Close()
 }
 
+// SyscallConn returns a raw connection for the reader's fd.
+// The connection is created once and reused, as SyscallConn is called on
+// every splice. Once the pipe end is closed its methods return an error.
 func (r *PipeReader) SyscallConn() (syscall.RawConn, error) {
-	return r.fd.SyscallConn()
+	if r.fd == nil {
+		return r.fd.SyscallConn()
+	}
+	return r.rc.get(r.fd)
+}
+
+// Detach returns the underlying file and detaches it from the reader, for
+// handing the fd to APIs which need an *os.File, such as
+// exec.Cmd.ExtraFiles. The caller becomes responsible for closing the file.
+// A file handed to a child process by AttachCmd is closed.
+//
+// The reader must not be used after calling Detach, its methods return
+// os.ErrInvalid. Detach must not be called concurrently with other methods.
+func (r *PipeReader) Detach() *os.File {
+	f := r.fd
+	r.fd = nil
+	r.leak.forget()
+	release(&r.active)
+	r.notify.stop()
+	if r.hold != nil {
+		r.hold.Close()
+		r.hold = nil
+	}
+	if r.child != nil {
+		r.child.Close()
+		r.child = nil
+	}
+	return f
 }
@@ -3,24 +3,48 @@ package pipes
 import (
 	"io"
 	"syscall"
+	"time"
 
 	"golang.org/x/sys/unix"
 )
 
 func (r *PipeReader) WriteTo(w io.Writer) (int64, error) {
+	return r.copyResult(r.writeToWriter(w, nil, nil, nil, 0))
+}
+
+// WriteToBuffer is like WriteTo, but if the data cannot be spliced to w and
+// has to be copied through userspace, it is copied through buf rather than a
+// buffer from the package's pool, like io.CopyBuffer. This lets callers which
+// manage their own memory avoid the internal buffers altogether.
+// If buf is empty, this is WriteTo.
+//
+// As with io.CopyBuffer, buf is not used if w implements io.ReaderFrom.
+func (r *PipeReader) WriteToBuffer(w io.Writer, buf []byte) (int64, error) {
+	return r.copyResult(r.writeToWriter(w, buf, nil, nil, 0))
+}
+
+// writeToWriter splices everything from the reader to w where possible,
+// otherwise it copies through buf, see userCopyBuffer.
+func (r *PipeReader) writeToWriter(w io.Writer, buf []byte, trace *SpliceTrace, log Logger, busyPoll time.Duration) (int64, error) {
+	if !SpliceSupported() {
+		return fallbackCopy(trace, log, "WriteTo", w, r.fd, buf)
+	}
+
 	if wc, ok := w.(syscall.Conn); ok {
 		if raw, err := wc.SyscallConn(); err == nil {
-			handled, n, err := r.writeTo(raw)
+			handled, n, err := r.writeTo(raw, trace, busyPoll)
 			if handled || err == nil {
 				return n, err
 			}
 		}
 	}
 
-	return io.Copy(w, r.fd)
+	return fallbackCopy(trace, log, "WriteTo", w, r.fd, buf)
 }
 
-func (r *PipeReader) writeTo(w syscall.RawConn) (bool, int64, error) {
+// writeTo splices everything from the reader to w. If busyPoll is set, it
+// spins for up to that long when the splice would block, see WithBusyPoll.
+func (r *PipeReader) writeTo(w syscall.RawConn, trace *SpliceTrace, busyPoll time.Duration) (bool, int64, error) {
 	rc, err := r.SyscallConn()
 	if err != nil {
 		return false, 0, err
@@ -30,23 +54,36 @@ func (r *PipeReader) writeTo(w syscall.RawConn) (bool, int64, error) {
 		copied    int64
 		readErr   error
 		spliceErr error
+		spin      = spinner{d: busyPoll}
 	)
 
+	trace.spliceStart()
+	defer func() { trace.spliceDone(copied, spliceErr) }()
+
 	// Beceause the writer may not be pollable we need to call `Read` first (which we know is pollable).
 	err = rc.Read(func(rfd uintptr) bool {
-		readErr = w.Write(func(wfd uintptr) bool {
-			var n int64
-			n, spliceErr = splice(int(rfd), int(wfd), 0)
-			if n > 0 {
-				copied += n
-			}
-			return true
-		})
+		for {
+			readErr = w.Write(func(wfd uintptr) bool {
+				var n int64
+				n, spliceErr = splice(int(rfd), int(wfd), 0)
+				if n > 0 {
+					copied += n
+					spin.reset()
+				}
+				return true
+			})
 
-		if readErr != nil {
-			return true
+			if readErr != nil {
+				return true
+			}
+			if spliceErr != unix.EAGAIN {
+				return true
+			}
+			if !spin.spin() {
+				trace.blocked()
+				return false
+			}
 		}
-		return spliceErr != unix.EAGAIN
 	})
 
 	if err != nil {
@@ -57,5 +94,5 @@ func (r *PipeReader) writeTo(w syscall.RawConn) (bool, int64, error) {
 		return copied > 0, copied, readErr
 	}
 
-	return copied > 0, copied, err
+	return spliceResult(copied, spliceErr)
 }
@@ -0,0 +1,23 @@
+//go:build !linux
+// +build !linux
+
+package pipes
+
+import "io"
+
+// WriteTo implements io.WriterTo for the pipe reader.
+// splice(2) is not available on this platform so this copies through
+// pooled userspace buffers, see userCopy.
+func (r *PipeReader) WriteTo(w io.Writer) (int64, error) {
+	return r.copyResult(userCopy(w, r.fd))
+}
+
+// WriteToBuffer is like WriteTo, but copies through buf rather than a buffer
+// from the package's pool, like io.CopyBuffer. This lets callers which
+// manage their own memory avoid the internal buffers altogether.
+// If buf is empty, this is WriteTo.
+//
+// As with io.CopyBuffer, buf is not used if w implements io.ReaderFrom.
+func (r *PipeReader) WriteToBuffer(w io.Writer, buf []byte) (int64, error) {
+	return r.copyResult(userCopyBuffer(w, r.fd, buf))
+}
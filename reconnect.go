@@ -0,0 +1,287 @@
+package pipes
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// ReconnectingWriter writes to a fifo and survives the reader going away.
+// This is useful for producers, such as loggers, whose consumer may be
+// restarted.
+//
+// When a write fails because the reader has closed the fifo (EPIPE), the
+// writer waits for a new reader to open the fifo and resumes writing where it
+// left off. While there is no reader, up to MaxBuffer bytes are buffered so
+// writes do not block. Once the buffer is full, writes block until a reader
+// shows up or the context passed to NewReconnectingWriter is done.
+// Buffered data is written out on the next write or call to Flush.
+//
+// Data which was already written to the fifo, but not yet read when the reader
+// went away, is lost.
+type ReconnectingWriter struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	path   string
+	max    int
+
+	mu     sync.Mutex
+	w      *PipeWriter
+	buf    []byte
+	closed bool
+}
+
+// NewReconnectingWriter creates a ReconnectingWriter for the fifo at p, which
+// must already exist.
+// The fifo is not opened until the first write.
+//
+// maxBuffer is the maximum number of bytes buffered while there is no
+// reader. If it is 0, writes block until there is a reader.
+func NewReconnectingWriter(ctx context.Context, p string, maxBuffer int) *ReconnectingWriter {
+	ctx, cancel := context.WithCancel(ctx)
+	return &ReconnectingWriter{
+		ctx:    ctx,
+		cancel: cancel,
+		path:   p,
+		max:    maxBuffer,
+	}
+}
+
+// Write writes p to the fifo, reconnecting to a new reader as needed.
+func (w *ReconnectingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+
+	var (
+		written int
+		block   bool
+	)
+	for {
+		err := w.flush(block)
+		if err == nil {
+			var n int
+			n, err = w.w.Write(p)
+			written += n
+			p = p[n:]
+			if err == nil {
+				return written, nil
+			}
+			if !errors.Is(err, syscall.EPIPE) {
+				return written, err
+			}
+			w.disconnect()
+		} else if !errors.Is(err, errNoReader) {
+			return written, err
+		}
+
+		// There is no reader.
+		if len(w.buf)+len(p) <= w.max {
+			w.buf = append(w.buf, p...)
+			return written + len(p), nil
+		}
+		block = true
+	}
+}
+
+// Flush waits for a reader, if needed, and writes out any buffered data.
+func (w *ReconnectingWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	return w.flush(true)
+}
+
+// flush makes sure there is a connected writer and writes out any buffered
+// data.
+// If block is false and there is no reader, errNoReader is returned.
+// This must be called with w.mu held.
+func (w *ReconnectingWriter) flush(block bool) error {
+	for {
+		if w.w == nil {
+			var (
+				f   *os.File
+				err error
+			)
+			if block {
+				f, err = openWriterRetry(w.ctx, w.path)
+			} else {
+				f, err = openWriter(w.path)
+			}
+			if err != nil {
+				return err
+			}
+			w.w = newWriter(f)
+		}
+
+		if len(w.buf) == 0 {
+			return nil
+		}
+
+		n, err := w.w.Write(w.buf)
+		w.buf = append(w.buf[:0], w.buf[n:]...)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, syscall.EPIPE) {
+			return err
+		}
+		w.disconnect()
+		if !block {
+			return errNoReader
+		}
+	}
+}
+
+// disconnect closes the current writer after the reader went away.
+// This must be called with w.mu held.
+func (w *ReconnectingWriter) disconnect() {
+	w.w.Close()
+	w.w = nil
+}
+
+// Close closes the writer. Any buffered data is discarded.
+// Close unblocks a write waiting for a reader.
+func (w *ReconnectingWriter) Close() error {
+	w.cancel()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	w.buf = nil
+
+	if w.w != nil {
+		err := w.w.Close()
+		w.w = nil
+		return err
+	}
+	return nil
+}
+
+// ReconnectingReader reads from a fifo across writer restarts.
+//
+// A fifo reader normally gets EOF as soon as the last writer closes the fifo.
+// ReconnectingReader instead waits for the next writer and keeps reading, so
+// long-lived consumers do not need to handle producer restarts themselves.
+// Read only returns io.EOF after the reader has been closed.
+type ReconnectingReader struct {
+	path     string
+	keepOpen bool
+
+	mu     sync.Mutex
+	f      *os.File
+	hold   *os.File
+	closed bool
+}
+
+// NewReconnectingReader opens the fifo at p, which must already exist, for
+// reading. Opening does not block.
+//
+// If keepOpen is true, the fifo is also opened for writing internally, so
+// there is always at least one writer and the reader never sees EOF.
+// Otherwise, when the last writer goes away the fifo is reopened and reads
+// block until a new writer shows up.
+func NewReconnectingReader(p string, keepOpen bool) (*ReconnectingReader, error) {
+	f, err := openReader(p)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ReconnectingReader{path: p, keepOpen: keepOpen, f: f}
+	if keepOpen {
+		// This can't fail with no reader since we are the reader.
+		r.hold, err = openWriter(p)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Read reads from the fifo, waiting for a new writer when the previous ones
+// have gone away.
+func (r *ReconnectingReader) Read(p []byte) (int, error) {
+	for {
+		r.mu.Lock()
+		f, closed := r.f, r.closed
+		r.mu.Unlock()
+		if closed {
+			return 0, io.EOF
+		}
+
+		n, err := f.Read(p)
+		if err != io.EOF || r.keepOpen {
+			if err != nil && r.isClosed() {
+				err = io.EOF
+			}
+			return n, err
+		}
+
+		// All writers have gone away.
+		if err := r.reopen(f); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (r *ReconnectingReader) isClosed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
+
+// reopen replaces old with a fresh reader and waits for a writer.
+func (r *ReconnectingReader) reopen(old *os.File) error {
+	f, err := openReader(r.path)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		f.Close()
+		return io.EOF
+	}
+	r.f = f
+	r.mu.Unlock()
+	old.Close()
+
+	if err := waitWriter(f); err != nil {
+		if r.isClosed() {
+			return io.EOF
+		}
+		return err
+	}
+	return nil
+}
+
+// Close closes the reader, unblocking any pending reads.
+func (r *ReconnectingReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+
+	if r.hold != nil {
+		r.hold.Close()
+	}
+	return r.f.Close()
+}
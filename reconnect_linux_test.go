@@ -0,0 +1,192 @@
+package pipes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func openTestReader(t *testing.T, p string) *os.File {
+	t.Helper()
+
+	r, err := os.OpenFile(p, os.O_RDONLY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func readString(t *testing.T, r *os.File, n int) string {
+	t.Helper()
+
+	r.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer r.SetReadDeadline(time.Time{})
+
+	buf := make([]byte, n)
+	var read int
+	for read < n {
+		nn, err := r.Read(buf[read:])
+		read += nn
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return string(buf)
+}
+
+func TestReconnectingWriter(t *testing.T) {
+	p := mkTestFifo(t)
+
+	w := NewReconnectingWriter(context.Background(), p, 16)
+	defer w.Close()
+
+	t.Run("buffer without reader", func(t *testing.T) {
+		if _, err := w.Write([]byte("hello ")); err != nil {
+			t.Fatal(err)
+		}
+
+		r := openTestReader(t, p)
+		if _, err := w.Write([]byte("world")); err != nil {
+			t.Fatal(err)
+		}
+		if s := readString(t, r, 11); s != "hello world" {
+			t.Fatalf("expected hello world, got %q", s)
+		}
+		r.Close()
+	})
+
+	t.Run("reconnect", func(t *testing.T) {
+		// The reader is gone, so this is buffered.
+		if _, err := w.Write([]byte("foo")); err != nil {
+			t.Fatal(err)
+		}
+
+		r := openTestReader(t, p)
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if s := readString(t, r, 3); s != "foo" {
+			t.Fatalf("expected foo, got %q", s)
+		}
+		r.Close()
+	})
+
+	t.Run("block when full", func(t *testing.T) {
+		ch := make(chan error, 1)
+		go func() {
+			_, err := w.Write([]byte("this is more than sixteen bytes"))
+			ch <- err
+		}()
+
+		select {
+		case err := <-ch:
+			t.Fatalf("write should block until there is a reader: %v", err)
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		r := openTestReader(t, p)
+		select {
+		case err := <-ch:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for write")
+		}
+		if s := readString(t, r, 31); s != "this is more than sixteen bytes" {
+			t.Fatalf("unexpected data: %q", s)
+		}
+		r.Close()
+	})
+
+	t.Run("close", func(t *testing.T) {
+		w := NewReconnectingWriter(context.Background(), p, 0)
+
+		ch := make(chan error, 1)
+		go func() {
+			_, err := w.Write([]byte("hello"))
+			ch <- err
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+		w.Close()
+
+		select {
+		case err := <-ch:
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected context.Canceled, got: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for write")
+		}
+
+		if _, err := w.Write([]byte("hello")); err != os.ErrClosed {
+			t.Fatalf("expected os.ErrClosed, got: %v", err)
+		}
+	})
+}
+
+func TestReconnectingReader(t *testing.T) {
+	for _, keepOpen := range []bool{false, true} {
+		keepOpen := keepOpen
+		t.Run(fmt.Sprintf("keepOpen=%v", keepOpen), func(t *testing.T) {
+			p := mkTestFifo(t)
+
+			r, err := NewReconnectingReader(p, keepOpen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			for _, msg := range []string{"first", "second"} {
+				w, err := OpenWriter(context.Background(), p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := w.Write([]byte(msg)); err != nil {
+					t.Fatal(err)
+				}
+				w.Close()
+
+				buf := make([]byte, len(msg))
+				if _, err := io.ReadFull(r, buf); err != nil {
+					t.Fatal(err)
+				}
+				if string(buf) != msg {
+					t.Fatalf("expected %q, got %q", msg, buf)
+				}
+			}
+
+			// Read blocks across the writer going away until the reader is
+			// closed.
+			ch := make(chan error, 1)
+			go func() {
+				_, err := r.Read(make([]byte, 1))
+				ch <- err
+			}()
+
+			select {
+			case err := <-ch:
+				t.Fatalf("read should block: %v", err)
+			case <-time.After(20 * time.Millisecond):
+			}
+
+			r.Close()
+			select {
+			case err := <-ch:
+				if err != io.EOF {
+					t.Fatalf("expected io.EOF, got: %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("timeout waiting for read")
+			}
+		})
+	}
+}
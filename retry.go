@@ -0,0 +1,30 @@
+package pipes
+
+import "time"
+
+// RetryPolicy controls how the low-level Splice and Tee functions, and a
+// Copier (see Copier.SetRetryPolicy), handle transient errors: EINTR, EAGAIN,
+// and ENOMEM, which the kernel returns for splice(2) and tee(2) under memory
+// pressure.
+//
+// The zero value does not retry at all.
+type RetryPolicy struct {
+	// MaxRetries is the maximum number of consecutive retries without making
+	// any progress. A negative value means there is no limit.
+	MaxRetries int
+
+	// Backoff is how long to sleep before retrying after EAGAIN or ENOMEM.
+	// ENOMEM is only retried if Backoff is set.
+	// It is doubled after each consecutive retry, up to MaxBackoff.
+	Backoff time.Duration
+
+	// MaxBackoff caps the sleep between retries.
+	// If zero, the backoff is not capped.
+	MaxBackoff time.Duration
+
+	// Poll waits with poll(2) until the source is readable and the
+	// destination is writable before retrying after EAGAIN. It has no effect
+	// on retrying ENOMEM.
+	// Note that polling blocks the calling OS thread.
+	Poll bool
+}
@@ -0,0 +1,74 @@
+package pipes
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// defaultTeeRetry is the policy used by Tee when none is specified.
+var defaultTeeRetry = &RetryPolicy{MaxRetries: -1, Poll: true}
+
+// wait reports whether an operation on rfd/wfd which failed with err should
+// be retried, waiting as the policy dictates before returning.
+// attempt is the number of consecutive retries made so far.
+//
+// A nil policy retries EINTR indefinitely and never retries EAGAIN or ENOMEM,
+// which is what the package uses internally since it relies on the Go runtime
+// poller instead.
+func (p *RetryPolicy) wait(attempt int, err error, rfd, wfd int) bool {
+	if err != unix.EINTR && err != unix.EAGAIN && err != unix.ENOMEM {
+		return false
+	}
+
+	if p == nil {
+		return err == unix.EINTR
+	}
+
+	if p.MaxRetries >= 0 && attempt >= p.MaxRetries {
+		return false
+	}
+
+	if err == unix.EINTR {
+		return true
+	}
+	if err == unix.ENOMEM && p.Backoff <= 0 {
+		// Retrying right away is unlikely to find more memory.
+		return false
+	}
+
+	if p.Backoff > 0 {
+		d := p.Backoff
+		for i := 0; i < attempt && (p.MaxBackoff == 0 || d < p.MaxBackoff); i++ {
+			d *= 2
+		}
+		if p.MaxBackoff > 0 && d > p.MaxBackoff {
+			d = p.MaxBackoff
+		}
+		time.Sleep(d)
+	}
+
+	if p.Poll && err == unix.EAGAIN {
+		if pollFd(rfd, unix.POLLIN) != nil {
+			return false
+		}
+		if pollFd(wfd, unix.POLLOUT) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// pollFd waits for fd to be ready for the requested events.
+// An error condition on the fd (e.g. POLLHUP) also counts as ready since the
+// next operation on the fd will report it.
+func pollFd(fd int, events int16) error {
+	fds := []unix.PollFd{{Fd: int32(fd), Events: events}}
+	for {
+		_, err := unix.Poll(fds, -1)
+		if err == unix.EINTR {
+			continue
+		}
+		return err
+	}
+}
@@ -0,0 +1,189 @@
+package pipes
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// DefaultMaxLineSize is the longest line returned by a LineScanner when
+// MaxLineSize is not set.
+const DefaultMaxLineSize = 1 << 20
+
+// LineScanner reads newline terminated lines from a pipe, such as for
+// shipping the logs of a process.
+//
+// It works like a bufio.Scanner splitting with bufio.ScanLines, but is tuned
+// for pipes: the buffer starts out at the capacity of the pipe so a single
+// read can empty it, and before reading into a partly used buffer the
+// LineScanner checks how much is waiting in the pipe (with FIONREAD, where
+// supported) and makes room for all of it instead of reading a bit at a time.
+// Lines are returned in place from the buffer without copying.
+//
+// A LineScanner is not safe for concurrent use.
+type LineScanner struct {
+	r   *PipeReader
+	buf []byte
+	// buf[start:end] is read but not yet returned, of which
+	// buf[start:searched] is known not to contain a newline.
+	start    int
+	searched int
+	end      int
+	// capacity is the capacity of the pipe, a single read never returns
+	// more than this.
+	capacity int
+	line     []byte
+	err      error
+
+	// MaxLineSize is the longest line, not counting the newline, which is
+	// returned. The buffer never grows past what is needed to hold such a
+	// line. If zero, DefaultMaxLineSize is used.
+	MaxLineSize int
+
+	// SplitLongLines makes the LineScanner return lines longer than
+	// MaxLineSize as several lines of up to MaxLineSize bytes. Otherwise
+	// scanning stops at such a line and Err returns bufio.ErrTooLong.
+	SplitLongLines bool
+}
+
+// NewLineScanner creates a LineScanner reading lines from r.
+//
+// Reads from r are buffered, so r should not be read from directly once it is
+// passed to the LineScanner.
+func NewLineScanner(r *PipeReader) *LineScanner {
+	capacity := pipeCapacity(r)
+	return &LineScanner{r: r, buf: make([]byte, capacity), capacity: capacity}
+}
+
+func (s *LineScanner) maxLineSize() int {
+	if s.MaxLineSize > 0 {
+		return s.MaxLineSize
+	}
+	return DefaultMaxLineSize
+}
+
+// Scan advances to the next line, which is then available through Bytes or
+// Text. It returns false once the pipe is at EOF or an error occurred, after
+// which Err returns the error, if any.
+//
+// The last line is returned even if it is not terminated by a newline.
+func (s *LineScanner) Scan() bool {
+	s.line = nil
+	max := s.maxLineSize()
+
+	for {
+		if i := bytes.IndexByte(s.buf[s.searched:s.end], '\n'); i >= 0 {
+			nl := s.searched + i
+			if nl-s.start > max {
+				return s.longLine(max)
+			}
+			s.line = dropCR(s.buf[s.start:nl])
+			s.start = nl + 1
+			s.searched = s.start
+			return true
+		}
+		s.searched = s.end
+
+		if s.end-s.start > max {
+			return s.longLine(max)
+		}
+
+		if s.err != nil {
+			if s.err == io.EOF && s.start < s.end {
+				s.line = dropCR(s.buf[s.start:s.end])
+				s.start = s.end
+				return true
+			}
+			return false
+		}
+		s.fill(max)
+	}
+}
+
+// longLine handles a line which is longer than max bytes.
+func (s *LineScanner) longLine(max int) bool {
+	if !s.SplitLongLines {
+		s.err = bufio.ErrTooLong
+		return false
+	}
+	s.line = s.buf[s.start : s.start+max]
+	s.start += max
+	if s.searched < s.start {
+		s.searched = s.start
+	}
+	return true
+}
+
+// fill reads once from the pipe into the buffer, first making room for as
+// much as is waiting in the pipe.
+func (s *LineScanner) fill(max int) {
+	if s.start > 0 {
+		copy(s.buf, s.buf[s.start:s.end])
+		s.end -= s.start
+		s.searched -= s.start
+		s.start = 0
+	}
+
+	// A read into at least the capacity of the pipe empties it, so only ask
+	// how much is waiting when there is less room than that.
+	want := s.end + 1
+	if len(s.buf)-s.end < s.capacity {
+		if n, err := s.r.Buffered(); err == nil && n > 0 {
+			want = s.end + n
+		}
+	}
+	if want > len(s.buf) {
+		// Up to a line longer than max must fit to tell it is too long.
+		limit := max + 1
+		if limit < s.capacity {
+			limit = s.capacity
+		}
+		if size := 2 * len(s.buf); want < size {
+			want = size
+		}
+		if want > limit {
+			want = limit
+		}
+		if want > len(s.buf) {
+			buf := make([]byte, want)
+			copy(buf, s.buf[:s.end])
+			s.buf = buf
+		}
+	}
+
+	n, err := s.r.Read(s.buf[s.end:])
+	s.end += n
+	if err != nil {
+		s.err = err
+	}
+}
+
+// dropCR drops a terminal \r from the line.
+func dropCR(line []byte) []byte {
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		return line[:len(line)-1]
+	}
+	return line
+}
+
+// Bytes returns the line found by the last call to Scan, without the newline.
+// The slice points into the LineScanner's buffer and is only valid until the
+// next call to Scan.
+func (s *LineScanner) Bytes() []byte {
+	return s.line
+}
+
+// Text returns the line found by the last call to Scan as a string, without
+// the newline.
+func (s *LineScanner) Text() string {
+	return string(s.line)
+}
+
+// Err returns the first error, other than io.EOF, which stopped the
+// LineScanner.
+func (s *LineScanner) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+	return s.err
+}
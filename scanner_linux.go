@@ -0,0 +1,21 @@
+package pipes
+
+import "golang.org/x/sys/unix"
+
+// pipeCapacity returns the capacity of the pipe r reads from, or
+// defaultBufSize if it cannot be found out, such as for a file which is
+// not a pipe.
+func pipeCapacity(r *PipeReader) int {
+	rc, err := r.SyscallConn()
+	if err != nil {
+		return defaultBufSize
+	}
+
+	size := defaultBufSize
+	rc.Control(func(fd uintptr) {
+		if n, err := unix.FcntlInt(fd, unix.F_GETPIPE_SZ, 0); err == nil && n > 0 {
+			size = n
+		}
+	})
+	return size
+}
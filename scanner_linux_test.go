@@ -0,0 +1,152 @@
+package pipes
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func scanAll(t *testing.T, s *LineScanner) []string {
+	t.Helper()
+
+	var lines []string
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	return lines
+}
+
+func TestLineScanner(t *testing.T) {
+	t.Run("lines", func(t *testing.T) {
+		r, w := newPipe(t)
+
+		go func() {
+			w.Write([]byte("one\ntwo\r\n\nthr"))
+			w.Write([]byte("ee\nfour"))
+			w.Close()
+		}()
+
+		s := NewLineScanner(r)
+		lines := scanAll(t, s)
+		if err := s.Err(); err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{"one", "two", "", "three", "four"}
+		if strings.Join(lines, ",") != strings.Join(expected, ",") {
+			t.Fatalf("expected %q, got %q", expected, lines)
+		}
+	})
+
+	t.Run("larger than pipe", func(t *testing.T) {
+		r, w := newPipe(t)
+
+		line := strings.Repeat("x", 3*defaultBufSize)
+		go func() {
+			io.WriteString(w, line+"\nend\n")
+			w.Close()
+		}()
+
+		s := NewLineScanner(r)
+		lines := scanAll(t, s)
+		if err := s.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if len(lines) != 2 || lines[0] != line || lines[1] != "end" {
+			t.Fatalf("unexpected lines: %d", len(lines))
+		}
+	})
+
+	t.Run("too long", func(t *testing.T) {
+		r, w := newPipe(t)
+
+		go func() {
+			io.WriteString(w, "short\n"+strings.Repeat("x", 100)+"\nafter\n")
+			w.Close()
+		}()
+
+		s := NewLineScanner(r)
+		s.MaxLineSize = 10
+		lines := scanAll(t, s)
+		if !errors.Is(s.Err(), bufio.ErrTooLong) {
+			t.Fatalf("expected ErrTooLong, got: %v", s.Err())
+		}
+		if len(lines) != 1 || lines[0] != "short" {
+			t.Fatalf("unexpected lines: %q", lines)
+		}
+		if s.Scan() {
+			t.Fatal("expected scanning to stay stopped")
+		}
+	})
+
+	t.Run("split long lines", func(t *testing.T) {
+		r, w := newPipe(t)
+
+		go func() {
+			io.WriteString(w, "0123456789abcdefghij0123\nafter\n")
+			w.Close()
+		}()
+
+		s := NewLineScanner(r)
+		s.MaxLineSize = 10
+		s.SplitLongLines = true
+		lines := scanAll(t, s)
+		if err := s.Err(); err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{"0123456789", "abcdefghij", "0123", "after"}
+		if strings.Join(lines, ",") != strings.Join(expected, ",") {
+			t.Fatalf("expected %q, got %q", expected, lines)
+		}
+	})
+}
+
+func benchmarkLines(b *testing.B, scan func(r *PipeReader) int) {
+	line := append(bytes.Repeat([]byte("x"), 99), '\n')
+	chunk := bytes.Repeat(line, 1000)
+
+	b.SetBytes(int64(len(chunk)))
+	b.ReportAllocs()
+
+	r, w, err := New()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer r.Close()
+
+	go func() {
+		for i := 0; i < b.N; i++ {
+			w.Write(chunk)
+		}
+		w.Close()
+	}()
+
+	b.ResetTimer()
+	if n := scan(r); n != 1000*b.N {
+		b.Fatalf("expected %d lines, got %d", 1000*b.N, n)
+	}
+}
+
+func BenchmarkLineScanner(b *testing.B) {
+	benchmarkLines(b, func(r *PipeReader) int {
+		var n int
+		s := NewLineScanner(r)
+		for s.Scan() {
+			n++
+		}
+		return n
+	})
+}
+
+func BenchmarkBufioScanner(b *testing.B) {
+	benchmarkLines(b, func(r *PipeReader) int {
+		var n int
+		s := bufio.NewScanner(r)
+		for s.Scan() {
+			n++
+		}
+		return n
+	})
+}
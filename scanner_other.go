@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package pipes
+
+// pipeCapacity returns defaultBufSize since the capacity of a pipe
+// cannot be queried on this platform.
+func pipeCapacity(r *PipeReader) int {
+	return defaultBufSize
+}
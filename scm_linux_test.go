@@ -0,0 +1,78 @@
+package pipes
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func unixSocketpair(t *testing.T) (*net.UnixConn, *net.UnixConn) {
+	t.Helper()
+
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conns := make([]*net.UnixConn, 2)
+	for i, fd := range fds {
+		f := os.NewFile(uintptr(fd), "socketpair")
+		c, err := net.FileConn(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns[i] = c.(*net.UnixConn)
+		t.Cleanup(func() { c.Close() })
+	}
+	return conns[0], conns[1]
+}
+
+func TestSendFD(t *testing.T) {
+	a, b := unixSocketpair(t)
+	r, w := newPipe(t)
+
+	if err := SendFD(a, r); err != nil {
+		t.Fatal(err)
+	}
+	if err := SendFD(a, w); err != nil {
+		t.Fatal(err)
+	}
+
+	rr, err := RecvReader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Close()
+	rw, err := RecvWriter(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	w.Close()
+
+	if _, err := rw.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	rw.Close()
+
+	buf, err := io.ReadAll(rr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Fatalf("expected hello, got: %q", buf)
+	}
+
+	f := createFile(t)
+	if err := SendFD(a, f); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RecvReader(b); !errors.Is(err, ErrNotFifo) {
+		t.Fatalf("expected ErrNotFifo, got: %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package pipes
+
+import (
+	"net"
+	"syscall"
+)
+
+// SendFD is not supported on this platform and always returns
+// ErrNotSupported.
+func SendFD(conn *net.UnixConn, c syscall.Conn) error {
+	return ErrNotSupported
+}
+
+// RecvFD is not supported on this platform and always returns
+// ErrNotSupported.
+func RecvFD(conn *net.UnixConn) (uintptr, error) {
+	return 0, ErrNotSupported
+}
+
+// RecvReader is not supported on this platform and always returns
+// ErrNotSupported.
+func RecvReader(conn *net.UnixConn) (*PipeReader, error) {
+	return nil, ErrNotSupported
+}
+
+// RecvWriter is not supported on this platform and always returns
+// ErrNotSupported.
+func RecvWriter(conn *net.UnixConn) (*PipeWriter, error) {
+	return nil, ErrNotSupported
+}
@@ -0,0 +1,103 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package pipes
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// SendFD sends the fd backing c, such as a PipeReader or PipeWriter, over
+// the unix socket conn using SCM_RIGHTS. The receiving process gets its own
+// fd for the same pipe, see RecvReader and RecvWriter.
+//
+// c is not closed, so once the peer has received it, the sender will
+// usually want to close its end.
+func SendFD(conn *net.UnixConn, c syscall.Conn) error {
+	fd, err := dupConn(c)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	// At least one byte of data has to be sent along with the fd.
+	_, _, err = conn.WriteMsgUnix([]byte{0}, unix.UnixRights(fd), nil)
+	return err
+}
+
+// RecvFD receives an fd sent with SendFD from the unix socket conn.
+// The returned fd is close-on-exec, and the caller is responsible for
+// closing it.
+func RecvFD(conn *net.UnixConn) (uintptr, error) {
+	buf := make([]byte, 1)
+	oob := make([]byte, unix.CmsgSpace(4))
+
+	_, oobn, flags, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return 0, err
+	}
+
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return 0, os.NewSyscallError("recvmsg", err)
+	}
+
+	var fds []int
+	for _, m := range msgs {
+		rights, err := unix.ParseUnixRights(&m)
+		if err != nil {
+			continue
+		}
+		fds = append(fds, rights...)
+	}
+	if flags&unix.MSG_CTRUNC != 0 || len(fds) != 1 {
+		for _, fd := range fds {
+			unix.Close(fd)
+		}
+		return 0, errBadFDMessage
+	}
+
+	unix.CloseOnExec(fds[0])
+	return uintptr(fds[0]), nil
+}
+
+// RecvReader receives the read end of a pipe sent with SendFD.
+// If the received fd is not a pipe or fifo, it is closed and an error
+// wrapping ErrNotFifo is returned.
+func RecvReader(conn *net.UnixConn) (*PipeReader, error) {
+	fd, err := RecvFD(conn)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewReaderFromFD(fd, "recv")
+	if err != nil {
+		unix.Close(int(fd))
+		return nil, err
+	}
+	return r, nil
+}
+
+// RecvWriter receives the write end of a pipe sent with SendFD.
+// If the received fd is not a pipe or fifo, it is closed and an error
+// wrapping ErrNotFifo is returned.
+func RecvWriter(conn *net.UnixConn) (*PipeWriter, error) {
+	fd, err := RecvFD(conn)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriterFromFD(fd, "recv")
+	if err != nil {
+		unix.Close(int(fd))
+		return nil, err
+	}
+	return w, nil
+}
+
+// errBadFDMessage is returned when a message received by RecvFD does not
+// carry exactly one fd.
+var errBadFDMessage = errors.New("expected exactly one fd in message")
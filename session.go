@@ -0,0 +1,348 @@
+package pipes
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Session message types, sent in the first byte of each frame.
+const (
+	sessionRequest byte = iota
+	sessionResponse
+	sessionError
+)
+
+// sessionHeaderSize is the size of the header of each session message: the
+// message type followed by an 8 byte big endian request ID.
+const sessionHeaderSize = 9
+
+var errNoSessionHandler = errors.New("session has no handler for requests")
+
+// SessionHandler handles a request received by a Session and returns the
+// response. The request slice is only valid until the handler returns.
+// The context is cancelled when the session is closed.
+type SessionHandler func(ctx context.Context, req []byte) ([]byte, error)
+
+// RemoteError is returned by Session.Call when the handler on the other side
+// of the session returned an error.
+type RemoteError struct {
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return "remote error: " + e.Message
+}
+
+type sessionResult struct {
+	resp []byte
+	err  error
+}
+
+// Session sends requests and receives responses over a connection, such as
+// a FifoConn, for simple request/response protocols between processes.
+//
+// Messages are framed with a Framer and carry a request ID, so multiple calls
+// can be in flight at the same time and their responses can arrive in any
+// order. Sessions are symmetric: both sides can make calls, and the handler
+// passed to NewSession serves the calls made by the other side.
+type Session struct {
+	conn io.ReadWriteCloser
+	fr   *Framer
+
+	wmu sync.Mutex
+	fw  *Framer
+
+	handler SessionHandler
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	mu       sync.Mutex
+	nextID   uint64
+	pending  map[uint64]chan sessionResult
+	err      error
+	lastSeen time.Time
+}
+
+// NewSession starts a session over conn. Requests from the other side are
+// passed to handler, which is called in its own goroutine for each request.
+// handler may be nil if the other side does not make calls.
+//
+// The session owns conn and closes it when the session is closed.
+func NewSession(conn io.ReadWriteCloser, handler SessionHandler) *Session {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Session{
+		conn:     conn,
+		fr:       NewFramer(conn, nil),
+		fw:       NewFramer(nil, conn),
+		handler:  handler,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		pending:  make(map[uint64]chan sessionResult),
+		lastSeen: time.Now(),
+	}
+	go s.readLoop()
+	return s
+}
+
+// Call sends req to the other side and waits for the response.
+// Use ctx to set a timeout for the call. If ctx is done before the response
+// arrives, ctx.Err() is returned and the response is dropped when it
+// arrives. This includes waiting to send req when the other side is not
+// reading, in which case req is still sent once the connection takes it.
+//
+// If the handler on the other side fails, the error is a *RemoteError.
+// Once the session is closed, Call returns os.ErrClosed, or the error which
+// caused the connection to fail.
+func (s *Session) Call(ctx context.Context, req []byte) ([]byte, error) {
+	ch := make(chan sessionResult, 1)
+
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return nil, s.err
+	}
+	s.nextID++
+	id := s.nextID
+	s.pending[id] = ch
+	s.mu.Unlock()
+
+	if err := s.sendContext(ctx, sessionRequest, id, req); err != nil {
+		s.removePending(id)
+		return nil, err
+	}
+
+	select {
+	case res := <-ch:
+		return res.resp, res.err
+	case <-ctx.Done():
+		s.removePending(id)
+		return nil, ctx.Err()
+	case <-s.done:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return nil, s.err
+	}
+}
+
+func (s *Session) removePending(id uint64) {
+	s.mu.Lock()
+	delete(s.pending, id)
+	s.mu.Unlock()
+}
+
+func (s *Session) send(typ byte, id uint64, body []byte) error {
+	return s.writeMsg(sessionMsg(typ, id, body))
+}
+
+// sendContext is like send, but stops waiting once ctx is done or the
+// session ends. The write itself cannot be interrupted without corrupting
+// the stream of frames, so it is left to finish in the background.
+func (s *Session) sendContext(ctx context.Context, typ byte, id uint64, body []byte) error {
+	if ctx.Done() == nil {
+		return s.send(typ, id, body)
+	}
+
+	// Build the message up front, body may be reused once this returns.
+	msg := sessionMsg(typ, id, body)
+	errc := make(chan error, 1)
+	go func() { errc <- s.writeMsg(msg) }()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.done:
+		return s.Err()
+	}
+}
+
+// sessionMsg builds a message in a single buffer so it goes out as one write.
+func sessionMsg(typ byte, id uint64, body []byte) []byte {
+	msg := make([]byte, sessionHeaderSize+len(body))
+	msg[0] = typ
+	binary.BigEndian.PutUint64(msg[1:sessionHeaderSize], id)
+	copy(msg[sessionHeaderSize:], body)
+	return msg
+}
+
+func (s *Session) writeMsg(msg []byte) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	return s.fw.WriteFrame(msg)
+}
+
+func (s *Session) readLoop() {
+	for {
+		msg, err := s.fr.ReadFrame()
+		if err != nil {
+			s.fail(err)
+			return
+		}
+
+		s.mu.Lock()
+		s.lastSeen = time.Now()
+		s.mu.Unlock()
+
+		// Empty frames are heartbeats, see Keepalive.
+		if len(msg) < sessionHeaderSize {
+			continue
+		}
+
+		typ := msg[0]
+		id := binary.BigEndian.Uint64(msg[1:sessionHeaderSize])
+		// The framer reuses its buffer, so copy the body out before the
+		// next read.
+		body := append([]byte(nil), msg[sessionHeaderSize:]...)
+
+		switch typ {
+		case sessionRequest:
+			go s.handle(id, body)
+		case sessionResponse, sessionError:
+			s.mu.Lock()
+			ch, ok := s.pending[id]
+			delete(s.pending, id)
+			s.mu.Unlock()
+			if !ok {
+				// The call was cancelled.
+				continue
+			}
+			if typ == sessionError {
+				ch <- sessionResult{err: &RemoteError{Message: string(body)}}
+			} else {
+				ch <- sessionResult{resp: body}
+			}
+		}
+	}
+}
+
+func (s *Session) handle(id uint64, req []byte) {
+	var (
+		resp []byte
+		err  = errNoSessionHandler
+	)
+	if s.handler != nil {
+		resp, err = s.handler(s.ctx, req)
+	}
+	if err != nil {
+		s.send(sessionError, id, []byte(err.Error()))
+		return
+	}
+	s.send(sessionResponse, id, resp)
+}
+
+// fail marks the session as failed with err, if it has not failed already.
+func (s *Session) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return
+	}
+	s.err = err
+	s.pending = nil
+	s.cancel()
+	close(s.done)
+}
+
+// Close closes the session and its connection. Pending calls return
+// os.ErrClosed.
+func (s *Session) Close() error {
+	s.fail(os.ErrClosed)
+	return s.conn.Close()
+}
+
+// Done returns a channel which is closed when the session is closed or the
+// connection fails.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the reason the session ended, or nil if it is still running.
+func (s *Session) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Keepalive starts sending heartbeats (empty frames) to the other side every
+// interval, and returns a channel which is closed if nothing, neither
+// messages nor heartbeats, has been received from the other side for longer
+// than timeout. This lets long lived sessions detect a peer which has hung or
+// gone away without closing its end, which a fifo does not report otherwise.
+//
+// The other side must also call Keepalive, with an interval shorter than
+// timeout. Heartbeats stop when the session ends. The session is not closed
+// when the peer goes silent, that is up to the caller.
+//
+// An interval of zero or less sends no heartbeats, and a timeout of zero or
+// less never reports the peer as silent.
+func (s *Session) Keepalive(interval, timeout time.Duration) <-chan struct{} {
+	silent := make(chan struct{})
+	if interval > 0 {
+		go s.heartbeat(interval)
+	}
+	if timeout > 0 {
+		go s.watchSilence(timeout, silent)
+	}
+	return silent
+}
+
+// minSilenceCheck is the shortest interval at which Keepalive checks for a
+// silent peer.
+const minSilenceCheck = time.Millisecond
+
+func (s *Session) heartbeat(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+		}
+		s.wmu.Lock()
+		err := s.fw.WriteFrame(nil)
+		s.wmu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// watchSilence closes silent once nothing has been received for longer than
+// timeout. This is checked separately from sending heartbeats, since sending
+// blocks if the peer stops reading.
+func (s *Session) watchSilence(timeout time.Duration, silent chan struct{}) {
+	check := timeout / 4
+	if check < minSilenceCheck {
+		check = minSilenceCheck
+	}
+	t := time.NewTicker(check)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+		}
+		if time.Since(s.LastSeen()) > timeout {
+			close(silent)
+			return
+		}
+	}
+}
+
+// LastSeen returns the time anything was last received from the other side.
+func (s *Session) LastSeen() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastSeen
+}
@@ -0,0 +1,228 @@
+package pipes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newSessionConns returns two connected FifoConns made of pipes.
+func newSessionConns(t *testing.T) (*FifoConn, *FifoConn) {
+	r1, w1, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, w2, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &FifoConn{PipeReader: r1, PipeWriter: w2}, &FifoConn{PipeReader: r2, PipeWriter: w1}
+}
+
+func TestSession(t *testing.T) {
+	a, b := newSessionConns(t)
+
+	release := make(chan struct{})
+	server := NewSession(b, func(ctx context.Context, req []byte) ([]byte, error) {
+		switch string(req) {
+		case "fail":
+			return nil, errors.New("boom")
+		case "slow":
+			<-release
+		}
+		return []byte(strings.ToUpper(string(req))), nil
+	})
+	defer server.Close()
+	client := NewSession(a, nil)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// A slow call does not hold up others.
+	slowCh := make(chan error, 1)
+	go func() {
+		resp, err := client.Call(ctx, []byte("slow"))
+		if err == nil && string(resp) != "SLOW" {
+			err = fmt.Errorf("unexpected response: %q", resp)
+		}
+		slowCh <- err
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := fmt.Sprintf("hello%d", i)
+			resp, err := client.Call(ctx, []byte(req))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if string(resp) != strings.ToUpper(req) {
+				t.Errorf("expected %q, got %q", strings.ToUpper(req), resp)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	close(release)
+	if err := <-slowCh; err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := client.Call(ctx, []byte("fail"))
+	var remoteErr *RemoteError
+	if !errors.As(err, &remoteErr) || remoteErr.Message != "boom" {
+		t.Fatalf("expected remote error, got: %v", err)
+	}
+
+	// The server has no handler.
+	if _, err := server.Call(ctx, []byte("hi")); !errors.As(err, &remoteErr) {
+		t.Fatalf("expected remote error, got: %v", err)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	release = make(chan struct{})
+	defer close(release)
+	if _, err := client.Call(timeoutCtx, []byte("slow")); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, got: %v", err)
+	}
+}
+
+func TestSessionClose(t *testing.T) {
+	a, b := newSessionConns(t)
+
+	block := make(chan struct{})
+	defer close(block)
+	server := NewSession(b, func(ctx context.Context, req []byte) ([]byte, error) {
+		<-block
+		return nil, nil
+	})
+	client := NewSession(a, nil)
+	defer client.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := client.Call(context.Background(), []byte("hi"))
+		errCh <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	server.Close()
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Fatal("expected error after the peer closed the session")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for call to fail")
+	}
+
+	select {
+	case <-client.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for session to end")
+	}
+	if _, err := server.Call(context.Background(), nil); err != os.ErrClosed {
+		t.Fatalf("expected os.ErrClosed, got: %v", err)
+	}
+}
+
+func TestSessionCallBlockedWrite(t *testing.T) {
+	a, b := newSessionConns(t)
+	defer b.Close()
+
+	// Nothing reads b, so a large request fills the pipe and the write
+	// blocks.
+	client := NewSession(a, nil)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := client.Call(ctx, make([]byte, 1<<20))
+		errc <- err
+	}()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected context.DeadlineExceeded, got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Call did not return once ctx was done")
+	}
+}
+
+func TestSessionKeepalive(t *testing.T) {
+	a, b := newSessionConns(t)
+
+	server := NewSession(b, nil)
+	defer server.Close()
+	client := NewSession(a, nil)
+	defer client.Close()
+
+	const (
+		interval = 5 * time.Millisecond
+		timeout  = 50 * time.Millisecond
+	)
+	serverSilent := server.Keepalive(interval, timeout)
+	clientSilent := client.Keepalive(interval, timeout)
+
+	// Both sides send heartbeats, so neither goes silent.
+	select {
+	case <-serverSilent:
+		t.Fatal("server reported the client as silent")
+	case <-clientSilent:
+		t.Fatal("client reported the server as silent")
+	case <-time.After(4 * timeout):
+	}
+
+	// Stop the server's heartbeats without closing its end of the
+	// connection, as if the process was hung.
+	server.fail(os.ErrClosed)
+
+	select {
+	case <-clientSilent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the server to be reported silent")
+	}
+	if time.Since(client.LastSeen()) < timeout {
+		t.Fatalf("unexpected last seen time: %v", client.LastSeen())
+	}
+}
+
+func TestSessionKeepaliveInvalid(t *testing.T) {
+	a, b := newSessionConns(t)
+	defer b.Close()
+
+	s := NewSession(a, nil)
+	defer s.Close()
+
+	// None of these may panic. Zero disables both heartbeats and the silence
+	// check, and a tiny timeout is checked at a sane rate.
+	for _, d := range []time.Duration{-time.Second, 0} {
+		select {
+		case <-s.Keepalive(d, d):
+			t.Fatalf("unexpected silence with %v", d)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	select {
+	case <-s.Keepalive(0, 3):
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for a tiny timeout to report silence")
+	}
+}
@@ -0,0 +1,24 @@
+package pipes
+
+// SpliceOptions are used to customize the behavior of Splice.
+type SpliceOptions struct {
+	// Flags are passed to splice(2).
+	// If zero, DefaultSpliceFlags is used.
+	Flags int
+
+	// OffIn is the offset to read from in the source.
+	// It must be nil if the source is a pipe. If set, the offset is advanced
+	// by the number of bytes copied and the file offset of the source is left
+	// untouched.
+	OffIn *int64
+
+	// OffOut is the offset to write to in the destination.
+	// It must be nil if the destination is a pipe. If set, the offset is
+	// advanced by the number of bytes copied and the file offset of the
+	// destination is left untouched.
+	OffOut *int64
+
+	// Retry controls how EINTR and EAGAIN are handled.
+	// If nil, EINTR is always retried and EAGAIN is returned to the caller.
+	Retry *RetryPolicy
+}
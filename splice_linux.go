@@ -0,0 +1,235 @@
+package pipes
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxSpliceSize is the most bytes requested from a single splice(2) or tee(2)
+// call. Requests are capped so they fit in an int on 32-bit platforms.
+const maxSpliceSize = 1 << 30
+
+// spliceLen returns the number of bytes to request from a single syscall
+// when remain bytes are left to copy.
+func spliceLen(remain int64) int {
+	if remain > maxSpliceSize {
+		return maxSpliceSize
+	}
+	return int(remain)
+}
+
+var (
+	spliceOnce sync.Once
+	// spliceOK is 1 if splice(2) and tee(2) are usable. It is accessed
+	// atomically so tests can flip it while copies are running.
+	spliceOK int32
+)
+
+// SpliceSupported reports whether splice(2) and tee(2) are usable.
+// Some sandboxes, like gVisor, and custom kernels may not implement them.
+//
+// This is checked once, the first time it is needed. When they are not
+// supported ReadFrom, WriteTo, Copy, CopyN, TeeCopy, and Copier transparently
+// copy through userspace instead.
+func SpliceSupported() bool {
+	spliceOnce.Do(func() {
+		if probeSplice() {
+			atomic.StoreInt32(&spliceOK, 1)
+		}
+	})
+	return atomic.LoadInt32(&spliceOK) == 1
+}
+
+// probeSplice checks if splice(2) and tee(2) work by moving a byte between
+// two pipes. This is the one case which must work when they are implemented at
+// all, so ENOSYS or EINVAL here means they are not supported.
+func probeSplice() bool {
+	src, err := mkPipe()
+	if err != nil {
+		return true
+	}
+	defer unix.Close(src[0])
+	defer unix.Close(src[1])
+
+	dst, err := mkPipe()
+	if err != nil {
+		return true
+	}
+	defer unix.Close(dst[0])
+	defer unix.Close(dst[1])
+
+	if _, err := unix.Write(src[1], []byte{0}); err != nil {
+		return true
+	}
+
+	if _, err := unix.Tee(src[0], dst[1], 1, unix.SPLICE_F_NONBLOCK); isSpliceUnsupported(err) {
+		return false
+	}
+	if _, err := unix.Splice(src[0], nil, dst[1], nil, 1, unix.SPLICE_F_NONBLOCK); isSpliceUnsupported(err) {
+		return false
+	}
+	return true
+}
+
+// isSpliceUnsupported reports whether err from splice(2) or tee(2) means the
+// operation is not possible at all with the fds passed in, for instance
+// because one of them is a file opened with O_APPEND, or because the syscall
+// is not implemented. The caller should fall back to a userspace copy.
+func isSpliceUnsupported(err error) bool {
+	return err == unix.ENOSYS || err == unix.EINVAL
+}
+
+// DefaultSpliceFlags are the flags used for splice(2) when none are specified.
+const DefaultSpliceFlags = unix.SPLICE_F_MOVE | unix.SPLICE_F_NONBLOCK | unix.SPLICE_F_MORE
+
+// Splice moves up to n bytes from src to dst using splice(2).
+// At least one of src or dst must be a pipe.
+//
+// If n is zero or less, Splice keeps going until src reaches EOF or the call
+// would block.
+//
+// By default Splice retries on EINTR and returns the number of bytes copied
+// along with the error which caused it to stop, if any. This includes EAGAIN
+// (ErrWouldBlock), which is returned when either side is non-blocking and not
+// ready. It is up to the caller to wait for the fds to be ready and try again,
+// unless a retry policy is set in opts.
+// If the kernel does not implement splice(2), the error matches
+// ErrNotSupported.
+// A return of fewer than n bytes with a nil error means src reached EOF.
+func Splice(dst, src int, n int64, opts *SpliceOptions) (int64, error) {
+	flags := DefaultSpliceFlags
+	var (
+		offIn, offOut *int64
+		retry         *RetryPolicy
+	)
+	if opts != nil {
+		if opts.Flags != 0 {
+			flags = opts.Flags
+		}
+		offIn, offOut = opts.OffIn, opts.OffOut
+		retry = opts.Retry
+	}
+	if n < 0 {
+		n = 0
+	}
+	copied, err := doSplice(src, offIn, dst, offOut, n, flags, retry, nil, nil)
+	return copied, mapErrno(err)
+}
+
+func splice(rfd, wfd int, remain int64) (copied int64, spliceErr error) {
+	return doSplice(rfd, nil, wfd, nil, remain, DefaultSpliceFlags, nil, nil, nil)
+}
+
+// doSplice implements Splice. The syscalls it issues are counted in sc, if it is
+// not nil, as well as in the process wide counts. Retries are logged to log,
+// see logEvent.
+func doSplice(rfd int, offIn *int64, wfd int, offOut *int64, remain int64, flags int, retry *RetryPolicy, sc *syscallCounter, log Logger) (copied int64, spliceErr error) {
+	noEnd := remain == 0
+	if noEnd {
+		remain = 1 << 62
+	}
+
+	var attempt int
+	for remain > 0 {
+		// The return type of unix.Splice differs between 32 and 64-bit
+		// platforms.
+		nn, err := unix.Splice(rfd, offIn, wfd, offOut, spliceLen(remain), flags)
+		countSyscall(sc, syscallSplice, err)
+		n := int64(nn)
+		if n > 0 {
+			atomic.AddInt64(&metrics.spliced, n)
+			copied += n
+			if !noEnd {
+				remain -= n
+			}
+		}
+
+		spliceErr = err
+
+		if err != nil {
+			if n > 0 {
+				attempt = 0
+			}
+			if retry.wait(attempt, err, rfd, wfd) {
+				logEvent(log, EventRetry, "op", "splice", "err", err, "attempt", attempt)
+				attempt++
+				continue
+			}
+			return
+		}
+		attempt = 0
+
+		if n == 0 {
+			// EOF
+			return
+		}
+	}
+
+	return
+}
+
+// Tee duplicates up to n bytes from the pipe src to the pipe dst using tee(2).
+// Unlike Splice, the data is not consumed from src.
+// Both src and dst must be pipes.
+//
+// If n is zero or less, as much data as is available is duplicated.
+// If flags is zero, SPLICE_F_MOVE is used (which is currently a no-op for
+// tee(2) but reserved for future use).
+//
+// Tee retries on EINTR. If the call would block (EAGAIN), Tee waits with
+// poll(2) until src is readable and dst is writable and then tries again, so
+// it is safe to use with non-blocking fds. Note that this blocks the calling
+// OS thread. Use TeeWithRetry to customize this behavior.
+// A return of 0 bytes with a nil error means there is no data in src and all
+// writers of src have been closed.
+func Tee(dst, src int, n int64, flags int) (int64, error) {
+	return TeeWithRetry(dst, src, n, flags, defaultTeeRetry)
+}
+
+// TeeWithRetry is like Tee but uses the passed in retry policy to handle
+// EINTR and EAGAIN.
+// If retry is nil, EINTR is always retried and EAGAIN (ErrWouldBlock) is
+// returned to the caller.
+func TeeWithRetry(dst, src int, n int64, flags int, retry *RetryPolicy) (int64, error) {
+	if flags == 0 {
+		flags = unix.SPLICE_F_MOVE
+	}
+	n, err := doTee(src, dst, n, flags, retry, nil, nil)
+	return n, mapErrno(err)
+}
+
+func tee(rfd, wfd int, do int64) (copied int64, teeErr error) {
+	// Note, this is not using SPLICE_F_NONBLOCK otherwise we'll end up getting in
+	// a situation where we copied less than desired due to non-blocking writes,
+	// but then with tee we can't try again because the reader side has not
+	// advanced at all.
+	return doTee(rfd, wfd, do, unix.SPLICE_F_MOVE, nil, nil, nil)
+}
+
+// doTee implements TeeWithRetry. The syscalls it issues are counted in sc, if it
+// is not nil, as well as in the process wide counts. Retries are logged to log,
+// see logEvent.
+func doTee(rfd, wfd int, do int64, flags int, retry *RetryPolicy, sc *syscallCounter, log Logger) (copied int64, teeErr error) {
+	if do <= 0 {
+		do = 1 << 62
+	}
+
+	for attempt := 0; ; attempt++ {
+		n, err := unix.Tee(rfd, wfd, spliceLen(do), flags)
+		countSyscall(sc, syscallTee, err)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil {
+			if retry.wait(attempt, err, rfd, wfd) {
+				logEvent(log, EventRetry, "op", "tee", "err", err, "attempt", attempt)
+				continue
+			}
+			return 0, err
+		}
+		// EOF
+		return 0, nil
+	}
+}
@@ -0,0 +1,386 @@
+package pipes
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestSplice(t *testing.T) {
+	f := createFile(t)
+	if _, err := f.Write([]byte("hello world")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	r, w := newPipe(t)
+
+	off := int64(6)
+	n, err := Splice(rawFd(t, w), int(f.Fd()), 5, &SpliceOptions{OffIn: &off})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Fatalf("expected 5 bytes, got %d", n)
+	}
+	if off != 11 {
+		t.Fatalf("expected offset to be advanced to 11, got %d", off)
+	}
+
+	pos, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos != 0 {
+		t.Fatalf("expected file offset to be untouched, got %d", pos)
+	}
+
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "world" {
+		t.Fatalf("expected %q, got %q", "world", buf)
+	}
+}
+
+func rawFd(t testing.TB, c syscall.Conn) int {
+	t.Helper()
+
+	rc, err := c.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fd int
+	if err := rc.Control(func(p uintptr) { fd = int(p) }); err != nil {
+		t.Fatal(err)
+	}
+	return fd
+}
+
+func TestTee(t *testing.T) {
+	r1, w1 := newPipe(t)
+	r2, w2 := newPipe(t)
+
+	if _, err := w1.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := Tee(rawFd(t, w2), rawFd(t, r1), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Fatalf("expected 5 bytes, got %d", n)
+	}
+
+	for _, r := range []*PipeReader{r1, r2} {
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != "hello" {
+			t.Fatalf("expected %q, got %q", "hello", buf)
+		}
+	}
+}
+
+func TestTeeWaitsForData(t *testing.T) {
+	r1, w1 := newPipe(t)
+	r2, w2 := newPipe(t)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		w1.Write([]byte("hello"))
+	}()
+
+	n, err := Tee(rawFd(t, w2), rawFd(t, r1), 0, unix.SPLICE_F_NONBLOCK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Fatalf("expected 5 bytes, got %d", n)
+	}
+
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(r2, buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSpliceLen(t *testing.T) {
+	for _, remain := range []int64{1 << 62, 1 << 31, maxSpliceSize + 1} {
+		if n := spliceLen(remain); n != maxSpliceSize {
+			t.Errorf("expected %d to be capped to %d, got %d", remain, maxSpliceSize, n)
+		}
+	}
+	if n := spliceLen(42); n != 42 {
+		t.Errorf("expected 42, got %d", n)
+	}
+}
+
+func TestSpliceRetry(t *testing.T) {
+	r1, w1 := newPipe(t)
+	r2, w2 := newPipe(t)
+
+	// No data, so without retries this should return EAGAIN right away.
+	_, err := Splice(rawFd(t, w2), rawFd(t, r1), 5, nil)
+	if err != unix.EAGAIN {
+		t.Fatalf("expected EAGAIN, got: %v", err)
+	}
+
+	_, err = Splice(rawFd(t, w2), rawFd(t, r1), 5, &SpliceOptions{Retry: &RetryPolicy{MaxRetries: 2, Backoff: time.Millisecond}})
+	if err != unix.EAGAIN {
+		t.Fatalf("expected EAGAIN after retries are exhausted, got: %v", err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		w1.Write([]byte("hello"))
+	}()
+
+	n, err := Splice(rawFd(t, w2), rawFd(t, r1), 5, &SpliceOptions{Retry: &RetryPolicy{MaxRetries: -1, Poll: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Fatalf("expected 5 bytes, got %d", n)
+	}
+
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(r2, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Fatalf("expected %q, got %q", "hello", buf)
+	}
+}
+
+// disableSplice makes SpliceSupported report false for the duration of the
+// test.
+func disableSplice(t *testing.T) {
+	t.Helper()
+
+	if !SpliceSupported() {
+		return
+	}
+	atomic.StoreInt32(&spliceOK, 0)
+	t.Cleanup(func() { atomic.StoreInt32(&spliceOK, 1) })
+}
+
+func TestRetryPolicyENOMEM(t *testing.T) {
+	if (*RetryPolicy)(nil).wait(0, unix.ENOMEM, -1, -1) {
+		t.Fatal("expected a nil policy not to retry ENOMEM")
+	}
+	if (&RetryPolicy{MaxRetries: -1, Poll: true}).wait(0, unix.ENOMEM, -1, -1) {
+		t.Fatal("expected ENOMEM not to be retried without a backoff")
+	}
+
+	p := &RetryPolicy{MaxRetries: 2, Backoff: time.Millisecond}
+	if !p.wait(0, unix.ENOMEM, -1, -1) {
+		t.Fatal("expected ENOMEM to be retried with a backoff")
+	}
+	if p.wait(2, unix.ENOMEM, -1, -1) {
+		t.Fatal("expected retries to be limited")
+	}
+}
+
+func TestSpliceUnsupported(t *testing.T) {
+	if !SpliceSupported() {
+		t.Fatal("expected splice to be supported")
+	}
+
+	t.Run("einval fallback", func(t *testing.T) {
+		// splice(2) does not support files opened with O_APPEND.
+		f, err := os.OpenFile(filepath.Join(t.TempDir(), "file"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		r, w := newPipe(t)
+		if _, err := w.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+
+		n, err := r.WriteTo(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 5 {
+			t.Fatalf("expected 5 bytes, got %d", n)
+		}
+	})
+
+	disableSplice(t)
+
+	t.Run("ReadFrom", func(t *testing.T) {
+		r1, w1 := newPipe(t)
+		r, w := newPipe(t)
+		go func() {
+			w1.Write([]byte("hello"))
+			w1.Close()
+		}()
+		go func() {
+			w.ReadFrom(r1)
+			w.Close()
+		}()
+
+		buf, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != "hello" {
+			t.Fatalf("expected hello, got %q", buf)
+		}
+	})
+
+	t.Run("TeeCopy", func(t *testing.T) {
+		r1, w1 := newPipe(t)
+		r2, w2 := newPipe(t)
+		r3, w3 := newPipe(t)
+
+		go func() {
+			w1.Write([]byte("hello"))
+			w1.Close()
+		}()
+
+		results, err := TeeCopy(r1, w2, w3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w2.Close()
+		w3.Close()
+
+		for i, r := range []*PipeReader{r2, r3} {
+			if results[i].Err != nil || results[i].N != 5 {
+				t.Fatalf("unexpected result: %+v", results[i])
+			}
+			buf, _ := io.ReadAll(r)
+			if string(buf) != "hello" {
+				t.Fatalf("expected hello, got %q", buf)
+			}
+		}
+	})
+
+	t.Run("Copier", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		r1, w1 := newPipe(t)
+		r2, w2 := newPipe(t)
+		r3, w3 := newPipe(t)
+
+		buf1 := new(syncBuffer)
+		buf2 := new(syncBuffer)
+		go io.Copy(buf1, r2)
+		go io.Copy(buf2, r3)
+
+		c, err := NewCopier(ctx, r1, w2, w3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		before := Syscalls()
+		if _, err := w1.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+
+		checkBuffer(t, buf1, "hello")
+		checkBuffer(t, buf2, "hello")
+
+		// One write by the test and one per writer by the copier.
+		if n := c.Stats().Syscalls.Writes; n != 2 {
+			t.Fatalf("expected 2 writes by the copier, got %d", n)
+		}
+		if n := Syscalls().Writes - before.Writes; n != 3 {
+			t.Fatalf("expected 3 writes in the process, got %d", n)
+		}
+
+		// As with splicing, the data moved by the copier is not counted.
+		if n := r1.BytesRead(); n != 0 {
+			t.Fatalf("expected no bytes read to be counted, got %d", n)
+		}
+		if n := w2.BytesWritten(); n != 0 {
+			t.Fatalf("expected no bytes written to be counted, got %d", n)
+		}
+	})
+}
+
+func TestSyscallStats(t *testing.T) {
+	r1, w1 := newPipe(t)
+	r2, w2 := newPipe(t)
+	rfd, wfd := rawFd(t, r1), rawFd(t, w2)
+
+	before := Syscalls()
+
+	// Nothing to read yet, so this fails with EAGAIN.
+	if _, err := Splice(wfd, rfd, 5, nil); err != unix.EAGAIN {
+		t.Fatalf("expected EAGAIN, got: %v", err)
+	}
+
+	if _, err := w1.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TeeWithRetry(wfd, rfd, 5, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := Splice(wfd, rfd, 5, nil); err != nil || n != 5 {
+		t.Fatalf("expected 5 bytes, got %d: %v", n, err)
+	}
+	if _, err := io.ReadFull(r2, make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	after := Syscalls()
+	if n := after.Splices - before.Splices; n < 2 {
+		t.Fatalf("expected at least 2 splice calls, got %d", n)
+	}
+	if n := after.Tees - before.Tees; n < 1 {
+		t.Fatalf("expected at least 1 tee call, got %d", n)
+	}
+	if n := after.EAGAIN - before.EAGAIN; n < 1 {
+		t.Fatalf("expected at least 1 EAGAIN, got %d", n)
+	}
+	if n := after.Writes - before.Writes; n < 1 {
+		t.Fatalf("expected at least 1 write call, got %d", n)
+	}
+
+	s := SyscallStats{Splices: 3, Tees: 1, EAGAIN: 1}
+	if s.Calls() != 4 || s.EAGAINRate() != 0.25 {
+		t.Fatalf("unexpected calls or rate: %d, %f", s.Calls(), s.EAGAINRate())
+	}
+	if (SyscallStats{}).EAGAINRate() != 0 {
+		t.Fatal("expected 0 rate with no calls")
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
+	r1, _ := newPipe(t)
+	_, w2 := newPipe(t)
+
+	_, err := Splice(rawFd(t, w2), rawFd(t, r1), 5, nil)
+	if !errors.Is(err, ErrWouldBlock) {
+		t.Fatalf("expected ErrWouldBlock, got: %v", err)
+	}
+
+	err = mapErrno(unix.ENOSYS)
+	if !errors.Is(err, ErrNotSupported) || !errors.Is(err, unix.ENOSYS) {
+		t.Fatalf("expected ENOSYS to match ErrNotSupported and ENOSYS, got: %v", err)
+	}
+	if err := mapErrno(unix.EINVAL); err != unix.EINVAL {
+		t.Fatalf("expected EINVAL to be returned as is, got: %v", err)
+	}
+}
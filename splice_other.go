@@ -0,0 +1,49 @@
+//go:build !linux
+// +build !linux
+
+package pipes
+
+// DefaultSpliceFlags are the flags used for splice(2) when none are specified.
+// splice(2) is not available on this platform.
+const DefaultSpliceFlags = 0
+
+// SpliceSupported reports whether splice(2) and tee(2) are usable.
+// They are never available on this platform.
+func SpliceSupported() bool {
+	return false
+}
+
+// Splice is not supported on this platform and always returns
+// ErrNotSupported.
+func Splice(dst, src int, n int64, opts *SpliceOptions) (int64, error) {
+	return 0, ErrNotSupported
+}
+
+// Tee is not supported on this platform and always returns ErrNotSupported.
+func Tee(dst, src int, n int64, flags int) (int64, error) {
+	return 0, ErrNotSupported
+}
+
+// TeeWithRetry is not supported on this platform and always returns
+// ErrNotSupported.
+func TeeWithRetry(dst, src int, n int64, flags int, retry *RetryPolicy) (int64, error) {
+	return 0, ErrNotSupported
+}
+
+// AllocPages is not supported on this platform and always returns
+// ErrNotSupported.
+func AllocPages(size int) ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+// FreePages is not supported on this platform and always returns
+// ErrNotSupported.
+func FreePages(b []byte) error {
+	return ErrNotSupported
+}
+
+// GiftBuffers is not supported on this platform and always returns
+// ErrNotSupported.
+func (w *PipeWriter) GiftBuffers(bufs [][]byte) (int64, error) {
+	return 0, ErrNotSupported
+}
@@ -0,0 +1,83 @@
+package pipes
+
+import (
+	"context"
+	"io"
+)
+
+// Stage is a single step in a Pipeline.
+//
+// RunStage should read from r and write to w until r returns io.EOF or ctx is
+// cancelled.
+// The pipeline takes care of closing w when the stage returns.
+type Stage interface {
+	RunStage(ctx context.Context, r *PipeReader, w *PipeWriter) error
+}
+
+// StageFunc is an adapter to allow the use of ordinary functions as a Stage.
+type StageFunc func(ctx context.Context, r *PipeReader, w *PipeWriter) error
+
+// RunStage calls f(ctx, r, w).
+func (f StageFunc) RunStage(ctx context.Context, r *PipeReader, w *PipeWriter) error {
+	return f(ctx, r, w)
+}
+
+// PassthroughStage returns a stage which copies data from r to w without
+// modification.
+// Since both sides are pipes this uses splice(2) where available.
+func PassthroughStage() Stage {
+	return StageFunc(func(ctx context.Context, r *PipeReader, w *PipeWriter) error {
+		_, err := w.ReadFrom(r)
+		return err
+	})
+}
+
+// TransformStage returns a stage which passes each chunk of data read from r
+// through fn and writes the result to w.
+//
+// The slice passed to fn comes from a shared pool and must not be retained
+// after fn returns. fn may modify the slice in place and return it.
+// The context is checked between each chunk.
+func TransformStage(fn func(p []byte) ([]byte, error)) Stage {
+	return StageFunc(func(ctx context.Context, r *PipeReader, w *PipeWriter) error {
+		buf := getBuf()
+		defer putBuf(buf)
+
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			n, err := r.Read(*buf)
+			if n > 0 {
+				out, ferr := fn((*buf)[:n])
+				if ferr != nil {
+					return ferr
+				}
+				if _, werr := w.Write(out); werr != nil {
+					return werr
+				}
+			}
+			if err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+		}
+	})
+}
+
+// FilterStage returns a stage which only forwards chunks of data for which
+// keep returns true.
+//
+// Note that chunk boundaries depend on how data was written to and read from
+// the pipe, so this is mostly useful when writers use message-sized writes.
+func FilterStage(keep func(p []byte) bool) Stage {
+	return TransformStage(func(p []byte) ([]byte, error) {
+		if !keep(p) {
+			return nil, nil
+		}
+		return p, nil
+	})
+}
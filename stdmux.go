@@ -0,0 +1,147 @@
+package pipes
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// StdStream identifies one of the streams multiplexed by a StdMux.
+type StdStream byte
+
+const (
+	StreamStdin StdStream = iota
+	StreamStdout
+	StreamStderr
+)
+
+// StdHeaderSize is the size of the header prepended to each chunk written
+// by a StdMux.
+//
+// The header is made up of the stream in the first byte, 3 bytes of padding,
+// and a 4 byte big endian payload length. This is the same format as the
+// Docker API uses for attach streams without a TTY.
+const StdHeaderSize = 8
+
+// maxStdPayload is the largest payload put in a single chunk by a StdMux.
+const maxStdPayload = 1 << 30
+
+// StdMux multiplexes the stdout and stderr streams of a process over a single
+// writer, such as one fifo, by framing each write with a header naming the
+// stream it belongs to.
+type StdMux struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewStdMux creates a StdMux writing framed chunks to w.
+func NewStdMux(w io.Writer) *StdMux {
+	return &StdMux{w: w}
+}
+
+// Stdout returns a writer for the stdout stream.
+func (m *StdMux) Stdout() io.Writer {
+	return m.Stream(StreamStdout)
+}
+
+// Stderr returns a writer for the stderr stream.
+func (m *StdMux) Stderr() io.Writer {
+	return m.Stream(StreamStderr)
+}
+
+// Stream returns a writer for the passed in stream.
+// Writes to the returned writers are safe for concurrent use and are never
+// interleaved in the output.
+func (m *StdMux) Stream(s StdStream) io.Writer {
+	return &stdMuxWriter{m: m, stream: s}
+}
+
+type stdMuxWriter struct {
+	m      *StdMux
+	stream StdStream
+}
+
+func (w *stdMuxWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > maxStdPayload {
+			chunk = chunk[:maxStdPayload]
+		}
+		if err := w.m.writeChunk(w.stream, chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+func (m *StdMux) writeChunk(s StdStream, p []byte) error {
+	var hdr [StdHeaderSize]byte
+	hdr[0] = byte(s)
+	binary.BigEndian.PutUint32(hdr[4:], uint32(len(p)))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Write the header and payload with one syscall when writing to a pipe,
+	// so small chunks stay atomic even with writers in other processes.
+	if pw, ok := m.w.(*PipeWriter); ok {
+		_, err := pw.WriteVec([][]byte{hdr[:], p})
+		return err
+	}
+
+	if _, err := m.w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := m.w.Write(p)
+	return err
+}
+
+// StdDemux reads a stream written by a StdMux from src and writes each chunk
+// to stdout or stderr, depending on the stream it belongs to, until src
+// returns EOF. It returns the total number of payload bytes written.
+//
+// The payloads are copied straight from src to the destination writers, so
+// when src is a *PipeReader and the destination a *PipeWriter the payloads
+// are spliced without going through userspace.
+// A nil stdout or stderr discards that stream.
+func StdDemux(src io.Reader, stdout, stderr io.Writer) (int64, error) {
+	var (
+		hdr     [StdHeaderSize]byte
+		written int64
+	)
+	for {
+		if _, err := io.ReadFull(src, hdr[:]); err != nil {
+			if err == io.EOF {
+				return written, nil
+			}
+			return written, err
+		}
+
+		var dst io.Writer
+		switch StdStream(hdr[0]) {
+		case StreamStdout:
+			dst = stdout
+		case StreamStderr:
+			dst = stderr
+		default:
+			return written, fmt.Errorf("unknown stream in header: %d", hdr[0])
+		}
+		if dst == nil {
+			dst = io.Discard
+		}
+
+		size := int64(binary.BigEndian.Uint32(hdr[4:]))
+		n, err := copyNBuffer(dst, src, size)
+		written += n
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return written, err
+		}
+	}
+}
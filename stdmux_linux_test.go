@@ -0,0 +1,106 @@
+package pipes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+func TestStdMux(t *testing.T) {
+	r, w, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	m := NewStdMux(w)
+	go func() {
+		defer w.Close()
+		m.Stdout().Write([]byte("out1"))
+		m.Stderr().Write([]byte("err1"))
+		m.Stdout().Write([]byte("out2"))
+	}()
+
+	type chunk struct {
+		s    StdStream
+		data string
+	}
+	expected := []chunk{
+		{StreamStdout, "out1"},
+		{StreamStderr, "err1"},
+		{StreamStdout, "out2"},
+	}
+
+	for _, e := range expected {
+		var hdr [StdHeaderSize]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			t.Fatal(err)
+		}
+		if StdStream(hdr[0]) != e.s {
+			t.Fatalf("expected stream %d, got %d", e.s, hdr[0])
+		}
+		data := make([]byte, binary.BigEndian.Uint32(hdr[4:]))
+		if _, err := io.ReadFull(r, data); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, []byte(e.data)) {
+			t.Fatalf("expected %q, got %q", e.data, data)
+		}
+	}
+	if _, err := r.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected EOF, got: %v", err)
+	}
+}
+
+func TestStdDemux(t *testing.T) {
+	r, w, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	outR, outW, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer outR.Close()
+
+	payload := bytes.Repeat([]byte("x"), 200<<10)
+	m := NewStdMux(w)
+	go func() {
+		defer w.Close()
+		m.Stdout().Write(payload)
+		m.Stderr().Write([]byte("err1"))
+		m.Stdout().Write([]byte("out2"))
+	}()
+
+	outCh := make(chan []byte, 1)
+	go func() {
+		b, _ := io.ReadAll(outR)
+		outCh <- b
+	}()
+
+	var stderr bytes.Buffer
+	n, err := StdDemux(r, outW, &stderr)
+	outW.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(payload)+8) {
+		t.Fatalf("expected %d bytes written, got %d", len(payload)+8, n)
+	}
+	if stderr.String() != "err1" {
+		t.Fatalf("unexpected stderr: %q", stderr.String())
+	}
+	if out := <-outCh; !bytes.Equal(out, append(payload, "out2"...)) {
+		t.Fatalf("unexpected stdout of %d bytes", len(out))
+	}
+
+	// A truncated chunk is an error.
+	var buf bytes.Buffer
+	NewStdMux(&buf).Stdout().Write([]byte("hello"))
+	if _, err := StdDemux(bytes.NewReader(buf.Bytes()[:buf.Len()-1]), nil, nil); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package pipes
+
+import (
+	"sync/atomic"
+	"syscall"
+)
+
+// SyscallStats counts the syscalls issued to move data, to check how well
+// tuning such as the pipe size or the chunk size is working. Few bytes per
+// call or a high EAGAIN rate usually mean the buffers are too small.
+type SyscallStats struct {
+	// Splices is the number of splice(2) calls.
+	Splices int64
+	// Tees is the number of tee(2) calls.
+	Tees int64
+	// Writes is the number of calls copying data from userspace into a pipe,
+	// such as write(2), writev(2) and vmsplice(2). A PipeWriter.Write counts
+	// as one.
+	Writes int64
+	// Reads is the number of calls copying data into userspace buffers, to
+	// be written out again, such as readv(2), or to be thrown away, such as
+	// when a Copier drains data no writer took.
+	Reads int64
+	// EAGAIN is the number of the above calls which failed with EAGAIN
+	// because the source was empty or the destination was full.
+	EAGAIN int64
+}
+
+// Calls returns the total number of syscalls.
+func (s SyscallStats) Calls() int64 {
+	return s.Splices + s.Tees + s.Writes + s.Reads
+}
+
+// EAGAINRate returns the fraction of syscalls which failed with EAGAIN, or 0
+// if there were none.
+func (s SyscallStats) EAGAINRate() float64 {
+	calls := s.Calls()
+	if calls == 0 {
+		return 0
+	}
+	return float64(s.EAGAIN) / float64(calls)
+}
+
+// Syscalls returns the syscall counts for all operations in this process.
+// Per-copier counts are available from Copier.Stats.
+func Syscalls() SyscallStats {
+	return globalSyscalls.snapshot()
+}
+
+type syscallOp int
+
+const (
+	syscallSplice syscallOp = iota
+	syscallTee
+	syscallWrite
+	syscallRead
+)
+
+// syscallCounter holds the counters for SyscallStats. Its fields are accessed
+// atomically, so it must be 64-bit aligned: keep it first in structs.
+type syscallCounter struct {
+	splices int64
+	tees    int64
+	writes  int64
+	reads   int64
+	eagain  int64
+}
+
+var globalSyscalls syscallCounter
+
+// countSyscall records a syscall of the passed in kind which returned err in
+// sc, if it is not nil, and in the process wide counts.
+func countSyscall(sc *syscallCounter, op syscallOp, err error) {
+	globalSyscalls.add(op, err)
+	if sc != nil {
+		sc.add(op, err)
+	}
+}
+
+func (sc *syscallCounter) add(op syscallOp, err error) {
+	switch op {
+	case syscallSplice:
+		atomic.AddInt64(&sc.splices, 1)
+	case syscallTee:
+		atomic.AddInt64(&sc.tees, 1)
+	case syscallWrite:
+		atomic.AddInt64(&sc.writes, 1)
+	case syscallRead:
+		atomic.AddInt64(&sc.reads, 1)
+	}
+	if err == syscall.EAGAIN {
+		atomic.AddInt64(&sc.eagain, 1)
+	}
+}
+
+func (sc *syscallCounter) snapshot() SyscallStats {
+	return SyscallStats{
+		Splices: atomic.LoadInt64(&sc.splices),
+		Tees:    atomic.LoadInt64(&sc.tees),
+		Writes:  atomic.LoadInt64(&sc.writes),
+		Reads:   atomic.LoadInt64(&sc.reads),
+		EAGAIN:  atomic.LoadInt64(&sc.eagain),
+	}
+}
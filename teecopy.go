@@ -0,0 +1,50 @@
+package pipes
+
+import "io"
+
+// TeeResult is the outcome of copying to a single writer with TeeCopy.
+type TeeResult struct {
+	// N is the number of bytes written to the writer.
+	N int64
+	// Err is the error which caused copying to the writer to stop, if any.
+	Err error
+}
+
+// teeCopyBuffer is TeeCopy implemented with a pooled userspace buffer.
+func teeCopyBuffer(r *PipeReader, writers []*PipeWriter) ([]TeeResult, error) {
+	results := make([]TeeResult, len(writers))
+
+	buf := getBuf()
+	defer putBuf(buf)
+
+	for {
+		active := false
+		for i := range results {
+			if results[i].Err == nil {
+				active = true
+				break
+			}
+		}
+		if !active {
+			return results, nil
+		}
+
+		n, err := r.Read(*buf)
+		if n > 0 {
+			for i, w := range writers {
+				if results[i].Err != nil {
+					continue
+				}
+				nw, werr := w.Write((*buf)[:n])
+				results[i].N += int64(nw)
+				results[i].Err = werr
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return results, nil
+			}
+			return results, err
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package pipes
+
+import (
+	"fmt"
+	"io"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// TeeCopy copies everything from r to all of the passed in writers until r
+// returns EOF.
+// It is a one-shot alternative to Copier for cases where writers do not need
+// to be added or removed while copying.
+//
+// Data is duplicated with tee(2) and moved with splice(2) so it never enters
+// userspace.
+//
+// If a writer fails it is dropped and copying continues with the remaining
+// writers. The returned results are in the same order as the writers.
+// The returned error is only set for errors reading from r.
+func TeeCopy(r *PipeReader, writers ...*PipeWriter) ([]TeeResult, error) {
+	if !SpliceSupported() {
+		return teeCopyBuffer(r, writers)
+	}
+
+	results := make([]TeeResult, len(writers))
+
+	rc, err := r.SyscallConn()
+	if err != nil {
+		return results, err
+	}
+
+	conns := make([]syscall.RawConn, 0, len(writers))
+	for _, w := range writers {
+		wc, err := w.SyscallConn()
+		if err != nil {
+			return results, err
+		}
+		conns = append(conns, wc)
+	}
+
+	buf, err := pipeBufs.get()
+	if err != nil {
+		return results, fmt.Errorf("error creating pipe buffer: %w", err)
+	}
+	defer pipeBufs.put(buf)
+
+	scratch, err := pipeBufs.get()
+	if err != nil {
+		return results, fmt.Errorf("error creating pipe buffer: %w", err)
+	}
+	defer pipeBufs.put(scratch)
+
+	active := make([]int, 0, len(writers))
+	for {
+		active = active[:0]
+		for i := range results {
+			if results[i].Err == nil {
+				active = append(active, i)
+			}
+		}
+		if len(active) == 0 {
+			return results, nil
+		}
+
+		total, err := spliceFromConn(rc, buf.wfd)
+		if err != nil {
+			return results, err
+		}
+		if total == 0 {
+			return results, nil
+		}
+
+		for j, i := range active {
+			var (
+				n   int64
+				err error
+			)
+
+			if j == len(active)-1 {
+				// This is the last writer, so just move the data out of the
+				// buffer.
+				n, err = spliceToConn(buf.rfd, conns[i], total)
+				if err != nil {
+					if derr := drainFd(buf.rfd, total-n); derr != nil {
+						return results, derr
+					}
+				}
+			} else {
+				// tee(2) does not consume the data from the buffer so a short
+				// write could not be resumed. Instead duplicate into a scratch
+				// pipe and splice from there.
+				n, err = tee(buf.rfd, scratch.wfd, total)
+				if err == nil && n < total {
+					err = io.ErrShortWrite
+				}
+				if err != nil {
+					if derr := drainFd(scratch.rfd, n); derr != nil {
+						return results, derr
+					}
+					n = 0
+				} else {
+					n, err = spliceToConn(scratch.rfd, conns[i], total)
+					if err != nil {
+						if derr := drainFd(scratch.rfd, total-n); derr != nil {
+							return results, derr
+						}
+					}
+				}
+			}
+
+			results[i].N += n
+			results[i].Err = writers[i].writeResult(err)
+		}
+	}
+}
+
+// spliceFromConn splices as much data as is available from rc into wfd,
+// waiting for rc to become readable if there is no data.
+// A return value of 0 bytes with a nil error means EOF.
+func spliceFromConn(rc syscall.RawConn, wfd int) (int64, error) {
+	var (
+		copied    int64
+		spliceErr error
+	)
+
+	err := rc.Read(func(rfd uintptr) bool {
+		copied, spliceErr = splice(int(rfd), wfd, 0)
+		return !(copied == 0 && spliceErr == unix.EAGAIN)
+	})
+	if err != nil {
+		return copied, err
+	}
+	if spliceErr == unix.EAGAIN {
+		spliceErr = nil
+	}
+	return copied, spliceErr
+}
+
+// spliceToConn splices exactly total bytes from rfd into wc, waiting for wc
+// to become writable as needed.
+func spliceToConn(rfd int, wc syscall.RawConn, total int64) (int64, error) {
+	var (
+		written   int64
+		spliceErr error
+	)
+
+	err := wc.Write(func(wfd uintptr) bool {
+		n, err := splice(rfd, int(wfd), total-written)
+		written += n
+		if err == unix.EAGAIN {
+			return written >= total
+		}
+		if err == nil && n == 0 && written < total {
+			err = io.ErrUnexpectedEOF
+		}
+		spliceErr = err
+		return true
+	})
+	if err != nil {
+		return written, err
+	}
+	return written, spliceErr
+}
+
+// drainFd reads and discards n bytes from fd.
+func drainFd(fd int, n int64) error {
+	buf := getBuf()
+	defer putBuf(buf)
+
+	for n > 0 {
+		b := *buf
+		if int64(len(b)) > n {
+			b = b[:n]
+		}
+		nn, err := unix.Read(fd, b)
+		if nn > 0 {
+			n -= int64(nn)
+		}
+		if err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			return err
+		}
+		if nn == 0 {
+			return io.ErrUnexpectedEOF
+		}
+	}
+	return nil
+}
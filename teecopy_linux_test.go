@@ -0,0 +1,83 @@
+package pipes
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestTeeCopy(t *testing.T) {
+	r1, w1 := newPipe(t)
+	r2, w2 := newPipe(t)
+	r3, w3 := newPipe(t)
+
+	data := bytes.Repeat([]byte("hello world"), 1e5)
+
+	go func() {
+		w1.Write(data)
+		w1.Close()
+	}()
+
+	chBufs := make(chan []byte, 2)
+	for _, r := range []*PipeReader{r2, r3} {
+		go func(r *PipeReader) {
+			buf, _ := io.ReadAll(r)
+			chBufs <- buf
+		}(r)
+	}
+
+	results, err := TeeCopy(r1, w2, w3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w2.Close()
+	w3.Close()
+
+	for i, res := range results {
+		if res.Err != nil {
+			t.Errorf("writer %d: %v", i, res.Err)
+		}
+		if res.N != int64(len(data)) {
+			t.Errorf("writer %d: expected %d bytes, got %d", i, len(data), res.N)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if buf := <-chBufs; !bytes.Equal(buf, data) {
+			t.Errorf("got unexpected data: %d bytes", len(buf))
+		}
+	}
+}
+
+func TestTeeCopyWriterClosed(t *testing.T) {
+	r1, w1 := newPipe(t)
+	r2, w2 := newPipe(t)
+	r3, w3 := newPipe(t)
+
+	r3.Close()
+
+	go func() {
+		w1.Write([]byte("hello"))
+		w1.Close()
+	}()
+
+	results, err := TeeCopy(r1, w2, w3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w2.Close()
+
+	buf, err := io.ReadAll(r2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Errorf("expected %q, got %q", "hello", buf)
+	}
+	if results[0].Err != nil || results[0].N != 5 {
+		t.Errorf("unexpected result for first writer: %+v", results[0])
+	}
+	if results[1].Err == nil {
+		t.Error("expected error for closed writer")
+	}
+}
@@ -0,0 +1,23 @@
+package pipes
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// setThreadNice sets the niceness of the calling thread, which must be
+// locked to the goroutine, and returns the niceness it had before.
+func setThreadNice(nice int) (int, error) {
+	tid := unix.Gettid()
+	// The raw getpriority(2) syscall returns 20 - nice, so it is never
+	// negative.
+	prio, err := unix.Getpriority(unix.PRIO_PROCESS, tid)
+	if err != nil {
+		return 0, os.NewSyscallError("getpriority", err)
+	}
+	if err := unix.Setpriority(unix.PRIO_PROCESS, tid, nice); err != nil {
+		return 0, os.NewSyscallError("setpriority", err)
+	}
+	return 20 - prio, nil
+}
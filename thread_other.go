@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package pipes
+
+// setThreadNice is not supported since niceness is per process on this
+// platform.
+func setThreadNice(nice int) (int, error) {
+	return 0, ErrNotSupported
+}
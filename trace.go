@@ -0,0 +1,76 @@
+package pipes
+
+import "context"
+
+// SpliceTrace is a set of hooks called at various stages of a copy, to see
+// which path the copy took and where it spent its time. It is similar to
+// net/http/httptrace.ClientTrace.
+//
+// A trace is attached to a context with WithSpliceTrace, and is used by the
+// operations which take that context, such as CopyContext and NewCopier.
+// Any of the hooks may be nil. Hooks may be called concurrently from
+// different goroutines and should return quickly.
+type SpliceTrace struct {
+	// SpliceStart is called before data is moved with splice(2).
+	SpliceStart func()
+	// SpliceDone is called when data has been moved with splice(2), with the
+	// number of bytes moved and the error the splice stopped with, if any.
+	// EAGAIN means the source ran dry or the destination is full.
+	SpliceDone func(n int64, err error)
+	// TeeDone is called when data has been duplicated to a writer with
+	// tee(2), with the number of bytes duplicated and the error, if any.
+	TeeDone func(n int64, err error)
+	// FallbackTaken is called when a copy goes through a userspace buffer
+	// instead of a zero-copy path. op names the operation, such as "Copy" or
+	// "Copier".
+	FallbackTaken func(op string)
+	// Blocked is called when a copy has to wait for the source to be
+	// readable or the destination to be writable.
+	Blocked func()
+}
+
+type spliceTraceKey struct{}
+
+// WithSpliceTrace returns a new context based on ctx which carries trace.
+func WithSpliceTrace(ctx context.Context, trace *SpliceTrace) context.Context {
+	return context.WithValue(ctx, spliceTraceKey{}, trace)
+}
+
+// ContextSpliceTrace returns the SpliceTrace attached to ctx, or nil if there
+// is none.
+func ContextSpliceTrace(ctx context.Context) *SpliceTrace {
+	t, _ := ctx.Value(spliceTraceKey{}).(*SpliceTrace)
+	return t
+}
+
+// The methods below are safe to call on a nil trace.
+
+func (t *SpliceTrace) spliceStart() {
+	if t != nil && t.SpliceStart != nil {
+		t.SpliceStart()
+	}
+}
+
+func (t *SpliceTrace) spliceDone(n int64, err error) {
+	if t != nil && t.SpliceDone != nil {
+		t.SpliceDone(n, err)
+	}
+}
+
+func (t *SpliceTrace) teeDone(n int64, err error) {
+	if t != nil && t.TeeDone != nil {
+		t.TeeDone(n, err)
+	}
+}
+
+func (t *SpliceTrace) fallbackTaken(op string) {
+	if t != nil && t.FallbackTaken != nil {
+		t.FallbackTaken(op)
+	}
+}
+
+func (t *SpliceTrace) blocked() {
+	if t != nil && t.Blocked != nil {
+		t.Blocked()
+	}
+}
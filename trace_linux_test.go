@@ -0,0 +1,177 @@
+package pipes
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+type traceRecorder struct {
+	mu        sync.Mutex
+	spliced   int64
+	teed      int64
+	starts    int
+	fallbacks []string
+	blocked   int
+}
+
+func (tr *traceRecorder) trace() *SpliceTrace {
+	return &SpliceTrace{
+		SpliceStart: func() {
+			tr.mu.Lock()
+			tr.starts++
+			tr.mu.Unlock()
+		},
+		SpliceDone: func(n int64, err error) {
+			tr.mu.Lock()
+			tr.spliced += n
+			tr.mu.Unlock()
+		},
+		TeeDone: func(n int64, err error) {
+			tr.mu.Lock()
+			tr.teed += n
+			tr.mu.Unlock()
+		},
+		FallbackTaken: func(op string) {
+			tr.mu.Lock()
+			tr.fallbacks = append(tr.fallbacks, op)
+			tr.mu.Unlock()
+		},
+		Blocked: func() {
+			tr.mu.Lock()
+			tr.blocked++
+			tr.mu.Unlock()
+		},
+	}
+}
+
+func TestSpliceTrace(t *testing.T) {
+	if !SpliceSupported() {
+		t.Skip("splice not supported")
+	}
+
+	t.Run("splice", func(t *testing.T) {
+		tr := &traceRecorder{}
+		ctx := WithSpliceTrace(context.Background(), tr.trace())
+
+		r1, w1 := newPipe(t)
+		r2, w2 := newPipe(t)
+
+		if _, err := w1.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		w1.Close()
+
+		n, err := CopyContext(ctx, w2, r1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 5 {
+			t.Fatalf("expected 5 bytes, got %d", n)
+		}
+		w2.Close()
+
+		data, err := io.ReadAll(r2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "hello" {
+			t.Fatalf("unexpected data: %q", data)
+		}
+
+		tr.mu.Lock()
+		defer tr.mu.Unlock()
+		if tr.starts == 0 {
+			t.Fatal("expected SpliceStart to be called")
+		}
+		if tr.spliced != 5 {
+			t.Fatalf("expected 5 bytes spliced, got %d", tr.spliced)
+		}
+		if len(tr.fallbacks) != 0 {
+			t.Fatalf("unexpected fallbacks: %v", tr.fallbacks)
+		}
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		tr := &traceRecorder{}
+		ctx := WithSpliceTrace(context.Background(), tr.trace())
+
+		var buf bytes.Buffer
+		if _, err := CopyContext(ctx, &buf, bytes.NewReader([]byte("hello"))); err != nil {
+			t.Fatal(err)
+		}
+
+		tr.mu.Lock()
+		defer tr.mu.Unlock()
+		if len(tr.fallbacks) != 1 || tr.fallbacks[0] != "Copy" {
+			t.Fatalf("unexpected fallbacks: %v", tr.fallbacks)
+		}
+		if tr.starts != 0 {
+			t.Fatal("unexpected SpliceStart")
+		}
+	})
+
+	t.Run("copier", func(t *testing.T) {
+		tr := &traceRecorder{}
+		ctx, cancel := context.WithCancel(WithSpliceTrace(context.Background(), tr.trace()))
+		defer cancel()
+
+		r, w := newPipe(t)
+		r1, w1 := newPipe(t)
+		r2, w2 := newPipe(t)
+
+		c, err := NewCopier(ctx, r, w1, w2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := w.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, r := range []*PipeReader{r1, r2} {
+			r.fd.SetReadDeadline(time.Now().Add(10 * time.Second))
+			buf := make([]byte, 5)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Wait for the copier to see EOF so all the hooks have run.
+		w.Close()
+		select {
+		case <-c.done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("timeout waiting for copier")
+		}
+
+		tr.mu.Lock()
+		defer tr.mu.Unlock()
+		if tr.teed != 5 {
+			t.Fatalf("expected 5 bytes teed, got %d", tr.teed)
+		}
+		// Once into the copier's buffer and once to the last writer.
+		if tr.spliced != 10 {
+			t.Fatalf("expected 10 bytes spliced, got %d", tr.spliced)
+		}
+	})
+}
+
+func TestContextSpliceTrace(t *testing.T) {
+	if ContextSpliceTrace(context.Background()) != nil {
+		t.Fatal("expected no trace")
+	}
+	trace := &SpliceTrace{}
+	if ContextSpliceTrace(WithSpliceTrace(context.Background(), trace)) != trace {
+		t.Fatal("expected trace from context")
+	}
+
+	// The hooks must be safe to call on a nil trace.
+	var nilTrace *SpliceTrace
+	nilTrace.spliceStart()
+	nilTrace.spliceDone(0, nil)
+	nilTrace.blocked()
+}
@@ -0,0 +1,344 @@
+package pipes
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// This is a minimal io_uring implementation with just enough to submit
+// splice(2), tee(2), and fixed buffer read/write operations.
+
+const (
+	ioringOffSQRing = 0
+	ioringOffCQRing = 0x8000000
+	ioringOffSQEs   = 0x10000000
+
+	ioringEnterGetEvents = 1 << 0
+
+	ioringOpReadFixed   = 4
+	ioringOpWriteFixed  = 5
+	ioringOpPollAdd     = 6
+	ioringOpAsyncCancel = 14
+	ioringOpSplice      = 30
+	ioringOpTee         = 33
+
+	ioringRegisterBuffers = 0
+
+	iosqeIODrain = 1 << 1
+	iosqeIOLink  = 1 << 2
+)
+
+type ioSQRingOffsets struct {
+	head        uint32
+	tail        uint32
+	ringMask    uint32
+	ringEntries uint32
+	flags       uint32
+	dropped     uint32
+	array       uint32
+	resv1       uint32
+	resv2       uint64
+}
+
+type ioCQRingOffsets struct {
+	head        uint32
+	tail        uint32
+	ringMask    uint32
+	ringEntries uint32
+	overflow    uint32
+	cqes        uint32
+	flags       uint32
+	resv1       uint32
+	resv2       uint64
+}
+
+type ioUringParams struct {
+	sqEntries    uint32
+	cqEntries    uint32
+	flags        uint32
+	sqThreadCPU  uint32
+	sqThreadIdle uint32
+	features     uint32
+	wqFd         uint32
+	resv         [3]uint32
+	sqOff        ioSQRingOffsets
+	cqOff        ioCQRingOffsets
+}
+
+type ioUringSqe struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	opFlags     uint32
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	spliceFdIn  int32
+	_           [2]uint64
+}
+
+type ioUringCqe struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// ioUring is a single io_uring instance.
+// Submissions are safe for concurrent use, completions must only be consumed
+// by one goroutine.
+type ioUring struct {
+	fd int
+
+	sqRing []byte
+	cqRing []byte
+	sqeMem []byte
+
+	sqHead  *uint32
+	sqTail  *uint32
+	sqMask  uint32
+	sqArray []uint32
+	sqes    []ioUringSqe
+
+	cqHead *uint32
+	cqTail *uint32
+	cqMask uint32
+	cqes   []ioUringCqe
+
+	mu       sync.Mutex
+	sqeTail  uint32
+	sqeHead  uint32
+	released bool
+}
+
+func newIOUring(entries uint32) (*ioUring, error) {
+	var p ioUringParams
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uintptr(entries), uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		return nil, os.NewSyscallError("io_uring_setup", mapErrno(errno))
+	}
+
+	u := &ioUring{fd: int(fd)}
+	unix.CloseOnExec(u.fd)
+
+	var err error
+	u.sqRing, err = unix.Mmap(u.fd, ioringOffSQRing, int(p.sqOff.array+p.sqEntries*4), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		u.close()
+		return nil, os.NewSyscallError("mmap", err)
+	}
+	u.cqRing, err = unix.Mmap(u.fd, ioringOffCQRing, int(p.cqOff.cqes+p.cqEntries*uint32(unsafe.Sizeof(ioUringCqe{}))), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		u.close()
+		return nil, os.NewSyscallError("mmap", err)
+	}
+	u.sqeMem, err = unix.Mmap(u.fd, ioringOffSQEs, int(p.sqEntries*uint32(unsafe.Sizeof(ioUringSqe{}))), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		u.close()
+		return nil, os.NewSyscallError("mmap", err)
+	}
+
+	u.sqHead = (*uint32)(unsafe.Pointer(&u.sqRing[p.sqOff.head]))
+	u.sqTail = (*uint32)(unsafe.Pointer(&u.sqRing[p.sqOff.tail]))
+	u.sqMask = *(*uint32)(unsafe.Pointer(&u.sqRing[p.sqOff.ringMask]))
+	u.sqArray = (*[1 << 20]uint32)(unsafe.Pointer(&u.sqRing[p.sqOff.array]))[:p.sqEntries:p.sqEntries]
+	u.sqes = (*[1 << 16]ioUringSqe)(unsafe.Pointer(&u.sqeMem[0]))[:p.sqEntries:p.sqEntries]
+
+	u.cqHead = (*uint32)(unsafe.Pointer(&u.cqRing[p.cqOff.head]))
+	u.cqTail = (*uint32)(unsafe.Pointer(&u.cqRing[p.cqOff.tail]))
+	u.cqMask = *(*uint32)(unsafe.Pointer(&u.cqRing[p.cqOff.ringMask]))
+	u.cqes = (*[1 << 20]ioUringCqe)(unsafe.Pointer(&u.cqRing[p.cqOff.cqes]))[:p.cqEntries:p.cqEntries]
+
+	return u, nil
+}
+
+func (u *ioUring) close() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.released {
+		return
+	}
+	u.released = true
+
+	for _, b := range [][]byte{u.sqeMem, u.cqRing, u.sqRing} {
+		if b != nil {
+			unix.Munmap(b)
+		}
+	}
+	unix.Close(u.fd)
+}
+
+// submit queues all the passed in entries and submits them to the kernel.
+// The caller must make sure there is room in the ring.
+func (u *ioUring) submit(entries ...ioUringSqe) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.released {
+		return os.ErrClosed
+	}
+
+	for _, e := range entries {
+		idx := u.sqeTail & u.sqMask
+		u.sqes[idx] = e
+		u.sqArray[idx] = idx
+		u.sqeTail++
+	}
+	atomic.StoreUint32(u.sqTail, u.sqeTail)
+
+	toSubmit := u.sqeTail - u.sqeHead
+	for toSubmit > 0 {
+		n, err := u.enter(toSubmit, 0, 0)
+		if err != nil {
+			return err
+		}
+		u.sqeHead += n
+		toSubmit -= n
+	}
+	return nil
+}
+
+func (u *ioUring) enter(toSubmit, minComplete, flags uint32) (uint32, error) {
+	for {
+		n, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(u.fd), uintptr(toSubmit), uintptr(minComplete), uintptr(flags), 0, 0)
+		if errno == unix.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return 0, os.NewSyscallError("io_uring_enter", errno)
+		}
+		return uint32(n), nil
+	}
+}
+
+// submitWait submits a single entry and waits for the next completion.
+// This is only useful when there is nothing else in flight on the ring.
+func (u *ioUring) submitWait(e ioUringSqe) (ioUringCqe, error) {
+	u.mu.Lock()
+	if u.released {
+		u.mu.Unlock()
+		return ioUringCqe{}, os.ErrClosed
+	}
+
+	idx := u.sqeTail & u.sqMask
+	u.sqes[idx] = e
+	u.sqArray[idx] = idx
+	u.sqeTail++
+	atomic.StoreUint32(u.sqTail, u.sqeTail)
+
+	n, err := u.enter(u.sqeTail-u.sqeHead, 1, ioringEnterGetEvents)
+	u.sqeHead += n
+	u.mu.Unlock()
+
+	if err != nil {
+		return ioUringCqe{}, err
+	}
+	return u.wait()
+}
+
+// registerBuffers registers bufs with the ring so they can be used with fixed
+// buffer operations, where the index into bufs identifies the buffer.
+// The buffers must stay valid until the ring is closed.
+func (u *ioUring) registerBuffers(bufs [][]byte) error {
+	iovs := make([]unix.Iovec, len(bufs))
+	for i, b := range bufs {
+		iovs[i].Base = &b[0]
+		iovs[i].SetLen(len(b))
+	}
+
+	_, _, errno := unix.Syscall6(unix.SYS_IO_URING_REGISTER, uintptr(u.fd), ioringRegisterBuffers, uintptr(unsafe.Pointer(&iovs[0])), uintptr(len(iovs)), 0, 0)
+	if errno != 0 {
+		return os.NewSyscallError("io_uring_register", errno)
+	}
+	return nil
+}
+
+// wait waits for the next completion and consumes it.
+func (u *ioUring) wait() (ioUringCqe, error) {
+	for {
+		head := atomic.LoadUint32(u.cqHead)
+		if head != atomic.LoadUint32(u.cqTail) {
+			cqe := u.cqes[head&u.cqMask]
+			atomic.StoreUint32(u.cqHead, head+1)
+			return cqe, nil
+		}
+		if _, err := u.enter(0, 1, ioringEnterGetEvents); err != nil {
+			return ioUringCqe{}, err
+		}
+	}
+}
+
+// cqeErr converts the result of a completion into an error.
+func cqeErr(res int32) error {
+	if res >= 0 {
+		return nil
+	}
+	return syscall.Errno(-res)
+}
+
+// pollSqe waits for events on fd.
+// The fds this package deals with are non-blocking, so operations on them are
+// linked behind a poll to only run once the fd is ready.
+func pollSqe(fd int, events uint32, userData uint64) ioUringSqe {
+	return ioUringSqe{
+		opcode:   ioringOpPollAdd,
+		flags:    iosqeIOLink,
+		fd:       int32(fd),
+		opFlags:  events,
+		userData: userData,
+	}
+}
+
+func spliceSqe(rfd, wfd int, n uint32, userData uint64) ioUringSqe {
+	return ioUringSqe{
+		opcode:     ioringOpSplice,
+		fd:         int32(wfd),
+		off:        ^uint64(0),
+		addr:       ^uint64(0),
+		len:        n,
+		opFlags:    unix.SPLICE_F_MOVE,
+		userData:   userData,
+		spliceFdIn: int32(rfd),
+	}
+}
+
+func teeSqe(rfd, wfd int, n uint32, userData uint64) ioUringSqe {
+	return ioUringSqe{
+		opcode:     ioringOpTee,
+		fd:         int32(wfd),
+		len:        n,
+		userData:   userData,
+		spliceFdIn: int32(rfd),
+	}
+}
+
+// fixedSqe reads or writes buf, which must be (part of) the registered buffer
+// at index.
+func fixedSqe(op uint8, fd int, buf []byte, index uint16) ioUringSqe {
+	return ioUringSqe{
+		opcode:   op,
+		fd:       int32(fd),
+		off:      ^uint64(0),
+		addr:     uint64(uintptr(unsafe.Pointer(&buf[0]))),
+		len:      uint32(len(buf)),
+		bufIndex: index,
+	}
+}
+
+func cancelSqe(target, userData uint64) ioUringSqe {
+	return ioUringSqe{
+		opcode:   ioringOpAsyncCancel,
+		fd:       -1,
+		addr:     target,
+		userData: userData,
+	}
+}
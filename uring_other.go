@@ -0,0 +1,53 @@
+//go:build !linux
+// +build !linux
+
+package pipes
+
+import "context"
+
+// UringCopier is like Copier but submits the splice(2) and tee(2) calls
+// through io_uring.
+//
+// This is only implemented on Linux. On this platform NewUringCopier always
+// returns ErrNotSupported, callers should use NewCopier instead.
+type UringCopier struct{}
+
+// NewUringCopier is not supported on this platform and always returns
+// ErrNotSupported.
+func NewUringCopier(ctx context.Context, r *PipeReader, writers ...*PipeWriter) (*UringCopier, error) {
+	return nil, ErrNotSupported
+}
+
+func (c *UringCopier) Add(w *PipeWriter) error {
+	return ErrNotSupported
+}
+
+func (c *UringCopier) SetMaxChunkSize(n int64) {}
+
+// UringIO reads and writes pipes through io_uring using a registered buffer.
+//
+// This is only implemented on Linux. On this platform NewUringIO always
+// returns ErrNotSupported.
+type UringIO struct{}
+
+// NewUringIO is not supported on this platform and always returns
+// ErrNotSupported.
+func NewUringIO(size int) (*UringIO, error) {
+	return nil, ErrNotSupported
+}
+
+func (u *UringIO) Close() error {
+	return nil
+}
+
+func (u *UringIO) Read(r *PipeReader, p []byte) (int, error) {
+	return 0, ErrNotSupported
+}
+
+func (u *UringIO) Write(w *PipeWriter, p []byte) (int, error) {
+	return 0, ErrNotSupported
+}
+
+func (u *UringIO) Copy(dst *PipeWriter, src *PipeReader) (int64, error) {
+	return 0, ErrNotSupported
+}
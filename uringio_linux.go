@@ -0,0 +1,223 @@
+package pipes
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// UringIO reads and writes pipes through io_uring using a buffer which is
+// registered with the kernel up front.
+//
+// This is meant for the cases where splice(2) cannot be used and data has to
+// pass through userspace, such as high frequency small reads and writes.
+// Since the buffer is registered once, the kernel does not need to pin and
+// map the memory for every operation.
+//
+// UringIO is safe for concurrent use, but operations are serialized.
+// io_uring may not be available (fixed buffers require Linux 5.1), in which
+// case NewUringIO returns an error and callers should fall back to regular
+// reads and writes.
+type UringIO struct {
+	mu   sync.Mutex
+	ring *ioUring
+	buf  []byte
+}
+
+// NewUringIO creates a UringIO with a registered buffer of at least size
+// bytes. The size is rounded up to a multiple of the page size.
+func NewUringIO(size int) (*UringIO, error) {
+	buf, err := AllocPages(size)
+	if err != nil {
+		return nil, err
+	}
+
+	ring, err := newIOUring(2)
+	if err != nil {
+		FreePages(buf)
+		return nil, err
+	}
+
+	if err := ring.registerBuffers([][]byte{buf}); err != nil {
+		ring.close()
+		FreePages(buf)
+		return nil, err
+	}
+
+	return &UringIO{ring: ring, buf: buf}, nil
+}
+
+// Close releases the ring and the registered buffer.
+func (u *UringIO) Close() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.buf == nil {
+		return nil
+	}
+
+	u.ring.close()
+	err := FreePages(u.buf)
+	u.buf = nil
+	return err
+}
+
+// Read reads up to len(p) bytes from r.
+func (u *UringIO) Read(r *PipeReader, p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	b, err := u.buffer(len(p))
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := u.read(r, b)
+	copy(p, b[:n])
+	return n, err
+}
+
+// Write writes all of p to w.
+func (u *UringIO) Write(w *PipeWriter, p []byte) (int, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var written int
+	for len(p) > 0 {
+		b, err := u.buffer(len(p))
+		if err != nil {
+			return written, err
+		}
+
+		copy(b, p)
+		err = u.write(w, b)
+		if err != nil {
+			return written, err
+		}
+		written += len(b)
+		p = p[len(b):]
+	}
+	return written, nil
+}
+
+// Copy copies from src to dst until src reaches EOF or an error occurs.
+// The data is read into and written out of the registered buffer without
+// being copied anywhere else.
+func (u *UringIO) Copy(dst *PipeWriter, src *PipeReader) (int64, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var copied int64
+	for {
+		b, err := u.buffer(len(u.buf))
+		if err != nil {
+			return copied, err
+		}
+
+		n, err := u.read(src, b)
+		if n > 0 {
+			if werr := u.write(dst, b[:n]); werr != nil {
+				return copied, werr
+			}
+			copied += int64(n)
+		}
+		if err == io.EOF {
+			return copied, nil
+		}
+		if err != nil {
+			return copied, err
+		}
+	}
+}
+
+// buffer returns up to n bytes of the registered buffer.
+// This must be called with u.mu held.
+func (u *UringIO) buffer(n int) ([]byte, error) {
+	if u.buf == nil {
+		return nil, os.ErrClosed
+	}
+	if n > len(u.buf) {
+		n = len(u.buf)
+	}
+	return u.buf[:n], nil
+}
+
+func (u *UringIO) read(r *PipeReader, b []byte) (int, error) {
+	rc, err := r.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := u.do(rc.Read, ioringOpReadFixed, b)
+	if err != nil {
+		return 0, err
+	}
+	if res == 0 {
+		return 0, io.EOF
+	}
+	return res, nil
+}
+
+func (u *UringIO) write(w *PipeWriter, b []byte) error {
+	wc, err := w.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	for len(b) > 0 {
+		n, err := u.do(wc.Write, ioringOpWriteFixed, b)
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// do runs op on the fd passed to the callback of wait, which is either the
+// Read or Write method of a syscall.RawConn.
+// The pipe is non-blocking, so if the fd is not ready the op fails with
+// EAGAIN and the Go poller waits for the fd to be ready before trying again.
+func (u *UringIO) do(wait func(func(uintptr) bool) error, op uint8, b []byte) (int, error) {
+	var (
+		res   int32
+		opErr error
+	)
+	err := wait(func(fd uintptr) bool {
+		for {
+			var cqe ioUringCqe
+			cqe, opErr = u.ring.submitWait(fixedSqe(op, int(fd), b, 0))
+			if opErr != nil {
+				return true
+			}
+			res = cqe.res
+			switch res {
+			case -int32(unix.EINTR):
+				continue
+			case -int32(unix.EAGAIN):
+				return false
+			}
+			return true
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	if opErr != nil {
+		return 0, opErr
+	}
+	if res < 0 {
+		name := "read"
+		if op == ioringOpWriteFixed {
+			name = "write"
+		}
+		return 0, os.NewSyscallError(name, cqeErr(res))
+	}
+	return int(res), nil
+}
@@ -0,0 +1,103 @@
+package pipes
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func newUringIO(t *testing.T, size int) *UringIO {
+	t.Helper()
+
+	u, err := NewUringIO(size)
+	if err != nil {
+		if errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EPERM) {
+			t.Skip("io_uring not available:", err)
+		}
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { u.Close() })
+	return u
+}
+
+func TestUringIO(t *testing.T) {
+	t.Run("read write", func(t *testing.T) {
+		u := newUringIO(t, 1)
+		r, w := newPipe(t)
+
+		n, err := u.Write(w, []byte("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 5 {
+			t.Fatalf("expected 5 bytes written, got %d", n)
+		}
+
+		buf := make([]byte, 16)
+		n, err = u.Read(r, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != "hello" {
+			t.Fatalf("expected hello, got %q", buf[:n])
+		}
+
+		w.Close()
+		if _, err := u.Read(r, buf); err != io.EOF {
+			t.Fatalf("expected io.EOF, got: %v", err)
+		}
+	})
+
+	t.Run("copy", func(t *testing.T) {
+		u := newUringIO(t, 4096)
+		r1, w1 := newPipe(t)
+		r2, w2 := newPipe(t)
+
+		data := bytes.Repeat([]byte("abcdefgh"), 64*1024)
+		go func() {
+			w1.Write(data)
+			w1.Close()
+		}()
+
+		type result struct {
+			n   int64
+			err error
+		}
+		ch := make(chan result, 1)
+		go func() {
+			n, err := u.Copy(w2, r1)
+			w2.Close()
+			ch <- result{n, err}
+		}()
+
+		got, err := io.ReadAll(r2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := <-ch
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		if res.n != int64(len(data)) {
+			t.Fatalf("expected %d bytes copied, got %d", len(data), res.n)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatal("data mismatch")
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		u := newUringIO(t, 1)
+		_, w := newPipe(t)
+
+		u.Close()
+		if _, err := u.Write(w, []byte("hello")); !errors.Is(err, os.ErrClosed) {
+			t.Fatalf("expected os.ErrClosed, got: %v", err)
+		}
+	})
+}
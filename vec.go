@@ -0,0 +1,35 @@
+package pipes
+
+// consumeBufs drops the first n bytes from bufs.
+func consumeBufs(bufs [][]byte, n int64) [][]byte {
+	for len(bufs) > 0 {
+		l := int64(len(bufs[0]))
+		if l > n {
+			bufs[0] = bufs[0][n:]
+			break
+		}
+		n -= l
+		bufs = bufs[1:]
+	}
+	return bufs
+}
+
+func bufsLen(bufs [][]byte) int64 {
+	var n int64
+	for _, b := range bufs {
+		n += int64(len(b))
+	}
+	return n
+}
+
+// limitBufs trims bufs so they hold at most n bytes in total.
+func limitBufs(bufs [][]byte, n int64) [][]byte {
+	for i, b := range bufs {
+		if int64(len(b)) >= n {
+			bufs[i] = b[:n]
+			return bufs[:i+1]
+		}
+		n -= int64(len(b))
+	}
+	return bufs
+}
@@ -0,0 +1,107 @@
+package pipes
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// iovMax is the maximum number of buffers passed to a single readv(2) or
+// writev(2) call (IOV_MAX).
+const iovMax = 1024
+
+// WriteVec writes the contents of bufs to the pipe as if they were
+// concatenated, without copying them into a single buffer first.
+// This uses writev(2), so for instance a header and payload can be written
+// with one syscall, and are not interleaved with other writers if the total
+// is no larger than PIPE_BUF.
+//
+// WriteVec returns once everything is written or an error occurs, along with
+// the number of bytes written. The slices in bufs may be modified.
+func (w *PipeWriter) WriteVec(bufs [][]byte) (int64, error) {
+	rc, err := w.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for len(bufs) > 0 {
+		iov := bufs
+		if len(iov) > iovMax {
+			iov = iov[:iovMax]
+		}
+
+		var (
+			n     int
+			opErr error
+		)
+		err := rc.Write(func(fd uintptr) bool {
+			for {
+				n, opErr = unix.Writev(int(fd), iov)
+				countSyscall(nil, syscallWrite, opErr)
+				if opErr != unix.EINTR {
+					break
+				}
+			}
+			return opErr != unix.EAGAIN
+		})
+		if err == nil && opErr != nil {
+			err = &os.PathError{Op: "writev", Path: w.fd.Name(), Err: opErr}
+		}
+		if err != nil {
+			return total, w.writeResult(err)
+		}
+
+		total += int64(n)
+		w.addWritten(int64(n))
+		bufs = consumeBufs(bufs, int64(n))
+	}
+	return total, nil
+}
+
+// ReadVec reads from the pipe into bufs, filling each buffer in turn, and
+// returns the number of bytes read. Like Read, it returns once some data is
+// available rather than waiting for bufs to be filled.
+// This uses readv(2), so data can be read directly into several buffers,
+// such as a fixed size header and its payload, with one syscall.
+//
+// At the end of the stream ReadVec returns 0, io.EOF.
+func (r *PipeReader) ReadVec(bufs [][]byte) (int, error) {
+	if bufsLen(bufs) == 0 {
+		return 0, nil
+	}
+	if len(bufs) > iovMax {
+		bufs = bufs[:iovMax]
+	}
+
+	rc, err := r.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		n     int
+		opErr error
+	)
+	err = rc.Read(func(fd uintptr) bool {
+		for {
+			n, opErr = unix.Readv(int(fd), bufs)
+			if opErr != unix.EINTR {
+				break
+			}
+		}
+		return opErr != unix.EAGAIN
+	})
+	if err == nil && opErr != nil {
+		err = &os.PathError{Op: "readv", Path: r.fd.Name(), Err: opErr}
+	}
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, r.readResult(io.EOF)
+	}
+	r.addRead(int64(n))
+	return n, nil
+}
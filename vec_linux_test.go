@@ -0,0 +1,54 @@
+package pipes
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestWriteVecReadVec(t *testing.T) {
+	r, w, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	hdr := []byte("header")
+	payload := bytes.Repeat([]byte("x"), 256<<10)
+	expected := append(append([]byte{}, hdr...), payload...)
+
+	errCh := make(chan error, 1)
+	go func() {
+		defer w.Close()
+		n, err := w.WriteVec([][]byte{hdr, {}, payload})
+		if err == nil && n != int64(len(expected)) {
+			err = io.ErrShortWrite
+		}
+		errCh <- err
+	}()
+
+	var got []byte
+	a := make([]byte, 6)
+	b := make([]byte, 32<<10)
+	for {
+		n, err := r.ReadVec([][]byte{a, b})
+		if n > len(a) {
+			got = append(append(got, a...), b[:n-len(a)]...)
+		} else {
+			got = append(got, a[:n]...)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, expected) {
+		t.Fatalf("expected %d bytes, got %d", len(expected), len(got))
+	}
+}
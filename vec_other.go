@@ -0,0 +1,53 @@
+//go:build !linux
+// +build !linux
+
+package pipes
+
+// WriteVec writes the contents of bufs to the pipe as if they were
+// concatenated.
+// writev(2) is not available on this platform, so the buffers are written
+// one at a time and may be interleaved with other writers.
+//
+// WriteVec returns once everything is written or an error occurs, along with
+// the number of bytes written.
+func (w *PipeWriter) WriteVec(bufs [][]byte) (int64, error) {
+	var total int64
+	for _, b := range bufs {
+		n, err := w.Write(b)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// ReadVec reads from the pipe into bufs, filling each buffer in turn, and
+// returns the number of bytes read. Like Read, it returns once some data is
+// available rather than waiting for bufs to be filled.
+// readv(2) is not available on this platform, so this reads into a pooled
+// buffer and copies the data into bufs.
+func (r *PipeReader) ReadVec(bufs [][]byte) (int, error) {
+	total := bufsLen(bufs)
+	if total == 0 {
+		return 0, nil
+	}
+
+	buf := getBuf()
+	defer putBuf(buf)
+
+	p := *buf
+	if int64(len(p)) > total {
+		p = p[:total]
+	}
+	n, err := r.Read(p)
+
+	p = p[:n]
+	for _, b := range bufs {
+		if len(p) == 0 {
+			break
+		}
+		p = p[copy(b, p):]
+	}
+	return n, err
+}
@@ -0,0 +1,78 @@
+package pipes
+
+import (
+	"io"
+	"os"
+)
+
+// vecCopyBufs is the number of pooled buffers vecCopy fills with a single
+// readv(2) call, and drains with a single writev(2) call.
+const vecCopyBufs = 4
+
+// userCopy copies from src to dst through pooled userspace buffers, for when
+// the data can not be moved in the kernel.
+//
+// If both src and dst are backed by fds, readv(2) and writev(2) are used to
+// move several buffers per syscall where the platform supports it (see
+// vecCopy). Otherwise this is io.Copy with a single pooled buffer.
+//
+// Where splice(2) is supported, vecCopy is not used since io.Copy lets the
+// os package move the data in the kernel. It is also only used for two
+// *os.File or when neither src implements io.WriterTo nor dst implements
+// io.ReaderFrom: those methods may move the data in the kernel, such as a
+// socket using sendfile(2) to read from a file, or a *PipeReader or
+// *PipeWriter splicing.
+func userCopy(dst io.Writer, src io.Reader) (int64, error) {
+	if !SpliceSupported() && useVecCopy(dst, src) {
+		if handled, n, err := vecCopy(dst, src); handled {
+			return n, err
+		}
+	}
+	return copyBuffer(dst, src)
+}
+
+// useVecCopy reports whether userCopy should try vecCopy for dst and src.
+func useVecCopy(dst io.Writer, src io.Reader) bool {
+	_, dstFile := dst.(*os.File)
+	_, srcFile := src.(*os.File)
+	if dstFile && srcFile {
+		return true
+	}
+	_, readerFrom := dst.(io.ReaderFrom)
+	_, writerTo := src.(io.WriterTo)
+	return !readerFrom && !writerTo
+}
+
+// userCopyBuffer is like userCopy, but copies through buf instead of pooled
+// buffers. If buf is empty, this is userCopy.
+//
+// Like io.CopyBuffer, buf is not used if src implements io.WriterTo or dst
+// implements io.ReaderFrom, except for an *os.File: its methods would copy
+// through a buffer of their own, so it is only read from or written to.
+func userCopyBuffer(dst io.Writer, src io.Reader, buf []byte) (int64, error) {
+	if len(buf) == 0 {
+		return userCopy(dst, src)
+	}
+	if f, ok := dst.(*os.File); ok {
+		dst = fileWriter{f}
+	}
+	if f, ok := src.(*os.File); ok {
+		src = fileReader{f}
+	}
+	return io.CopyBuffer(dst, src, buf)
+}
+
+// fileReader hides all methods of an *os.File but Read. It only holds a
+// pointer, so storing it in an interface does not allocate.
+type fileReader struct{ f *os.File }
+
+func (r fileReader) Read(p []byte) (int, error) {
+	return r.f.Read(p)
+}
+
+// fileWriter hides all methods of an *os.File but Write, see fileReader.
+type fileWriter struct{ f *os.File }
+
+func (w fileWriter) Write(p []byte) (int, error) {
+	return w.f.Write(p)
+}
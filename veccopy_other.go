@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package pipes
+
+import "io"
+
+// vecCopy is not supported on this platform, userCopy falls back to a single
+// buffer.
+func vecCopy(dst io.Writer, src io.Reader) (bool, int64, error) {
+	return false, 0, nil
+}
@@ -0,0 +1,114 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package pipes
+
+import (
+	"io"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// vecCopy copies from src to dst, which must both be backed by fds, reading
+// into vecCopyBufs pooled buffers at a time with readv(2) and writing them
+// out with writev(2). This moves more data per syscall than a single buffer,
+// without needing a large contiguous allocation.
+//
+// handled is false if src or dst is not backed by an fd, in which case
+// nothing was copied.
+func vecCopy(dst io.Writer, src io.Reader) (handled bool, written int64, _ error) {
+	dc, ok := dst.(syscall.Conn)
+	if !ok {
+		return false, 0, nil
+	}
+	sc, ok := src.(syscall.Conn)
+	if !ok {
+		return false, 0, nil
+	}
+	draw, err := dc.SyscallConn()
+	if err != nil {
+		return false, 0, nil
+	}
+	sraw, err := sc.SyscallConn()
+	if err != nil {
+		return false, 0, nil
+	}
+
+	var pooled [vecCopyBufs]*[]byte
+	for i := range pooled {
+		pooled[i] = getBuf()
+		defer putBuf(pooled[i])
+	}
+	iov := make([][]byte, vecCopyBufs)
+
+	for {
+		for i, buf := range pooled {
+			iov[i] = *buf
+		}
+
+		var (
+			nr      int
+			readErr error
+		)
+		err := sraw.Read(func(fd uintptr) bool {
+			for {
+				nr, readErr = readv(int(fd), iov)
+				countSyscall(nil, syscallRead, readErr)
+				if readErr != unix.EINTR {
+					break
+				}
+			}
+			return readErr != unix.EAGAIN
+		})
+		if err == nil && readErr != nil {
+			err = os.NewSyscallError("readv", readErr)
+		}
+		if nr > 0 {
+			n, werr := writevAll(draw, limitBufs(iov, int64(nr)))
+			written += n
+			if werr != nil {
+				return true, written, werr
+			}
+		}
+		if err != nil {
+			return true, written, err
+		}
+		if nr == 0 {
+			// EOF
+			return true, written, nil
+		}
+	}
+}
+
+// writevAll writes all of bufs to rc with writev(2), returning the number of
+// bytes written.
+func writevAll(rc syscall.RawConn, bufs [][]byte) (int64, error) {
+	var total int64
+	for len(bufs) > 0 {
+		var (
+			n        int
+			writeErr error
+		)
+		err := rc.Write(func(fd uintptr) bool {
+			for {
+				n, writeErr = writev(int(fd), bufs)
+				countSyscall(nil, syscallWrite, writeErr)
+				if writeErr != unix.EINTR {
+					break
+				}
+			}
+			return writeErr != unix.EAGAIN
+		})
+		if err == nil && writeErr != nil {
+			err = os.NewSyscallError("writev", writeErr)
+		}
+		if err != nil {
+			return total, err
+		}
+		total += int64(n)
+		bufs = consumeBufs(bufs, int64(n))
+	}
+	return total, nil
+}
@@ -0,0 +1,42 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package pipes
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// readv and writev are not wrapped by x/sys/unix on this platform, so the
+// syscalls are made directly.
+
+func readv(fd int, iov [][]byte) (int, error) {
+	return vecSyscall(unix.SYS_READV, fd, iov)
+}
+
+func writev(fd int, iov [][]byte) (int, error) {
+	return vecSyscall(unix.SYS_WRITEV, fd, iov)
+}
+
+func vecSyscall(trap uintptr, fd int, bufs [][]byte) (int, error) {
+	iov := make([]unix.Iovec, 0, len(bufs))
+	for _, b := range bufs {
+		if len(b) == 0 {
+			continue
+		}
+		v := unix.Iovec{Base: &b[0]}
+		v.SetLen(len(b))
+		iov = append(iov, v)
+	}
+	if len(iov) == 0 {
+		return 0, nil
+	}
+
+	n, _, errno := unix.Syscall(trap, uintptr(fd), uintptr(unsafe.Pointer(&iov[0])), uintptr(len(iov)))
+	if errno != 0 {
+		return int(n), errno
+	}
+	return int(n), nil
+}
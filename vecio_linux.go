@@ -0,0 +1,11 @@
+package pipes
+
+import "golang.org/x/sys/unix"
+
+func readv(fd int, iov [][]byte) (int, error) {
+	return unix.Readv(fd, iov)
+}
+
+func writev(fd int, iov [][]byte) (int, error) {
+	return unix.Writev(fd, iov)
+}
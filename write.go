@@ -2,21 +2,105 @@ package pipes
 
 import (
 	"os"
+	"sync/atomic"
 	"syscall"
 )
 
 type PipeWriter struct {
+	// nwritten and maxSplice are accessed atomically, they are kept first so
+	// they are 64-bit aligned on 32-bit platforms.
+	nwritten  int64
+	maxSplice int64
+
 	fd *os.File
+
+	// child is the file handed to a child process by AttachCmd.
+	child *os.File
+
+	state *pipeState
+	// leak is set when leak detection is enabled, see EnableLeakDetection.
+	leak *leakEntry
+	// active is 1 until the writer is closed or detached, see release.
+	active int32
+	// closed is set to 1 by the first call to Close.
+	closed int32
+
+	rc rawConnCache
+
+	// notify backs CloseNotify.
+	notify peerNotify
 }
 
+// Write writes p to the pipe. It counts as one call in the Writes of
+// SyscallStats, even if the runtime needs several write(2) calls for it.
 func (w *PipeWriter) Write(p []byte) (int, error) {
-	return w.fd.Write(p)
+	n, err := w.write(p, nil)
+	w.addWritten(int64(n))
+	return n, err
+}
+
+// write is Write without adding to BytesWritten, for helpers which do not
+// count toward it, such as Copier. The call is counted in sc, if it is not
+// nil, as well as in the process wide counts.
+func (w *PipeWriter) write(p []byte, sc *syscallCounter) (int, error) {
+	n, err := w.fd.Write(p)
+	countSyscall(sc, syscallWrite, err)
+	return n, w.writeResult(err)
 }
 
+// Close closes the writer.
+// It is safe to call Close more than once, including concurrently. Only the
+// first call closes the pipe, any others return ErrAlreadyClosed.
 func (w *PipeWriter) Close() error {
+	if !atomic.CompareAndSwapInt32(&w.closed, 0, 1) {
+		return ErrAlreadyClosed
+	}
+	release(&w.active)
+	w.notify.stop()
+	if w.child != nil {
+		return joinErrors(w.fd.Close(), w.child.Close())
+	}
 	return w.fd.Close()
 }
 
+// SyscallConn returns a raw connection for the writer's fd.
+// The connection is created once and reused, as SyscallConn is called on
+// every splice. Once the pipe end is closed its methods return an error.
 func (w *PipeWriter) SyscallConn() (syscall.RawConn, error) {
-	return w.fd.SyscallConn()
+	if w.fd == nil {
+		return w.fd.SyscallConn()
+	}
+	return w.rc.get(w.fd)
+}
+
+// Detach returns the underlying file and detaches it from the writer, for
+// handing the fd to APIs which need an *os.File, such as
+// exec.Cmd.ExtraFiles. The caller becomes responsible for closing the file.
+// A file handed to a child process by AttachCmd is closed.
+//
+// The writer must not be used after calling Detach, its methods return
+// os.ErrInvalid. Detach must not be called concurrently with other methods.
+func (w *PipeWriter) Detach() *os.File {
+	f := w.fd
+	w.fd = nil
+	w.leak.forget()
+	release(&w.active)
+	w.notify.stop()
+	if w.child != nil {
+		w.child.Close()
+		w.child = nil
+	}
+	return f
+}
+
+// SetMaxSpliceSize sets the maximum number of bytes moved into the pipe by a
+// single splice(2) call, 0 meaning no limit.
+// This bounds how long a single call can take, which matters when the writer
+// is used with a Copier that is serving several writers.
+func (w *PipeWriter) SetMaxSpliceSize(n int64) {
+	atomic.StoreInt64(&w.maxSplice, n)
+}
+
+func (w *PipeWriter) maxSpliceSize() int64 {
+	return atomic.LoadInt64(&w.maxSplice)
 }
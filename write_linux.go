@@ -2,7 +2,10 @@ package pipes
 
 import (
 	"io"
+	"os"
 	"syscall"
+	"time"
+	"unsafe"
 
 	"golang.org/x/sys/unix"
 )
@@ -12,6 +15,26 @@ import (
 // reader does not support splicing then it falls back to normal io.Copy
 // semantics.
 func (w *PipeWriter) ReadFrom(r io.Reader) (int64, error) {
+	return w.ReadFromBuffer(r, nil)
+}
+
+// ReadFromBuffer is like ReadFrom, but if the data cannot be spliced from r
+// and has to be copied through userspace, it is copied through buf rather
+// than a buffer from the package's pool, like io.CopyBuffer. This lets
+// callers which manage their own memory avoid the internal buffers
+// altogether.
+// If buf is empty, this is ReadFrom.
+//
+// As with io.CopyBuffer, buf is not used if r implements io.WriterTo.
+func (w *PipeWriter) ReadFromBuffer(r io.Reader, buf []byte) (int64, error) {
+	n, err := w.readFromReader(r, buf, nil, nil, 0)
+	w.addWritten(n)
+	return n, w.writeResult(err)
+}
+
+// readFromReader splices everything from r to the writer where possible,
+// otherwise it copies through buf, see userCopyBuffer.
+func (w *PipeWriter) readFromReader(r io.Reader, buf []byte, trace *SpliceTrace, log Logger, busyPoll time.Duration) (int64, error) {
 	var (
 		remain int64 = 0
 		rr           = r
@@ -25,21 +48,78 @@ func (w *PipeWriter) ReadFrom(r io.Reader) (int64, error) {
 		}
 	}
 
+	if !SpliceSupported() {
+		return fallbackCopy(trace, log, "ReadFrom", w.fd, r, buf)
+	}
+
+	if sr, ok := rr.(sectionReader); ok {
+		handled, n, err := w.readFromSection(sr, remain, trace)
+		if handled || err == nil {
+			return n, err
+		}
+	}
+
 	if rc, ok := rr.(syscall.Conn); ok {
 		if raw, err := rc.SyscallConn(); err == nil {
-			handled, n, err := w.readFrom(raw, remain)
+			handled, n, err := w.readFrom(raw, remain, nil, trace, busyPoll)
 			if handled || err == nil {
 				return n, err
 			}
 		}
 	}
 
-	return io.Copy(w.fd, r)
+	return fallbackCopy(trace, log, "ReadFrom", w.fd, r, buf)
+}
+
+// sectionReader is implemented by *io.SectionReader (as of go1.22), as well as
+// any other reader which reads a section of an underlying io.ReaderAt.
+type sectionReader interface {
+	io.Seeker
+	Outer() (r io.ReaderAt, off int64, n int64)
+}
+
+// readFromSection splices from the file underlying a section reader using an
+// explicit offset, so the file's own offset is left untouched.
+// The section reader is advanced by the number of bytes copied.
+func (w *PipeWriter) readFromSection(sr sectionReader, remain int64, trace *SpliceTrace) (bool, int64, error) {
+	ra, base, size := sr.Outer()
+	rc, ok := ra.(syscall.Conn)
+	if !ok {
+		return false, 0, nil
+	}
+	raw, err := rc.SyscallConn()
+	if err != nil {
+		return false, 0, err
+	}
+
+	pos, err := sr.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false, 0, err
+	}
+
+	n := size - pos
+	if n <= 0 {
+		return true, 0, nil
+	}
+	if remain > 0 && remain < n {
+		n = remain
+	}
+
+	off := base + pos
+	handled, copied, err := w.readFrom(raw, n, &off, trace, 0)
+	if copied > 0 {
+		if _, serr := sr.Seek(copied, io.SeekCurrent); serr != nil && err == nil {
+			err = serr
+		}
+	}
+	return handled, copied, err
 }
 
-func (w *PipeWriter) readFrom(rc syscall.RawConn, remain int64) (bool, int64, error) {
-	// TODO: Maybe cache this
-	wc, err := w.fd.SyscallConn()
+// readFrom splices up to remain bytes, or everything if remain is 0, from rc
+// to the writer. If busyPoll is set, it spins for up to that long when the
+// splice would block, see WithBusyPoll.
+func (w *PipeWriter) readFrom(rc syscall.RawConn, remain int64, offIn *int64, trace *SpliceTrace, busyPoll time.Duration) (bool, int64, error) {
+	wc, err := w.SyscallConn()
 	if err != nil {
 		return false, 0, err
 	}
@@ -49,29 +129,46 @@ func (w *PipeWriter) readFrom(rc syscall.RawConn, remain int64) (bool, int64, er
 		readErr   error
 		noEnd     = remain == 0
 		spliceErr error
+		lastN     int64
+		spin      = spinner{d: busyPoll}
 	)
 
+	trace.spliceStart()
+	defer func() { trace.spliceDone(copied, spliceErr) }()
+
 	// Beceause the reader may not be pollable we need to call `Write` first (which we know is pollable).
 	err = wc.Write(func(wfd uintptr) bool {
-		readErr = rc.Read(func(rfd uintptr) bool {
-			var n int64
-			n, spliceErr = splice(int(rfd), int(wfd), remain)
-			if n > 0 {
-				copied += n
-				if !noEnd {
-					remain -= n
+		for {
+			readErr = rc.Read(func(rfd uintptr) bool {
+				lastN, spliceErr = doSplice(int(rfd), offIn, int(wfd), nil, minChunk(remain, w.maxSpliceSize()), DefaultSpliceFlags, nil, nil, nil)
+				if lastN > 0 {
+					copied += lastN
+					if !noEnd {
+						remain -= lastN
+					}
+					spin.reset()
 				}
-			}
-			return true
-		})
+				return true
+			})
 
-		if readErr != nil {
-			return true
-		}
-		if remain == 0 && !noEnd {
-			return true
+			if readErr != nil {
+				return true
+			}
+			if remain == 0 && !noEnd {
+				return true
+			}
+			if spliceErr == unix.EAGAIN {
+				if spin.spin() {
+					continue
+				}
+				trace.blocked()
+				return false
+			}
+			if spliceErr != nil || lastN == 0 {
+				return true
+			}
+			// The splice was capped by the max splice size, keep going.
 		}
-		return spliceErr != unix.EAGAIN
 	})
 
 	if err != nil {
@@ -82,5 +179,136 @@ func (w *PipeWriter) readFrom(rc syscall.RawConn, remain int64) (bool, int64, er
 		return copied > 0, copied, readErr
 	}
 
-	return copied > 0, copied, err
+	return spliceResult(copied, spliceErr)
+}
+
+// spliceResult returns the result of a splice loop which copied the passed in
+// number of bytes before stopping with spliceErr.
+// If nothing could be copied because the fds cannot be spliced, this is
+// reported as not handled so the caller falls back to a userspace copy.
+func spliceResult(copied int64, spliceErr error) (bool, int64, error) {
+	switch {
+	case spliceErr == nil, spliceErr == unix.EAGAIN:
+		return copied > 0, copied, nil
+	case copied == 0 && isSpliceUnsupported(spliceErr):
+		return false, 0, os.NewSyscallError("splice", spliceErr)
+	default:
+		return true, copied, os.NewSyscallError("splice", spliceErr)
+	}
+}
+
+// maxIovecs is the maximum number of iovecs passed in a single syscall.
+// This matches IOV_MAX on Linux.
+const maxIovecs = 1024
+
+// WriteBuffers writes the contents of bufs to the pipe using vmsplice(2).
+// Rather than copying the data into the pipe as write(2) does, the pages
+// backing bufs are mapped directly into the pipe.
+//
+// Because the pipe references the caller's memory, the buffers must not be
+// modified (or reused) until the data has been consumed from the other end of
+// the pipe. Modifying them before then changes the data the reader sees.
+//
+// For the same reason the caller must keep bufs referenced until then. The
+// pipe holds on to the pages, not to the Go objects, so buffers on the Go
+// heap which become unreachable may be freed by the garbage collector and
+// their memory handed out to new objects, whose contents the reader then
+// sees. Buffers from AllocPages are not managed by the garbage collector,
+// and GiftBuffers hands such buffers over to the kernel altogether.
+//
+// If these guarantees cannot be made, use Write instead.
+//
+// WriteBuffers blocks until all data has been written or an error occurs and
+// returns the number of bytes written.
+func (w *PipeWriter) WriteBuffers(bufs [][]byte) (int64, error) {
+	return w.vmsplice(bufs, unix.SPLICE_F_NONBLOCK)
+}
+
+func (w *PipeWriter) vmsplice(bufs [][]byte, flags int) (int64, error) {
+	wc, err := w.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	iovs := make([]unix.Iovec, 0, len(bufs))
+	for _, b := range bufs {
+		if len(b) == 0 {
+			continue
+		}
+		iov := unix.Iovec{Base: &b[0]}
+		iov.SetLen(len(b))
+		iovs = append(iovs, iov)
+	}
+
+	var (
+		written   int64
+		spliceErr error
+	)
+	defer func() { w.addWritten(written) }()
+
+	err = wc.Write(func(fd uintptr) bool {
+		for len(iovs) > 0 {
+			chunk := iovs
+			if len(chunk) > maxIovecs {
+				chunk = chunk[:maxIovecs]
+			}
+
+			var n int
+			n, spliceErr = unix.Vmsplice(int(fd), chunk, flags)
+			countSyscall(nil, syscallWrite, spliceErr)
+			if n > 0 {
+				written += int64(n)
+				iovs = consumeIovecs(iovs, n)
+			}
+			switch spliceErr {
+			case nil:
+			case unix.EINTR:
+				spliceErr = nil
+			case unix.EAGAIN:
+				return false
+			default:
+				return true
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return written, w.writeResult(err)
+	}
+	return written, w.writeResult(spliceErr)
+}
+
+// consumeIovecs advances iovs by n bytes.
+func consumeIovecs(iovs []unix.Iovec, n int) []unix.Iovec {
+	for n > 0 && len(iovs) > 0 {
+		l := int(iovs[0].Len)
+		if l > n {
+			iovs[0].Base = (*byte)(unsafe.Pointer(uintptr(unsafe.Pointer(iovs[0].Base)) + uintptr(n)))
+			iovs[0].SetLen(l - n)
+			return iovs
+		}
+		n -= l
+		iovs = iovs[1:]
+	}
+	return iovs
+}
+
+// GiftBuffers is like WriteBuffers but passes SPLICE_F_GIFT to vmsplice(2),
+// donating the pages backing bufs to the kernel so it can move them into the
+// reader without copying.
+//
+// Every buffer must be page aligned and a multiple of the page size,
+// otherwise ErrNotPageAligned is returned and nothing is written. Use
+// AllocPages to allocate suitable buffers.
+//
+// Once the buffers have been gifted the caller gives up ownership of them and
+// must never read or write them again. They may still be released with
+// FreePages.
+func (w *PipeWriter) GiftBuffers(bufs [][]byte) (int64, error) {
+	for _, b := range bufs {
+		if len(b) > 0 && !isPageAligned(b) {
+			return 0, ErrNotPageAligned
+		}
+	}
+	return w.vmsplice(bufs, unix.SPLICE_F_NONBLOCK|unix.SPLICE_F_GIFT)
 }
@@ -0,0 +1,25 @@
+//go:build !linux
+// +build !linux
+
+package pipes
+
+import "io"
+
+// ReadFrom implements io.ReaderFrom for the pipe writer.
+// splice(2) is not available on this platform so this copies through
+// pooled userspace buffers, see userCopy.
+func (w *PipeWriter) ReadFrom(r io.Reader) (int64, error) {
+	return w.ReadFromBuffer(r, nil)
+}
+
+// ReadFromBuffer is like ReadFrom, but copies through buf rather than a
+// buffer from the package's pool, like io.CopyBuffer. This lets callers
+// which manage their own memory avoid the internal buffers altogether.
+// If buf is empty, this is ReadFrom.
+//
+// As with io.CopyBuffer, buf is not used if r implements io.WriterTo.
+func (w *PipeWriter) ReadFromBuffer(r io.Reader, buf []byte) (int64, error) {
+	n, err := userCopyBuffer(w.fd, r, buf)
+	w.addWritten(n)
+	return n, w.writeResult(err)
+}
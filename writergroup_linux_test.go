@@ -0,0 +1,83 @@
+package pipes
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestWriterGroup(t *testing.T) {
+	const (
+		producers  = 4
+		records    = 10
+		recordSize = 100 << 10
+	)
+
+	r, w, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// Each producer gets its own group sharing the lock file, the same as
+	// producers in separate processes would.
+	lockPath := filepath.Join(t.TempDir(), "lock")
+	groups := make([]*WriterGroup, producers)
+	for i := range groups {
+		g, err := NewLockedWriterGroup(w, lockPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer g.Close()
+		groups[i] = g
+	}
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, producers)
+	for i, g := range groups {
+		wg.Add(1)
+		go func(b byte, g *WriterGroup) {
+			defer wg.Done()
+			rec := bytes.Repeat([]byte{b}, recordSize)
+			for j := 0; j < records; j++ {
+				if _, err := g.Write(rec); err != nil {
+					errCh <- err
+					return
+				}
+			}
+		}(byte('a'+i), g)
+	}
+	go func() {
+		wg.Wait()
+		w.Close()
+		close(errCh)
+	}()
+
+	fr := NewFramer(r, nil)
+	var n int
+	for {
+		rec, err := fr.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rec) != recordSize {
+			t.Fatalf("expected record of %d bytes, got %d", recordSize, len(rec))
+		}
+		if bytes.Count(rec, rec[:1]) != recordSize {
+			t.Fatal("record was interleaved with another record")
+		}
+		n++
+	}
+
+	for err := range errCh {
+		t.Fatal(err)
+	}
+	if n != producers*records {
+		t.Fatalf("expected %d records, got %d", producers*records, n)
+	}
+}
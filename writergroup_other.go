@@ -0,0 +1,23 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package pipes
+
+import (
+	"io"
+	"os"
+)
+
+// NewLockedWriterGroup is not supported on this platform and always returns
+// ErrNotSupported.
+func NewLockedWriterGroup(w io.Writer, lockPath string) (*WriterGroup, error) {
+	return nil, ErrNotSupported
+}
+
+func lockFile(f *os.File) error {
+	return ErrNotSupported
+}
+
+func unlockFile(f *os.File) error {
+	return ErrNotSupported
+}
@@ -0,0 +1,32 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package pipes
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// NewLockedWriterGroup is like NewWriterGroup, but also takes an advisory
+// lock on the file at lockPath around each record, so that producers in
+// different processes can share w. The lock file is created if needed.
+//
+// Call Close to release the lock file when done.
+func NewLockedWriterGroup(w io.Writer, lockPath string) (*WriterGroup, error) {
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterGroup{f: NewFramer(nil, w), lock: f}, nil
+}
+
+func lockFile(f *os.File) error {
+	return flock(f, unix.LOCK_EX)
+}
+
+func unlockFile(f *os.File) error {
+	return flock(f, unix.LOCK_UN)
+}